@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/bhop_dynasty/0x40_cloud/internal/config"
 	"github.com/bhop_dynasty/0x40_cloud/internal/handlers"
@@ -32,6 +34,11 @@ func main() {
 	}
 
 	r := gin.Default()
+	// По умолчанию gin верит X-Forwarded-For от любого клиента, и лимиты по IP
+	// обходились бы подделанным заголовком
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowOrigins = cfg.CORS.AllowedOrigins
@@ -46,20 +53,96 @@ func main() {
 	starredRepo := repositories.NewStarredFileRepository(db)
 	starredFolderRepo := repositories.NewStarredFolderRepository(db)
 	sharedFileRepo := repositories.NewSharedFileRepository(db)
+	fileGrantRepo := repositories.NewFileGrantRepository(db)
+	teamRepo := repositories.NewTeamRepository(db)
+	vaultRepo := repositories.NewVaultRepository(db)
+	storageUsageRepo := repositories.NewStorageUsageRepository(db)
+	settingRepo := repositories.NewSettingRepository(db)
+	jobRepo := repositories.NewJobRepository(db)
+	fileChangeRepo := repositories.NewFileChangeRepository(db)
+	accessKeyRepo := repositories.NewAccessKeyRepository(db)
+	s3UploadRepo := repositories.NewS3UploadRepository(db)
+	sshKeyRepo := repositories.NewSSHKeyRepository(db)
+	twoFactorRepo := repositories.NewTwoFactorRepository(db)
+	auditRepo := repositories.NewAuditRepository(db)
+	personalTokenRepo := repositories.NewPersonalTokenRepository(db)
+	inviteRepo := repositories.NewInviteRepository(db)
 
 	// Services
-	authService := services.NewAuthService(userRepo, cfg)
+	settingsService := services.NewSettingsService(settingRepo, cfg)
+	sessionService := services.NewSessionService(redisClient, cfg.JWT.RefreshExpiration)
+	authService := services.NewAuthService(userRepo, sessionService, cfg)
+	authService.SetSettingsService(settingsService)
+	twoFactorService := services.NewTwoFactorService(twoFactorRepo, userRepo, redisClient, cfg.Storage.EncryptionKey, cfg.Auth.TOTPIssuer)
+	authService.SetTwoFactorService(twoFactorService)
+	personalTokenService := services.NewPersonalTokenService(personalTokenRepo, userRepo)
+	authService.SetPersonalTokenService(personalTokenService)
+	inviteService := services.NewInviteService(inviteRepo, userRepo, cfg)
+	authService.SetInviteService(inviteService)
+	rateLimiter := services.NewRateLimiter(redisClient, cfg.Security.RateLimitEnabled)
+	auditService := services.NewAuditService(auditRepo)
+	loginGuard := services.NewLoginGuard(redisClient, rateLimiter, auditService, cfg.Security)
+	authService.SetLoginGuard(loginGuard)
+	mailer, err := services.NewMailer(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+	accountService := services.NewAccountService(userRepo, sessionService, redisClient, mailer, rateLimiter, loginGuard, cfg)
+	authService.SetAccountService(accountService)
+	authService.SetOIDCService(services.NewOIDCService(cfg.OIDC, redisClient))
 	fileService, err := services.NewFileService(fileRepo, starredRepo, starredFolderRepo, cfg.Storage.Path, cfg.Storage.EncryptionKey, cfg.Storage.Limit, cfg.Storage.MaxUploadSize)
 	if err != nil {
 		log.Fatalf("Failed to initialize file service: %v", err)
 	}
 	activityService := services.NewActivityService(redisClient, fileRepo)
-	shareService := services.NewShareService(sharedFileRepo, fileRepo, fileService)
+	eventService := services.NewEventService(redisClient)
+	fileService.SetEventService(eventService)
+	fileService.SetGrantRepository(fileGrantRepo)
+	fileService.SetTeamRepository(teamRepo, cfg.Storage.TeamLimit)
+	fileService.SetUserRepository(userRepo)
+	fileService.SetStorageUsageRepository(storageUsageRepo)
+	fileService.SetShareRepository(sharedFileRepo)
+	fileService.SetVaultRepository(vaultRepo)
+	fileService.SetQuotaPolicy(cfg.Storage.QuotaIncludesTrash, cfg.Storage.QuotaWarnings)
+	teamService := services.NewTeamService(teamRepo, userRepo, fileService)
+	grantService := services.NewGrantService(fileGrantRepo, userRepo, fileRepo, fileService)
+	grantService.SetEventService(eventService)
+	shareService := services.NewShareService(sharedFileRepo, fileRepo, fileService, cfg.JWT.Secret)
+	shareService.SetEventService(eventService)
+	jobService := services.NewJobService(jobRepo, cfg.Jobs.Workers, cfg.Jobs.MaxAttempts, cfg.Jobs.ResultTTL)
+	fileService.RegisterJobs(jobService)
+	adminService := services.NewAdminService(userRepo, fileService, teamService, settingsService, sessionService, jobService)
+	adminService.SetTwoFactorService(twoFactorService)
+	adminService.SetAuditService(auditService)
+	adminService.SetActivityService(activityService)
+	adminService.RegisterJobs(jobService)
+	syncService := services.NewSyncService(fileChangeRepo, fileRepo, cfg.Sync.JournalRetention)
+	syncService.RegisterJobs(jobService)
+	accessKeyService := services.NewAccessKeyService(accessKeyRepo, cfg.Storage.EncryptionKey)
+	s3Service := services.NewS3Service(fileService, s3UploadRepo)
+	s3Service.RegisterJobs(jobService)
+	sshKeyService := services.NewSSHKeyService(sshKeyRepo, userRepo)
 
 	// Handlers
 	authHandler := handlers.NewAuthHandler(authService)
-	fileHandler := handlers.NewFileHandler(fileService, activityService)
+	fileHandler := handlers.NewFileHandler(fileService, activityService, jobService)
 	shareHandler := handlers.NewShareHandler(shareService)
+	grantHandler := handlers.NewGrantHandler(grantService)
+	teamHandler := handlers.NewTeamHandler(teamService, fileService)
+	vaultHandler := handlers.NewVaultHandler(fileService)
+	jobHandler := handlers.NewJobHandler(jobService, fileService)
+	eventHandler := handlers.NewEventHandler(eventService)
+	syncHandler := handlers.NewSyncHandler(syncService)
+	webdavHandler := handlers.NewWebDAVHandler(authService, fileService)
+	authService.OnSessionsRevoked(webdavHandler.ForgetUser)
+	accessKeyHandler := handlers.NewAccessKeyHandler(accessKeyService)
+	s3Handler := handlers.NewS3Handler(s3Service, accessKeyService, cfg.S3.Region)
+	sshKeyHandler := handlers.NewSSHKeyHandler(sshKeyService)
+	adminHandler := handlers.NewAdminHandler(adminService)
+	twoFactorHandler := handlers.NewTwoFactorHandler(twoFactorService)
+	personalTokenHandler := handlers.NewPersonalTokenHandler(personalTokenService)
+	inviteHandler := handlers.NewInviteHandler(inviteService)
+	accountHandler := handlers.NewAccountHandler(accountService, jobService)
 
 	healthHandler := func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -70,32 +153,132 @@ func main() {
 	r.GET("/health", healthHandler)
 	r.HEAD("/health", healthHandler)
 
+	// WebDAV (авторизация HTTP Basic внутри обработчика)
+	if cfg.WebDAV.Enabled {
+		for _, method := range handlers.WebDAVMethods {
+			r.Handle(method, handlers.WebDAVPrefix, webdavHandler.ServeHTTP)
+			r.Handle(method, handlers.WebDAVPrefix+"/*path", webdavHandler.ServeHTTP)
+		}
+	}
+
 	api := r.Group("/api")
 	{
+		// Лимиты по IP: bcrypt и проверка паролей ссылок дорогие, а перебор дешевый
+		authLimit := middleware.RateLimit(rateLimiter, "auth", cfg.Security.AuthPerMinute, time.Minute)
+		registerLimit := middleware.RateLimit(rateLimiter, "register", cfg.Security.RegisterPerHour, time.Hour)
+		shareLimit := middleware.RateLimit(rateLimiter, "share", cfg.Security.SharePerMinute, time.Minute)
+		shareUnlockLimit := middleware.RateLimit(rateLimiter, "share_unlock", cfg.Security.AuthPerMinute, time.Minute)
+
 		auth := api.Group("/auth")
 		{
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
+			auth.POST("/register", registerLimit, authHandler.Register)
+			auth.POST("/login", authLimit, authHandler.Login)
+			auth.POST("/login/2fa", authLimit, authHandler.LoginTwoFactor)
 			auth.POST("/logout", authHandler.Logout)
+			auth.POST("/refresh", authLimit, authHandler.Refresh)
+			auth.GET("/methods", authHandler.Methods)
+			auth.GET("/oidc/login", authLimit, authHandler.OIDCLogin)
+			auth.GET("/oidc/callback", authLimit, authHandler.OIDCCallback)
+			auth.POST("/email/verify", authLimit, accountHandler.VerifyEmail)
+			auth.POST("/email/resend", authLimit, accountHandler.ResendVerification)
+			auth.POST("/password/forgot", authLimit, accountHandler.ForgotPassword)
+			auth.POST("/password/reset", authLimit, accountHandler.ResetPassword)
+			auth.POST("/account/restore", authLimit, accountHandler.RestoreAccount)
+			auth.GET("/invites/:code", authLimit, inviteHandler.CheckInvite)
 		}
 
 		// Public share routes
 		public := api.Group("/public")
+		public.Use(shareLimit)
 		{
 			public.GET("/share/:token", shareHandler.GetSharedFile)
 			public.GET("/share/:token/download", shareHandler.DownloadSharedFile)
+			public.POST("/share/:token/unlock", shareUnlockLimit, shareHandler.UnlockShare)
+			public.GET("/share/:token/files", shareHandler.ListSharedFolder)
+			public.GET("/share/:token/files/:fileId/download", shareHandler.DownloadSharedFolderFile)
+			public.POST("/share/:token/upload", shareHandler.UploadToFileRequest)
 		}
 
 		protected := api.Group("")
-		protected.Use(middleware.AuthMiddleware(authService))
+		protected.Use(middleware.AuthMiddleware(authService), middleware.TokenScopeMiddleware(middleware.TokenScopeRules{
+			Share: []string{
+				"/api/files/:id/share",
+				"/api/files/folder/share",
+				"/api/files/folder/request",
+				"/api/shares",
+				"/api/shares/:token",
+				"/api/grants",
+				"/api/grants/:id",
+				"/api/teams/:id/members",
+				"/api/teams/:id/members/:userId",
+			},
+			SessionOnly: []string{
+				"/api/auth/sessions",
+				"/api/auth/logout-all",
+				"/api/auth/2fa",
+				"/api/auth/password",
+				"/api/auth/email",
+				"/api/account/delete",
+				"/api/tokens",
+				"/api/s3/keys",
+				"/api/ssh-keys",
+				"/api/invites",
+			},
+		}))
 		{
 			protected.GET("/auth/me", authHandler.GetMe)
+			protected.GET("/auth/sessions", authHandler.ListSessions)
+			protected.DELETE("/auth/sessions/:id", authHandler.RevokeSession)
+			protected.POST("/auth/logout-all", authHandler.LogoutAll)
+			protected.GET("/auth/2fa", twoFactorHandler.GetStatus)
+			protected.POST("/auth/2fa/setup", twoFactorHandler.Setup)
+			protected.POST("/auth/2fa/enable", twoFactorHandler.Enable)
+			protected.POST("/auth/2fa/disable", twoFactorHandler.Disable)
+			protected.POST("/auth/2fa/recovery-codes", twoFactorHandler.RegenerateRecoveryCodes)
+			protected.POST("/auth/password", accountHandler.ChangePassword)
+			protected.POST("/auth/email", accountHandler.ChangeEmail)
+			protected.POST("/account/export", accountHandler.ExportData)
+			protected.POST("/account/delete", accountHandler.DeleteAccount)
+			protected.GET("/events", eventHandler.Stream)
 
 			// Share management routes
 			protected.POST("/files/:id/share", shareHandler.CreateShare)
+			protected.POST("/files/folder/share", shareHandler.CreateFolderShare)
+			protected.POST("/files/folder/request", shareHandler.CreateFileRequest)
 			protected.GET("/shares", shareHandler.ListShares)
 			protected.DELETE("/shares/:token", shareHandler.RevokeShare)
 
+			// Доступ к файлам для других пользователей
+			protected.GET("/grants", grantHandler.ListGrants)
+			protected.POST("/grants", grantHandler.CreateGrant)
+			protected.DELETE("/grants/:id", grantHandler.RevokeGrant)
+			protected.GET("/shared-with-me", grantHandler.ListSharedWithMe)
+
+			// Команды и их пространства
+			protected.GET("/teams", teamHandler.ListTeams)
+			protected.POST("/teams", teamHandler.CreateTeam)
+			protected.GET("/teams/:id", teamHandler.GetTeam)
+			protected.POST("/teams/:id/members", teamHandler.AddMember)
+			protected.PATCH("/teams/:id/members/:userId", teamHandler.UpdateMember)
+			protected.DELETE("/teams/:id/members/:userId", teamHandler.RemoveMember)
+			protected.GET("/teams/:id/files", teamHandler.GetFiles)
+			protected.GET("/teams/:id/files/search", teamHandler.SearchFiles)
+			protected.POST("/teams/:id/files/upload", teamHandler.Upload)
+			protected.POST("/teams/:id/folder", teamHandler.CreateFolder)
+			protected.GET("/teams/:id/trash", teamHandler.GetTrash)
+
+			// E2E-хранилища: сервер хранит только шифротекст и обернутые ключи
+			protected.GET("/vaults", vaultHandler.ListVaults)
+			protected.POST("/vaults", vaultHandler.CreateVault)
+			protected.GET("/vaults/:id", vaultHandler.GetVault)
+			protected.DELETE("/vaults/:id", vaultHandler.DeleteVault)
+			protected.PUT("/vaults/:id/key", vaultHandler.UpdateVaultKey)
+			protected.GET("/vaults/:id/files", vaultHandler.ListFiles)
+			protected.POST("/vaults/:id/files", vaultHandler.Upload)
+			protected.GET("/vaults/:id/files/:fileId", vaultHandler.DownloadFile)
+			protected.PATCH("/vaults/:id/files/:fileId", vaultHandler.UpdateFile)
+			protected.DELETE("/vaults/:id/files/:fileId", vaultHandler.DeleteFile)
+
 			// File routes - специфичные роуты должны идти ПЕРЕД :id параметрами
 			protected.POST("/files/upload", fileHandler.Upload)
 			protected.GET("/files/storage", fileHandler.GetStorageStats)
@@ -108,9 +291,11 @@ func main() {
 			protected.GET("/files/search", fileHandler.SearchFiles)
 			protected.GET("/files/trash", fileHandler.GetDeletedFiles)
 			protected.GET("/files/download-folder", fileHandler.DownloadFolder)
+			protected.POST("/files/download-folder/async", fileHandler.DownloadFolderAsync)
 			protected.POST("/files/folder", fileHandler.CreateFolder)
 			protected.DELETE("/files/folder", fileHandler.DeleteFolder)
 			protected.POST("/files/folder/star", fileHandler.ToggleStarredFolder)
+			protected.POST("/files/batch", fileHandler.BatchOperations)
 
 			protected.POST("/files/:id/star", fileHandler.ToggleStarred)
 			protected.GET("/files/:id/download", fileHandler.DownloadFile)
@@ -119,6 +304,58 @@ func main() {
 			protected.DELETE("/files/:id", fileHandler.DeleteFile)
 			protected.POST("/files/:id/restore", fileHandler.RestoreFile)
 			protected.DELETE("/files/:id/permanent", fileHandler.DeleteFilePermanently)
+
+			// Background jobs
+			protected.GET("/jobs", jobHandler.ListJobs)
+			protected.GET("/jobs/:id", jobHandler.GetJob)
+			protected.GET("/jobs/:id/events", jobHandler.StreamJob)
+			protected.GET("/jobs/:id/download", jobHandler.DownloadJobResult)
+			protected.POST("/jobs/:id/cancel", jobHandler.CancelJob)
+
+			// Delta sync for desktop clients
+			protected.GET("/sync/changes", syncHandler.GetChanges)
+			protected.GET("/sync/snapshot", syncHandler.GetSnapshot)
+
+			// Ключи доступа к S3-совместимому API
+			protected.GET("/s3/keys", accessKeyHandler.ListKeys)
+			protected.POST("/s3/keys", accessKeyHandler.CreateKey)
+			protected.DELETE("/s3/keys/:id", accessKeyHandler.DeleteKey)
+
+			// SSH-ключи для входа по SFTP
+			protected.GET("/ssh-keys", sshKeyHandler.ListKeys)
+			protected.POST("/ssh-keys", sshKeyHandler.AddKey)
+			protected.DELETE("/ssh-keys/:id", sshKeyHandler.DeleteKey)
+
+			// Личные токены доступа для скриптов и CLI
+			protected.GET("/tokens", personalTokenHandler.ListTokens)
+			protected.POST("/tokens", personalTokenHandler.CreateToken)
+			protected.DELETE("/tokens/:id", personalTokenHandler.RevokeToken)
+
+			// Приглашения на регистрацию
+			protected.GET("/invites", inviteHandler.ListInvites)
+			protected.POST("/invites", inviteHandler.CreateInvite)
+			protected.DELETE("/invites/:id", inviteHandler.RevokeInvite)
+		}
+
+		// Администрирование
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthMiddleware(authService), middleware.AdminMiddleware(authService))
+		{
+			admin.GET("/users", adminHandler.ListUsers)
+			admin.DELETE("/users/:id", adminHandler.DeleteUser)
+			admin.PATCH("/users/:id/role", adminHandler.SetRole)
+			admin.POST("/users/:id/disable", adminHandler.DisableUser)
+			admin.POST("/users/:id/enable", adminHandler.EnableUser)
+			admin.POST("/users/:id/password", adminHandler.ResetPassword)
+			admin.DELETE("/users/:id/2fa", adminHandler.ResetTwoFactor)
+			admin.GET("/users/:id/quota", adminHandler.GetUserQuota)
+			admin.PUT("/users/:id/quota", adminHandler.SetUserQuota)
+			admin.GET("/storage", adminHandler.GetStorageStats)
+			admin.GET("/audit", adminHandler.ListAuditEvents)
+			admin.GET("/settings/registration", adminHandler.GetRegistration)
+			admin.PUT("/settings/registration", adminHandler.SetRegistration)
+			admin.GET("/invites", inviteHandler.ListAllInvites)
+			admin.DELETE("/invites/:id", inviteHandler.AdminRevokeInvite)
 		}
 	}
 
@@ -133,9 +370,42 @@ func main() {
 	log.Printf("🌐 CORS allowed origins: %v", cfg.CORS.AllowedOrigins)
 	log.Printf("💾 Storage path: %s", cfg.Storage.Path)
 	// Инициализация базы данных
-	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.StarredFile{}, &models.StarredFolder{}, &models.SharedFile{}); err != nil {
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.StarredFile{}, &models.StarredFolder{}, &models.SharedFile{}, &models.ShareDownloadEvent{}, &models.FileGrant{}, &models.Team{}, &models.TeamMember{}, &models.StorageUsage{}, &models.QuotaReservation{}, &models.Setting{}, &models.Job{}, &models.FileChange{}, &models.FileChangeWatermark{}, &models.AccessKey{}, &models.S3MultipartUpload{}, &models.S3MultipartPart{}, &models.SSHKey{}, &models.RecoveryCode{}, &models.AuditEvent{}, &models.PersonalToken{}, &models.Invite{}, &models.Vault{}); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
+	if err := authService.BootstrapAdmins(); err != nil {
+		log.Fatalf("Failed to assign admin roles: %v", err)
+	}
+
+	jobService.Start(context.Background())
+
+	// S3-шлюз слушает отдельный порт: S3-клиенты адресуют бакеты от корня пути
+	if cfg.S3.Enabled {
+		s3Router := gin.New()
+		s3Router.Use(gin.Logger(), gin.Recovery())
+		s3Handler.Register(s3Router)
+
+		go func() {
+			log.Printf("🪣 S3 gateway listening on %s", cfg.S3.Addr)
+			if err := s3Router.Run(cfg.S3.Addr); err != nil {
+				log.Fatalf("Failed to start S3 gateway: %v", err)
+			}
+		}()
+	}
+
+	if cfg.SFTP.Enabled {
+		sftpServer, err := handlers.NewSFTPServer(authService, sshKeyService, fileService, cfg.SFTP.HostKeyPath)
+		if err != nil {
+			log.Fatalf("Failed to initialize SFTP server: %v", err)
+		}
+
+		go func() {
+			log.Printf("🔑 SFTP server listening on %s", cfg.SFTP.Addr)
+			if err := sftpServer.ListenAndServe(cfg.SFTP.Addr); err != nil {
+				log.Fatalf("Failed to start SFTP server: %v", err)
+			}
+		}()
+	}
 
 	if err := r.Run(":" + cfg.Server.Port); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
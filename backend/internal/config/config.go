@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -17,11 +18,20 @@ type Config struct {
 	CORS     CORSConfig
 	Storage  StorageConfig
 	Auth     AuthConfig
+	Jobs     JobsConfig
+	Sync     SyncConfig
+	WebDAV   WebDAVConfig
+	S3       S3Config
+	SFTP     SFTPConfig
+	Security SecurityConfig
+	OIDC     OIDCConfig
+	Mail     MailConfig
 }
 
 type ServerConfig struct {
-	Port string
-	Env  string
+	Port           string
+	Env            string
+	TrustedProxies []string // Прокси, которым доверяем X-Forwarded-For: от него зависит IP в лимитах
 }
 
 type DatabaseConfig struct {
@@ -41,8 +51,9 @@ type RedisConfig struct {
 }
 
 type JWTConfig struct {
-	Secret     string
-	Expiration string
+	Secret            string
+	Expiration        string        // Время жизни access-токена
+	RefreshExpiration time.Duration // Время жизни сессии без активности (refresh-токена)
 }
 
 type CORSConfig struct {
@@ -53,11 +64,97 @@ type StorageConfig struct {
 	Path          string
 	EncryptionKey string
 	Limit         int64
+	TeamLimit     int64 // Квота пространства команды по умолчанию
 	MaxUploadSize int64
+
+	QuotaIncludesTrash bool  // Учитывать ли корзину в квоте
+	QuotaWarnings      []int // Пороги мягких предупреждений, % от квоты
 }
 
 type AuthConfig struct {
 	DisableRegistration bool
+	RegistrationMode    string   // open, invite (только по приглашениям) или closed; администратор меняет его без перезапуска
+	InvitesPerUser      int      // Сколько приглашений может создать обычный пользователь, 0 - только администраторы
+	AdminEmails         []string // Эти пользователи получают роль администратора при запуске и регистрации
+	TOTPIssuer          string   // Название сервера в приложении-аутентификаторе
+
+	DisablePasswordLogin bool // Вход только через OIDC: пароли не принимаются ни в API, ни в WebDAV/SFTP
+
+	AppURL                   string // Адрес веб-интерфейса для ссылок в письмах
+	RequireEmailVerification bool   // Не пускать по паролю, пока email не подтвержден
+
+	DeletionGracePeriod time.Duration // Сколько удаленный пользователем аккаунт можно восстановить
+}
+
+// MailConfig - отправка писем (подтверждение email, сброс пароля).
+// Driver: smtp, file (письма .eml в Dir) или log (текст письма в лог).
+type MailConfig struct {
+	Driver string
+	From   string
+	Dir    string
+
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPTLS      string // starttls, tls (сразу TLS, обычно порт 465) или none
+}
+
+// OIDCConfig - вход через внешний OpenID Connect провайдер (authorization code + PKCE)
+type OIDCConfig struct {
+	Enabled      bool
+	ProviderName string // Подпись кнопки входа
+	IssuerURL    string // Из него берется /.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string // Пусто - публичный клиент, защищенный только PKCE
+	RedirectURL  string // https://<host>/api/auth/oidc/callback, как зарегистрирован у провайдера
+	Scopes       []string
+
+	UsernameClaim string   // Откуда брать имя нового пользователя
+	GroupsClaim   string   // Claim со списком групп
+	AdminGroups   []string // Участники этих групп получают роль администратора при каждом входе
+	AllowSignup   bool     // Создавать пользователя при первом входе (только в режиме регистрации open)
+	PostLoginURL  string   // Куда вернуть браузер после входа
+}
+
+// S3Config - S3-совместимый шлюз на отдельном порту (aws --endpoint-url http://host:9000)
+type S3Config struct {
+	Enabled bool
+	Addr    string
+	Region  string
+}
+
+// SFTPConfig - встроенный SFTP-сервер. Ключ хоста создается при первом запуске.
+type SFTPConfig struct {
+	Enabled     bool
+	Addr        string
+	HostKeyPath string
+}
+
+type WebDAVConfig struct {
+	Enabled bool
+}
+
+// SecurityConfig - ограничение частоты запросов и блокировка подбора паролей
+type SecurityConfig struct {
+	RateLimitEnabled bool
+	AuthPerMinute    int // Запросов входа/обновления токена с одного IP и на один аккаунт в минуту
+	RegisterPerHour  int // Регистраций с одного IP в час
+	SharePerMinute   int // Запросов к публичным ссылкам с одного IP в минуту
+
+	LockoutThreshold int           // Неудачных входов подряд до блокировки аккаунта
+	LockoutBase      time.Duration // Первая блокировка, дальше время удваивается
+	LockoutMax       time.Duration
+}
+
+type SyncConfig struct {
+	JournalRetention time.Duration
+}
+
+type JobsConfig struct {
+	Workers     int
+	MaxAttempts int
+	ResultTTL   time.Duration
 }
 
 func Load() *Config {
@@ -80,10 +177,23 @@ func Load() *Config {
 		log.Fatalf("CRITICAL: ENCRYPTION_KEY must be exactly 32 bytes, got %d bytes", len(encryptionKey))
 	}
 
+	// REGISTRATION_MODE заменяет DISABLE_REGISTRATION, старая переменная задает значение по умолчанию
+	registrationMode := "open"
+	if getEnvAsBool("DISABLE_REGISTRATION", false) {
+		registrationMode = "closed"
+	}
+	registrationMode = getEnv("REGISTRATION_MODE", registrationMode)
+	switch registrationMode {
+	case "open", "invite", "closed":
+	default:
+		log.Fatalf("REGISTRATION_MODE must be open, invite or closed, got %q", registrationMode)
+	}
+
 	return &Config{
 		Server: ServerConfig{
-			Port: getEnv("PORT", "8080"),
-			Env:  getEnv("ENV", "development"),
+			Port:           getEnv("PORT", "8080"),
+			Env:            getEnv("ENV", "development"),
+			TrustedProxies: strings.Split(getEnv("TRUSTED_PROXIES", "127.0.0.1,::1,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16"), ","),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -94,8 +204,9 @@ func Load() *Config {
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		JWT: JWTConfig{
-			Secret:     jwtSecret,
-			Expiration: getEnv("JWT_EXPIRATION", "24h"),
+			Secret:            jwtSecret,
+			Expiration:        getEnv("JWT_EXPIRATION", "15m"),
+			RefreshExpiration: getEnvAsDuration("REFRESH_TOKEN_EXPIRATION", 30*24*time.Hour),
 		},
 		CORS: CORSConfig{
 			AllowedOrigins: strings.Split(getEnv("ALLOWED_ORIGINS", "http://localhost:5173,http://localhost:5174,http://localhost:3000"), ","),
@@ -104,7 +215,10 @@ func Load() *Config {
 			Path:          getEnv("STORAGE_PATH", "./storage"),
 			EncryptionKey: encryptionKey,
 			Limit:         int64(getEnvAsInt("STORAGE_LIMIT_BYTES", 10*1024*1024*1024)),        // 10 GB default
+			TeamLimit:     int64(getEnvAsInt("TEAM_STORAGE_LIMIT_BYTES", 10*1024*1024*1024)),   // 10 GB default
 			MaxUploadSize: int64(getEnvAsInt("MAX_UPLOAD_SIZE", 1*1024*1024*1024)),          // 1 GB default
+			QuotaIncludesTrash: getEnvAsBool("STORAGE_QUOTA_INCLUDE_TRASH", false),
+			QuotaWarnings:      getEnvAsIntList("STORAGE_QUOTA_WARNINGS", []int{80, 95}),
 		},
 		Redis: RedisConfig{
 			Host:     getEnv("REDIS_HOST", "localhost"),
@@ -114,6 +228,71 @@ func Load() *Config {
 		},
 		Auth: AuthConfig{
 			DisableRegistration: getEnvAsBool("DISABLE_REGISTRATION", false),
+			RegistrationMode:    registrationMode,
+			InvitesPerUser:      getEnvAsInt("INVITES_PER_USER", 0),
+			AdminEmails:         getEnvAsList("ADMIN_EMAILS"),
+			TOTPIssuer:          getEnv("TOTP_ISSUER", "0x40 Cloud"),
+
+			DisablePasswordLogin: getEnvAsBool("DISABLE_PASSWORD_LOGIN", false),
+
+			AppURL:                   strings.TrimRight(getEnv("APP_URL", "http://localhost:5173"), "/"),
+			RequireEmailVerification: getEnvAsBool("REQUIRE_EMAIL_VERIFICATION", false),
+
+			DeletionGracePeriod: getEnvAsDuration("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour),
+		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "log"),
+			From:         getEnv("MAIL_FROM", "0x40 Cloud <noreply@localhost>"),
+			Dir:          getEnv("MAIL_DIR", "./storage/mail"),
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     getEnv("SMTP_PORT", "587"),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			SMTPTLS:      getEnv("SMTP_TLS", "starttls"),
+		},
+		OIDC: OIDCConfig{
+			Enabled:       getEnvAsBool("OIDC_ENABLED", false),
+			ProviderName:  getEnv("OIDC_PROVIDER_NAME", "SSO"),
+			IssuerURL:     getEnv("OIDC_ISSUER_URL", ""),
+			ClientID:      getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret:  getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:   getEnv("OIDC_REDIRECT_URL", ""),
+			Scopes:        strings.Fields(getEnv("OIDC_SCOPES", "openid email profile")),
+			UsernameClaim: getEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+			GroupsClaim:   getEnv("OIDC_GROUPS_CLAIM", "groups"),
+			AdminGroups:   getEnvAsList("OIDC_ADMIN_GROUPS"),
+			AllowSignup:   getEnvAsBool("OIDC_ALLOW_SIGNUP", true),
+			PostLoginURL:  getEnv("OIDC_POST_LOGIN_URL", "/dashboard"),
+		},
+		Jobs: JobsConfig{
+			Workers:     getEnvAsInt("JOB_WORKERS", 2),
+			MaxAttempts: getEnvAsInt("JOB_MAX_ATTEMPTS", 3),
+			ResultTTL:   getEnvAsDuration("JOB_RESULT_TTL", 24*time.Hour),
+		},
+		Sync: SyncConfig{
+			JournalRetention: getEnvAsDuration("SYNC_JOURNAL_RETENTION", 30*24*time.Hour),
+		},
+		WebDAV: WebDAVConfig{
+			Enabled: getEnvAsBool("WEBDAV_ENABLED", true),
+		},
+		S3: S3Config{
+			Enabled: getEnvAsBool("S3_ENABLED", false),
+			Addr:    getEnv("S3_ADDR", ":9000"),
+			Region:  getEnv("S3_REGION", "us-east-1"),
+		},
+		SFTP: SFTPConfig{
+			Enabled:     getEnvAsBool("SFTP_ENABLED", false),
+			Addr:        getEnv("SFTP_ADDR", ":2022"),
+			HostKeyPath: getEnv("SFTP_HOST_KEY_PATH", "./storage/ssh_host_ed25519_key"),
+		},
+		Security: SecurityConfig{
+			RateLimitEnabled: getEnvAsBool("RATE_LIMIT_ENABLED", true),
+			AuthPerMinute:    getEnvAsInt("RATE_LIMIT_AUTH_PER_MINUTE", 10),
+			RegisterPerHour:  getEnvAsInt("RATE_LIMIT_REGISTER_PER_HOUR", 5),
+			SharePerMinute:   getEnvAsInt("RATE_LIMIT_SHARE_PER_MINUTE", 60),
+			LockoutThreshold: getEnvAsInt("LOGIN_LOCKOUT_THRESHOLD", 5),
+			LockoutBase:      getEnvAsDuration("LOGIN_LOCKOUT_BASE", time.Minute),
+			LockoutMax:       getEnvAsDuration("LOGIN_LOCKOUT_MAX", time.Hour),
 		},
 	}
 }
@@ -144,3 +323,41 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	valueStr := os.Getenv(key)
+	if valueStr != "" {
+		if value, err := time.ParseDuration(valueStr); err == nil {
+			return value
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsList читает список через запятую, пустые элементы отбрасываются
+func getEnvAsList(key string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func getEnvAsIntList(key string, defaultValue []int) []int {
+	items := getEnvAsList(key)
+	if len(items) == 0 {
+		return defaultValue
+	}
+	result := make([]int, 0, len(items))
+	for _, item := range items {
+		value, err := strconv.Atoi(item)
+		if err != nil {
+			log.Printf("Warning: invalid value %q in %s, using default", item, key)
+			return defaultValue
+		}
+		result = append(result, value)
+	}
+	return result
+}
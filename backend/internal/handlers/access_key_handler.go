@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type AccessKeyHandler struct {
+	accessKeyService *services.AccessKeyService
+}
+
+func NewAccessKeyHandler(accessKeyService *services.AccessKeyService) *AccessKeyHandler {
+	return &AccessKeyHandler{accessKeyService: accessKeyService}
+}
+
+func (h *AccessKeyHandler) ListKeys(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	keys, err := h.accessKeyService.ListKeys(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateKey выдает новую пару ключей для S3. Секрет показывается только в этом ответе.
+func (h *AccessKeyHandler) CreateKey(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req models.CreateAccessKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, err := h.accessKeyService.CreateKey(userID.(uint), req.Name)
+	if err != nil {
+		if errors.Is(err, services.ErrTooManyAccessKeys) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+func (h *AccessKeyHandler) DeleteKey(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key ID"})
+		return
+	}
+
+	if err := h.accessKeyService.DeleteKey(uint(id), userID.(uint)); err != nil {
+		if errors.Is(err, services.ErrAccessKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Access key deleted"})
+}
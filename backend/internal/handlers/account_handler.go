@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// mailSentMessage - одинаковый ответ для известных и неизвестных адресов
+const mailSentMessage = "If the address belongs to an account, an email has been sent"
+
+type AccountHandler struct {
+	accountService *services.AccountService
+	jobService     *services.JobService
+}
+
+func NewAccountHandler(accountService *services.AccountService, jobService *services.JobService) *AccountHandler {
+	return &AccountHandler{
+		accountService: accountService,
+		jobService:     jobService,
+	}
+}
+
+// ChangePassword меняет пароль; остальные сессии пользователя закрываются
+func (h *AccountHandler) ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": getValidationError(err)})
+		return
+	}
+
+	err := h.accountService.ChangePassword(c.Request.Context(), userID.(uint), c.GetString("session_id"), &req, c.ClientIP())
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
+
+// ChangeEmail отправляет ссылку подтверждения на новый адрес
+func (h *AccountHandler) ChangeEmail(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req models.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": getValidationError(err)})
+		return
+	}
+
+	if err := h.accountService.RequestEmailChange(c.Request.Context(), userID.(uint), &req, c.ClientIP()); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Confirmation email sent to the new address"})
+}
+
+func (h *AccountHandler) VerifyEmail(c *gin.Context) {
+	var req models.AccountTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": getValidationError(err)})
+		return
+	}
+
+	user, err := h.accountService.VerifyEmail(c.Request.Context(), req.Token)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user.ToResponse()})
+}
+
+func (h *AccountHandler) ResendVerification(c *gin.Context) {
+	var req models.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": getValidationError(err)})
+		return
+	}
+
+	if err := h.accountService.ResendVerification(c.Request.Context(), req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": mailSentMessage})
+}
+
+func (h *AccountHandler) ForgotPassword(c *gin.Context) {
+	var req models.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": getValidationError(err)})
+		return
+	}
+
+	if err := h.accountService.ForgotPassword(c.Request.Context(), req.Email); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": mailSentMessage})
+}
+
+// ResetPassword задает новый пароль по ссылке из письма и закрывает все сессии
+func (h *AccountHandler) ResetPassword(c *gin.Context) {
+	var req models.PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": getValidationError(err)})
+		return
+	}
+
+	if err := h.accountService.ResetPassword(c.Request.Context(), &req); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, sign in with the new password"})
+}
+
+// ExportData ставит в очередь архив со всеми данными пользователя.
+// Если выгрузка уже идет, возвращает ее задачу. Готовый архив - GET /jobs/:id/download.
+func (h *AccountHandler) ExportData(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	jobs, err := h.jobService.ListJobs(userID.(uint), 20)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, job := range jobs {
+		if job.Type == services.JobTypeAccountExport && (job.Status == models.JobPending || job.Status == models.JobRunning) {
+			c.JSON(http.StatusAccepted, gin.H{"job": job})
+			return
+		}
+	}
+
+	job, err := h.jobService.Enqueue(userID.(uint), services.JobTypeAccountExport, struct{}{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job": job})
+}
+
+// DeleteAccount отключает аккаунт и назначает удаление данных после отсрочки
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": getValidationError(err)})
+		return
+	}
+
+	response, err := h.accountService.RequestDeletion(c.Request.Context(), userID.(uint), &req, c.ClientIP())
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	clearAuthCookies(c)
+	c.JSON(http.StatusAccepted, response)
+}
+
+// RestoreAccount отменяет удаление по ссылке из письма
+func (h *AccountHandler) RestoreAccount(c *gin.Context) {
+	var req models.AccountTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": getValidationError(err)})
+		return
+	}
+
+	if err := h.accountService.CancelDeletion(c.Request.Context(), req.Token); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account restored, you can sign in again"})
+}
+
+func respondAccountError(c *gin.Context, err error) {
+	var tooMany *services.TooManyAttemptsError
+	switch {
+	case errors.As(err, &tooMany):
+		respondTooManyAttempts(c, tooMany)
+	case errors.Is(err, services.ErrInvalidCurrentPassword), errors.Is(err, services.ErrPasswordLoginDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidAccountToken), errors.Is(err, services.ErrEmailUnchanged),
+		errors.Is(err, services.ErrDeleteConfirmation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrEmailTaken), errors.Is(err, services.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	adminService *services.AdminService
+}
+
+func NewAdminHandler(adminService *services.AdminService) *AdminHandler {
+	return &AdminHandler{adminService: adminService}
+}
+
+// ListUsers - пользователи с занятым местом; ?q= ищет по имени и email
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	users, err := h.adminService.ListUsers(c.Query("q"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+func (h *AdminHandler) SetRole(c *gin.Context) {
+	adminID, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.adminService.SetRole(adminID, userID, req.Role); err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated"})
+}
+
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	h.setDisabled(c, true)
+}
+
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	h.setDisabled(c, false)
+}
+
+func (h *AdminHandler) setDisabled(c *gin.Context, disabled bool) {
+	adminID, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.SetDisabled(adminID, userID, disabled); err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	if disabled {
+		c.JSON(http.StatusOK, gin.H{"message": "User disabled"})
+	} else {
+		c.JSON(http.StatusOK, gin.H{"message": "User enabled"})
+	}
+}
+
+// DeleteUser отключает аккаунт сразу, а файлы и прочие данные удаляет в фоне.
+// Прогресс доступен через /jobs/:id.
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	adminID, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.adminService.DeleteUser(adminID, userID)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job": job})
+}
+
+func (h *AdminHandler) ResetPassword(c *gin.Context) {
+	_, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": getValidationError(err)})
+		return
+	}
+
+	response, err := h.adminService.ResetPassword(userID, req.Password)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ResetTwoFactor снимает второй фактор с аккаунта пользователя
+func (h *AdminHandler) ResetTwoFactor(c *gin.Context) {
+	_, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.ResetTwoFactor(userID); err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
+
+func (h *AdminHandler) GetUserQuota(c *gin.Context) {
+	_, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	quota, err := h.adminService.GetUserQuota(userID)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, quota)
+}
+
+// SetUserQuota задает квоту пользователя; {"quota": null} возвращает квоту по умолчанию
+func (h *AdminHandler) SetUserQuota(c *gin.Context) {
+	_, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	quota, err := h.adminService.SetUserQuota(userID, req.Quota)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, quota)
+}
+
+// ListAuditEvents - журнал безопасности (блокировки входа); ?type= фильтрует по типу
+func (h *AdminHandler) ListAuditEvents(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	events, err := h.adminService.ListAuditEvents(c.Query("type"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+func (h *AdminHandler) GetStorageStats(c *gin.Context) {
+	stats, err := h.adminService.GetStorageStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (h *AdminHandler) GetRegistration(c *gin.Context) {
+	mode, err := h.adminService.RegistrationMode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, registrationSettings(mode))
+}
+
+// SetRegistration меняет режим регистрации без перезапуска сервера
+func (h *AdminHandler) SetRegistration(c *gin.Context) {
+	var req models.RegistrationSettingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mode := req.Mode
+	if mode == "" {
+		if req.Enabled == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mode is required"})
+			return
+		}
+		mode = models.RegistrationClosed
+		if *req.Enabled {
+			mode = models.RegistrationOpen
+		}
+	}
+
+	if err := h.adminService.SetRegistrationMode(mode); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, registrationSettings(mode))
+}
+
+func registrationSettings(mode string) models.RegistrationSettings {
+	return models.RegistrationSettings{
+		Mode:    mode,
+		Enabled: mode != models.RegistrationClosed,
+	}
+}
+
+// adminTarget достает администратора из контекста и пользователя из :id
+func adminTarget(c *gin.Context) (adminID, userID uint, ok bool) {
+	id, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return 0, 0, false
+	}
+
+	target, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, 0, false
+	}
+
+	return id.(uint), uint(target), true
+}
+
+func respondAdminError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAdminSelf), errors.Is(err, services.ErrLastAdmin),
+		errors.Is(err, services.ErrTwoFactorNotEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
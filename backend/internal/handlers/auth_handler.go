@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bhop_dynasty/0x40_cloud/internal/models"
 	"github.com/bhop_dynasty/0x40_cloud/internal/services"
@@ -45,7 +51,12 @@ func getValidationError(err error) string {
 
 func (h *AuthHandler) Register(c *gin.Context) {
 	// Check if registration is disabled
-	if h.authService.Config.Auth.DisableRegistration {
+	mode, err := h.authService.RegistrationMode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check registration settings"})
+		return
+	}
+	if mode == models.RegistrationClosed {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is disabled"})
 		return
 	}
@@ -56,14 +67,30 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.Register(&req)
+	response, err := h.authService.Register(c.Request.Context(), &req, sessionClient(c))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		switch {
+		case errors.Is(err, services.ErrRegistrationDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Registration is disabled"})
+		case errors.Is(err, services.ErrInviteRequired):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "invite_required": true})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// Вход откроется после перехода по ссылке из письма
+	if response.EmailVerificationRequired {
+		c.JSON(http.StatusCreated, gin.H{
+			"user":                        response.User,
+			"email_verification_required": true,
+		})
 		return
 	}
 
 	// Set JWT token as httpOnly cookie
-	h.setAuthCookie(c, response.Token)
+	h.setAuthCookies(c, response)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"user": response.User,
@@ -77,20 +104,246 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.Login(&req)
+	response, err := h.authService.Login(c.Request.Context(), &req, sessionClient(c))
 	if err != nil {
+		var tooMany *services.TooManyAttemptsError
+		if errors.As(err, &tooMany) {
+			respondTooManyAttempts(c, tooMany)
+			return
+		}
+		if errors.Is(err, services.ErrPasswordLoginDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "email_verification_required": true})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Нужен второй фактор: cookie не выставляем, клиент продолжает вход через /auth/login/2fa
+	if response.TwoFactorRequired {
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"pre_auth_token":      response.PreAuthToken,
+		})
+		return
+	}
+
 	// Set JWT token as httpOnly cookie
-	h.setAuthCookie(c, response.Token)
+	h.setAuthCookies(c, response)
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": response.User,
+	})
+}
+
+// LoginTwoFactor - второй шаг входа: pre-auth токен и код TOTP или код восстановления
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": getValidationError(err)})
+		return
+	}
+
+	response, err := h.authService.LoginTwoFactor(c.Request.Context(), &req, sessionClient(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidPreAuthToken),
+			errors.Is(err, services.ErrInvalidTwoFactorCode),
+			errors.Is(err, services.ErrTwoFactorNotEnabled),
+			errors.Is(err, services.ErrAccountDisabled):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete login"})
+		}
+		return
+	}
+
+	h.setAuthCookies(c, response)
 
 	c.JSON(http.StatusOK, gin.H{
 		"user": response.User,
 	})
 }
 
+// Methods сообщает странице логина, какие способы входа включены
+func (h *AuthHandler) Methods(c *gin.Context) {
+	methods, err := h.authService.AuthMethods()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load auth settings"})
+		return
+	}
+	c.JSON(http.StatusOK, methods)
+}
+
+// oidcStateCookie связывает вход с браузером, который его начал: без нее
+// можно было бы подсунуть жертве callback со своим code (login CSRF)
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/api/auth/oidc"
+)
+
+// OIDCLogin перенаправляет браузер к провайдеру. ?redirect= - путь в приложении
+// (только относительный), куда вернуться после входа.
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	authURL, state, err := h.authService.BeginOIDCLogin(c.Request.Context(), safeRedirect(c.Query("redirect")))
+	if err != nil {
+		if errors.Is(err, services.ErrOIDCDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, 600, oidcStateCookiePath, "", false, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback принимает браузер от провайдера, выставляет cookie сессии и
+// возвращает его в приложение. Ошибки показываются на странице логина.
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, oidcStateCookiePath, "", false, true)
+
+	if providerError := c.Query("error"); providerError != "" {
+		h.oidcFailed(c, providerError)
+		return
+	}
+	if state == "" || cookieState != state {
+		h.oidcFailed(c, "invalid_state")
+		return
+	}
+
+	response, redirect, err := h.authService.CompleteOIDCLogin(c.Request.Context(), state, c.Query("code"), sessionClient(c))
+	if err != nil {
+		code := "login_failed"
+		switch {
+		case errors.Is(err, services.ErrOIDCInvalidState):
+			code = "invalid_state"
+		case errors.Is(err, services.ErrAccountDisabled):
+			code = "account_disabled"
+		case errors.Is(err, services.ErrOIDCSignupDisabled):
+			code = "signup_disabled"
+		case errors.Is(err, services.ErrOIDCEmailRequired), errors.Is(err, services.ErrOIDCEmailTaken):
+			code = "email_conflict"
+		}
+		log.Printf("OIDC login failed: %v", err)
+		h.oidcFailed(c, code)
+		return
+	}
+
+	h.setAuthCookies(c, response)
+	if redirect == "" {
+		redirect = h.authService.Config.OIDC.PostLoginURL
+	}
+	c.Redirect(http.StatusFound, redirect)
+}
+
+func (h *AuthHandler) oidcFailed(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, "/login?sso_error="+url.QueryEscape(code))
+}
+
+// safeRedirect пропускает только пути внутри приложения, чтобы ссылка на вход
+// не могла увести пользователя на чужой сайт
+func safeRedirect(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.Contains(redirect, "\\") {
+		return ""
+	}
+	return redirect
+}
+
+// Refresh обменивает refresh-токен (cookie или тело запроса) на новую пару токенов.
+// Клиенты без cookie получают токены в теле ответа.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	refreshToken := refreshTokenFrom(c)
+	if refreshToken == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token required"})
+		return
+	}
+
+	response, err := h.authService.Refresh(c.Request.Context(), refreshToken, sessionClient(c))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			clearAuthCookies(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	h.setAuthCookies(c, response)
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":          response.User,
+		"token":         response.Token,
+		"refresh_token": response.RefreshToken,
+	})
+}
+
+// ListSessions - устройства, с которых выполнен вход
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(c.Request.Context(), userID.(uint), c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	sessionID := c.Param("id")
+	if err := h.authService.RevokeSession(c.Request.Context(), userID.(uint), sessionID); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if sessionID == c.GetString("session_id") {
+		clearAuthCookies(c)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// LogoutAll закрывает все сессии пользователя, включая текущую
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := h.authService.RevokeAllSessions(c.Request.Context(), userID.(uint)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	clearAuthCookies(c)
+	c.JSON(http.StatusOK, gin.H{"message": "logged out from all sessions"})
+}
+
 func (h *AuthHandler) GetMe(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -107,34 +360,87 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 	c.JSON(http.StatusOK, user.ToResponse())
 }
 
+// Logout закрывает текущую сессию на сервере: ее refresh- и access-токены
+// перестают приниматься сразу, а не по истечении срока
 func (h *AuthHandler) Logout(c *gin.Context) {
-	c.SetCookie(
-		"auth_token",
-		"",
-		-1, // expires immediately
-		"/",
-		"",
-		false, // secure (false to support HTTP)
-		true,  // httpOnly
-	)
+	if refreshToken := refreshTokenFrom(c); refreshToken != "" {
+		if err := h.authService.Logout(c.Request.Context(), refreshToken); err != nil &&
+			!errors.Is(err, services.ErrSessionNotFound) && !errors.Is(err, services.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+	}
+
+	clearAuthCookies(c)
 
 	c.JSON(http.StatusOK, gin.H{"message": "logged out successfully"})
 }
 
-func (h *AuthHandler) setAuthCookie(c *gin.Context, token string) {
-	maxAge := 24 * 60 * 60
+// refreshCookiePath - refresh-токен уходит только на эндпоинты авторизации
+const refreshCookiePath = "/api/auth"
+
+func (h *AuthHandler) setAuthCookies(c *gin.Context, response *models.AuthResponse) {
+	// SameSite=Lax for cross-origin support
+	c.SetSameSite(http.SameSiteLaxMode)
+
+	accessTTL, err := time.ParseDuration(h.authService.Config.JWT.Expiration)
+	if err != nil {
+		accessTTL = 15 * time.Minute
+	}
 
 	c.SetCookie(
-		"auth_token", // name
-		token,        // value
-		maxAge,       // max age in seconds
-		"/",          // path
-		"",           // domain (empty = current domain)
-		false,        // secure (false to support HTTP)
-		true,         // httpOnly (not accessible via JavaScript)
+		"auth_token",             // name
+		response.Token,           // value
+		int(accessTTL.Seconds()), // max age in seconds
+		"/",                      // path
+		"",                       // domain (empty = current domain)
+		false,                    // secure (false to support HTTP)
+		true,                     // httpOnly (not accessible via JavaScript)
 	)
 
-	// Also set SameSite policy - Lax for cross-origin support
-	c.Writer.Header().Set("Set-Cookie",
-		c.Writer.Header().Get("Set-Cookie")+"; SameSite=Lax")
+	// Пустой refresh-токен - ротацию уже выполнил параллельный запрос, cookie у клиента новая
+	if response.RefreshToken != "" {
+		c.SetCookie(
+			"refresh_token",
+			response.RefreshToken,
+			int(h.authService.Config.JWT.RefreshExpiration.Seconds()),
+			refreshCookiePath,
+			"",
+			false,
+			true,
+		)
+	}
+}
+
+func clearAuthCookies(c *gin.Context) {
+	c.SetCookie("auth_token", "", -1, "/", "", false, true)
+	c.SetCookie("refresh_token", "", -1, refreshCookiePath, "", false, true)
+}
+
+func refreshTokenFrom(c *gin.Context) string {
+	if token, err := c.Cookie("refresh_token"); err == nil && token != "" {
+		return token
+	}
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err == nil {
+		return req.RefreshToken
+	}
+	return ""
+}
+
+// respondTooManyAttempts отвечает 429 с Retry-After в секундах
+func respondTooManyAttempts(c *gin.Context, err *services.TooManyAttemptsError) {
+	seconds := int(math.Ceil(err.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error":       err.Error(),
+		"retry_after": seconds,
+	})
+}
+
+func sessionClient(c *gin.Context) services.SessionClient {
+	return services.SessionClient{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
 }
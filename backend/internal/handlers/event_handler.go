@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Интервал комментариев-пингов, чтобы прокси не закрывали простаивающее соединение
+const eventKeepAliveInterval = 25 * time.Second
+
+type EventHandler struct {
+	eventService *services.EventService
+}
+
+func NewEventHandler(eventService *services.EventService) *EventHandler {
+	return &EventHandler{eventService: eventService}
+}
+
+// Stream отдает события пользователя через Server-Sent Events.
+// При переподключении браузер сам присылает Last-Event-ID, и пропущенные события досылаются из истории.
+func (h *EventHandler) Stream(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	events, err := h.eventService.Subscribe(c.Request.Context(), userID.(uint), lastEventID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			return true
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			payload, err := json.Marshal(event)
+			if err != nil {
+				return true
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, payload)
+			return true
+		}
+	})
+}
@@ -1,17 +1,50 @@
 package handlers
 
 import (
+	"errors"
+	"net/http"
+	"strconv"
+
 	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/gin-gonic/gin"
 )
 
 type FileHandler struct {
 	fileService     *services.FileService
 	activityService *services.ActivityService
+	jobService      *services.JobService
 }
 
-func NewFileHandler(fileService *services.FileService, activityService *services.ActivityService) *FileHandler {
+func NewFileHandler(fileService *services.FileService, activityService *services.ActivityService, jobService *services.JobService) *FileHandler {
 	return &FileHandler{
 		fileService:     fileService,
 		activityService: activityService,
+		jobService:      jobService,
 	}
 }
+
+// folderOwner определяет, в чьем пространстве работает запрос к папке.
+// Без owner_id - в своем; с owner_id - в папке другого пользователя, если он выдал доступ.
+// При ошибке отвечает сам.
+func (h *FileHandler) folderOwner(c *gin.Context, userID uint, ownerParam, folderPath string, write bool) (uint, bool) {
+	if ownerParam == "" {
+		return userID, true
+	}
+
+	ownerID, err := strconv.ParseUint(ownerParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid owner_id"})
+		return 0, false
+	}
+
+	if err := h.fileService.AuthorizeFolder(userID, uint(ownerID), folderPath, write); err != nil {
+		if errors.Is(err, services.ErrAccessDenied) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return 0, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return 0, false
+	}
+
+	return uint(ownerID), true
+}
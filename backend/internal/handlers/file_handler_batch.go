@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// BatchOperations выполняет несколько операций над файлами за один запрос
+func (h *FileHandler) BatchOperations(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req models.BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "operations are required"})
+		return
+	}
+
+	if len(req.Operations) > models.MaxBatchOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("too many operations: max is %d", models.MaxBatchOperations)})
+		return
+	}
+
+	for i := range req.Operations {
+		if req.Operations[i].TargetPath == "" {
+			continue
+		}
+		sanitizedPath, err := utils.SanitizePath(req.Operations[i].TargetPath)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid target_path in operation %d", i)})
+			return
+		}
+		req.Operations[i].TargetPath = sanitizedPath
+	}
+
+	resp, err := h.fileService.ExecuteBatch(userID.(uint), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
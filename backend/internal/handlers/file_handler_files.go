@@ -8,6 +8,7 @@ import (
 	"strconv"
 
 	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/bhop_dynasty/0x40_cloud/internal/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -26,14 +27,25 @@ func (h *FileHandler) Upload(c *gin.Context) {
 	}
 
 	// Получаем дополнительные параметры
-	virtualPath := c.PostForm("virtual_path")
-	if virtualPath == "" {
-		virtualPath = "/"
+	virtualPath, err := utils.SanitizePath(c.PostForm("virtual_path"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
+		return
 	}
 
 	folderName := c.PostForm("folder_name")
 
-	uploadedFile, err := h.fileService.UploadFileWithPath(userID.(uint), file, virtualPath, folderName)
+	// Загрузка в чужую папку учитывается в квоте ее владельца
+	ownerID, ok := h.folderOwner(c, userID.(uint), c.PostForm("owner_id"), virtualPath, true)
+	if !ok {
+		return
+	}
+
+	upload := h.fileService.UploadFileWithPath
+	if ownerID != userID.(uint) {
+		upload = h.fileService.UploadGrantedFile
+	}
+	uploadedFile, err := upload(ownerID, file, virtualPath, folderName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
 	"github.com/bhop_dynasty/0x40_cloud/internal/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -28,7 +29,12 @@ func (h *FileHandler) GetFilesByPath(c *gin.Context) {
 		return
 	}
 
-	files, err := h.fileService.GetFilesByPath(userID.(uint), sanitizedPath)
+	ownerID, ok := h.folderOwner(c, userID.(uint), c.Query("owner_id"), sanitizedPath, false)
+	if !ok {
+		return
+	}
+
+	files, err := h.fileService.GetFilesByPath(ownerID, sanitizedPath)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -97,18 +103,56 @@ func (h *FileHandler) DownloadFolder(c *gin.Context) {
 		return
 	}
 
+	ownerID, ok := h.folderOwner(c, userID.(uint), c.Query("owner_id"), sanitizedPath, false)
+	if !ok {
+		return
+	}
+
 	c.Header("Content-Description", "File Transfer")
 	c.Header("Content-Transfer-Encoding", "binary")
 	c.Header("Content-Disposition", "attachment; filename=folder.zip")
 	c.Header("Content-Type", "application/zip")
 
-	if err := h.fileService.DownloadFolderAsZip(sanitizedPath, userID.(uint), c.Writer); err != nil {
+	if err := h.fileService.DownloadFolderAsZip(sanitizedPath, ownerID, c.Writer); err != nil {
 		// Note: if we already started writing zip, this error might not be properly sent as JSON
 		log.Printf("Failed to download folder: %v", err)
 		return
 	}
 }
 
+// DownloadFolderAsync ставит архивирование папки в очередь фоновых задач.
+// Готовый архив скачивается через GET /jobs/:id/download.
+func (h *FileHandler) DownloadFolderAsync(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req struct {
+		Path string `json:"path" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		return
+	}
+
+	sanitizedPath, err := utils.SanitizePath(req.Path)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
+		return
+	}
+
+	job, err := h.jobService.Enqueue(userID.(uint), services.JobTypeFolderZip, services.FolderJobPayload{Path: sanitizedPath})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job": job})
+}
+
 func (h *FileHandler) DeleteFolder(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -128,7 +172,24 @@ func (h *FileHandler) DeleteFolder(c *gin.Context) {
 		return
 	}
 
-	if err := h.fileService.DeleteFolder(sanitizedPath, userID.(uint)); err != nil {
+	ownerID, ok := h.folderOwner(c, userID.(uint), c.Query("owner_id"), sanitizedPath, true)
+	if !ok {
+		return
+	}
+
+	// Большие папки удаляются в фоне, клиент следит за прогрессом через /jobs/:id.
+	// Задачи выполняются от имени владельца, поэтому чужие папки удаляются только синхронно.
+	if c.Query("async") == "true" && ownerID == userID.(uint) {
+		job, err := h.jobService.Enqueue(userID.(uint), services.JobTypeFolderDelete, services.FolderJobPayload{Path: sanitizedPath})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"job": job})
+		return
+	}
+
+	if err := h.fileService.DeleteFolder(sanitizedPath, ownerID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -144,8 +205,9 @@ func (h *FileHandler) CreateFolder(c *gin.Context) {
 	}
 
 	var req struct {
-		Path string `json:"path"`
-		Name string `json:"name" binding:"required"`
+		Path    string `json:"path"`
+		Name    string `json:"name" binding:"required"`
+		OwnerID string `json:"owner_id"` // Папка другого пользователя с доступом на запись
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -164,7 +226,12 @@ func (h *FileHandler) CreateFolder(c *gin.Context) {
 		return
 	}
 
-	file, err := h.fileService.CreateFolder(userID.(uint), sanitizedPath, req.Name)
+	ownerID, ok := h.folderOwner(c, userID.(uint), req.OwnerID, sanitizedPath, true)
+	if !ok {
+		return
+	}
+
+	file, err := h.fileService.CreateFolder(ownerID, sanitizedPath, req.Name)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
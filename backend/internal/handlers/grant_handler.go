@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/bhop_dynasty/0x40_cloud/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type GrantHandler struct {
+	grantService *services.GrantService
+}
+
+func NewGrantHandler(grantService *services.GrantService) *GrantHandler {
+	return &GrantHandler{grantService: grantService}
+}
+
+// CreateGrant выдает другому пользователю доступ к файлу или папке
+func (h *GrantHandler) CreateGrant(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req models.CreateGrantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.FileID == nil {
+		if req.Path == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file_id or path is required"})
+			return
+		}
+		sanitizedPath, err := utils.SanitizePath(req.Path)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
+			return
+		}
+		req.Path = sanitizedPath
+	}
+
+	grant, err := h.grantService.CreateGrant(userID.(uint), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrGrantUserNotFound), errors.Is(err, services.ErrGrantInvalidTarget):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrGrantSelf):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, grant)
+}
+
+// ListGrants - доступы, выданные текущим пользователем
+func (h *GrantHandler) ListGrants(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	grants, err := h.grantService.ListGrants(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, grants)
+}
+
+// ListSharedWithMe - раздел "Доступные мне". Содержимое папок читается через
+// обычные эндпоинты файлов с параметром owner_id.
+func (h *GrantHandler) ListSharedWithMe(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	grants, err := h.grantService.ListSharedWithMe(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, grants)
+}
+
+func (h *GrantHandler) RevokeGrant(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grant ID"})
+		return
+	}
+
+	if err := h.grantService.RevokeGrant(userID.(uint), uint(id)); err != nil {
+		if errors.Is(err, services.ErrGrantNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Access revoked"})
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type InviteHandler struct {
+	inviteService *services.InviteService
+}
+
+func NewInviteHandler(inviteService *services.InviteService) *InviteHandler {
+	return &InviteHandler{inviteService: inviteService}
+}
+
+func (h *InviteHandler) ListInvites(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	invites, err := h.inviteService.List(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// CreateInvite выпускает приглашение. Код и ссылка возвращаются только в этом ответе.
+func (h *InviteHandler) CreateInvite(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req models.CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invite, err := h.inviteService.Create(userID.(uint), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInviteExpiry), errors.Is(err, services.ErrInviteTooLong):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInviteAdminOnly), errors.Is(err, services.ErrInvitesNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrTooManyInvites):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, invite)
+}
+
+func (h *InviteHandler) RevokeInvite(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	h.revoke(c, userID.(uint))
+}
+
+// CheckInvite - публичная проверка кода для страницы регистрации
+func (h *InviteHandler) CheckInvite(c *gin.Context) {
+	status, err := h.inviteService.Check(c.Param("code"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !status.Valid {
+		c.JSON(http.StatusNotFound, status)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// ListAllInvites - все приглашения сервера для администратора
+func (h *InviteHandler) ListAllInvites(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	invites, err := h.inviteService.ListAll(limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// AdminRevokeInvite отзывает приглашение любого пользователя
+func (h *InviteHandler) AdminRevokeInvite(c *gin.Context) {
+	h.revoke(c, 0)
+}
+
+func (h *InviteHandler) revoke(c *gin.Context, createdBy uint) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite ID"})
+		return
+	}
+
+	if err := h.inviteService.Revoke(createdBy, uint(id)); err != nil {
+		if errors.Is(err, services.ErrInviteNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite revoked"})
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type JobHandler struct {
+	jobService  *services.JobService
+	fileService *services.FileService
+}
+
+func NewJobHandler(jobService *services.JobService, fileService *services.FileService) *JobHandler {
+	return &JobHandler{
+		jobService:  jobService,
+		fileService: fileService,
+	}
+}
+
+func (h *JobHandler) ListJobs(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	limit := 50
+	if limitParam := c.Query("limit"); limitParam != "" {
+		if parsedLimit, err := strconv.Atoi(limitParam); err == nil && parsedLimit > 0 && parsedLimit <= 200 {
+			limit = parsedLimit
+		}
+	}
+
+	jobs, err := h.jobService.ListJobs(userID.(uint), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+func (h *JobHandler) GetJob(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job ID"})
+		return
+	}
+
+	job, err := h.jobService.GetJob(jobID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// StreamJob отдает прогресс задачи через Server-Sent Events до её завершения.
+// После перезагрузки страницы клиент просто переподключается и получает текущее состояние.
+func (h *JobHandler) StreamJob(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job ID"})
+		return
+	}
+
+	job, err := h.jobService.GetJob(jobID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // nginx не должен буферизовать поток
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var lastUpdate time.Time
+	var lastProgress int64 = -1
+	c.Stream(func(w io.Writer) bool {
+		if !job.UpdatedAt.Equal(lastUpdate) || job.Progress != lastProgress {
+			c.SSEvent("progress", job)
+			lastUpdate = job.UpdatedAt
+			lastProgress = job.Progress
+		}
+		if job.IsFinished() {
+			c.SSEvent("done", job)
+			return false
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ticker.C:
+		}
+
+		current, err := h.jobService.GetJob(jobID, userID.(uint))
+		if err != nil {
+			c.SSEvent("error", gin.H{"error": err.Error()})
+			return false
+		}
+		job = current
+		return true
+	})
+}
+
+func (h *JobHandler) CancelJob(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job ID"})
+		return
+	}
+
+	job, err := h.jobService.CancelJob(jobID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// DownloadJobResult отдает результат задачи (архив папки или выгрузку аккаунта)
+func (h *JobHandler) DownloadJobResult(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job ID"})
+		return
+	}
+
+	job, err := h.jobService.GetJob(jobID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	isArchive := job.Type == services.JobTypeFolderZip || job.Type == services.JobTypeAccountExport
+	if !isArchive || job.Status != models.JobCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "job has no downloadable result"})
+		return
+	}
+
+	var result services.FolderZipResult
+	if err := json.Unmarshal(job.Result, &result); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid job result"})
+		return
+	}
+
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Transfer-Encoding", "binary")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", result.Filename))
+	c.Header("Content-Type", "application/zip")
+
+	if err := h.fileService.DownloadJobArtifact(job, c.Writer); err != nil {
+		log.Printf("Failed to download job result: %v", err)
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		}
+	}
+}
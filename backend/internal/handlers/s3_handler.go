@@ -0,0 +1,689 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	s3Namespace     = "http://s3.amazonaws.com/doc/2006-03-01/"
+	s3TimeFormat    = "2006-01-02T15:04:05.000Z"
+	s3MaxXMLRequest = 2 * 1024 * 1024
+)
+
+var (
+	errS3NotImplemented  = errors.New("this operation is not implemented")
+	errS3MalformedXML    = errors.New("the XML you provided was not well-formed")
+	errS3InvalidArgument = errors.New("invalid argument")
+)
+
+// Подресурсы бакета (?versioning, ?acl и т.п.), которые шлюз не поддерживает.
+// Без этой проверки GET с ними вернул бы листинг вместо ошибки.
+var s3UnsupportedSubresources = []string{
+	"acl", "policy", "versioning", "versions", "lifecycle", "cors", "tagging", "website",
+	"logging", "notification", "replication", "encryption", "object-lock", "publicAccessBlock",
+	"ownershipControls", "accelerate", "requestPayment", "analytics", "inventory", "metrics",
+}
+
+func hasUnsupportedSubresource(query url.Values) bool {
+	for _, name := range s3UnsupportedSubresources {
+		if query.Has(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// S3Handler реализует S3-совместимый API (path-style: /bucket/key) на отдельном порту
+type S3Handler struct {
+	s3Service  *services.S3Service
+	accessKeys *services.AccessKeyService
+	region     string
+}
+
+func NewS3Handler(s3Service *services.S3Service, accessKeys *services.AccessKeyService, region string) *S3Handler {
+	return &S3Handler{s3Service: s3Service, accessKeys: accessKeys, region: region}
+}
+
+// Register вешает все запросы на один обработчик: операция S3 определяется методом и query-параметрами
+func (h *S3Handler) Register(r *gin.Engine) {
+	r.Any("/*path", h.Serve)
+}
+
+func (h *S3Handler) Serve(c *gin.Context) {
+	c.Header("x-amz-request-id", strings.ToUpper(strings.ReplaceAll(uuid.New().String(), "-", "")[:16]))
+
+	req, err := h.accessKeys.AuthenticateS3(c.Request)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(c.Request.URL.Path, "/"), "/")
+	query := c.Request.URL.Query()
+	method := c.Request.Method
+
+	switch {
+	case bucket == "":
+		if method != http.MethodGet {
+			h.writeError(c, errS3NotImplemented)
+			return
+		}
+		h.listBuckets(c, req)
+
+	case key == "":
+		switch {
+		case method == http.MethodPut:
+			h.createBucket(c, req, bucket)
+		case method == http.MethodDelete:
+			h.deleteBucket(c, req, bucket)
+		case method == http.MethodHead:
+			h.headBucket(c, req, bucket)
+		case method == http.MethodGet && query.Has("location"):
+			h.getBucketLocation(c, req, bucket)
+		case method == http.MethodGet && query.Has("uploads"):
+			h.listMultipartUploads(c, req, bucket)
+		case method == http.MethodGet && !hasUnsupportedSubresource(query):
+			h.listObjects(c, req, bucket, query)
+		case method == http.MethodPost && query.Has("delete"):
+			h.deleteObjects(c, req, bucket)
+		default:
+			h.writeError(c, errS3NotImplemented)
+		}
+
+	default:
+		switch {
+		case method == http.MethodPut && query.Has("uploadId"):
+			h.uploadPart(c, req, bucket, key, query)
+		case method == http.MethodPut && c.GetHeader("X-Amz-Copy-Source") != "":
+			h.writeError(c, errS3NotImplemented)
+		case method == http.MethodPut:
+			h.putObject(c, req, bucket, key)
+		case (method == http.MethodGet || method == http.MethodHead) && query.Has("uploadId"):
+			h.listParts(c, req, bucket, key, query)
+		case method == http.MethodGet || method == http.MethodHead:
+			h.getObject(c, req, bucket, key)
+		case method == http.MethodDelete && query.Has("uploadId"):
+			h.abortMultipartUpload(c, req, bucket, key, query)
+		case method == http.MethodDelete:
+			h.deleteObject(c, req, bucket, key)
+		case method == http.MethodPost && query.Has("uploads"):
+			h.createMultipartUpload(c, req, bucket, key)
+		case method == http.MethodPost && query.Has("uploadId"):
+			h.completeMultipartUpload(c, req, bucket, key, query)
+		default:
+			h.writeError(c, errS3NotImplemented)
+		}
+	}
+}
+
+type s3Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type s3BucketEntry struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name        `xml:"ListAllMyBucketsResult"`
+	Xmlns   string          `xml:"xmlns,attr"`
+	Owner   s3Owner         `xml:"Owner"`
+	Buckets []s3BucketEntry `xml:"Buckets>Bucket"`
+}
+
+func (h *S3Handler) listBuckets(c *gin.Context, req *services.S3Request) {
+	buckets, err := h.s3Service.ListBuckets(req.UserID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	result := listAllMyBucketsResult{
+		Xmlns:   s3Namespace,
+		Owner:   s3Owner{ID: strconv.FormatUint(uint64(req.UserID), 10)},
+		Buckets: make([]s3BucketEntry, 0, len(buckets)),
+	}
+	for _, bucket := range buckets {
+		result.Buckets = append(result.Buckets, s3BucketEntry{
+			Name:         bucket.OriginalName,
+			CreationDate: bucket.CreatedAt.UTC().Format(s3TimeFormat),
+		})
+	}
+	h.writeXML(c, http.StatusOK, result)
+}
+
+func (h *S3Handler) createBucket(c *gin.Context, req *services.S3Request, bucket string) {
+	if err := h.s3Service.CreateBucket(req.UserID, bucket); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Header("Location", "/"+bucket)
+	c.Status(http.StatusOK)
+}
+
+func (h *S3Handler) deleteBucket(c *gin.Context, req *services.S3Request, bucket string) {
+	if err := h.s3Service.DeleteBucket(req.UserID, bucket); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *S3Handler) headBucket(c *gin.Context, req *services.S3Request, bucket string) {
+	if err := h.s3Service.HeadBucket(req.UserID, bucket); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Header("x-amz-bucket-region", h.region)
+	c.Status(http.StatusOK)
+}
+
+type locationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Region  string   `xml:",chardata"`
+}
+
+func (h *S3Handler) getBucketLocation(c *gin.Context, req *services.S3Request, bucket string) {
+	if err := h.s3Service.HeadBucket(req.UserID, bucket); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	// По соглашению S3 us-east-1 обозначается пустым значением
+	region := h.region
+	if region == "us-east-1" {
+		region = ""
+	}
+	h.writeXML(c, http.StatusOK, locationConstraint{Xmlns: s3Namespace, Region: region})
+}
+
+type s3ObjectEntry struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type s3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name         `xml:"ListBucketResult"`
+	Xmlns                 string           `xml:"xmlns,attr"`
+	Name                  string           `xml:"Name"`
+	Prefix                string           `xml:"Prefix"`
+	Delimiter             string           `xml:"Delimiter,omitempty"`
+	MaxKeys               int              `xml:"MaxKeys"`
+	IsTruncated           bool             `xml:"IsTruncated"`
+	Marker                *string          `xml:"Marker"`
+	NextMarker            string           `xml:"NextMarker,omitempty"`
+	KeyCount              *int             `xml:"KeyCount"`
+	ContinuationToken     string           `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string           `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string           `xml:"StartAfter,omitempty"`
+	Contents              []s3ObjectEntry  `xml:"Contents"`
+	CommonPrefixes        []s3CommonPrefix `xml:"CommonPrefixes"`
+}
+
+// listObjects обслуживает ListObjectsV2 (list-type=2) и старый ListObjects
+func (h *S3Handler) listObjects(c *gin.Context, req *services.S3Request, bucket string, query url.Values) {
+	isV2 := query.Get("list-type") == "2"
+
+	maxKeys := 1000
+	if raw := query.Get("max-keys"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			h.writeError(c, errS3InvalidArgument)
+			return
+		}
+		maxKeys = parsed
+	}
+
+	marker := query.Get("marker")
+	if isV2 {
+		marker = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			decoded, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				h.writeError(c, errS3InvalidArgument)
+				return
+			}
+			marker = string(decoded)
+		}
+	}
+
+	list, err := h.s3Service.ListObjects(req.UserID, bucket, query.Get("prefix"), query.Get("delimiter"), marker, maxKeys)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	result := listBucketResult{
+		Xmlns:          s3Namespace,
+		Name:           bucket,
+		Prefix:         query.Get("prefix"),
+		Delimiter:      query.Get("delimiter"),
+		MaxKeys:        maxKeys,
+		IsTruncated:    list.IsTruncated,
+		Contents:       make([]s3ObjectEntry, 0, len(list.Objects)),
+		CommonPrefixes: make([]s3CommonPrefix, 0, len(list.CommonPrefixes)),
+	}
+	for _, object := range list.Objects {
+		result.Contents = append(result.Contents, s3ObjectEntry{
+			Key:          object.Key,
+			LastModified: object.LastModified.UTC().Format(s3TimeFormat),
+			ETag:         object.ETag,
+			Size:         object.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	for _, prefix := range list.CommonPrefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, s3CommonPrefix{Prefix: prefix})
+	}
+
+	if isV2 {
+		keyCount := len(result.Contents) + len(result.CommonPrefixes)
+		result.KeyCount = &keyCount
+		result.ContinuationToken = query.Get("continuation-token")
+		result.StartAfter = query.Get("start-after")
+		if list.IsTruncated {
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(list.NextMarker))
+		}
+	} else {
+		result.Marker = &marker
+		if list.IsTruncated {
+			result.NextMarker = list.NextMarker
+		}
+	}
+
+	h.writeXML(c, http.StatusOK, result)
+}
+
+func (h *S3Handler) getObject(c *gin.Context, req *services.S3Request, bucket, key string) {
+	file, err := h.s3Service.GetObject(req.UserID, bucket, key)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	reader, err := h.s3Service.OpenObject(file)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	defer reader.Close()
+
+	contentType := file.MimeType
+	if contentType == "inode/directory" {
+		contentType = "application/x-directory"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("ETag", services.S3ETag(file))
+
+	// ServeContent обрабатывает Range, If-Modified-Since, If-None-Match и HEAD
+	http.ServeContent(c.Writer, c.Request, file.OriginalName, file.UpdatedAt, reader)
+}
+
+func (h *S3Handler) putObject(c *gin.Context, req *services.S3Request, bucket, key string) {
+	_, etag, err := h.s3Service.PutObject(req.UserID, bucket, key, c.GetHeader("Content-Type"), req.Body, req.Size)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Header("ETag", etag)
+	c.Status(http.StatusOK)
+}
+
+func (h *S3Handler) deleteObject(c *gin.Context, req *services.S3Request, bucket, key string) {
+	if err := h.s3Service.DeleteObject(req.UserID, bucket, key); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type deleteObjectsRequest struct {
+	Quiet   bool `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+type deletedObject struct {
+	Key string `xml:"Key"`
+}
+
+type deleteObjectError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name            `xml:"DeleteResult"`
+	Xmlns   string              `xml:"xmlns,attr"`
+	Deleted []deletedObject     `xml:"Deleted"`
+	Errors  []deleteObjectError `xml:"Error"`
+}
+
+func (h *S3Handler) deleteObjects(c *gin.Context, req *services.S3Request, bucket string) {
+	var body deleteObjectsRequest
+	if err := h.readXML(req, &body); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	if len(body.Objects) > 1000 {
+		h.writeError(c, errS3MalformedXML)
+		return
+	}
+
+	result := deleteResult{Xmlns: s3Namespace}
+	for _, object := range body.Objects {
+		if err := h.s3Service.DeleteObject(req.UserID, bucket, object.Key); err != nil {
+			if errors.Is(err, services.ErrS3NoSuchBucket) {
+				h.writeError(c, err)
+				return
+			}
+			_, code := s3ErrorStatus(err)
+			result.Errors = append(result.Errors, deleteObjectError{Key: object.Key, Code: code, Message: err.Error()})
+			continue
+		}
+		if !body.Quiet {
+			result.Deleted = append(result.Deleted, deletedObject{Key: object.Key})
+		}
+	}
+
+	h.writeXML(c, http.StatusOK, result)
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+func (h *S3Handler) createMultipartUpload(c *gin.Context, req *services.S3Request, bucket, key string) {
+	upload, err := h.s3Service.CreateMultipartUpload(req.UserID, bucket, key, c.GetHeader("Content-Type"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.writeXML(c, http.StatusOK, initiateMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: upload.ID.String(),
+	})
+}
+
+func (h *S3Handler) uploadPart(c *gin.Context, req *services.S3Request, bucket, key string, query url.Values) {
+	if c.GetHeader("X-Amz-Copy-Source") != "" {
+		h.writeError(c, errS3NotImplemented)
+		return
+	}
+
+	partNumber, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil {
+		h.writeError(c, services.ErrS3InvalidPartNumber)
+		return
+	}
+
+	etag, err := h.s3Service.UploadPart(req.UserID, bucket, key, query.Get("uploadId"), partNumber, req.Body, req.Size)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Header("ETag", etag)
+	c.Status(http.StatusOK)
+}
+
+type completeMultipartUploadRequest struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+func (h *S3Handler) completeMultipartUpload(c *gin.Context, req *services.S3Request, bucket, key string, query url.Values) {
+	var body completeMultipartUploadRequest
+	if err := h.readXML(req, &body); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	parts := make([]models.S3CompletedPart, 0, len(body.Parts))
+	for _, part := range body.Parts {
+		parts = append(parts, models.S3CompletedPart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+
+	_, etag, err := h.s3Service.CompleteMultipartUpload(req.UserID, bucket, key, query.Get("uploadId"), parts)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.writeXML(c, http.StatusOK, completeMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Location: "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     etag,
+	})
+}
+
+func (h *S3Handler) abortMultipartUpload(c *gin.Context, req *services.S3Request, bucket, key string, query url.Values) {
+	if err := h.s3Service.AbortMultipartUpload(req.UserID, bucket, key, query.Get("uploadId")); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type s3PartEntry struct {
+	PartNumber   int    `xml:"PartNumber"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+}
+
+type listPartsResult struct {
+	XMLName     xml.Name      `xml:"ListPartsResult"`
+	Xmlns       string        `xml:"xmlns,attr"`
+	Bucket      string        `xml:"Bucket"`
+	Key         string        `xml:"Key"`
+	UploadID    string        `xml:"UploadId"`
+	IsTruncated bool          `xml:"IsTruncated"`
+	Parts       []s3PartEntry `xml:"Part"`
+}
+
+func (h *S3Handler) listParts(c *gin.Context, req *services.S3Request, bucket, key string, query url.Values) {
+	upload, err := h.s3Service.ListParts(req.UserID, bucket, key, query.Get("uploadId"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	result := listPartsResult{
+		Xmlns:    s3Namespace,
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: upload.ID.String(),
+		Parts:    make([]s3PartEntry, 0, len(upload.Parts)),
+	}
+	for _, part := range upload.Parts {
+		result.Parts = append(result.Parts, s3PartEntry{
+			PartNumber:   part.PartNumber,
+			LastModified: part.UpdatedAt.UTC().Format(s3TimeFormat),
+			ETag:         `"` + part.ETag + `"`,
+			Size:         part.Size,
+		})
+	}
+	h.writeXML(c, http.StatusOK, result)
+}
+
+type s3UploadEntry struct {
+	Key       string `xml:"Key"`
+	UploadID  string `xml:"UploadId"`
+	Initiated string `xml:"Initiated"`
+}
+
+type listMultipartUploadsResult struct {
+	XMLName     xml.Name        `xml:"ListMultipartUploadsResult"`
+	Xmlns       string          `xml:"xmlns,attr"`
+	Bucket      string          `xml:"Bucket"`
+	IsTruncated bool            `xml:"IsTruncated"`
+	Uploads     []s3UploadEntry `xml:"Upload"`
+}
+
+func (h *S3Handler) listMultipartUploads(c *gin.Context, req *services.S3Request, bucket string) {
+	uploads, err := h.s3Service.ListMultipartUploads(req.UserID, bucket)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	result := listMultipartUploadsResult{
+		Xmlns:   s3Namespace,
+		Bucket:  bucket,
+		Uploads: make([]s3UploadEntry, 0, len(uploads)),
+	}
+	for _, upload := range uploads {
+		result.Uploads = append(result.Uploads, s3UploadEntry{
+			Key:       upload.Key,
+			UploadID:  upload.ID.String(),
+			Initiated: upload.CreatedAt.UTC().Format(s3TimeFormat),
+		})
+	}
+	h.writeXML(c, http.StatusOK, result)
+}
+
+func (h *S3Handler) readXML(req *services.S3Request, v interface{}) error {
+	data, err := io.ReadAll(io.LimitReader(req.Body, s3MaxXMLRequest))
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return errS3MalformedXML
+	}
+	return nil
+}
+
+func (h *S3Handler) writeXML(c *gin.Context, status int, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Data(status, "application/xml", append([]byte(xml.Header), data...))
+}
+
+type s3ErrorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+func s3ErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrS3MissingAuth):
+		return http.StatusForbidden, "AccessDenied"
+	case errors.Is(err, services.ErrS3MalformedAuth):
+		return http.StatusBadRequest, "AuthorizationHeaderMalformed"
+	case errors.Is(err, services.ErrS3InvalidAccessKey):
+		return http.StatusForbidden, "InvalidAccessKeyId"
+	case errors.Is(err, services.ErrS3SignatureMismatch):
+		return http.StatusForbidden, "SignatureDoesNotMatch"
+	case errors.Is(err, services.ErrS3RequestExpired):
+		return http.StatusForbidden, "RequestTimeTooSkewed"
+	case errors.Is(err, services.ErrS3ContentSHA256Mismatch):
+		return http.StatusBadRequest, "XAmzContentSHA256Mismatch"
+	case errors.Is(err, services.ErrS3IncompleteBody):
+		return http.StatusBadRequest, "IncompleteBody"
+	case errors.Is(err, services.ErrS3NoSuchBucket):
+		return http.StatusNotFound, "NoSuchBucket"
+	case errors.Is(err, services.ErrS3BucketExists):
+		return http.StatusConflict, "BucketAlreadyOwnedByYou"
+	case errors.Is(err, services.ErrS3BucketNotEmpty):
+		return http.StatusConflict, "BucketNotEmpty"
+	case errors.Is(err, services.ErrS3InvalidBucketName):
+		return http.StatusBadRequest, "InvalidBucketName"
+	case errors.Is(err, services.ErrS3NoSuchKey):
+		return http.StatusNotFound, "NoSuchKey"
+	case errors.Is(err, services.ErrS3NoSuchUpload):
+		return http.StatusNotFound, "NoSuchUpload"
+	case errors.Is(err, services.ErrS3InvalidPart):
+		return http.StatusBadRequest, "InvalidPart"
+	case errors.Is(err, services.ErrS3InvalidPartOrder):
+		return http.StatusBadRequest, "InvalidPartOrder"
+	case errors.Is(err, services.ErrS3EntityTooSmall):
+		return http.StatusBadRequest, "EntityTooSmall"
+	case errors.Is(err, services.ErrS3InvalidKey),
+		errors.Is(err, services.ErrS3InvalidPartNumber),
+		errors.Is(err, services.ErrS3FolderNotEmptyBody),
+		errors.Is(err, errS3InvalidArgument):
+		return http.StatusBadRequest, "InvalidArgument"
+	case errors.Is(err, services.ErrFileTooLarge):
+		return http.StatusBadRequest, "EntityTooLarge"
+	case errors.Is(err, services.ErrQuotaExceeded):
+		return http.StatusForbidden, "QuotaExceeded"
+	case errors.Is(err, errS3MalformedXML):
+		return http.StatusBadRequest, "MalformedXML"
+	case errors.Is(err, errS3NotImplemented):
+		return http.StatusNotImplemented, "NotImplemented"
+	default:
+		return http.StatusInternalServerError, "InternalError"
+	}
+}
+
+func (h *S3Handler) writeError(c *gin.Context, err error) {
+	status, code := s3ErrorStatus(err)
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		log.Printf("S3 %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+		message = "We encountered an internal error. Please try again."
+	}
+
+	if c.Request.Method == http.MethodHead {
+		c.Status(status)
+		return
+	}
+
+	data, _ := xml.Marshal(s3ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Resource:  c.Request.URL.Path,
+		RequestID: c.Writer.Header().Get("x-amz-request-id"),
+	})
+	c.Data(status, "application/xml", append([]byte(xml.Header), data...))
+}
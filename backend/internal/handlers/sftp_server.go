@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTPServer - встроенный SSH-сервер, который поддерживает только подсистему sftp.
+// Пользователь видит свое дерево VirtualPath; вход по паролю или зарегистрированному ключу.
+type SFTPServer struct {
+	authService   *services.AuthService
+	sshKeyService *services.SSHKeyService
+	fileService   *services.FileService
+	config        *ssh.ServerConfig
+}
+
+func NewSFTPServer(authService *services.AuthService, sshKeyService *services.SSHKeyService, fileService *services.FileService, hostKeyPath string) (*SFTPServer, error) {
+	s := &SFTPServer{
+		authService:   authService,
+		sshKeyService: sshKeyService,
+		fileService:   fileService,
+	}
+
+	hostKey, err := loadOrCreateHostKey(hostKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s.config = &ssh.ServerConfig{
+		PasswordCallback:  s.passwordCallback,
+		PublicKeyCallback: s.publicKeyCallback,
+		MaxAuthTries:      3,
+		ServerVersion:     "SSH-2.0-0x40cloud",
+	}
+	s.config.AddHostKey(hostKey)
+
+	return s, nil
+}
+
+// loadOrCreateHostKey читает ключ хоста или генерирует ed25519 при первом запуске,
+// чтобы отпечаток сервера не менялся между перезапусками
+func loadOrCreateHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return ssh.ParsePrivateKey(data)
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read host key: %w", err)
+	}
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate host key: %w", err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode host key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create host key directory: %w", err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save host key: %w", err)
+	}
+
+	log.Printf("✓ Generated SFTP host key at %s", path)
+	return ssh.NewSignerFromKey(privateKey)
+}
+
+func (s *SFTPServer) passwordCallback(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	user, token, err := s.authService.AuthenticateBasic(context.Background(), conn.User(), string(password), remoteIP(conn.RemoteAddr()))
+	if err != nil {
+		log.Printf("SFTP password login failed for %q from %s", conn.User(), conn.RemoteAddr())
+		return nil, err
+	}
+	// SFTP-сессия не разделяет чтение и запись, поэтому токену нужны оба права
+	if token != nil && (!token.HasScope(models.TokenScopeRead) || !token.HasScope(models.TokenScopeWrite)) {
+		log.Printf("SFTP login for %q rejected: token %d lacks read/write scope", conn.User(), token.ID)
+		return nil, fmt.Errorf("token requires read and write scopes")
+	}
+	return sftpPermissions(user.ID), nil
+}
+
+func (s *SFTPServer) publicKeyCallback(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	user, err := s.sshKeyService.AuthenticateKey(conn.User(), key)
+	if err != nil {
+		return nil, err
+	}
+	return sftpPermissions(user.ID), nil
+}
+
+// remoteIP - адрес клиента без порта, как ClientIP в HTTP-обработчиках
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+func sftpPermissions(userID uint) *ssh.Permissions {
+	return &ssh.Permissions{
+		Extensions: map[string]string{"user_id": strconv.FormatUint(uint64(userID), 10)},
+	}
+}
+
+func (s *SFTPServer) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *SFTPServer) serveConn(netConn net.Conn) {
+	defer netConn.Close()
+
+	conn, channels, requests, err := ssh.NewServerConn(netConn, s.config)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(requests)
+
+	userID, err := strconv.ParseUint(conn.Permissions.Extensions["user_id"], 10, 32)
+	if err != nil {
+		return
+	}
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.serveSession(channel, channelRequests, uint(userID))
+	}
+}
+
+// serveSession разрешает только "subsystem sftp": shell, exec и pty отклоняются
+func (s *SFTPServer) serveSession(channel ssh.Channel, requests <-chan *ssh.Request, userID uint) {
+	defer channel.Close()
+
+	for req := range requests {
+		if req.Type != "subsystem" || string(req.Payload[min(4, len(req.Payload)):]) != "sftp" {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		go ssh.DiscardRequests(requests)
+
+		session := newSFTPSession(s.fileService.VirtualFS(userID), channel)
+		if err := session.serve(); err != nil {
+			log.Printf("SFTP session for user %d ended: %v", userID, err)
+		}
+
+		// exit-status 0, иначе некоторые клиенты считают сессию аварийной
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+		return
+	}
+}
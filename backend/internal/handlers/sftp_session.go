@@ -0,0 +1,650 @@
+package handlers
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"golang.org/x/net/webdav"
+)
+
+// Типы пакетов и коды ответа SFTP v3 (draft-ietf-secsh-filexfer-02)
+const (
+	sftpInit     = 1
+	sftpVersion  = 2
+	sftpOpen     = 3
+	sftpClose    = 4
+	sftpRead     = 5
+	sftpWrite    = 6
+	sftpLstat    = 7
+	sftpFstat    = 8
+	sftpSetstat  = 9
+	sftpFsetstat = 10
+	sftpOpendir  = 11
+	sftpReaddir  = 12
+	sftpRemove   = 13
+	sftpMkdir    = 14
+	sftpRmdir    = 15
+	sftpRealpath = 16
+	sftpStat     = 17
+	sftpRename   = 18
+	sftpReadlink = 19
+	sftpSymlink  = 20
+	sftpStatus   = 101
+	sftpHandle   = 102
+	sftpData     = 103
+	sftpName     = 104
+	sftpAttrs    = 105
+	sftpExtended = 200
+
+	sftpStatusOK               = 0
+	sftpStatusEOF              = 1
+	sftpStatusNoSuchFile       = 2
+	sftpStatusPermissionDenied = 3
+	sftpStatusFailure          = 4
+	sftpStatusBadMessage       = 5
+	sftpStatusOpUnsupported    = 8
+
+	sftpFlagRead   = 0x01
+	sftpFlagWrite  = 0x02
+	sftpFlagAppend = 0x04
+	sftpFlagCreate = 0x08
+	sftpFlagTrunc  = 0x10
+	sftpFlagExcl   = 0x20
+
+	sftpAttrSize        = 0x01
+	sftpAttrPermissions = 0x04
+	sftpAttrACModTime   = 0x08
+
+	sftpProtocolVersion = 3
+	sftpMaxPacket       = 1024 * 1024
+	sftpMaxReadSize     = 256 * 1024
+	sftpReaddirBatch    = 100
+)
+
+var (
+	errSFTPBadMessage        = errors.New("bad message")
+	errSFTPInvalidHandle     = errors.New("invalid handle")
+	errSFTPUnsupported       = errors.New("operation not supported")
+	errSFTPNonSequential     = errors.New("only sequential writes are supported")
+	errSFTPDirectoryNotEmpty = errors.New("directory not empty")
+	errSFTPIsDirectory       = errors.New("is a directory")
+	errSFTPNotDirectory      = errors.New("not a directory")
+)
+
+// sftpAborter реализуют файлы, открытые на запись в VirtualFS
+type sftpAborter interface {
+	Abort()
+}
+
+type sftpHandleState struct {
+	file    webdav.File
+	writing bool
+	offset  int64 // Для записи - сколько байт уже записано
+	entries []fs.FileInfo
+	listed  bool
+}
+
+// sftpSession обрабатывает запросы одного клиента последовательно.
+// Файловые операции выполняет VirtualFS, так же как для WebDAV.
+type sftpSession struct {
+	vfs        *services.VirtualFS
+	rw         io.ReadWriter
+	ctx        context.Context
+	handles    map[string]*sftpHandleState
+	nextHandle uint64
+}
+
+func newSFTPSession(vfs *services.VirtualFS, rw io.ReadWriter) *sftpSession {
+	return &sftpSession{
+		vfs:     vfs,
+		rw:      rw,
+		ctx:     context.Background(),
+		handles: make(map[string]*sftpHandleState),
+	}
+}
+
+func (s *sftpSession) serve() error {
+	defer s.closeAll()
+
+	for {
+		packetType, payload, err := s.readPacket()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if packetType == sftpInit {
+			resp := newSFTPPacket(sftpVersion)
+			resp.uint32(sftpProtocolVersion)
+			if err := s.writePacket(resp); err != nil {
+				return err
+			}
+			continue
+		}
+
+		req := &sftpReader{data: payload}
+		id := req.uint32()
+		if req.err != nil {
+			return errSFTPBadMessage
+		}
+
+		if err := s.writePacket(s.dispatch(packetType, id, req)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *sftpSession) readPacket() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(s.rw, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1 || length > sftpMaxPacket {
+		return 0, nil, errSFTPBadMessage
+	}
+
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(s.rw, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[4], payload, nil
+}
+
+func (s *sftpSession) writePacket(p *sftpPacket) error {
+	binary.BigEndian.PutUint32(p.buf[:4], uint32(len(p.buf)-4))
+	_, err := s.rw.Write(p.buf)
+	return err
+}
+
+func (s *sftpSession) dispatch(packetType byte, id uint32, req *sftpReader) *sftpPacket {
+	switch packetType {
+	case sftpOpen:
+		return s.open(id, req)
+	case sftpClose:
+		return s.closeHandle(id, req)
+	case sftpRead:
+		return s.read(id, req)
+	case sftpWrite:
+		return s.write(id, req)
+	case sftpStat, sftpLstat:
+		name := s.path(req.string())
+		if req.err != nil {
+			return statusPacket(id, errSFTPBadMessage)
+		}
+		info, err := s.vfs.Stat(s.ctx, name)
+		if err != nil {
+			return statusPacket(id, err)
+		}
+		return attrsPacket(id, info)
+	case sftpFstat:
+		handle, err := s.handle(req.string())
+		if err != nil {
+			return statusPacket(id, err)
+		}
+		info, err := handle.file.Stat()
+		if err != nil {
+			return statusPacket(id, err)
+		}
+		return attrsPacket(id, info)
+	case sftpSetstat, sftpFsetstat:
+		// Права и время модификации не хранятся - клиенты выставляют их после загрузки
+		return statusPacket(id, nil)
+	case sftpOpendir:
+		return s.opendir(id, req)
+	case sftpReaddir:
+		return s.readdir(id, req)
+	case sftpRemove:
+		return s.remove(id, req)
+	case sftpMkdir:
+		name := s.path(req.string())
+		if req.err != nil {
+			return statusPacket(id, errSFTPBadMessage)
+		}
+		return statusPacket(id, s.vfs.Mkdir(s.ctx, name, 0755))
+	case sftpRmdir:
+		return s.rmdir(id, req)
+	case sftpRealpath:
+		name := s.path(req.string())
+		if req.err != nil {
+			return statusPacket(id, errSFTPBadMessage)
+		}
+		resp := newSFTPPacket(sftpName)
+		resp.uint32(id)
+		resp.uint32(1)
+		resp.string(name)
+		resp.string(name)
+		resp.uint32(0)
+		return resp
+	case sftpRename:
+		oldName, newName := s.path(req.string()), s.path(req.string())
+		if req.err != nil {
+			return statusPacket(id, errSFTPBadMessage)
+		}
+		return statusPacket(id, s.vfs.Rename(s.ctx, oldName, newName))
+	case sftpExtended:
+		return s.extended(id, req)
+	case sftpReadlink, sftpSymlink:
+		return statusPacket(id, errSFTPUnsupported)
+	default:
+		return statusPacket(id, errSFTPUnsupported)
+	}
+}
+
+// path приводит путь клиента к абсолютному: домашний каталог - корень дерева пользователя
+func (s *sftpSession) path(name string) string {
+	return path.Join("/", name)
+}
+
+func (s *sftpSession) handle(name string) (*sftpHandleState, error) {
+	handle, ok := s.handles[name]
+	if !ok {
+		return nil, errSFTPInvalidHandle
+	}
+	return handle, nil
+}
+
+func (s *sftpSession) open(id uint32, req *sftpReader) *sftpPacket {
+	name := s.path(req.string())
+	pflags := req.uint32()
+	if req.err != nil {
+		return statusPacket(id, errSFTPBadMessage)
+	}
+
+	if pflags&sftpFlagAppend != 0 {
+		return statusPacket(id, errSFTPUnsupported)
+	}
+
+	flag := os.O_RDONLY
+	writing := pflags&sftpFlagWrite != 0
+	if writing {
+		flag = os.O_WRONLY
+		if pflags&sftpFlagRead != 0 {
+			flag = os.O_RDWR
+		}
+	}
+	if pflags&sftpFlagCreate != 0 {
+		flag |= os.O_CREATE
+	}
+	if pflags&sftpFlagTrunc != 0 {
+		flag |= os.O_TRUNC
+	}
+	if pflags&sftpFlagExcl != 0 {
+		flag |= os.O_EXCL
+	}
+
+	file, err := s.vfs.OpenFile(s.ctx, name, flag, 0644)
+	if err != nil {
+		return statusPacket(id, err)
+	}
+
+	if !writing {
+		info, err := file.Stat()
+		if err == nil && info.IsDir() {
+			file.Close()
+			return statusPacket(id, errSFTPIsDirectory)
+		}
+	}
+
+	return s.handlePacket(id, &sftpHandleState{file: file, writing: writing})
+}
+
+func (s *sftpSession) opendir(id uint32, req *sftpReader) *sftpPacket {
+	name := s.path(req.string())
+	if req.err != nil {
+		return statusPacket(id, errSFTPBadMessage)
+	}
+
+	file, err := s.vfs.OpenFile(s.ctx, name, os.O_RDONLY, 0)
+	if err != nil {
+		return statusPacket(id, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil || !info.IsDir() {
+		file.Close()
+		return statusPacket(id, errSFTPNotDirectory)
+	}
+
+	return s.handlePacket(id, &sftpHandleState{file: file})
+}
+
+func (s *sftpSession) handlePacket(id uint32, handle *sftpHandleState) *sftpPacket {
+	s.nextHandle++
+	name := strconv.FormatUint(s.nextHandle, 10)
+	s.handles[name] = handle
+
+	resp := newSFTPPacket(sftpHandle)
+	resp.uint32(id)
+	resp.string(name)
+	return resp
+}
+
+func (s *sftpSession) closeHandle(id uint32, req *sftpReader) *sftpPacket {
+	name := req.string()
+	handle, err := s.handle(name)
+	if err != nil {
+		return statusPacket(id, err)
+	}
+	delete(s.handles, name)
+
+	// Для записи Close сохраняет файл: здесь всплывают ошибки квоты и шифрования
+	return statusPacket(id, handle.file.Close())
+}
+
+func (s *sftpSession) read(id uint32, req *sftpReader) *sftpPacket {
+	handle, err := s.handle(req.string())
+	offset := req.uint64()
+	length := req.uint32()
+	if req.err != nil {
+		return statusPacket(id, errSFTPBadMessage)
+	}
+	if err != nil {
+		return statusPacket(id, err)
+	}
+	if handle.writing {
+		return statusPacket(id, os.ErrPermission)
+	}
+
+	if length > sftpMaxReadSize {
+		length = sftpMaxReadSize
+	}
+
+	if _, err := handle.file.Seek(int64(offset), io.SeekStart); err != nil {
+		return statusPacket(id, err)
+	}
+
+	buf := make([]byte, length)
+	n, err := io.ReadFull(handle.file, buf)
+	if n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+		return statusPacket(id, io.EOF)
+	}
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return statusPacket(id, err)
+	}
+
+	resp := newSFTPPacket(sftpData)
+	resp.uint32(id)
+	resp.bytes(buf[:n])
+	return resp
+}
+
+func (s *sftpSession) write(id uint32, req *sftpReader) *sftpPacket {
+	handle, err := s.handle(req.string())
+	offset := req.uint64()
+	data := req.bytes()
+	if req.err != nil {
+		return statusPacket(id, errSFTPBadMessage)
+	}
+	if err != nil {
+		return statusPacket(id, err)
+	}
+	if !handle.writing {
+		return statusPacket(id, os.ErrPermission)
+	}
+
+	// Запись идет потоком в шифрование, поэтому произвольные смещения невозможны
+	if int64(offset) != handle.offset {
+		return statusPacket(id, errSFTPNonSequential)
+	}
+
+	n, err := handle.file.Write(data)
+	handle.offset += int64(n)
+	return statusPacket(id, err)
+}
+
+func (s *sftpSession) readdir(id uint32, req *sftpReader) *sftpPacket {
+	handle, err := s.handle(req.string())
+	if req.err != nil {
+		return statusPacket(id, errSFTPBadMessage)
+	}
+	if err != nil {
+		return statusPacket(id, err)
+	}
+
+	if !handle.listed {
+		entries, err := handle.file.Readdir(0)
+		if err != nil {
+			return statusPacket(id, err)
+		}
+		handle.entries = entries
+		handle.listed = true
+	}
+
+	if len(handle.entries) == 0 {
+		return statusPacket(id, io.EOF)
+	}
+
+	batch := handle.entries
+	if len(batch) > sftpReaddirBatch {
+		batch = batch[:sftpReaddirBatch]
+	}
+	handle.entries = handle.entries[len(batch):]
+
+	resp := newSFTPPacket(sftpName)
+	resp.uint32(id)
+	resp.uint32(uint32(len(batch)))
+	for _, info := range batch {
+		resp.string(info.Name())
+		resp.string(longName(info))
+		resp.attrs(info)
+	}
+	return resp
+}
+
+func (s *sftpSession) remove(id uint32, req *sftpReader) *sftpPacket {
+	name := s.path(req.string())
+	if req.err != nil {
+		return statusPacket(id, errSFTPBadMessage)
+	}
+
+	info, err := s.vfs.Stat(s.ctx, name)
+	if err != nil {
+		return statusPacket(id, err)
+	}
+	if info.IsDir() {
+		return statusPacket(id, errSFTPIsDirectory)
+	}
+	return statusPacket(id, s.vfs.RemoveAll(s.ctx, name))
+}
+
+func (s *sftpSession) rmdir(id uint32, req *sftpReader) *sftpPacket {
+	name := s.path(req.string())
+	if req.err != nil {
+		return statusPacket(id, errSFTPBadMessage)
+	}
+
+	dir, err := s.vfs.OpenFile(s.ctx, name, os.O_RDONLY, 0)
+	if err != nil {
+		return statusPacket(id, err)
+	}
+	defer dir.Close()
+
+	info, err := dir.Stat()
+	if err != nil {
+		return statusPacket(id, err)
+	}
+	if !info.IsDir() {
+		return statusPacket(id, errSFTPNotDirectory)
+	}
+
+	entries, err := dir.Readdir(0)
+	if err != nil {
+		return statusPacket(id, err)
+	}
+	if len(entries) > 0 {
+		return statusPacket(id, errSFTPDirectoryNotEmpty)
+	}
+	return statusPacket(id, s.vfs.RemoveAll(s.ctx, name))
+}
+
+// extended поддерживает posix-rename@openssh.com - переименование с заменой существующего файла
+func (s *sftpSession) extended(id uint32, req *sftpReader) *sftpPacket {
+	request := req.string()
+	if request != "posix-rename@openssh.com" {
+		return statusPacket(id, errSFTPUnsupported)
+	}
+
+	oldName, newName := s.path(req.string()), s.path(req.string())
+	if req.err != nil {
+		return statusPacket(id, errSFTPBadMessage)
+	}
+
+	if info, err := s.vfs.Stat(s.ctx, newName); err == nil {
+		if info.IsDir() {
+			return statusPacket(id, errSFTPIsDirectory)
+		}
+		if err := s.vfs.RemoveAll(s.ctx, newName); err != nil {
+			return statusPacket(id, err)
+		}
+	}
+	return statusPacket(id, s.vfs.Rename(s.ctx, oldName, newName))
+}
+
+// closeAll закрывает хендлы при завершении сессии. Незакрытые клиентом записи
+// отменяются: после обрыва соединения не должен появиться обрезанный файл.
+func (s *sftpSession) closeAll() {
+	for name, handle := range s.handles {
+		if aborter, ok := handle.file.(sftpAborter); ok && handle.writing {
+			aborter.Abort()
+		} else {
+			handle.file.Close()
+		}
+		delete(s.handles, name)
+	}
+}
+
+func statusPacket(id uint32, err error) *sftpPacket {
+	code := uint32(sftpStatusOK)
+	message := "OK"
+
+	switch {
+	case err == nil:
+	case errors.Is(err, io.EOF):
+		code, message = sftpStatusEOF, "EOF"
+	case errors.Is(err, os.ErrNotExist):
+		code, message = sftpStatusNoSuchFile, "No such file"
+	case errors.Is(err, os.ErrPermission):
+		code, message = sftpStatusPermissionDenied, "Permission denied"
+	case errors.Is(err, errSFTPBadMessage):
+		code, message = sftpStatusBadMessage, err.Error()
+	case errors.Is(err, errSFTPUnsupported):
+		code, message = sftpStatusOpUnsupported, err.Error()
+	case errors.Is(err, services.ErrQuotaExceeded):
+		code, message = sftpStatusFailure, "Storage quota exceeded"
+	default:
+		code, message = sftpStatusFailure, err.Error()
+	}
+
+	resp := newSFTPPacket(sftpStatus)
+	resp.uint32(id)
+	resp.uint32(code)
+	resp.string(message)
+	resp.string("en")
+	return resp
+}
+
+func attrsPacket(id uint32, info fs.FileInfo) *sftpPacket {
+	resp := newSFTPPacket(sftpAttrs)
+	resp.uint32(id)
+	resp.attrs(info)
+	return resp
+}
+
+// longName - строка в формате ls -l, которую показывают клиенты в листинге
+func longName(info fs.FileInfo) string {
+	return fmt.Sprintf("%s 1 owner owner %12d %s %s",
+		info.Mode().String(), info.Size(), info.ModTime().Format("Jan _2 15:04"), info.Name())
+}
+
+type sftpPacket struct {
+	buf []byte
+}
+
+func newSFTPPacket(packetType byte) *sftpPacket {
+	// Первые 4 байта - длина, заполняется в writePacket
+	return &sftpPacket{buf: []byte{0, 0, 0, 0, packetType}}
+}
+
+func (p *sftpPacket) uint32(v uint32) {
+	p.buf = binary.BigEndian.AppendUint32(p.buf, v)
+}
+
+func (p *sftpPacket) uint64(v uint64) {
+	p.buf = binary.BigEndian.AppendUint64(p.buf, v)
+}
+
+func (p *sftpPacket) bytes(v []byte) {
+	p.uint32(uint32(len(v)))
+	p.buf = append(p.buf, v...)
+}
+
+func (p *sftpPacket) string(v string) {
+	p.bytes([]byte(v))
+}
+
+func (p *sftpPacket) attrs(info fs.FileInfo) {
+	mode := uint32(0100644)
+	if info.IsDir() {
+		mode = 040755
+	}
+	mtime := uint32(info.ModTime().Unix())
+
+	p.uint32(sftpAttrSize | sftpAttrPermissions | sftpAttrACModTime)
+	p.uint64(uint64(info.Size()))
+	p.uint32(mode)
+	p.uint32(mtime)
+	p.uint32(mtime)
+}
+
+// sftpReader разбирает поля запроса; первая ошибка запоминается, последующие чтения возвращают нули
+type sftpReader struct {
+	data []byte
+	err  error
+}
+
+func (r *sftpReader) uint32() uint32 {
+	if r.err != nil || len(r.data) < 4 {
+		r.err = errSFTPBadMessage
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.data)
+	r.data = r.data[4:]
+	return v
+}
+
+func (r *sftpReader) uint64() uint64 {
+	if r.err != nil || len(r.data) < 8 {
+		r.err = errSFTPBadMessage
+		return 0
+	}
+	v := binary.BigEndian.Uint64(r.data)
+	r.data = r.data[8:]
+	return v
+}
+
+func (r *sftpReader) bytes() []byte {
+	length := r.uint32()
+	if r.err != nil || uint32(len(r.data)) < length {
+		r.err = errSFTPBadMessage
+		return nil
+	}
+	v := r.data[:length]
+	r.data = r.data[length:]
+	return v
+}
+
+func (r *sftpReader) string() string {
+	return string(r.bytes())
+}
@@ -1,16 +1,22 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/bhop_dynasty/0x40_cloud/internal/models"
 	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/bhop_dynasty/0x40_cloud/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+// Cookie с подтверждением пароля защищенной ссылки
+const shareUnlockCookie = "share_unlock"
+
 type ShareHandler struct {
 	service *services.ShareService
 }
@@ -39,7 +45,7 @@ func (h *ShareHandler) CreateShare(c *gin.Context) {
 		return
 	}
 
-	share, err := h.service.CreateShare(userID, fileID, req.Limit, req.ExpiresAt)
+	share, err := h.service.CreateShare(userID, fileID, &req)
 	if err != nil {
 		fmt.Printf("CreateShare Error: %v\n", err)
 		if err.Error() == "unauthorized" {
@@ -57,23 +63,179 @@ func (h *ShareHandler) CreateShare(c *gin.Context) {
 	c.JSON(http.StatusCreated, share)
 }
 
+// CreateFolderShare создает публичную ссылку на папку
+func (h *ShareHandler) CreateFolderShare(c *gin.Context) {
+	userIDRaw, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDRaw.(uint)
+
+	var req models.CreateFolderShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	folderPath, err := utils.SanitizePath(req.Path)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
+		return
+	}
+
+	share, err := h.service.CreateFolderShare(userID, folderPath, &req.CreateShareRequest)
+	if err != nil {
+		if errors.Is(err, services.ErrShareInvalidTarget) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, share)
+}
+
+// CreateFileRequest создает ссылку для загрузки файлов в папку посторонними
+func (h *ShareHandler) CreateFileRequest(c *gin.Context) {
+	userIDRaw, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := userIDRaw.(uint)
+
+	var req models.CreateFileRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	folderPath, err := utils.SanitizePath(req.Path)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
+		return
+	}
+
+	share, err := h.service.CreateFileRequest(userID, folderPath, &req)
+	if err != nil {
+		if errors.Is(err, services.ErrShareInvalidTarget) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, share)
+}
+
+// authorizeShare проверяет ссылку и cookie разблокировки; при ошибке отвечает сам
+func (h *ShareHandler) authorizeShare(c *gin.Context) (*models.SharedFile, bool) {
+	unlock, _ := c.Cookie(shareUnlockCookie)
+	share, err := h.service.AuthorizeShare(c.Param("token"), unlock)
+	if err != nil {
+		if errors.Is(err, services.ErrSharePasswordRequired) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "password_required": true})
+			return nil, false
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	return share, true
+}
+
 // GetSharedFile godoc
 func (h *ShareHandler) GetSharedFile(c *gin.Context) {
+	share, ok := h.authorizeShare(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, share.ToPublicResponse())
+}
+
+// UnlockShare проверяет пароль ссылки и ставит cookie, действующую ShareUnlockTTL.
+// Cookie ограничена путем ссылки, поэтому разблокировки разных ссылок не пересекаются.
+func (h *ShareHandler) UnlockShare(c *gin.Context) {
+	var req models.UnlockShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	token := c.Param("token")
-	share, err := h.service.GetSharedFile(token)
+	value, err := h.service.UnlockShare(token, req.Password)
 	if err != nil {
+		if errors.Is(err, services.ErrShareInvalidPassword) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, share)
+
+	if value != "" {
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     shareUnlockCookie,
+			Value:    value,
+			Path:     "/api/public/share/" + token,
+			MaxAge:   int(services.ShareUnlockTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share unlocked"})
+}
+
+// beginDownload занимает скачивание в лимите ссылки; при ошибке отвечает сам
+func (h *ShareHandler) beginDownload(c *gin.Context, share *models.SharedFile) (*services.ShareDownload, bool) {
+	download, err := h.service.BeginDownload(share, services.DownloadClient{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrShareLimitReached) || errors.Is(err, services.ErrShareExpired) {
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		log.Printf("Error reserving share download: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start download"})
+		return nil, false
+	}
+	return download, true
 }
 
 // DownloadSharedFile godoc
+// Для ссылки на папку отдает всю папку zip-архивом.
 func (h *ShareHandler) DownloadSharedFile(c *gin.Context) {
-	token := c.Param("token")
-	share, err := h.service.GetSharedFile(token)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	share, ok := h.authorizeShare(c)
+	if !ok {
+		return
+	}
+
+	if share.Type == models.ShareTypeRequest {
+		c.JSON(http.StatusForbidden, gin.H{"error": services.ErrShareWrongType.Error()})
+		return
+	}
+
+	download, ok := h.beginDownload(c, share)
+	if !ok {
+		return
+	}
+
+	if share.Type == models.ShareTypeFolder {
+		c.Header("Content-Description", "File Transfer")
+		c.Header("Content-Transfer-Encoding", "binary")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.zip\"", share.ToPublicResponse().Name))
+		c.Header("Content-Type", "application/zip")
+
+		if err := h.service.DownloadSharedFolderZip(c.Request.Context(), download, c.Writer); err != nil {
+			log.Printf("Error downloading shared folder: %v", err)
+		}
 		return
 	}
 
@@ -84,11 +246,121 @@ func (h *ShareHandler) DownloadSharedFile(c *gin.Context) {
 	c.Header("Content-Type", share.File.MimeType)
 	c.Header("Content-Length", fmt.Sprintf("%d", share.File.Size))
 
-	if _, err := h.service.DownloadSharedFile(token, c.Writer); err != nil {
+	if err := h.service.DownloadSharedFile(download, c.Writer); err != nil {
 		fmt.Printf("Error downloading shared file: %v\n", err)
 	}
 }
 
+// ListSharedFolder отдает содержимое расшаренной папки; ?path= - подпапка внутри нее
+func (h *ShareHandler) ListSharedFolder(c *gin.Context) {
+	share, ok := h.authorizeShare(c)
+	if !ok {
+		return
+	}
+
+	entries, err := h.service.ListSharedFolder(share, c.Query("path"))
+	if err != nil {
+		if errors.Is(err, services.ErrShareWrongType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error listing shared folder: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list folder"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// DownloadSharedFolderFile скачивает один файл из расшаренной папки
+func (h *ShareHandler) DownloadSharedFolderFile(c *gin.Context) {
+	share, ok := h.authorizeShare(c)
+	if !ok {
+		return
+	}
+
+	fileID, err := uuid.Parse(c.Param("fileId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		return
+	}
+
+	file, err := h.service.GetSharedFolderFile(share, fileID)
+	if err != nil {
+		if errors.Is(err, services.ErrShareWrongType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	download, ok := h.beginDownload(c, share)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Transfer-Encoding", "binary")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", file.OriginalName))
+	c.Header("Content-Type", file.MimeType)
+	c.Header("Content-Length", fmt.Sprintf("%d", file.Size))
+
+	if err := h.service.DownloadSharedFolderFile(download, file, c.Writer); err != nil {
+		log.Printf("Error downloading shared folder file: %v", err)
+	}
+}
+
+// UploadToFileRequest принимает файл от посетителя ссылки-запроса.
+// В ответе нет id и путей: посетитель не должен ничего знать о хранилище владельца.
+func (h *ShareHandler) UploadToFileRequest(c *gin.Context) {
+	share, ok := h.authorizeShare(c)
+	if !ok {
+		return
+	}
+	if share.Type != models.ShareTypeRequest {
+		c.JSON(http.StatusForbidden, gin.H{"error": services.ErrShareWrongType.Error()})
+		return
+	}
+
+	// Не даем разобрать multipart больше лимита ссылки (с запасом на заголовки формы)
+	if share.MaxFileSize != nil {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, *share.MaxFileSize+1<<20)
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no file provided"})
+		return
+	}
+
+	if _, err := h.service.UploadToFileRequest(share, fileHeader); err != nil {
+		switch {
+		case errors.Is(err, services.ErrFileTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file too large"})
+		case errors.Is(err, services.ErrShareLimitReached), errors.Is(err, services.ErrShareExpired):
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrQuotaExceeded):
+			c.JSON(http.StatusInsufficientStorage, gin.H{"error": "owner's storage is full"})
+		default:
+			log.Printf("Error uploading to file request: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file"})
+		}
+		return
+	}
+
+	// Только то, что прислал сам посетитель
+	c.JSON(http.StatusCreated, gin.H{
+		"name": fileHeader.Filename,
+		"size": fileHeader.Size,
+	})
+}
+
 // RevokeShare godoc
 func (h *ShareHandler) RevokeShare(c *gin.Context) {
 	userIDRaw, exists := c.Get("user_id")
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type SyncHandler struct {
+	syncService *services.SyncService
+}
+
+func NewSyncHandler(syncService *services.SyncService) *SyncHandler {
+	return &SyncHandler{syncService: syncService}
+}
+
+// GetChanges отдает журнал изменений после курсора.
+// Если журнал уже сжат, отвечает 410 с reset=true - клиенту нужен полный /sync/snapshot.
+func (h *SyncHandler) GetChanges(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	limit := 500
+	if limitParam := c.Query("limit"); limitParam != "" {
+		if parsedLimit, err := strconv.Atoi(limitParam); err == nil && parsedLimit > 0 && parsedLimit <= 5000 {
+			limit = parsedLimit
+		}
+	}
+
+	resp, err := h.syncService.GetChanges(userID.(uint), c.Query("cursor"), limit)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if resp.Reset {
+		c.JSON(http.StatusGone, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *SyncHandler) GetSnapshot(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	resp, err := h.syncService.GetSnapshot(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
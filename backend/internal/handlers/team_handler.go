@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/bhop_dynasty/0x40_cloud/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// TeamHandler - команды и их пространства. Операции над отдельными файлами команды
+// (скачивание, переименование, удаление) идут через обычные /files/:id.
+type TeamHandler struct {
+	teamService *services.TeamService
+	fileService *services.FileService
+}
+
+func NewTeamHandler(teamService *services.TeamService, fileService *services.FileService) *TeamHandler {
+	return &TeamHandler{teamService: teamService, fileService: fileService}
+}
+
+// teamParams разбирает :id команды и пользователя; при ошибке отвечает сам
+func teamParams(c *gin.Context) (teamID, userID uint, ok bool) {
+	userIDRaw, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return 0, 0, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return 0, 0, false
+	}
+	return uint(id), userIDRaw.(uint), true
+}
+
+func respondTeamError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrTeamNotFound), errors.Is(err, services.ErrTeamUserNotFound),
+		errors.Is(err, services.ErrTeamMemberNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTeamForbidden), errors.Is(err, services.ErrAccessDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTeamLastOwner):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrQuotaExceeded):
+		c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrFileTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (h *TeamHandler) ListTeams(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	teams, err := h.teamService.ListTeams(userID.(uint))
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, teams)
+}
+
+func (h *TeamHandler) CreateTeam(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req models.CreateTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	team, err := h.teamService.CreateTeam(userID.(uint), req.Name)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, team)
+}
+
+func (h *TeamHandler) GetTeam(c *gin.Context) {
+	teamID, userID, ok := teamParams(c)
+	if !ok {
+		return
+	}
+
+	team, err := h.teamService.GetTeam(teamID, userID)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, team)
+}
+
+func (h *TeamHandler) AddMember(c *gin.Context) {
+	teamID, userID, ok := teamParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.AddTeamMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	member, err := h.teamService.AddMember(teamID, userID, &req)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+func (h *TeamHandler) UpdateMember(c *gin.Context) {
+	teamID, userID, ok := teamParams(c)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.UpdateTeamMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.teamService.UpdateMember(teamID, userID, uint(memberID), req.Role); err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member updated"})
+}
+
+// RemoveMember исключает участника; свой id - выход из команды
+func (h *TeamHandler) RemoveMember(c *gin.Context) {
+	teamID, userID, ok := teamParams(c)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.teamService.RemoveMember(teamID, userID, uint(memberID)); err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+// GetFiles - содержимое папки пространства команды (?path=)
+func (h *TeamHandler) GetFiles(c *gin.Context) {
+	teamID, userID, ok := teamParams(c)
+	if !ok {
+		return
+	}
+
+	sanitizedPath, err := utils.SanitizePath(c.Query("path"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
+		return
+	}
+
+	files, err := h.fileService.GetTeamFilesByPath(teamID, userID, sanitizedPath)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"files": files})
+}
+
+func (h *TeamHandler) SearchFiles(c *gin.Context) {
+	teamID, userID, ok := teamParams(c)
+	if !ok {
+		return
+	}
+
+	limit := 20
+	if limitParam := c.Query("limit"); limitParam != "" {
+		if parsedLimit, err := strconv.Atoi(limitParam); err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	files, err := h.fileService.SearchTeamFiles(teamID, userID, c.Query("q"), limit)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"files": files})
+}
+
+func (h *TeamHandler) Upload(c *gin.Context) {
+	teamID, userID, ok := teamParams(c)
+	if !ok {
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no file provided"})
+		return
+	}
+
+	virtualPath, err := utils.SanitizePath(c.PostForm("virtual_path"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
+		return
+	}
+
+	uploadedFile, err := h.fileService.UploadTeamFile(teamID, userID, file, virtualPath, c.PostForm("folder_name"))
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, uploadedFile)
+}
+
+func (h *TeamHandler) CreateFolder(c *gin.Context) {
+	teamID, userID, ok := teamParams(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Path string `json:"path"`
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	if strings.Contains(req.Name, "/") || strings.Contains(req.Name, "\\") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder name"})
+		return
+	}
+
+	sanitizedPath, err := utils.SanitizePath(req.Path)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
+		return
+	}
+
+	folder, err := h.fileService.CreateTeamFolder(teamID, userID, sanitizedPath, req.Name)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"folder": folder})
+}
+
+// GetTrash - удаленные файлы команды; восстановление через POST /files/:id/restore
+func (h *TeamHandler) GetTrash(c *gin.Context) {
+	teamID, userID, ok := teamParams(c)
+	if !ok {
+		return
+	}
+
+	files, err := h.fileService.GetTeamDeletedFiles(teamID, userID)
+	if err != nil {
+		respondTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"files": files})
+}
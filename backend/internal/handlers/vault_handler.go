@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// VaultHandler - E2E-хранилища. Сервер принимает и отдает только шифротекст,
+// поэтому обычные /files/:id с файлами хранилищ не работают (404), а
+// список недоступных функций возвращается в GET /vaults.
+type VaultHandler struct {
+	fileService *services.FileService
+}
+
+func NewVaultHandler(fileService *services.FileService) *VaultHandler {
+	return &VaultHandler{fileService: fileService}
+}
+
+// vaultParams разбирает :id хранилища и пользователя; при ошибке отвечает сам
+func vaultParams(c *gin.Context) (vaultID, userID uint, ok bool) {
+	userIDRaw, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return 0, 0, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vault ID"})
+		return 0, 0, false
+	}
+	return uint(id), userIDRaw.(uint), true
+}
+
+// vaultFileParams дополнительно разбирает :fileId
+func vaultFileParams(c *gin.Context) (vaultID, userID uint, fileID uuid.UUID, ok bool) {
+	vaultID, userID, ok = vaultParams(c)
+	if !ok {
+		return 0, 0, uuid.Nil, false
+	}
+
+	fileID, err := uuid.Parse(c.Param("fileId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return 0, 0, uuid.Nil, false
+	}
+	return vaultID, userID, fileID, true
+}
+
+func respondVaultError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrVaultNotFound), errors.Is(err, services.ErrVaultFileNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrVaultExists), errors.Is(err, services.ErrTooManyVaults),
+		errors.Is(err, services.ErrVaultKeyConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrVaultIncomplete):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrQuotaExceeded):
+		c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrFileTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (h *VaultHandler) ListVaults(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	vaults, err := h.fileService.ListVaults(userID.(uint))
+	if err != nil {
+		respondVaultError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, vaults)
+}
+
+// CreateVault сохраняет ключ хранилища, уже обернутый на клиенте
+func (h *VaultHandler) CreateVault(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req models.CreateVaultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	vault, err := h.fileService.CreateVault(userID.(uint), &req)
+	if err != nil {
+		respondVaultError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, vault)
+}
+
+func (h *VaultHandler) GetVault(c *gin.Context) {
+	vaultID, userID, ok := vaultParams(c)
+	if !ok {
+		return
+	}
+
+	vault, err := h.fileService.GetVault(userID, vaultID)
+	if err != nil {
+		respondVaultError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, vault)
+}
+
+func (h *VaultHandler) UpdateVaultKey(c *gin.Context) {
+	vaultID, userID, ok := vaultParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateVaultKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	vault, err := h.fileService.UpdateVaultKey(userID, vaultID, &req)
+	if err != nil {
+		respondVaultError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, vault)
+}
+
+func (h *VaultHandler) DeleteVault(c *gin.Context) {
+	vaultID, userID, ok := vaultParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.fileService.DeleteVault(userID, vaultID); err != nil {
+		respondVaultError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vault deleted"})
+}
+
+func (h *VaultHandler) ListFiles(c *gin.Context) {
+	vaultID, userID, ok := vaultParams(c)
+	if !ok {
+		return
+	}
+
+	files, err := h.fileService.ListVaultFiles(userID, vaultID)
+	if err != nil {
+		respondVaultError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"files": files})
+}
+
+// Upload принимает multipart-форму: file - шифротекст, encrypted_name и
+// wrapped_key - зашифрованные клиентом имя и ключ файла. Content-Type части
+// игнорируется, сервер хранит все как application/octet-stream.
+func (h *VaultHandler) Upload(c *gin.Context) {
+	vaultID, userID, ok := vaultParams(c)
+	if !ok {
+		return
+	}
+
+	var meta models.VaultFileMetadata
+	if err := c.ShouldBind(&meta); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no file provided"})
+		return
+	}
+	src, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
+		return
+	}
+	defer src.Close()
+
+	file, err := h.fileService.UploadVaultFile(userID, vaultID, src, fileHeader.Size, &meta)
+	if err != nil {
+		respondVaultError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, file)
+}
+
+// DownloadFile отдает шифротекст без расшифровки и без угадывания типа:
+// браузер не должен пытаться показать его как страницу или картинку
+func (h *VaultHandler) DownloadFile(c *gin.Context) {
+	vaultID, userID, fileID, ok := vaultFileParams(c)
+	if !ok {
+		return
+	}
+
+	file, blob, err := h.fileService.OpenVaultFile(userID, vaultID, fileID)
+	if err != nil {
+		respondVaultError(c, err)
+		return
+	}
+	defer blob.Close()
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.bin", file.ID))
+	c.Header("ETag", `"`+file.SHA256+`"`)
+	http.ServeContent(c.Writer, c.Request, "", file.UpdatedAt, blob)
+}
+
+func (h *VaultHandler) UpdateFile(c *gin.Context) {
+	vaultID, userID, fileID, ok := vaultFileParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateVaultFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	file, err := h.fileService.UpdateVaultFile(userID, vaultID, fileID, &req)
+	if err != nil {
+		respondVaultError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, file)
+}
+
+// DeleteFile удаляет файл навсегда: у хранилищ нет корзины
+func (h *VaultHandler) DeleteFile(c *gin.Context) {
+	vaultID, userID, fileID, ok := vaultFileParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.fileService.DeleteVaultFile(userID, vaultID, fileID); err != nil {
+		respondVaultError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "File deleted"})
+}
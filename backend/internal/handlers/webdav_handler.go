@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/webdav"
+)
+
+const (
+	WebDAVPrefix = "/dav"
+
+	// bcrypt на каждый запрос WebDAV-клиента слишком дорог, поэтому успешный вход кешируется
+	davCredentialTTL = 5 * time.Minute
+)
+
+// WebDAVMethods - методы, которые нужно зарегистрировать в роутере для WebDAV
+var WebDAVMethods = []string{
+	"OPTIONS", "GET", "HEAD", "PUT", "DELETE",
+	"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK",
+}
+
+// davCredential - успешная проверка пароля. Stamp - services.CredentialStamp на
+// момент проверки: после смены пароля или включения 2FA запись перестает подходить.
+type davCredential struct {
+	userID    uint
+	stamp     string
+	expiresAt time.Time
+}
+
+type WebDAVHandler struct {
+	authService *services.AuthService
+	fileService *services.FileService
+
+	mu          sync.Mutex
+	locks       map[uint]webdav.LockSystem
+	credentials map[string]davCredential
+}
+
+func NewWebDAVHandler(authService *services.AuthService, fileService *services.FileService) *WebDAVHandler {
+	return &WebDAVHandler{
+		authService: authService,
+		fileService: fileService,
+		locks:       make(map[uint]webdav.LockSystem),
+		credentials: make(map[string]davCredential),
+	}
+}
+
+// ServeHTTP обслуживает WebDAV поверх VirtualPath пользователя с HTTP Basic авторизацией
+func (h *WebDAVHandler) ServeHTTP(c *gin.Context) {
+	login, password, ok := c.Request.BasicAuth()
+	if !ok {
+		h.unauthorized(c)
+		return
+	}
+
+	userID, token, err := h.authenticate(c, login, password)
+	if err != nil {
+		var tooMany *services.TooManyAttemptsError
+		if errors.As(err, &tooMany) {
+			respondTooManyAttempts(c, tooMany)
+			return
+		}
+		h.unauthorized(c)
+		return
+	}
+	if token != nil && !token.HasScope(davRequiredScope(c.Request.Method)) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	handler := &webdav.Handler{
+		Prefix:     WebDAVPrefix,
+		FileSystem: h.fileService.VirtualFS(userID),
+		LockSystem: h.lockSystem(userID),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				log.Printf("WebDAV %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	handler.ServeHTTP(c.Writer, c.Request)
+}
+
+func (h *WebDAVHandler) unauthorized(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Basic realm="0x40 Cloud", charset="UTF-8"`)
+	c.AbortWithStatus(http.StatusUnauthorized)
+}
+
+// davRequiredScope - scope личного токена, нужный для метода WebDAV
+func davRequiredScope(method string) string {
+	switch method {
+	case "OPTIONS", "GET", "HEAD", "PROPFIND":
+		return models.TokenScopeRead
+	}
+	return models.TokenScopeWrite
+}
+
+// authenticate принимает пароль или личный токен. Токены не кешируются: их
+// проверка дешевая, а отзыв должен действовать сразу.
+func (h *WebDAVHandler) authenticate(c *gin.Context, login, password string) (uint, *models.PersonalToken, error) {
+	if strings.HasPrefix(password, services.PersonalTokenPrefix) {
+		user, token, err := h.authService.AuthenticateBasic(c.Request.Context(), login, password, c.ClientIP())
+		if err != nil {
+			return 0, nil, err
+		}
+		return user.ID, token, nil
+	}
+
+	sum := sha256.Sum256([]byte(login + "\x00" + password))
+	key := hex.EncodeToString(sum[:])
+
+	h.mu.Lock()
+	cached, ok := h.credentials[key]
+	h.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		// Дешевая проверка вместо bcrypt: аккаунт не отключен и не удален,
+		// пароль и 2FA с момента проверки не менялись
+		user, err := h.authService.GetActiveUser(cached.userID)
+		if err == nil && services.CredentialStamp(user) == cached.stamp {
+			return user.ID, nil, nil
+		}
+		h.mu.Lock()
+		delete(h.credentials, key)
+		h.mu.Unlock()
+	}
+
+	user, err := h.authService.Authenticate(c.Request.Context(), login, password, c.ClientIP())
+	if err != nil {
+		return 0, nil, err
+	}
+
+	h.mu.Lock()
+	now := time.Now()
+	for k, v := range h.credentials {
+		if now.After(v.expiresAt) {
+			delete(h.credentials, k)
+		}
+	}
+	h.credentials[key] = davCredential{
+		userID:    user.ID,
+		stamp:     services.CredentialStamp(user),
+		expiresAt: now.Add(davCredentialTTL),
+	}
+	h.mu.Unlock()
+
+	return user.ID, nil, nil
+}
+
+// ForgetUser удаляет закешированные пароли пользователя. Вызывается при отзыве
+// его сессий (AuthService.OnSessionsRevoked).
+func (h *WebDAVHandler) ForgetUser(userID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for k, v := range h.credentials {
+		if v.userID == userID {
+			delete(h.credentials, k)
+		}
+	}
+}
+
+// lockSystem - блокировки хранятся отдельно для каждого пользователя, т.к. пути пересекаются
+func (h *WebDAVHandler) lockSystem(userID uint) webdav.LockSystem {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ls, ok := h.locks[userID]
+	if !ok {
+		ls = webdav.NewMemLS()
+		h.locks[userID] = ls
+	}
+	return ls
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminMiddleware пропускает только администраторов. Роль читается из БД на
+// каждый запрос, поэтому снятие роли действует сразу, без перевыпуска токена.
+// Личному токену нужен scope admin. Должен стоять после AuthMiddleware.
+func AdminMiddleware(authService *services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
+			c.Abort()
+			return
+		}
+
+		if !HasTokenScope(c, models.TokenScopeAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "token does not have the required scope", "required_scope": models.TokenScopeAdmin})
+			c.Abort()
+			return
+		}
+
+		user, err := authService.GetUserByID(userID.(uint))
+		if err != nil || !user.IsAdmin() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
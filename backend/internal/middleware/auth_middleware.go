@@ -12,6 +12,11 @@ func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token, err := c.Cookie("auth_token")
 		
+		// Скрипт с токеном в заголовке мог получить и cookie - токен важнее
+		if authHeader := c.GetHeader("Authorization"); strings.HasPrefix(authHeader, "Bearer "+services.PersonalTokenPrefix) {
+			token, err = strings.TrimPrefix(authHeader, "Bearer "), nil
+		}
+
 		if err != nil || token == "" {
 			authHeader := c.GetHeader("Authorization")
 			if authHeader == "" {
@@ -30,14 +35,42 @@ func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 			token = parts[1]
 		}
 
-		claims, err := authService.ValidateToken(token)
+		// Личный токен доступа: права ограничены его scopes (см. TokenScopeMiddleware)
+		if strings.HasPrefix(token, services.PersonalTokenPrefix) {
+			user, personalToken, err := authService.AuthenticatePersonalToken(token, c.ClientIP())
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+				c.Abort()
+				return
+			}
+
+			c.Set("user_id", user.ID)
+			c.Set("email", user.Email)
+			c.Set("username", user.Username)
+			c.Set("token_id", personalToken.ID)
+			c.Set("token_scopes", personalToken.ScopeList())
+
+			c.Next()
+			return
+		}
+
+		claims, err := authService.ValidateToken(c.Request.Context(), token, c.ClientIP())
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
 			c.Abort()
 			return
 		}
 
-		c.Set("user_id", uint(claims["user_id"].(float64)))
+		// Токен остается валидным до истечения, поэтому отключение аккаунта проверяется здесь
+		userID := uint(claims["user_id"].(float64))
+		if _, err := authService.GetActiveUser(userID); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "account is disabled or deleted"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", userID)
+		c.Set("session_id", claims["sid"].(string))
 		c.Set("email", claims["email"].(string))
 		c.Set("username", claims["username"].(string))
 
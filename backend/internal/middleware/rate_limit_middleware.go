@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit ограничивает число запросов с одного IP: не больше limit за window.
+// name разделяет счетчики, так что у входа и публичных ссылок лимиты свои.
+// limit <= 0 отключает ограничение.
+func RateLimit(limiter *services.RateLimiter, name string, limit int, window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := limiter.Allow(c.Request.Context(), name+":"+c.ClientIP(), limit, window)
+
+		var tooMany *services.TooManyAttemptsError
+		if errors.As(err, &tooMany) {
+			seconds := int(math.Ceil(tooMany.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":       "too many requests",
+				"retry_after": seconds,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// TokenScopeRules - какие маршруты требуют особых прав личного токена.
+// Пути сравниваются с c.FullPath(), то есть с шаблоном маршрута.
+type TokenScopeRules struct {
+	Share       []string // Маршруты ссылок и доступов: нужен scope share
+	SessionOnly []string // Префиксы маршрутов, закрытых для токенов (сессии, 2FA, ключи, сами токены)
+}
+
+// TokenScopeMiddleware проверяет права личного токена: чтение - scope read,
+// изменения - write, ссылки - share. Запросы из сессии браузера проходят
+// без проверки. Должен стоять после AuthMiddleware.
+func TokenScopeMiddleware(rules TokenScopeRules) gin.HandlerFunc {
+	share := make(map[string]bool, len(rules.Share))
+	for _, path := range rules.Share {
+		share[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if _, isToken := c.Get("token_scopes"); !isToken {
+			c.Next()
+			return
+		}
+
+		path := c.FullPath()
+		for _, prefix := range rules.SessionOnly {
+			if strings.HasPrefix(path, prefix) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "this endpoint is not available with an API token"})
+				c.Abort()
+				return
+			}
+		}
+
+		required := models.TokenScopeWrite
+		switch {
+		case share[path]:
+			required = models.TokenScopeShare
+		case c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead:
+			required = models.TokenScopeRead
+		}
+
+		if !HasTokenScope(c, required) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":          "token does not have the required scope",
+				"required_scope": required,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// HasTokenScope - есть ли у запроса право scope. Сессия браузера имеет все права.
+func HasTokenScope(c *gin.Context, scope string) bool {
+	value, isToken := c.Get("token_scopes")
+	if !isToken {
+		return true
+	}
+	for _, s := range value.([]string) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// ChangePasswordRequest - смена пароля из настроек аккаунта
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+	ConfirmPassword string `json:"confirm_password" binding:"required,eqfield=NewPassword"`
+}
+
+// ChangeEmailRequest - новый адрес вступает в силу после перехода по ссылке из письма
+type ChangeEmailRequest struct {
+	Email    string `json:"email" binding:"required,email,max=100"`
+	Password string `json:"password" binding:"required"`
+}
+
+// EmailRequest - адрес для повторного письма подтверждения или сброса пароля
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// AccountTokenRequest - токен из ссылки в письме (подтверждение email, отмена удаления)
+type AccountTokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// PasswordResetRequest - новый пароль по токену из письма сброса
+type PasswordResetRequest struct {
+	Token           string `json:"token" binding:"required"`
+	Password        string `json:"password" binding:"required,min=6"`
+	ConfirmPassword string `json:"confirm_password" binding:"required,eqfield=Password"`
+}
+
+// DeleteAccountRequest - подтверждение удаления своего аккаунта. Confirm - имя
+// пользователя; пароль обязателен, если он у аккаунта есть (нет у входящих через OIDC).
+type DeleteAccountRequest struct {
+	Confirm  string `json:"confirm" binding:"required"`
+	Password string `json:"password"`
+}
+
+// DeleteAccountResponse - когда данные будут удалены окончательно
+type DeleteAccountResponse struct {
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// AdminUserResponse - пользователь в списке администратора вместе с занятым местом
+type AdminUserResponse struct {
+	ID           uint       `json:"id"`
+	Username     string     `json:"username"`
+	Email        string     `json:"email"`
+	Role         string     `json:"role"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`
+	StorageQuota *int64     `json:"storage_quota,omitempty"`
+	UsedBytes    int64      `json:"used_bytes"`
+	TrashBytes   int64      `json:"trash_bytes"`
+
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"` // Пользователь удалил аккаунт, идет отсрочка
+}
+
+type AdminUserList struct {
+	Users []AdminUserResponse `json:"users"`
+	Total int64               `json:"total"`
+}
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=user admin"`
+}
+
+// ResetPasswordRequest - без пароля сервер сгенерирует временный и вернет его один раз
+type ResetPasswordRequest struct {
+	Password string `json:"password" binding:"omitempty,min=6"`
+}
+
+type ResetPasswordResponse struct {
+	Password string `json:"password,omitempty"` // Только для сгенерированного пароля
+}
+
+// RegistrationSettingRequest - нужен mode; enabled оставлен для старых клиентов
+// и означает open или closed
+type RegistrationSettingRequest struct {
+	Mode    string `json:"mode" binding:"omitempty,oneof=open invite closed"`
+	Enabled *bool  `json:"enabled"`
+}
+
+// GlobalStorageStats - занятое место на всем сервере и эффект дедупликации.
+// Logical* - сумма размеров всех записей files, Unique* - по одному блобу на SHA256.
+type GlobalStorageStats struct {
+	Users         int64   `json:"users"`
+	Files         int64   `json:"files"`
+	LogicalBytes  int64   `json:"logical_bytes"`
+	TrashBytes    int64   `json:"trash_bytes"`
+	UniqueBlobs   int64   `json:"unique_blobs"`
+	UniqueBytes   int64   `json:"unique_bytes"`
+	StoredBytes   int64   `json:"stored_bytes"` // Зашифрованные блобы на диске
+	SavedBytes    int64   `json:"saved_bytes"`  // Сколько сэкономила дедупликация
+	DedupRatio    float64 `json:"dedup_ratio"`
+	PhysicalTotal int64   `json:"physical_total"`
+	PhysicalFree  int64   `json:"physical_free"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// AuditEvent - запись журнала безопасности: блокировки входа и другие события,
+// которые администратор должен видеть после того, как они произошли
+type AuditEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	Type    string `gorm:"not null;size:50;index" json:"type"`
+	UserID  *uint  `gorm:"index" json:"user_id,omitempty"` // nil - аккаунта с таким логином нет
+	Account string `gorm:"size:255" json:"account"`        // Логин, с которым пытались войти
+	IP      string `gorm:"size:64" json:"ip"`
+	Details string `gorm:"type:text" json:"details"`
+}
+
+const (
+	AuditLoginLockout = "login_lockout"
+)
+
+type AuditEventList struct {
+	Events []AuditEvent `json:"events"`
+	Total  int64        `json:"total"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "github.com/google/uuid"
+
+// Операции, поддерживаемые POST /files/batch
+const (
+	BatchOpDelete  = "delete"
+	BatchOpMove    = "move"
+	BatchOpCopy    = "copy"
+	BatchOpStar    = "star"
+	BatchOpUnstar  = "unstar"
+	BatchOpRestore = "restore"
+	BatchOpPurge   = "purge"
+)
+
+// MaxBatchOperations ограничивает размер одного пакетного запроса
+const MaxBatchOperations = 1000
+
+type BatchOperation struct {
+	Op         string    `json:"op" binding:"required"`
+	FileID     uuid.UUID `json:"file_id" binding:"required"`
+	TargetPath string    `json:"target_path"` // для move и copy
+}
+
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations" binding:"required,min=1"`
+	// Atomic - все или ничего: при первой ошибке откатываются все операции
+	Atomic bool `json:"atomic"`
+}
+
+type BatchItemResult struct {
+	Index   int       `json:"index"`
+	Op      string    `json:"op"`
+	FileID  uuid.UUID `json:"file_id"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+	File    *File     `json:"file,omitempty"` // результат move/copy
+}
+
+type BatchResponse struct {
+	Results    []BatchItemResult `json:"results"`
+	Succeeded  int               `json:"succeeded"`
+	Failed     int               `json:"failed"`
+	RolledBack bool              `json:"rolled_back"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExportManifest - manifest.json в архиве "все мои данные"
+type ExportManifest struct {
+	Version    int          `json:"version"`
+	ExportedAt time.Time    `json:"exported_at"`
+	User       UserResponse `json:"user"`
+
+	Files          []ExportFile  `json:"files"`
+	StarredFolders []string      `json:"starred_folders"`
+	Shares         []ExportShare `json:"shares"`
+	GrantsGiven    []ExportGrant `json:"grants_given"`
+	GrantsReceived []ExportGrant `json:"grants_received"`
+	Vaults         []ExportVault `json:"vaults"`
+}
+
+// ExportFile - файл или папка; ArchivePath пуст, если содержимого в архиве нет
+type ExportFile struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Folder      string     `json:"folder"`
+	IsFolder    bool       `json:"is_folder"`
+	Size        int64      `json:"size"`
+	MimeType    string     `json:"mime_type"`
+	SHA256      string     `json:"sha256,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"` // Файл в корзине
+	Starred     bool       `json:"starred"`
+	ArchivePath string     `json:"archive_path,omitempty"`
+}
+
+// ExportShare - публичная ссылка без токена: архив может попасть в чужие руки
+type ExportShare struct {
+	Type              string     `json:"type"`
+	FileID            *uuid.UUID `json:"file_id,omitempty"`
+	FolderPath        string     `json:"folder_path,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	Limit             *int       `json:"limit,omitempty"`
+	Downloads         int        `json:"downloads"`
+	Uploads           int        `json:"uploads"`
+	PasswordProtected bool       `json:"password_protected"`
+}
+
+// ExportGrant - доступ, выданный пользователю или полученный им
+type ExportGrant struct {
+	User       string     `json:"user"` // Кому выдан или кто выдал
+	Type       string     `json:"type"`
+	FileID     *uuid.UUID `json:"file_id,omitempty"`
+	FolderPath string     `json:"folder_path,omitempty"`
+	Permission string     `json:"permission"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
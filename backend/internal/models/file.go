@@ -13,7 +13,8 @@ type File struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	UserID        uint   `gorm:"not null;index" json:"user_id"`
+	UserID        uint   `gorm:"not null;index" json:"user_id"`  // Владелец; для файлов команды - кто загрузил
+	TeamID        *uint  `gorm:"index" json:"team_id,omitempty"` // Файл принадлежит пространству команды
 	Filename      string `gorm:"not null" json:"filename"`
 	OriginalName  string `gorm:"not null" json:"original_name"`
 	Path          string `gorm:"not null;index" json:"path"`           // Путь к зашифрованному файлу на диске
@@ -24,6 +25,11 @@ type File struct {
 	Size          int64  `gorm:"not null" json:"size"`           // Размер оригинального файла
 	EncryptedSize int64  `gorm:"not null" json:"encrypted_size"` // Размер зашифрованного файла
 
+	// Файл E2E-хранилища: на диске шифротекст клиента, имя и ключ файла тоже зашифрованы им, см. Vault
+	VaultID       *uint  `gorm:"index" json:"vault_id,omitempty"`
+	EncryptedName string `gorm:"type:text" json:"-"`
+	WrappedKey    string `gorm:"type:text" json:"-"`
+
 	User      User `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	IsStarred bool `gorm:"-" json:"is_starred"` // Не сохраняется в БД, вычисляется динамически
 }
@@ -42,7 +48,19 @@ type StorageStats struct {
 	DocSize   int64 `json:"doc_size"`
 	OtherSize int64 `json:"other_size"`
 	TrashSize int64 `json:"trash_size"`
+	VaultSize int64 `json:"vault_size"` // Шифротекст E2E-хранилищ, входит в TotalUsed
 	Limit         int64 `json:"limit"`
 	PhysicalTotal int64 `json:"physical_total"`
 	PhysicalFree  int64 `json:"physical_free"`
+
+	QuotaUsed          int64         `json:"quota_used"` // Что учитывается в квоте: TotalUsed и, если включено, корзина
+	QuotaIncludesTrash bool          `json:"quota_includes_trash"`
+	Warning            *QuotaWarning `json:"warning,omitempty"`
+}
+
+// QuotaWarning - мягкое предупреждение: занято больше Threshold процентов квоты
+type QuotaWarning struct {
+	Threshold   int     `json:"threshold"`
+	UsedPercent float64 `json:"used_percent"`
+	Message     string  `json:"message"`
 }
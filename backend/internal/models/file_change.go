@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Типы изменений в журнале синхронизации
+const (
+	ChangeCreate  = "create"
+	ChangeUpdate  = "update"
+	ChangeMove    = "move"
+	ChangeTrash   = "trash"
+	ChangeRestore = "restore"
+	ChangeDelete  = "delete"
+)
+
+// FileChange - запись журнала изменений для клиентов синхронизации.
+// Seq монотонно растет в пределах пользователя и служит курсором.
+type FileChange struct {
+	Seq       uint64    `gorm:"primaryKey;autoIncrement" json:"seq"`
+	CreatedAt time.Time `gorm:"index" json:"time"`
+
+	UserID      uint      `gorm:"not null;index:idx_file_changes_user_seq,priority:1" json:"-"`
+	FileID      uuid.UUID `gorm:"type:uuid;not null" json:"file_id"`
+	Op          string    `gorm:"not null;size:16" json:"op"`
+	Name        string    `json:"name"`
+	VirtualPath string    `json:"virtual_path"`
+	OldPath     string    `json:"old_path,omitempty"` // для move
+	IsDir       bool      `json:"is_dir"`
+	MimeType    string    `json:"mime_type,omitempty"`
+	SHA256      string    `gorm:"size:64" json:"sha256,omitempty"`
+	Size        int64     `json:"size"`
+	FileUpdated time.Time `json:"updated_at"`
+}
+
+// FileChangeWatermark - до какого Seq журнал пользователя уже сжат.
+// Курсор меньше этого значения больше не может быть продолжен.
+type FileChangeWatermark struct {
+	UserID           uint   `gorm:"primaryKey;autoIncrement:false"`
+	CompactedThrough uint64 `gorm:"not null"`
+}
+
+func NewFileChange(op string, file *File, oldPath string) *FileChange {
+	return &FileChange{
+		UserID:      file.UserID,
+		FileID:      file.ID,
+		Op:          op,
+		Name:        file.OriginalName,
+		VirtualPath: file.VirtualPath,
+		OldPath:     oldPath,
+		IsDir:       file.MimeType == "inode/directory",
+		MimeType:    file.MimeType,
+		SHA256:      file.SHA256,
+		Size:        file.Size,
+		FileUpdated: file.UpdatedAt,
+	}
+}
+
+type SyncChangesResponse struct {
+	Changes []FileChange `json:"changes"`
+	Cursor  string       `json:"cursor"`
+	HasMore bool         `json:"has_more"`
+	// Reset - курсор устарел (журнал сжат), клиент должен заново получить /sync/snapshot
+	Reset bool `json:"reset"`
+}
+
+type SyncSnapshotResponse struct {
+	Files  []File `json:"files"`
+	Cursor string `json:"cursor"`
+}
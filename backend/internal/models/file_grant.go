@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	GrantPermissionRead  = "read"
+	GrantPermissionWrite = "write" // Чтение и изменение
+)
+
+// FileGrant - доступ другого зарегистрированного пользователя к файлу или папке владельца.
+// Файлы остаются у владельца и учитываются только в его квоте.
+type FileGrant struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	OwnerID    uint       `gorm:"not null;index" json:"owner_id"`
+	GranteeID  uint       `gorm:"not null;index" json:"grantee_id"`
+	Type       string     `gorm:"size:20;not null" json:"type"`             // ShareTypeFile или ShareTypeFolder
+	FileID     *uuid.UUID `gorm:"type:uuid;index" json:"file_id,omitempty"` // Для доступа к файлу
+	FolderPath string     `gorm:"default:''" json:"folder_path,omitempty"`  // Для доступа к папке, например /projects/
+	Permission string     `gorm:"size:10;not null" json:"permission"`
+
+	Owner   User `gorm:"foreignKey:OwnerID" json:"-"`
+	Grantee User `gorm:"foreignKey:GranteeID" json:"-"`
+	File    File `gorm:"foreignKey:FileID" json:"-"`
+}
+
+type CreateGrantRequest struct {
+	Grantee    string     `json:"grantee" binding:"required"` // Имя пользователя или email
+	FileID     *uuid.UUID `json:"file_id"`
+	Path       string     `json:"path"` // Папка, если file_id не указан
+	Permission string     `json:"permission" binding:"required,oneof=read write"`
+}
+
+// GrantResponse - выданный доступ; владелец видит, кому выдал, получатель - от кого получил
+type GrantResponse struct {
+	ID         uint       `json:"id"`
+	Type       string     `json:"type"`
+	Permission string     `json:"permission"`
+	OwnerID    uint       `json:"owner_id"`
+	Owner      string     `json:"owner"`
+	Grantee    string     `json:"grantee"`
+	FileID     *uuid.UUID `json:"file_id,omitempty"`
+	FolderPath string     `json:"folder_path,omitempty"`
+	Name       string     `json:"name"`
+	MimeType   string     `json:"mime_type,omitempty"`
+	Size       int64      `json:"size,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
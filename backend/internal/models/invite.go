@@ -0,0 +1,100 @@
+package models
+
+import "time"
+
+// Invite - приглашение на регистрацию. Как и у личных токенов, хранится только
+// SHA-256 кода; Prefix помогает узнать приглашение в списке.
+type Invite struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+
+	CreatedBy uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"uniqueIndex;not null;size:64"`
+	Prefix    string `gorm:"size:32;not null"`
+	Note      string `gorm:"size:200"`
+
+	MaxUses      int        `gorm:"not null"` // 0 - без ограничения
+	Uses         int        `gorm:"not null;default:0"`
+	ExpiresAt    *time.Time // nil - бессрочное
+	StorageQuota *int64     // Квота для зарегистрированных по приглашению, nil - по умолчанию
+	RevokedAt    *time.Time // Отозванные остаются в списке и в счете лимита пользователя
+}
+
+// Usable - приглашение еще можно использовать для регистрации
+func (i *Invite) Usable(now time.Time) bool {
+	if i.RevokedAt != nil {
+		return false
+	}
+	if i.ExpiresAt != nil && !i.ExpiresAt.After(now) {
+		return false
+	}
+	return i.MaxUses == 0 || i.Uses < i.MaxUses
+}
+
+type InviteResponse struct {
+	ID           uint       `json:"id"`
+	Prefix       string     `json:"prefix"`
+	Note         string     `json:"note,omitempty"`
+	CreatedBy    uint       `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	MaxUses      int        `json:"max_uses"`
+	Uses         int        `json:"uses"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	StorageQuota *int64     `json:"storage_quota,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	Active       bool       `json:"active"`
+}
+
+func (i *Invite) ToResponse() InviteResponse {
+	return InviteResponse{
+		ID:           i.ID,
+		Prefix:       i.Prefix,
+		Note:         i.Note,
+		CreatedBy:    i.CreatedBy,
+		CreatedAt:    i.CreatedAt,
+		MaxUses:      i.MaxUses,
+		Uses:         i.Uses,
+		ExpiresAt:    i.ExpiresAt,
+		StorageQuota: i.StorageQuota,
+		RevokedAt:    i.RevokedAt,
+		Active:       i.Usable(time.Now()),
+	}
+}
+
+// CreateInviteRequest - MaxUses, бессрочность и квоту задает только администратор
+type CreateInviteRequest struct {
+	Note         string     `json:"note" binding:"max=200"`
+	MaxUses      *int       `json:"max_uses" binding:"omitempty,min=0,max=10000"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	StorageQuota *int64     `json:"storage_quota" binding:"omitempty,min=0"`
+}
+
+// InviteCreatedResponse - код и ссылка показываются только при создании
+type InviteCreatedResponse struct {
+	InviteResponse
+	Code string `json:"code"`
+	URL  string `json:"url"`
+}
+
+// InviteStatusResponse - проверка кода со страницы регистрации
+type InviteStatusResponse struct {
+	Valid     bool       `json:"valid"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type InviteList struct {
+	Invites []InviteResponse `json:"invites"`
+	Limit   int              `json:"limit"` // Сколько приглашений пользователь может создать, -1 - без ограничения
+	Created int64            `json:"created"`
+}
+
+// RegistrationSettings - режим регистрации для администратора
+type RegistrationSettings struct {
+	Mode    string `json:"mode"`
+	Enabled bool   `json:"enabled"` // mode != closed, для старых клиентов
+}
+
+type AdminInviteList struct {
+	Invites []InviteResponse `json:"invites"`
+	Total   int64            `json:"total"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+// Job - фоновая задача (архивирование папки, рекурсивное удаление и т.п.)
+type Job struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID uint      `gorm:"not null;index" json:"user_id"`
+	Type   string    `gorm:"not null;size:50" json:"type"`
+	Status JobStatus `gorm:"not null;index;size:20;default:'pending'" json:"status"`
+
+	Payload json.RawMessage `gorm:"type:jsonb" json:"payload,omitempty"`
+	Result  json.RawMessage `gorm:"type:jsonb" json:"result,omitempty"`
+	Error   string          `gorm:"type:text" json:"error,omitempty"`
+
+	Progress int64 `gorm:"default:0" json:"progress"` // Сколько единиц работы выполнено
+	Total    int64 `gorm:"default:0" json:"total"`    // Сколько всего (0 - неизвестно)
+
+	Attempts        int       `gorm:"default:0" json:"attempts"`
+	MaxAttempts     int       `gorm:"default:1" json:"max_attempts"`
+	CancelRequested bool      `gorm:"default:false" json:"cancel_requested"`
+	RunAfter        time.Time `gorm:"index" json:"-"` // Для отложенного повтора после ошибки
+
+	WorkerID    string     `gorm:"size:64" json:"-"`
+	HeartbeatAt *time.Time `json:"-"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// IsFinished - задача в конечном состоянии и больше не изменится
+func (j *Job) IsFinished() bool {
+	return j.Status == JobCompleted || j.Status == JobFailed || j.Status == JobCanceled
+}
@@ -0,0 +1,11 @@
+package models
+
+// AuthMethodsResponse - какие способы входа предлагать на странице логина
+type AuthMethodsResponse struct {
+	PasswordLogin    bool   `json:"password_login"`
+	Registration     bool   `json:"registration"`
+	RegistrationMode string `json:"registration_mode"` // open, invite или closed
+	OIDC             bool   `json:"oidc"`
+	OIDCName         string `json:"oidc_name,omitempty"`
+	OIDCLoginURL     string `json:"oidc_login_url,omitempty"`
+}
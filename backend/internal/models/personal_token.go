@@ -0,0 +1,83 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// PersonalToken - долгоживущий токен для скриптов и CI. Хранится только
+// SHA-256 токена; Prefix - его начало, чтобы пользователь узнал токен в списке.
+type PersonalToken struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+
+	UserID    uint   `gorm:"not null;index"`
+	Name      string `gorm:"size:100;not null"`
+	TokenHash string `gorm:"uniqueIndex;not null;size:64"`
+	Prefix    string `gorm:"size:32;not null"`
+	Scopes    string `gorm:"size:100;not null"` // Через запятую: read,write
+
+	ExpiresAt  *time.Time // nil - бессрочный
+	LastUsedAt *time.Time
+	LastUsedIP string `gorm:"size:64"`
+}
+
+// Права токена. Сессия браузера имеет все права пользователя, токен - только перечисленные.
+const (
+	TokenScopeRead  = "read"  // Чтение файлов и метаданных
+	TokenScopeWrite = "write" // Загрузка, изменение и удаление файлов
+	TokenScopeShare = "share" // Публичные ссылки и доступы другим пользователям
+	TokenScopeAdmin = "admin" // API администратора (только для администраторов)
+)
+
+func (t *PersonalToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(t.Scopes, ",")
+}
+
+func (t *PersonalToken) HasScope(scope string) bool {
+	for _, s := range t.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type PersonalTokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+}
+
+func (t *PersonalToken) ToResponse() PersonalTokenResponse {
+	return PersonalTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     t.ScopeList(),
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		LastUsedIP: t.LastUsedIP,
+	}
+}
+
+type CreatePersonalTokenRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,oneof=read write share admin"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// PersonalTokenCreatedResponse - токен целиком показывается только при создании
+type PersonalTokenCreatedResponse struct {
+	PersonalTokenResponse
+	Token string `json:"token"`
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AccessKey - ключ доступа к S3-совместимому API (SigV4).
+// Секрет нужен серверу для проверки подписи, поэтому хранится зашифрованным, а не хешем.
+type AccessKey struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID          uint   `gorm:"not null;index" json:"user_id"`
+	Name            string `gorm:"size:100" json:"name"`
+	AccessKeyID     string `gorm:"uniqueIndex;not null;size:32" json:"access_key_id"`
+	EncryptedSecret string `gorm:"not null" json:"-"`
+}
+
+type CreateAccessKeyRequest struct {
+	Name string `json:"name" binding:"max=100"`
+}
+
+// AccessKeyCreatedResponse - секрет возвращается только один раз, при создании
+type AccessKeyCreatedResponse struct {
+	AccessKey
+	SecretAccessKey string `json:"secret_access_key"`
+}
+
+// S3MultipartUpload - незавершенная multipart-загрузка. Части лежат на диске зашифрованными
+// до CompleteMultipartUpload и удаляются фоновой задачей, если загрузку бросили.
+type S3MultipartUpload struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CreatedAt time.Time
+
+	UserID      uint   `gorm:"not null;index"`
+	Bucket      string `gorm:"not null"`
+	Key         string `gorm:"not null"`
+	ContentType string
+
+	Parts []S3MultipartPart `gorm:"foreignKey:UploadID;constraint:OnDelete:CASCADE"`
+}
+
+type S3MultipartPart struct {
+	UploadID   uuid.UUID `gorm:"type:uuid;primaryKey"`
+	PartNumber int       `gorm:"primaryKey;autoIncrement:false"`
+	UpdatedAt  time.Time
+
+	ETag string `gorm:"not null;size:64"` // MD5 открытого текста части
+	Size int64  `gorm:"not null"`
+}
+
+// S3Object - объект в листинге бакета
+type S3Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ETag         string
+}
+
+type S3ListResult struct {
+	Objects        []S3Object
+	CommonPrefixes []string
+	IsTruncated    bool
+	NextMarker     string // Последний возвращенный ключ или префикс
+}
+
+// S3CompletedPart - часть из запроса CompleteMultipartUpload
+type S3CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
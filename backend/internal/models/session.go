@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Session - вход с одного устройства. Хранится в Redis, пока жив refresh-токен;
+// удаление сессии сразу отзывает и ее access-токены.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     uint      `json:"-"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+
+	RefreshHash     string    `json:"refresh_hash"`      // SHA256 текущего refresh-токена
+	PrevRefreshHash string    `json:"prev_refresh_hash"` // Предыдущий токен - для обнаружения повторного использования
+	RotatedAt       time.Time `json:"rotated_at"`
+}
+
+// SessionResponse - сессия в списке "мои устройства"
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+func (s *Session) ToResponse(currentID string) SessionResponse {
+	return SessionResponse{
+		ID:         s.ID,
+		IP:         s.IP,
+		UserAgent:  s.UserAgent,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+		Current:    s.ID == currentID,
+	}
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
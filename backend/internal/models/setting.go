@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Setting - параметр сервера, который администратор меняет без перезапуска.
+// Отсутствие записи означает значение из конфигурации.
+type Setting struct {
+	Key       string    `gorm:"primaryKey;size:64" json:"key"`
+	Value     string    `gorm:"type:text;not null" json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const (
+	SettingRegistrationEnabled = "registration_enabled" // Устарел: до режимов регистрации был только флаг
+	SettingRegistrationMode    = "registration_mode"
+)
+
+// Режимы регистрации
+const (
+	RegistrationOpen   = "open"   // Кто угодно
+	RegistrationInvite = "invite" // Только с кодом приглашения
+	RegistrationClosed = "closed" // Новых пользователей создает администратор
+)
@@ -1,28 +1,157 @@
 package models
 
 import (
+	"path"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	ShareTypeFile    = "file"
+	ShareTypeFolder  = "folder"
+	ShareTypeRequest = "request" // Запрос файлов: посетители только загружают в папку
+)
+
 type SharedFile struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
-	Token     string    `gorm:"uniqueIndex;not null" json:"token"`
-	FileID    uuid.UUID `gorm:"not null;index" json:"file_id"`
-	UserID    uint      `gorm:"not null;index" json:"user_id"`
-	Downloads int       `gorm:"default:0" json:"downloads"`
-	Limit     *int      `json:"limit"`     // nil means unlimited
-	ExpiresAt *time.Time `json:"expires_at"` // nil means never expires
+	Token      string     `gorm:"uniqueIndex;not null" json:"token"`
+	Type       string     `gorm:"size:20;not null;default:'file'" json:"type"`
+	FileID     *uuid.UUID `gorm:"index" json:"file_id"`                    // Для ссылок на файл
+	FolderPath string     `gorm:"default:''" json:"folder_path,omitempty"` // Для ссылок на папку, например /photos/2024/
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Downloads  int        `gorm:"default:0" json:"downloads"`
+	Limit      *int       `json:"limit"`      // nil means unlimited; для запроса файлов - сколько файлов можно загрузить
+	ExpiresAt  *time.Time `json:"expires_at"` // nil means never expires
+
+	Uploads     int    `gorm:"default:0" json:"uploads"` // Для запроса файлов
+	MaxFileSize *int64 `json:"max_file_size,omitempty"`  // Для запроса файлов; nil - ограничение сервера
+
+	PasswordHash      string `json:"-"`
+	PasswordProtected bool   `gorm:"default:false" json:"password_protected"`
+	HideOwner         bool   `gorm:"default:false" json:"hide_owner"` // Не показывать имя владельца на публичной странице
 
 	File File `gorm:"foreignKey:FileID" json:"file,omitempty"`
 	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+
+	DownloadEvents []ShareDownloadEvent `gorm:"foreignKey:ShareID;constraint:OnDelete:CASCADE" json:"download_events,omitempty"`
+}
+
+// ShareDownloadEvent - запись журнала скачиваний по ссылке, видна только владельцу.
+// IP хранится в виде HMAC, чтобы можно было отличить посетителей, не храня сам адрес.
+type ShareDownloadEvent struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ShareID   uint       `gorm:"not null;index" json:"-"`
+	FileID    *uuid.UUID `gorm:"type:uuid" json:"file_id,omitempty"` // Для файлов из расшаренной папки
+	IPHash    string     `gorm:"size:64" json:"ip_hash"`
+	UserAgent string     `gorm:"size:512" json:"user_agent"`
+	BytesSent int64      `json:"bytes_sent"`
+	Completed bool       `json:"completed"` // false - скачивание оборвалось и в лимит не засчитано
 }
 
 type CreateShareRequest struct {
 	Limit     *int       `json:"limit"`
 	ExpiresAt *time.Time `json:"expires_at"`
+	Password  string     `json:"password" binding:"omitempty,min=4,max=72"`
+	HideOwner bool       `json:"hide_owner"`
+}
+
+type CreateFolderShareRequest struct {
+	CreateShareRequest
+	Path string `json:"path" binding:"required"`
+}
+
+// CreateFileRequestRequest - ссылка, по которой посторонние загружают файлы в папку.
+// Limit ограничивает число загруженных файлов.
+type CreateFileRequestRequest struct {
+	CreateShareRequest
+	Path        string `json:"path" binding:"required"`
+	MaxFileSize *int64 `json:"max_file_size" binding:"omitempty,min=1"`
+}
+
+type UnlockShareRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// SharedFolderEntry - элемент листинга папки по публичной ссылке
+type SharedFolderEntry struct {
+	ID        *uuid.UUID `json:"id,omitempty"` // nil для папок
+	Name      string     `json:"name"`
+	Path      string     `json:"path"` // Путь внутри расшаренной папки
+	IsDir     bool       `json:"is_dir"`
+	MimeType  string     `json:"mime_type,omitempty"`
+	Size      int64      `json:"size"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// PublicShareResponse - все, что видит анонимный посетитель ссылки.
+// Пути на диске, хеши, id и email владельца сюда не попадают.
+type PublicShareResponse struct {
+	Token              string     `json:"token"`
+	Type               string     `json:"type"`
+	Name               string     `json:"name"`
+	MimeType           string     `json:"mime_type,omitempty"`
+	Size               int64      `json:"size,omitempty"`
+	Owner              string     `json:"owner,omitempty"` // Только имя пользователя и только если владелец не скрыт
+	PasswordProtected  bool       `json:"password_protected"`
+	DownloadsRemaining *int       `json:"downloads_remaining,omitempty"`
+	UploadsRemaining   *int       `json:"uploads_remaining,omitempty"`
+	MaxFileSize        *int64     `json:"max_file_size,omitempty"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+// ToPublicResponse - единственный способ отдать ссылку в публичный API
+func (s *SharedFile) ToPublicResponse() PublicShareResponse {
+	resp := PublicShareResponse{
+		Token:             s.Token,
+		Type:              s.Type,
+		PasswordProtected: s.PasswordProtected,
+		ExpiresAt:         s.ExpiresAt,
+		CreatedAt:         s.CreatedAt,
+	}
+
+	switch s.Type {
+	case ShareTypeFolder, ShareTypeRequest:
+		resp.Name = path.Base(strings.TrimSuffix(s.FolderPath, "/"))
+	default:
+		resp.Name = s.File.OriginalName
+		resp.MimeType = s.File.MimeType
+		resp.Size = s.File.Size
+	}
+
+	if !s.HideOwner {
+		resp.Owner = s.User.Username
+	}
+
+	if s.Limit != nil {
+		remaining := *s.Limit - s.Used()
+		if remaining < 0 {
+			remaining = 0
+		}
+		if s.Type == ShareTypeRequest {
+			resp.UploadsRemaining = &remaining
+		} else {
+			resp.DownloadsRemaining = &remaining
+		}
+	}
+
+	if s.Type == ShareTypeRequest {
+		resp.MaxFileSize = s.MaxFileSize
+	}
+
+	return resp
+}
+
+// Used - сколько раз ссылка уже использована в счет Limit
+func (s *SharedFile) Used() int {
+	if s.Type == ShareTypeRequest {
+		return s.Uploads
+	}
+	return s.Downloads
 }
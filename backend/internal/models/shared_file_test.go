@@ -0,0 +1,132 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Поля владельца и хранилища, которые не должны попасть в публичный API ни на каком уровне
+var publicForbiddenKeys = []string{
+	"path", "sha256", "user_id", "email", "file_id", "folder_path", "password_hash",
+}
+
+func testShare(shareType string, hideOwner bool) SharedFile {
+	fileID := uuid.New()
+	limit := 5
+	maxSize := int64(1 << 20)
+	expires := time.Now().Add(time.Hour)
+
+	return SharedFile{
+		ID:                1,
+		Token:             "token",
+		Type:              shareType,
+		FileID:            &fileID,
+		FolderPath:        "/private/photos/",
+		UserID:            42,
+		Limit:             &limit,
+		ExpiresAt:         &expires,
+		MaxFileSize:       &maxSize,
+		PasswordHash:      "$2a$12$secret",
+		PasswordProtected: true,
+		HideOwner:         hideOwner,
+		File: File{
+			ID:           fileID,
+			UserID:       42,
+			OriginalName: "report.pdf",
+			Path:         "/app/storage/ab/cd/abcdef",
+			VirtualPath:  "/private/",
+			SHA256:       "abcdef",
+			MimeType:     "application/pdf",
+			Size:         1024,
+		},
+		User: User{
+			ID:       42,
+			Username: "owner",
+			Email:    "owner@example.com",
+			Password: "$2a$12$hash",
+		},
+	}
+}
+
+// publicKeys разбирает JSON и собирает ключи всех уровней вложенности
+func publicKeys(t *testing.T, v interface{}) map[string]interface{} {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	keys := make(map[string]interface{})
+	var walk func(interface{})
+	walk = func(node interface{}) {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			for k, child := range n {
+				keys[k] = child
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range n {
+				walk(child)
+			}
+		}
+	}
+	walk(decoded)
+	return keys
+}
+
+func TestToPublicResponseHidesInternalFields(t *testing.T) {
+	for _, shareType := range []string{ShareTypeFile, ShareTypeFolder, ShareTypeRequest} {
+		for _, hideOwner := range []bool{false, true} {
+			share := testShare(shareType, hideOwner)
+			keys := publicKeys(t, share.ToPublicResponse())
+
+			for _, key := range publicForbiddenKeys {
+				if _, ok := keys[key]; ok {
+					t.Errorf("%s share (hide_owner=%v): %q leaked to public response", shareType, hideOwner, key)
+				}
+			}
+
+			owner, ok := keys["owner"]
+			if hideOwner && ok {
+				t.Errorf("%s share: owner %v shown although hide_owner is set", shareType, owner)
+			}
+			if !hideOwner && owner != "owner" {
+				t.Errorf("%s share: owner = %v, want username", shareType, owner)
+			}
+		}
+	}
+}
+
+func TestSharedFolderEntryHidesInternalFields(t *testing.T) {
+	id := uuid.New()
+	entries := []SharedFolderEntry{
+		{ID: &id, Name: "report.pdf", Path: "/2024/", MimeType: "application/pdf", Size: 1024},
+		{Name: "2024", Path: "/", IsDir: true},
+	}
+
+	// path здесь - путь внутри расшаренной папки, остальное не должно появляться
+	allowed := map[string]bool{
+		"id": true, "name": true, "path": true, "is_dir": true,
+		"mime_type": true, "size": true, "updated_at": true,
+	}
+	keys := publicKeys(t, entries)
+	for key := range keys {
+		if !allowed[key] {
+			t.Errorf("unexpected field %q in shared folder entry", key)
+		}
+	}
+	for _, key := range publicForbiddenKeys {
+		if _, ok := keys[key]; ok && key != "path" {
+			t.Errorf("%q leaked to shared folder entry", key)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// SSHKey - публичный ключ пользователя для входа по SFTP
+type SSHKey struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID      uint   `gorm:"not null;index" json:"user_id"`
+	Name        string `gorm:"size:100" json:"name"`
+	PublicKey   string `gorm:"type:text;not null" json:"public_key"` // В формате authorized_keys
+	Fingerprint string `gorm:"uniqueIndex;not null;size:64" json:"fingerprint"`
+}
+
+type CreateSSHKeyRequest struct {
+	Name      string `json:"name" binding:"max=100"`
+	PublicKey string `json:"public_key" binding:"required"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StorageUsage - счетчик занятого места в личном пространстве пользователя.
+// Меняется в тех же транзакциях, что и таблица files, поэтому проверка квоты
+// не просматривает все файлы. Расхождения исправляет периодическая сверка.
+type StorageUsage struct {
+	UserID        uint      `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	UsedBytes     int64     `gorm:"not null;default:0" json:"used_bytes"`
+	TrashBytes    int64     `gorm:"not null;default:0" json:"trash_bytes"`
+	ReservedBytes int64     `gorm:"not null;default:0" json:"reserved_bytes"` // Сумма действующих QuotaReservation
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// QuotaReservation - место, занятое под загрузку до появления записи в files.
+// Резерв снимается после сохранения файла или при ошибке; резервы, брошенные
+// упавшим процессом, снимает сверка по истечении ExpiresAt.
+type QuotaReservation struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	Size      int64     `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+// UsageReconcileResult - итог задачи сверки счетчиков с таблицей files
+type UsageReconcileResult struct {
+	Checked             int   `json:"checked"`
+	Corrected           int   `json:"corrected"`
+	ExpiredReservations int64 `json:"expired_reservations"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+const (
+	TeamRoleOwner  = "owner"  // Управляет участниками, читает и изменяет файлы
+	TeamRoleEditor = "editor" // Читает и изменяет файлы
+	TeamRoleViewer = "viewer" // Только читает
+)
+
+// Team - общее пространство, файлы которого принадлежат команде, а не одному пользователю
+type Team struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name         string `gorm:"size:100;not null" json:"name"`
+	StorageLimit int64  `gorm:"default:0" json:"storage_limit"` // 0 - лимит из конфигурации (TEAM_STORAGE_LIMIT_BYTES)
+
+	Members []TeamMember `gorm:"foreignKey:TeamID;constraint:OnDelete:CASCADE" json:"members,omitempty"`
+}
+
+type TeamMember struct {
+	TeamID    uint      `gorm:"primaryKey" json:"team_id"`
+	UserID    uint      `gorm:"primaryKey;index" json:"user_id"`
+	Role      string    `gorm:"size:20;not null" json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+type CreateTeamRequest struct {
+	Name string `json:"name" binding:"required,min=1,max=100"`
+}
+
+type AddTeamMemberRequest struct {
+	User string `json:"user" binding:"required"` // Имя пользователя или email
+	Role string `json:"role" binding:"required,oneof=owner editor viewer"`
+}
+
+type UpdateTeamMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner editor viewer"`
+}
+
+// TeamResponse - команда глазами участника
+type TeamResponse struct {
+	ID           uint                 `json:"id"`
+	Name         string               `json:"name"`
+	Role         string               `json:"role"` // Роль текущего пользователя
+	StorageUsed  int64                `json:"storage_used"`
+	StorageLimit int64                `json:"storage_limit"`
+	Members      []TeamMemberResponse `json:"members,omitempty"`
+	CreatedAt    time.Time            `json:"created_at"`
+}
+
+type TeamMemberResponse struct {
+	UserID   uint      `json:"user_id"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// RecoveryCode - одноразовый код восстановления на случай потери устройства с TOTP.
+// Хранится только SHA-256 кода, сам код показывается пользователю один раз.
+type RecoveryCode struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID   uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash string     `gorm:"not null;size:64" json:"-"`
+	UsedAt   *time.Time `json:"used_at,omitempty"`
+}
+
+// TwoFactorSetupResponse - секрет для ручного ввода и otpauth:// URI для QR-кода
+type TwoFactorSetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TwoFactorStatusResponse struct {
+	Enabled           bool  `json:"enabled"`
+	Pending           bool  `json:"pending"` // Секрет выдан, но еще не подтвержден кодом
+	RecoveryCodesLeft int64 `json:"recovery_codes_left"`
+}
+
+// TwoFactorCodeRequest - код из приложения или код восстановления
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required,max=32"`
+}
+
+type TwoFactorLoginRequest struct {
+	PreAuthToken string `json:"pre_auth_token" binding:"required"`
+	Code         string `json:"code" binding:"required,max=32"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
@@ -15,6 +15,46 @@ type User struct {
 	Username string `gorm:"uniqueIndex;not null;size:50" json:"username"`
 	Email    string `gorm:"uniqueIndex;not null;size:100" json:"email"`
 	Password string `gorm:"not null" json:"-"`
+
+	Role         string     `gorm:"size:20;not null;default:'user'" json:"role"`
+	StorageQuota *int64     `json:"storage_quota,omitempty"` // nil - квота по умолчанию (STORAGE_LIMIT_BYTES)
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`   // Отключенный пользователь не может войти ни одним способом
+
+	// Email ждет подтверждения по ссылке из письма. Флаг, а не время подтверждения:
+	// пользователи, созданные до проверки email и через OIDC, считаются подтвержденными.
+	EmailVerificationPending bool `gorm:"not null;default:false" json:"-"`
+
+	// Пользователь удалил аккаунт сам: до этого времени аккаунт отключен и удаление
+	// можно отменить, потом данные удаляются окончательно
+	DeletionScheduledAt *time.Time `gorm:"index" json:"-"`
+
+	// TOTP: секрет зашифрован ключом ENCRYPTION_KEY. Пока TOTPEnabledAt пуст,
+	// секрет ждет подтверждения первым кодом. TOTPLastStep защищает от повтора кода.
+	TOTPSecret    string     `gorm:"size:255" json:"-"`
+	TOTPEnabledAt *time.Time `json:"-"`
+	TOTPLastStep  int64      `gorm:"not null;default:0" json:"-"`
+
+	// Учетная запись у OIDC-провайдера. Пользователи, созданные через OIDC,
+	// не имеют пароля (Password пуст) и входят только через провайдера.
+	OIDCIssuer  *string `gorm:"size:255;uniqueIndex:idx_users_oidc" json:"-"`
+	OIDCSubject *string `gorm:"size:255;uniqueIndex:idx_users_oidc" json:"-"`
+}
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
 }
 
 // Request/Response модели
@@ -23,6 +63,7 @@ type RegisterRequest struct {
 	Email           string `json:"email" binding:"required,email"`
 	Password        string `json:"password" binding:"required,min=6"`
 	ConfirmPassword string `json:"confirm_password" binding:"required,eqfield=Password"`
+	InviteCode      string `json:"invite_code" binding:"max=64"` // Обязателен в режиме invite
 }
 
 type LoginRequest struct {
@@ -31,22 +72,52 @@ type LoginRequest struct {
 }
 
 type AuthResponse struct {
-	Token string       `json:"token"`
-	User  UserResponse `json:"user"`
+	Token        string       `json:"token"`
+	RefreshToken string       `json:"refresh_token,omitempty"`
+	User         UserResponse `json:"user"`
+
+	// Пароль верный, но нужен второй фактор: сессии еще нет, есть только
+	// PreAuthToken для POST /auth/login/2fa
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	PreAuthToken      string `json:"pre_auth_token,omitempty"`
+
+	// Аккаунт создан, но войти можно только после подтверждения email
+	EmailVerificationRequired bool `json:"email_verification_required,omitempty"`
 }
 
 type UserResponse struct {
 	ID        uint      `json:"id"`
 	Username  string    `json:"username"`
 	Email     string    `json:"email"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
+
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
+	EmailVerified    bool `json:"email_verified"`
 }
 
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
-		ID:        u.ID,
-		Username:  u.Username,
-		Email:     u.Email,
-		CreatedAt: u.CreatedAt,
+		ID:               u.ID,
+		Username:         u.Username,
+		Email:            u.Email,
+		Role:             u.Role,
+		CreatedAt:        u.CreatedAt,
+		TwoFactorEnabled: u.TwoFactorEnabled(),
+		EmailVerified:    !u.EmailVerificationPending,
 	}
 }
+
+// SetQuotaRequest - квота пользователя в байтах; null возвращает квоту по умолчанию
+type SetQuotaRequest struct {
+	Quota *int64 `json:"quota" binding:"omitempty,min=0"`
+}
+
+// UserQuotaResponse - квота и занятое место пользователя для администратора
+type UserQuotaResponse struct {
+	UserID        uint  `json:"user_id"`
+	Quota         int64 `json:"quota"`
+	IsDefault     bool  `json:"is_default"` // Квота не задана, действует STORAGE_LIMIT_BYTES
+	Used          int64 `json:"used"`
+	IncludesTrash bool  `json:"includes_trash"`
+}
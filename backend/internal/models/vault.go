@@ -0,0 +1,149 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Vault - хранилище со сквозным шифрованием. Ключ хранилища создает клиент и
+// присылает только обернутым (WrappedKey, например ключом из пароля через KDF);
+// KeyParams - непрозрачные для сервера параметры разворачивания (алгоритм, соль).
+// Файлы хранилища - записи files с VaultID: содержимое, имя и ключ файла
+// шифрует клиент, сервер их не расшифровывает и не разбирает.
+type Vault struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	UserID uint   `gorm:"not null;uniqueIndex:idx_vaults_user_name"`
+	Name   string `gorm:"size:100;not null;uniqueIndex:idx_vaults_user_name"` // Открытое название, видно серверу
+
+	WrappedKey string `gorm:"type:text;not null"`
+	KeyParams  string `gorm:"type:text;not null"`
+	KeyVersion int    `gorm:"not null;default:1"` // Растет при каждой перешифровке ключа
+}
+
+// VaultUnavailableFeatures - что сервер не умеет делать с файлами хранилищ:
+// он не видит ни имен, ни содержимого. Файлы хранилищ не попадают в списки
+// папок, поиск, корзину, журнал синхронизации, WebDAV, S3 и SFTP, а обычные
+// API файлов (/api/files/:id, ссылки, доступы) отвечают на их ID 404.
+var VaultUnavailableFeatures = []string{
+	"search",     // Имена зашифрованы
+	"thumbnails", // И превью: содержимое не расшифровать
+	"dedup",      // Одинаковые файлы дают разный шифротекст
+	"sharing",    // Публичные ссылки и доступы другим пользователям
+	"trash",      // Удаление сразу окончательное
+	"folder_zip", // Архив папки собирается на сервере
+	"sync",       // Журнал изменений и протоколы WebDAV, S3, SFTP
+}
+
+type VaultResponse struct {
+	ID         uint      `json:"id"`
+	Name       string    `json:"name"`
+	WrappedKey string    `json:"wrapped_key"`
+	KeyParams  string    `json:"key_params"`
+	KeyVersion int       `json:"key_version"`
+	Files      int64     `json:"files"`
+	Size       int64     `json:"size"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (v *Vault) ToResponse() VaultResponse {
+	return VaultResponse{
+		ID:         v.ID,
+		Name:       v.Name,
+		WrappedKey: v.WrappedKey,
+		KeyParams:  v.KeyParams,
+		KeyVersion: v.KeyVersion,
+		CreatedAt:  v.CreatedAt,
+		UpdatedAt:  v.UpdatedAt,
+	}
+}
+
+type VaultList struct {
+	Vaults              []VaultResponse `json:"vaults"`
+	UnavailableFeatures []string        `json:"unavailable_features"`
+}
+
+// VaultUsage - число файлов и объем шифротекста хранилища
+type VaultUsage struct {
+	VaultID uint
+	Files   int64
+	Size    int64
+}
+
+type CreateVaultRequest struct {
+	Name       string `json:"name" binding:"required,max=100"`
+	WrappedKey string `json:"wrapped_key" binding:"required,max=4096"`
+	KeyParams  string `json:"key_params" binding:"required,max=4096"`
+}
+
+// UpdateVaultKeyRequest - перешифровка ключа хранилища (например, при смене
+// пароля). KeyVersion - версия, которую видел клиент: если ключ уже сменили
+// с другого устройства, сервер ответит 409, а не затрет его.
+type UpdateVaultKeyRequest struct {
+	WrappedKey string `json:"wrapped_key" binding:"required,max=4096"`
+	KeyParams  string `json:"key_params" binding:"required,max=4096"`
+	KeyVersion int    `json:"key_version" binding:"required,min=1"`
+}
+
+// VaultFileResponse - метаданные файла хранилища. Size и SHA256 относятся к
+// шифротексту: по ним клиент проверяет, что скачал блоб целиком.
+type VaultFileResponse struct {
+	ID            uuid.UUID `json:"id"`
+	VaultID       uint      `json:"vault_id"`
+	EncryptedName string    `json:"encrypted_name"`
+	WrappedKey    string    `json:"wrapped_key"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (f *File) ToVaultFileResponse() VaultFileResponse {
+	response := VaultFileResponse{
+		ID:            f.ID,
+		EncryptedName: f.EncryptedName,
+		WrappedKey:    f.WrappedKey,
+		Size:          f.Size,
+		SHA256:        f.SHA256,
+		CreatedAt:     f.CreatedAt,
+		UpdatedAt:     f.UpdatedAt,
+	}
+	if f.VaultID != nil {
+		response.VaultID = *f.VaultID
+	}
+	return response
+}
+
+// VaultFileMetadata - поля формы при загрузке файла в хранилище
+type VaultFileMetadata struct {
+	EncryptedName string `form:"encrypted_name" binding:"required,max=4096"`
+	WrappedKey    string `form:"wrapped_key" binding:"required,max=4096"`
+}
+
+// UpdateVaultFileRequest - переименование (новое зашифрованное имя) или
+// перешифровка ключа файла новым ключом хранилища
+type UpdateVaultFileRequest struct {
+	EncryptedName *string `json:"encrypted_name" binding:"omitempty,min=1,max=4096"`
+	WrappedKey    *string `json:"wrapped_key" binding:"omitempty,min=1,max=4096"`
+}
+
+// ExportVault - хранилище в выгрузке данных: ключ остается обернутым, файлы
+// лежат в архиве шифротекстом, расшифровать их может только сам пользователь
+type ExportVault struct {
+	ID         uint              `json:"id"`
+	Name       string            `json:"name"`
+	WrappedKey string            `json:"wrapped_key"`
+	KeyParams  string            `json:"key_params"`
+	KeyVersion int               `json:"key_version"`
+	CreatedAt  time.Time         `json:"created_at"`
+	Files      []ExportVaultFile `json:"files"`
+}
+
+type ExportVaultFile struct {
+	VaultFileResponse
+	ArchivePath string `json:"archive_path"`
+}
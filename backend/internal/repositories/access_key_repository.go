@@ -0,0 +1,47 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"gorm.io/gorm"
+)
+
+type AccessKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewAccessKeyRepository(db *gorm.DB) *AccessKeyRepository {
+	return &AccessKeyRepository{db: db}
+}
+
+func (r *AccessKeyRepository) Create(key *models.AccessKey) error {
+	return r.db.Create(key).Error
+}
+
+// FindByAccessKeyID ищет ключ; ключи отключенных и удаленных пользователей не находятся
+func (r *AccessKeyRepository) FindByAccessKeyID(accessKeyID string) (*models.AccessKey, error) {
+	var key models.AccessKey
+	err := r.db.Joins("JOIN users ON users.id = access_keys.user_id AND users.disabled_at IS NULL AND users.deleted_at IS NULL").
+		Where("access_keys.access_key_id = ?", accessKeyID).
+		First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *AccessKeyRepository) FindByUserID(userID uint) ([]models.AccessKey, error) {
+	var keys []models.AccessKey
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// Delete удаляет ключ пользователя, возвращает false, если такого ключа нет
+func (r *AccessKeyRepository) Delete(id uint, userID uint) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.AccessKey{})
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"gorm.io/gorm"
+)
+
+type FileChangeRepository struct {
+	db *gorm.DB
+}
+
+func NewFileChangeRepository(db *gorm.DB) *FileChangeRepository {
+	return &FileChangeRepository{db: db}
+}
+
+// FindSince возвращает изменения пользователя с Seq больше cursor
+func (r *FileChangeRepository) FindSince(userID uint, cursor uint64, limit int) ([]models.FileChange, error) {
+	var changes []models.FileChange
+	err := r.db.Where("user_id = ? AND seq > ?", userID, cursor).
+		Order("seq ASC").
+		Limit(limit).
+		Find(&changes).Error
+	return changes, err
+}
+
+// LatestSeq возвращает последний Seq пользователя (с учетом уже сжатой части журнала)
+func (r *FileChangeRepository) LatestSeq(userID uint) (uint64, error) {
+	var result struct {
+		Seq uint64
+	}
+	err := r.db.Model(&models.FileChange{}).
+		Select("COALESCE(MAX(seq), 0) AS seq").
+		Where("user_id = ?", userID).
+		Scan(&result).Error
+	if err != nil {
+		return 0, err
+	}
+
+	watermark, err := r.Watermark(userID)
+	if err != nil {
+		return 0, err
+	}
+	if watermark > result.Seq {
+		return watermark, nil
+	}
+	return result.Seq, nil
+}
+
+func (r *FileChangeRepository) Watermark(userID uint) (uint64, error) {
+	var watermark models.FileChangeWatermark
+	err := r.db.Where("user_id = ?", userID).Limit(1).Find(&watermark).Error
+	return watermark.CompactedThrough, err
+}
+
+// Compact удаляет записи старше before и запоминает, до какого Seq журнал сжат.
+// Удаление идет по seq <= только что записанного водяного знака в том же запросе:
+// запись, которую водяной знак не покрывает, не удаляется, даже если ее created_at меньше before.
+func (r *FileChangeRepository) Compact(before time.Time) (int64, error) {
+	res := r.db.Exec(`
+		WITH marks AS (
+			INSERT INTO file_change_watermarks (user_id, compacted_through)
+			SELECT user_id, MAX(seq) FROM file_changes WHERE created_at < ? GROUP BY user_id
+			ON CONFLICT (user_id) DO UPDATE
+			SET compacted_through = GREATEST(file_change_watermarks.compacted_through, EXCLUDED.compacted_through)
+			RETURNING user_id, compacted_through
+		)
+		DELETE FROM file_changes USING marks
+		WHERE file_changes.user_id = marks.user_id AND file_changes.seq <= marks.compacted_through`,
+		before)
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/google/uuid"
+
+	"gorm.io/gorm"
+)
+
+type FileGrantRepository struct {
+	db *gorm.DB
+}
+
+func NewFileGrantRepository(db *gorm.DB) *FileGrantRepository {
+	return &FileGrantRepository{db: db}
+}
+
+// WithTx возвращает копию репозитория, работающую внутри транзакции tx
+func (r *FileGrantRepository) WithTx(tx *gorm.DB) *FileGrantRepository {
+	return &FileGrantRepository{db: tx}
+}
+
+func (r *FileGrantRepository) Create(grant *models.FileGrant) error {
+	return r.db.Create(grant).Error
+}
+
+// FindExisting ищет уже выданный доступ к тому же файлу или папке; nil, если его нет
+func (r *FileGrantRepository) FindExisting(ownerID, granteeID uint, fileID *uuid.UUID, folderPath string) (*models.FileGrant, error) {
+	query := r.db.Where("owner_id = ? AND grantee_id = ?", ownerID, granteeID)
+	if fileID != nil {
+		query = query.Where("file_id = ?", *fileID)
+	} else {
+		query = query.Where("file_id IS NULL AND folder_path = ?", folderPath)
+	}
+
+	var grant models.FileGrant
+	if err := query.First(&grant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func (r *FileGrantRepository) Update(grant *models.FileGrant) error {
+	return r.db.Save(grant).Error
+}
+
+func (r *FileGrantRepository) FindByOwnerID(ownerID uint) ([]models.FileGrant, error) {
+	var grants []models.FileGrant
+	err := r.db.Preload("Owner").Preload("Grantee").Preload("File").
+		Where("owner_id = ?", ownerID).Order("created_at desc").Find(&grants).Error
+	return grants, err
+}
+
+func (r *FileGrantRepository) FindByGranteeID(granteeID uint) ([]models.FileGrant, error) {
+	var grants []models.FileGrant
+	err := r.db.Preload("Owner").Preload("Grantee").Preload("File").
+		Where("grantee_id = ?", granteeID).Order("created_at desc").Find(&grants).Error
+	return grants, err
+}
+
+// FindBetween - все доступы, выданные владельцем конкретному пользователю.
+// Проверки прав читают их при каждом запросе, поэтому отзыв действует сразу.
+func (r *FileGrantRepository) FindBetween(ownerID, granteeID uint) ([]models.FileGrant, error) {
+	var grants []models.FileGrant
+	err := r.db.Where("owner_id = ? AND grantee_id = ?", ownerID, granteeID).Find(&grants).Error
+	return grants, err
+}
+
+// Delete удаляет доступ, только если он принадлежит владельцу; возвращает удаленную запись
+func (r *FileGrantRepository) Delete(id, ownerID uint) (*models.FileGrant, error) {
+	var grant models.FileGrant
+	if err := r.db.Where("id = ? AND owner_id = ?", id, ownerID).First(&grant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := r.db.Delete(&grant).Error; err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
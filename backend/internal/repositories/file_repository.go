@@ -17,13 +17,38 @@ func NewFileRepository(db *gorm.DB) *FileRepository {
 	return &FileRepository{db: db}
 }
 
+// journalLockNamespace - первый ключ pg_advisory_xact_lock для журнала изменений.
+// Блокировка по пользователю гарантирует, что порядок Seq совпадает с порядком коммитов.
+const journalLockNamespace = 0x40
+
+// recordChange пишет запись журнала синхронизации в той же транзакции, что и само изменение
+func recordChange(tx *gorm.DB, op string, file *models.File, oldPath string) error {
+	// Пространства команд и E2E-хранилища в журнал синхронизации пользователя не попадают
+	if file.TeamID != nil || file.VaultID != nil {
+		return nil
+	}
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", journalLockNamespace, int32(file.UserID)).Error; err != nil {
+		return err
+	}
+	return tx.Create(models.NewFileChange(op, file, oldPath)).Error
+}
+
 func (r *FileRepository) Create(file *models.File) error {
-	return r.db.Create(file).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(file).Error; err != nil {
+			return err
+		}
+		if err := adjustUsage(tx, file, file.Size, 0); err != nil {
+			return err
+		}
+		return recordChange(tx, models.ChangeCreate, file, "")
+	})
 }
 
+// FindByID не находит файлы E2E-хранилищ: с ними работает только VaultRepository
 func (r *FileRepository) FindByID(id uuid.UUID) (*models.File, error) {
 	var file models.File
-	err := r.db.Preload("User").Where("id = ?", id).First(&file).Error
+	err := r.db.Preload("User").Where("id = ? AND vault_id IS NULL", id).First(&file).Error
 	if err != nil {
 		return nil, err
 	}
@@ -32,7 +57,18 @@ func (r *FileRepository) FindByID(id uuid.UUID) (*models.File, error) {
 
 func (r *FileRepository) FindByIDUnscoped(id uuid.UUID) (*models.File, error) {
 	var file models.File
-	err := r.db.Unscoped().Preload("User").Where("id = ?", id).First(&file).Error
+	err := r.db.Unscoped().Preload("User").Where("id = ? AND vault_id IS NULL", id).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// FindPersonalByID ищет файл только в личном пространстве пользователя:
+// командные файлы и файлы хранилищ с тем же user_id не находятся
+func (r *FileRepository) FindPersonalByID(id uuid.UUID, userID uint) (*models.File, error) {
+	var file models.File
+	err := r.db.Scopes(personalSpace(userID)).Where("id = ?", id).First(&file).Error
 	if err != nil {
 		return nil, err
 	}
@@ -41,19 +77,19 @@ func (r *FileRepository) FindByIDUnscoped(id uuid.UUID) (*models.File, error) {
 
 func (r *FileRepository) FindByUserID(userID uint) ([]models.File, error) {
 	var files []models.File
-	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&files).Error
+	err := r.db.Scopes(personalSpace(userID)).Order("created_at DESC").Find(&files).Error
 	return files, err
 }
 
 func (r *FileRepository) FindByIDs(fileIDs []uuid.UUID, userID uint) ([]models.File, error) {
 	var files []models.File
-	err := r.db.Where("id IN ? AND user_id = ?", fileIDs, userID).Find(&files).Error
+	err := r.db.Scopes(personalSpace(userID)).Where("id IN ?", fileIDs).Find(&files).Error
 	return files, err
 }
 
 func (r *FileRepository) FindRecentByUserID(userID uint, limit int) ([]models.File, error) {
 	var files []models.File
-	err := r.db.Where("user_id = ?", userID).
+	err := r.db.Scopes(personalSpace(userID)).
 		Order("created_at DESC").
 		Limit(limit).
 		Find(&files).Error
@@ -62,7 +98,7 @@ func (r *FileRepository) FindRecentByUserID(userID uint, limit int) ([]models.Fi
 
 func (r *FileRepository) FindBySHA256AndUserID(sha256 string, userID uint) (*models.File, error) {
 	var file models.File
-	err := r.db.Where("sha256 = ? AND user_id = ?", sha256, userID).First(&file).Error
+	err := r.db.Scopes(personalSpace(userID)).Where("sha256 = ?", sha256).First(&file).Error
 	if err != nil {
 		return nil, err
 	}
@@ -76,14 +112,56 @@ func (r *FileRepository) CountBySHA256(sha256 string) (int64, error) {
 }
 
 func (r *FileRepository) Update(file *models.File) error {
-	return r.db.Save(file).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var previous models.File
+		if err := tx.Select("virtual_path", "user_id", "team_id", "size").Where("id = ?", file.ID).First(&previous).Error; err != nil {
+			return err
+		}
+		if err := tx.Save(file).Error; err != nil {
+			return err
+		}
+		if previous.Size != file.Size || previous.UserID != file.UserID || !sameTeam(previous.TeamID, file.TeamID) {
+			if err := adjustUsage(tx, &previous, -previous.Size, 0); err != nil {
+				return err
+			}
+			if err := adjustUsage(tx, file, file.Size, 0); err != nil {
+				return err
+			}
+		}
+		if previous.VirtualPath != file.VirtualPath {
+			return recordChange(tx, models.ChangeMove, file, previous.VirtualPath)
+		}
+		return recordChange(tx, models.ChangeUpdate, file, "")
+	})
 }
 
 func (r *FileRepository) Delete(id uuid.UUID) error {
-	return r.db.Where("id = ?", id).Delete(&models.File{}).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var file models.File
+		if err := tx.Where("id = ?", id).First(&file).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", id).Delete(&models.File{}).Error; err != nil {
+			return err
+		}
+		if err := adjustUsage(tx, &file, -file.Size, file.Size); err != nil {
+			return err
+		}
+		return recordChange(tx, models.ChangeTrash, &file, "")
+	})
 }
 
 func (r *FileRepository) FindByUserIDAndPath(userID uint, virtualPath string) ([]models.File, error) {
+	return r.findByPath(personalSpace(userID), virtualPath)
+}
+
+// FindByTeamAndPath - то же, что FindByUserIDAndPath, для пространства команды
+func (r *FileRepository) FindByTeamAndPath(teamID uint, virtualPath string) ([]models.File, error) {
+	return r.findByPath(teamSpace(teamID), virtualPath)
+}
+
+// findByPath возвращает содержимое папки в пространстве space, включая неявные подпапки
+func (r *FileRepository) findByPath(space func(*gorm.DB) *gorm.DB, virtualPath string) ([]models.File, error) {
 	var files []models.File
 
 	// Нормализуем путь - он должен заканчиваться на /
@@ -92,7 +170,7 @@ func (r *FileRepository) FindByUserIDAndPath(userID uint, virtualPath string) ([
 	}
 
 	// Получаем файлы в текущем пути
-	err := r.db.Where("user_id = ? AND virtual_path = ?", userID, virtualPath).
+	err := r.db.Scopes(space).Where("virtual_path = ?", virtualPath).
 		Order("folder_name ASC, original_name ASC").
 		Find(&files).Error
 
@@ -107,7 +185,8 @@ func (r *FileRepository) FindByUserIDAndPath(userID uint, virtualPath string) ([
 
 	err = r.db.Model(&models.File{}).
 		Select("DISTINCT virtual_path").
-		Where("user_id = ? AND virtual_path LIKE ? AND virtual_path != ?", userID, searchPattern, virtualPath).
+		Scopes(space).
+		Where("virtual_path LIKE ? AND virtual_path != ?", searchPattern, virtualPath).
 		Find(&subPaths).Error
 
 	if err != nil {
@@ -149,28 +228,59 @@ func (r *FileRepository) FindByUserIDAndPath(userID uint, virtualPath string) ([
 
 func (r *FileRepository) FindDeletedByUserID(userID uint) ([]models.File, error) {
 	var files []models.File
-	err := r.db.Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", userID).Order("deleted_at DESC").Find(&files).Error
+	err := r.db.Unscoped().Scopes(personalSpace(userID)).Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&files).Error
 	return files, err
 }
 
 func (r *FileRepository) Restore(id uuid.UUID) error {
-	return r.db.Unscoped().Model(&models.File{}).Where("id = ?", id).Update("deleted_at", nil).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Unscoped().Model(&models.File{}).Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+		if res.Error != nil {
+			return res.Error
+		}
+		var file models.File
+		if err := tx.Where("id = ?", id).First(&file).Error; err != nil {
+			return err
+		}
+		if res.RowsAffected > 0 {
+			if err := adjustUsage(tx, &file, file.Size, -file.Size); err != nil {
+				return err
+			}
+		}
+		return recordChange(tx, models.ChangeRestore, &file, "")
+	})
 }
 
 func (r *FileRepository) DeletePermanently(id uuid.UUID) error {
-	return r.db.Unscoped().Where("id = ?", id).Delete(&models.File{}).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var file models.File
+		if err := tx.Unscoped().Where("id = ?", id).First(&file).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("id = ?", id).Delete(&models.File{}).Error; err != nil {
+			return err
+		}
+		used, trash := -file.Size, int64(0)
+		if file.DeletedAt.Valid {
+			used, trash = 0, -file.Size
+		}
+		if err := adjustUsage(tx, &file, used, trash); err != nil {
+			return err
+		}
+		return recordChange(tx, models.ChangeDelete, &file, "")
+	})
 }
 
 func (r *FileRepository) CountBySHA256Unscoped(sha256 string) (int64, error) {
 	var count int64
-	err := r.db.Unscoped().Model(&models.File{}).Where("sha256 = ?", sha256).Count(&count).Error
+	err := r.db.Unscoped().Model(&models.File{}).Where("sha256 = ? AND vault_id IS NULL", sha256).Count(&count).Error
 	return count, err
 }
 
 func (r *FileRepository) FindImagesByUserID(userID uint, limit int) ([]models.File, error) {
 	var files []models.File
 	// MIME types for images: image/jpeg, image/png, image/gif, etc.
-	err := r.db.Where("user_id = ? AND mime_type LIKE ?", userID, "image/%").
+	err := r.db.Scopes(personalSpace(userID)).Where("mime_type LIKE ?", "image/%").
 		Order("created_at DESC").
 		Limit(limit).
 		Find(&files).Error
@@ -179,10 +289,19 @@ func (r *FileRepository) FindImagesByUserID(userID uint, limit int) ([]models.Fi
 
 // SearchByName searches files by original_name (case-insensitive)
 func (r *FileRepository) SearchByName(userID uint, query string, limit int) ([]models.File, error) {
+	return r.searchByName(personalSpace(userID), query, limit)
+}
+
+// SearchByNameInTeam ищет файлы в пространстве команды
+func (r *FileRepository) SearchByNameInTeam(teamID uint, query string, limit int) ([]models.File, error) {
+	return r.searchByName(teamSpace(teamID), query, limit)
+}
+
+func (r *FileRepository) searchByName(space func(*gorm.DB) *gorm.DB, query string, limit int) ([]models.File, error) {
 	var files []models.File
 	searchPattern := "%" + query + "%"
-	err := r.db.Where("user_id = ? AND original_name ILIKE ? AND mime_type != ?",
-		userID, searchPattern, "inode/directory").
+	err := r.db.Scopes(space).Where("original_name ILIKE ? AND mime_type != ?",
+		searchPattern, "inode/directory").
 		Order("updated_at DESC").
 		Limit(limit).
 		Find(&files).Error
@@ -199,7 +318,7 @@ func (r *FileRepository) FindAllRecursively(userID uint, virtualPathPrefix strin
 
 	searchPattern := virtualPathPrefix + "%"
 
-	err := r.db.Where("user_id = ? AND virtual_path LIKE ?", userID, searchPattern).
+	err := r.db.Scopes(personalSpace(userID)).Where("virtual_path LIKE ?", searchPattern).
 		Find(&files).Error
 
 	if err != nil {
@@ -220,7 +339,7 @@ func (r *FileRepository) GetStorageStats(userID uint) (*models.StorageStats, err
 	var results []Result
 	err := r.db.Model(&models.File{}).
 		Select("mime_type, size").
-		Where("user_id = ?", userID).
+		Scopes(personalSpace(userID)).
 		Find(&results).Error
 
 	if err != nil {
@@ -248,7 +367,8 @@ func (r *FileRepository) GetStorageStats(userID uint) (*models.StorageStats, err
 	}
 	err = r.db.Unscoped().Model(&models.File{}).
 		Select("COALESCE(SUM(size), 0) as total_size").
-		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Scopes(personalSpace(userID)).
+		Where("deleted_at IS NOT NULL").
 		Scan(&trashResult).Error
 
 	if err != nil {
@@ -256,5 +376,137 @@ func (r *FileRepository) GetStorageStats(userID uint) (*models.StorageStats, err
 	}
 	stats.TrashSize = trashResult.TotalSize
 
+	// Хранилища не делятся по типам: MIME-тип их файлов неизвестен
+	err = r.db.Model(&models.File{}).
+		Select("COALESCE(SUM(size), 0)").
+		Where("user_id = ? AND team_id IS NULL AND vault_id IS NOT NULL", userID).
+		Scan(&stats.VaultSize).Error
+	if err != nil {
+		return nil, err
+	}
+	stats.TotalUsed += stats.VaultSize
+
+	return stats, nil
+}
+
+// WithTx возвращает копию репозитория, работающую внутри транзакции tx
+func (r *FileRepository) WithTx(tx *gorm.DB) *FileRepository {
+	return &FileRepository{db: tx}
+}
+
+// Transaction выполняет fn в одной транзакции БД
+func (r *FileRepository) Transaction(fn func(tx *gorm.DB) error) error {
+	return r.db.Transaction(fn)
+}
+
+// FindByPathAndName ищет файлы с указанным именем в папке (новые первыми)
+func (r *FileRepository) FindByPathAndName(userID uint, virtualPath, name string) ([]models.File, error) {
+	var files []models.File
+	err := r.db.Scopes(personalSpace(userID)).Where("virtual_path = ? AND original_name = ?", virtualPath, name).
+		Order("created_at DESC").
+		Find(&files).Error
+	return files, err
+}
+
+// HasFilesUnderPath проверяет, есть ли файлы внутри папки (папки без маркера существуют неявно)
+func (r *FileRepository) HasFilesUnderPath(userID uint, virtualPathPrefix string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.File{}).
+		Scopes(personalSpace(userID)).
+		Where("virtual_path LIKE ?", virtualPathPrefix+"%").
+		Limit(1).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// personalSpace - файлы личного пространства пользователя (без файлов команд, которые он загрузил,
+// и без E2E-хранилищ: их имена и содержимое сервер не видит)
+func personalSpace(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ? AND team_id IS NULL AND vault_id IS NULL", userID)
+	}
+}
+
+func sameTeam(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// teamSpace - файлы пространства команды; user_id у них - кто загрузил, а не владелец
+func teamSpace(teamID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("team_id = ?", teamID)
+	}
+}
+
+func (r *FileRepository) FindBySHA256AndTeam(sha256 string, teamID uint) (*models.File, error) {
+	var file models.File
+	err := r.db.Scopes(teamSpace(teamID)).Where("sha256 = ?", sha256).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+func (r *FileRepository) FindDeletedByTeam(teamID uint) ([]models.File, error) {
+	var files []models.File
+	err := r.db.Unscoped().Scopes(teamSpace(teamID)).Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&files).Error
+	return files, err
+}
+
+// TeamStorageUsed - сколько занимают активные файлы команды (для квоты команды)
+func (r *FileRepository) TeamStorageUsed(teamID uint) (int64, error) {
+	var used int64
+	err := r.db.Model(&models.File{}).
+		Select("COALESCE(SUM(size), 0)").
+		Scopes(teamSpace(teamID)).
+		Scan(&used).Error
+	return used, err
+}
+
+// FindAllByUserIDUnscoped - все файлы личного пространства, включая корзину
+func (r *FileRepository) FindAllByUserIDUnscoped(userID uint) ([]models.File, error) {
+	var files []models.File
+	err := r.db.Unscoped().Scopes(personalSpace(userID)).Find(&files).Error
+	return files, err
+}
+
+// GetGlobalStats считает занятое место по всему серверу. Папки не учитываются,
+// корзина входит в объем блобов: ее файлы еще лежат на диске.
+func (r *FileRepository) GetGlobalStats() (*models.GlobalStorageStats, error) {
+	stats := &models.GlobalStorageStats{}
+
+	err := r.db.Unscoped().Model(&models.File{}).
+		Select("COUNT(*) FILTER (WHERE deleted_at IS NULL) AS files, "+
+			"COALESCE(SUM(size) FILTER (WHERE deleted_at IS NULL), 0) AS logical_bytes, "+
+			"COALESCE(SUM(size) FILTER (WHERE deleted_at IS NOT NULL), 0) AS trash_bytes").
+		Where("mime_type <> ?", "inode/directory").
+		Scan(stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Файлы E2E-хранилищ не дедуплицируются: у каждого свой блоб
+	blobs := r.db.Unscoped().Model(&models.File{}).
+		Select("DISTINCT ON (CASE WHEN vault_id IS NULL THEN sha256 ELSE path END) size, encrypted_size").
+		Where("mime_type <> ? AND sha256 <> ''", "inode/directory").
+		Order("CASE WHEN vault_id IS NULL THEN sha256 ELSE path END")
+	var unique struct {
+		UniqueBlobs int64
+		UniqueBytes int64
+		StoredBytes int64
+	}
+	err = r.db.Table("(?) AS blobs", blobs).
+		Select("COUNT(*) AS unique_blobs, COALESCE(SUM(size), 0) AS unique_bytes, COALESCE(SUM(encrypted_size), 0) AS stored_bytes").
+		Scan(&unique).Error
+	if err != nil {
+		return nil, err
+	}
+	stats.UniqueBlobs = unique.UniqueBlobs
+	stats.UniqueBytes = unique.UniqueBytes
+	stats.StoredBytes = unique.StoredBytes
+
 	return stats, nil
 }
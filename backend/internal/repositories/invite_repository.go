@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"gorm.io/gorm"
+)
+
+type InviteRepository struct {
+	db *gorm.DB
+}
+
+func NewInviteRepository(db *gorm.DB) *InviteRepository {
+	return &InviteRepository{db: db}
+}
+
+func (r *InviteRepository) Create(invite *models.Invite) error {
+	return r.db.Create(invite).Error
+}
+
+func (r *InviteRepository) FindByCreator(userID uint) ([]models.Invite, error) {
+	var invites []models.Invite
+	err := r.db.Where("created_by = ?", userID).Order("created_at DESC").Find(&invites).Error
+	return invites, err
+}
+
+// CountByCreator считает и отозванные, и использованные приглашения:
+// иначе лимит обходился бы отзывом старых
+func (r *InviteRepository) CountByCreator(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Invite{}).Where("created_by = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// List - все приглашения сервера для администратора
+func (r *InviteRepository) List(limit, offset int) ([]models.Invite, int64, error) {
+	var total int64
+	if err := r.db.Model(&models.Invite{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var invites []models.Invite
+	err := r.db.Order("created_at DESC").Limit(limit).Offset(offset).Find(&invites).Error
+	return invites, total, err
+}
+
+func (r *InviteRepository) FindByHash(hash string) (*models.Invite, error) {
+	var invite models.Invite
+	err := r.db.Where("code_hash = ?", hash).First(&invite).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// Use засчитывает использование, если приглашение еще действует. Проверка и
+// увеличение счетчика - один UPDATE, поэтому параллельные регистрации не
+// превысят MaxUses.
+func (r *InviteRepository) Use(id uint, now time.Time) (bool, error) {
+	result := r.db.Model(&models.Invite{}).
+		Where("id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?) AND (max_uses = 0 OR uses < max_uses)", id, now).
+		Update("uses", gorm.Expr("uses + 1"))
+	return result.RowsAffected > 0, result.Error
+}
+
+// Release возвращает использование, если регистрация по приглашению не удалась
+func (r *InviteRepository) Release(id uint) error {
+	return r.db.Model(&models.Invite{}).
+		Where("id = ? AND uses > 0", id).
+		Update("uses", gorm.Expr("uses - 1")).Error
+}
+
+// Revoke отзывает приглашение; createdBy = 0 - любое (для администратора).
+// Возвращает false, если такого приглашения нет.
+func (r *InviteRepository) Revoke(id, createdBy uint, now time.Time) (bool, error) {
+	db := r.db.Model(&models.Invite{}).Where("id = ?", id)
+	if createdBy != 0 {
+		db = db.Where("created_by = ?", createdBy)
+	}
+	result := db.Update("revoked_at", gorm.Expr("COALESCE(revoked_at, ?)", now))
+	return result.RowsAffected > 0, result.Error
+}
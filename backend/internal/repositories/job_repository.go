@@ -0,0 +1,209 @@
+package repositories
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type JobRepository struct {
+	db *gorm.DB
+}
+
+func NewJobRepository(db *gorm.DB) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+func (r *JobRepository) Create(job *models.Job) error {
+	return r.db.Create(job).Error
+}
+
+func (r *JobRepository) FindByID(id uuid.UUID) (*models.Job, error) {
+	var job models.Job
+	if err := r.db.Where("id = ?", id).First(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// HasActive проверяет, есть ли ожидающая или выполняющаяся задача такого типа
+func (r *JobRepository) HasActive(jobType string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Job{}).
+		Where("type = ? AND status IN ?", jobType, []models.JobStatus{models.JobPending, models.JobRunning}).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *JobRepository) FindByUserID(userID uint, limit int) ([]models.Job, error) {
+	var jobs []models.Job
+	err := r.db.Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&jobs).Error
+	return jobs, err
+}
+
+// ClaimNext атомарно забирает следующую готовую к запуску задачу.
+// SKIP LOCKED позволяет нескольким репликам бэкенда разбирать одну очередь.
+func (r *JobRepository) ClaimNext(workerID string, types []string) (*models.Job, error) {
+	var job models.Job
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND run_after <= ? AND type IN ?", models.JobPending, time.Now(), types).
+			Order("created_at ASC").
+			First(&job).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		job.Status = models.JobRunning
+		job.WorkerID = workerID
+		job.Attempts++
+		job.StartedAt = &now
+		job.HeartbeatAt = &now
+
+		return tx.Model(&models.Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"status":       job.Status,
+			"worker_id":    workerID,
+			"attempts":     job.Attempts,
+			"started_at":   now,
+			"heartbeat_at": now,
+		}).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// UpdateProgress сохраняет прогресс и продлевает heartbeat, если задача все еще
+// выполняется этим воркером. Возвращает true, если задачу пора остановить:
+// пользователь запросил отмену или задача уже передана другому воркеру.
+func (r *JobRepository) UpdateProgress(id uuid.UUID, workerID string, progress, total int64) (bool, error) {
+	res := r.db.Model(&models.Job{}).
+		Where("id = ? AND worker_id = ? AND status = ?", id, workerID, models.JobRunning).
+		Updates(map[string]interface{}{
+			"progress":     progress,
+			"total":        total,
+			"heartbeat_at": time.Now(),
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return true, nil
+	}
+
+	var job models.Job
+	if err := r.db.Select("cancel_requested").Where("id = ?", id).First(&job).Error; err != nil {
+		return false, err
+	}
+	return job.CancelRequested, nil
+}
+
+// Finish завершает задачу, если она все еще за этим воркером. false - задачу
+// уже вернули в очередь как зависшую, и ее статусом распоряжается новый запуск.
+func (r *JobRepository) Finish(id uuid.UUID, workerID string, status models.JobStatus, result json.RawMessage, errMsg string) (bool, error) {
+	updates := map[string]interface{}{
+		"status":      status,
+		"error":       errMsg,
+		"finished_at": time.Now(),
+	}
+	if result != nil {
+		updates["result"] = result
+	}
+	res := r.db.Model(&models.Job{}).
+		Where("id = ? AND worker_id = ? AND status = ?", id, workerID, models.JobRunning).
+		Updates(updates)
+	return res.RowsAffected > 0, res.Error
+}
+
+// Requeue возвращает задачу в очередь для повторной попытки (с той же оговоркой, что Finish)
+func (r *JobRepository) Requeue(id uuid.UUID, workerID string, runAfter time.Time, errMsg string) (bool, error) {
+	res := r.db.Model(&models.Job{}).
+		Where("id = ? AND worker_id = ? AND status = ?", id, workerID, models.JobRunning).
+		Updates(map[string]interface{}{
+			"status":    models.JobPending,
+			"run_after": runAfter,
+			"error":     errMsg,
+			"worker_id": "",
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+// RequestCancel отменяет ожидающую задачу сразу, а выполняющейся выставляет флаг
+func (r *JobRepository) RequestCancel(id uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Job{}).
+			Where("id = ? AND status = ?", id, models.JobPending).
+			Updates(map[string]interface{}{"status": models.JobCanceled, "finished_at": time.Now(), "cancel_requested": true}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.Job{}).
+			Where("id = ? AND status = ?", id, models.JobRunning).
+			Update("cancel_requested", true).Error
+	})
+}
+
+// RequeueStale разбирает задачи, воркер которых перестал отвечать (например, упал контейнер).
+// Отмененные пользователем завершаются как canceled, исчерпавшие попытки - как failed:
+// задача, которая роняет процесс, не должна перезапускаться бесконечно. Остальные
+// возвращаются в очередь. Возвращает число возвращенных и закрытых задач.
+func (r *JobRepository) RequeueStale(heartbeatBefore time.Time) (requeued, closed int64, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		stale := func() *gorm.DB {
+			return tx.Model(&models.Job{}).Where("status = ? AND heartbeat_at < ?", models.JobRunning, heartbeatBefore)
+		}
+
+		res := stale().Where("cancel_requested = ?", true).Updates(map[string]interface{}{
+			"status":      models.JobCanceled,
+			"error":       "canceled",
+			"finished_at": now,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		closed = res.RowsAffected
+
+		res = stale().Where("attempts >= max_attempts").Updates(map[string]interface{}{
+			"status":      models.JobFailed,
+			"error":       "worker stopped responding",
+			"finished_at": now,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		closed += res.RowsAffected
+
+		res = stale().Updates(map[string]interface{}{"status": models.JobPending, "worker_id": "", "run_after": now})
+		requeued = res.RowsAffected
+		return res.Error
+	})
+	return requeued, closed, err
+}
+
+func (r *JobRepository) FindFinishedBefore(before time.Time) ([]models.Job, error) {
+	var jobs []models.Job
+	err := r.db.Where("status IN ? AND finished_at < ?",
+		[]models.JobStatus{models.JobCompleted, models.JobFailed, models.JobCanceled}, before).
+		Find(&jobs).Error
+	return jobs, err
+}
+
+func (r *JobRepository) Delete(id uuid.UUID) error {
+	return r.db.Where("id = ?", id).Delete(&models.Job{}).Error
+}
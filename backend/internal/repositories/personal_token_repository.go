@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"gorm.io/gorm"
+)
+
+type PersonalTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewPersonalTokenRepository(db *gorm.DB) *PersonalTokenRepository {
+	return &PersonalTokenRepository{db: db}
+}
+
+func (r *PersonalTokenRepository) Create(token *models.PersonalToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *PersonalTokenRepository) FindByUserID(userID uint) ([]models.PersonalToken, error) {
+	var tokens []models.PersonalToken
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *PersonalTokenRepository) CountByUserID(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.PersonalToken{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// FindActiveByHash возвращает неистекший токен или nil
+func (r *PersonalTokenRepository) FindActiveByHash(hash string, now time.Time) (*models.PersonalToken, error) {
+	var token models.PersonalToken
+	err := r.db.Where("token_hash = ? AND (expires_at IS NULL OR expires_at > ?)", hash, now).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Touch обновляет время и адрес последнего использования, но не чаще раза в
+// interval: скрипт может делать сотни запросов в минуту
+func (r *PersonalTokenRepository) Touch(id uint, ip string, now time.Time, interval time.Duration) error {
+	return r.db.Model(&models.PersonalToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, now.Add(-interval)).
+		Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": ip,
+		}).Error
+}
+
+// Delete отзывает токен пользователя, возвращает false, если такого токена нет
+func (r *PersonalTokenRepository) Delete(id uint, userID uint) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.PersonalToken{})
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type S3UploadRepository struct {
+	db *gorm.DB
+}
+
+func NewS3UploadRepository(db *gorm.DB) *S3UploadRepository {
+	return &S3UploadRepository{db: db}
+}
+
+func (r *S3UploadRepository) Create(upload *models.S3MultipartUpload) error {
+	return r.db.Create(upload).Error
+}
+
+// FindByID возвращает загрузку вместе с частями (по возрастанию номера)
+func (r *S3UploadRepository) FindByID(id uuid.UUID, userID uint) (*models.S3MultipartUpload, error) {
+	var upload models.S3MultipartUpload
+	err := r.db.Preload("Parts", func(db *gorm.DB) *gorm.DB {
+		return db.Order("part_number ASC")
+	}).Where("id = ? AND user_id = ?", id, userID).First(&upload).Error
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+func (r *S3UploadRepository) FindByBucket(userID uint, bucket string) ([]models.S3MultipartUpload, error) {
+	var uploads []models.S3MultipartUpload
+	err := r.db.Where("user_id = ? AND bucket = ?", userID, bucket).
+		Order("key ASC, created_at ASC").
+		Find(&uploads).Error
+	return uploads, err
+}
+
+func (r *S3UploadRepository) FindOlderThan(before time.Time) ([]models.S3MultipartUpload, error) {
+	var uploads []models.S3MultipartUpload
+	err := r.db.Where("created_at < ?", before).Find(&uploads).Error
+	return uploads, err
+}
+
+// SavePart создает или перезаписывает часть (повторная загрузка части с тем же номером разрешена)
+func (r *S3UploadRepository) SavePart(part *models.S3MultipartPart) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "upload_id"}, {Name: "part_number"}},
+		DoUpdates: clause.AssignmentColumns([]string{"e_tag", "size", "updated_at"}),
+	}).Create(part).Error
+}
+
+// PendingSize - сколько места уже занимают незавершенные загрузки пользователя,
+// не считая части partNumber загрузки uploadID (ее заменяет новая загрузка части)
+func (r *S3UploadRepository) PendingSize(userID uint, uploadID uuid.UUID, partNumber int) (int64, error) {
+	var total int64
+	err := r.db.Model(&models.S3MultipartPart{}).
+		Joins("JOIN s3_multipart_uploads ON s3_multipart_uploads.id = s3_multipart_parts.upload_id").
+		Where("s3_multipart_uploads.user_id = ?", userID).
+		Where("NOT (s3_multipart_parts.upload_id = ? AND s3_multipart_parts.part_number = ?)", uploadID, partNumber).
+		Select("COALESCE(SUM(s3_multipart_parts.size), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// WithTx возвращает копию репозитория, работающую внутри транзакции tx
+func (r *S3UploadRepository) WithTx(tx *gorm.DB) *S3UploadRepository {
+	return &S3UploadRepository{db: tx}
+}
+
+func (r *S3UploadRepository) Delete(id uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("upload_id = ?", id).Delete(&models.S3MultipartPart{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&models.S3MultipartUpload{}).Error
+	})
+}
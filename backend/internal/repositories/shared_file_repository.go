@@ -1,6 +1,8 @@
 package repositories
 
 import (
+	"time"
+
 	"github.com/bhop_dynasty/0x40_cloud/internal/models"
 
 	"gorm.io/gorm"
@@ -14,6 +16,11 @@ func NewSharedFileRepository(db *gorm.DB) *SharedFileRepository {
 	return &SharedFileRepository{db: db}
 }
 
+// WithTx возвращает копию репозитория, работающую внутри транзакции tx
+func (r *SharedFileRepository) WithTx(tx *gorm.DB) *SharedFileRepository {
+	return &SharedFileRepository{db: tx}
+}
+
 func (r *SharedFileRepository) Create(share *models.SharedFile) error {
 	return r.db.Create(share).Error
 }
@@ -28,7 +35,10 @@ func (r *SharedFileRepository) GetByToken(token string) (*models.SharedFile, err
 
 func (r *SharedFileRepository) GetByUserID(userID uint) ([]models.SharedFile, error) {
 	var shares []models.SharedFile
-	if err := r.db.Preload("File").Where("user_id = ?", userID).Order("created_at desc").Find(&shares).Error; err != nil {
+	err := r.db.Preload("File").
+		Preload("DownloadEvents", func(db *gorm.DB) *gorm.DB { return db.Order("created_at desc") }).
+		Where("user_id = ?", userID).Order("created_at desc").Find(&shares).Error
+	if err != nil {
 		return nil, err
 	}
 	return shares, nil
@@ -38,6 +48,45 @@ func (r *SharedFileRepository) Delete(token string) error {
 	return r.db.Where("token = ?", token).Delete(&models.SharedFile{}).Error
 }
 
-func (r *SharedFileRepository) IncrementDownloads(token string) error {
-	return r.db.Model(&models.SharedFile{}).Where("token = ?", token).UpdateColumn("downloads", gorm.Expr("downloads + ?", 1)).Error
+// ReserveDownload атомарно проверяет срок и лимит ссылки и занимает одно скачивание.
+// false - ссылка уже исчерпана или истекла (в том числе из-за параллельного запроса).
+func (r *SharedFileRepository) ReserveDownload(token string) (bool, error) {
+	return r.reserve(token, "downloads")
+}
+
+// ReleaseDownload возвращает занятое скачивание, если передача не состоялась
+func (r *SharedFileRepository) ReleaseDownload(token string) error {
+	return r.release(token, "downloads")
+}
+
+// ReserveUpload - то же, что ReserveDownload, для загрузок по запросу файлов
+func (r *SharedFileRepository) ReserveUpload(token string) (bool, error) {
+	return r.reserve(token, "uploads")
+}
+
+func (r *SharedFileRepository) ReleaseUpload(token string) error {
+	return r.release(token, "uploads")
+}
+
+// reserve увеличивает счетчик column одним условным UPDATE, не выходя за limit
+func (r *SharedFileRepository) reserve(token, column string) (bool, error) {
+	result := r.db.Model(&models.SharedFile{}).
+		Where("token = ?", token).
+		Where(`("limit" IS NULL OR `+column+` < "limit")`).
+		Where("(expires_at IS NULL OR expires_at > ?)", time.Now()).
+		UpdateColumn(column, gorm.Expr(column+" + 1"))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *SharedFileRepository) release(token, column string) error {
+	return r.db.Model(&models.SharedFile{}).
+		Where("token = ? AND "+column+" > 0", token).
+		UpdateColumn(column, gorm.Expr(column+" - 1")).Error
+}
+
+func (r *SharedFileRepository) CreateDownloadEvent(event *models.ShareDownloadEvent) error {
+	return r.db.Create(event).Error
 }
@@ -0,0 +1,44 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"gorm.io/gorm"
+)
+
+type SSHKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewSSHKeyRepository(db *gorm.DB) *SSHKeyRepository {
+	return &SSHKeyRepository{db: db}
+}
+
+func (r *SSHKeyRepository) Create(key *models.SSHKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *SSHKeyRepository) FindByFingerprint(fingerprint string) (*models.SSHKey, error) {
+	var key models.SSHKey
+	err := r.db.Where("fingerprint = ?", fingerprint).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *SSHKeyRepository) FindByUserID(userID uint) ([]models.SSHKey, error) {
+	var keys []models.SSHKey
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// Delete удаляет ключ пользователя, возвращает false, если такого ключа нет
+func (r *SSHKeyRepository) Delete(id uint, userID uint) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.SSHKey{})
+	return result.RowsAffected > 0, result.Error
+}
@@ -69,3 +69,7 @@ func (r *StarredFileRepository) GetStarredMap(userID uint, fileIDs []uuid.UUID)
 	}
 	return starredMap, nil
 }
+
+func (r *StarredFileRepository) WithTx(tx *gorm.DB) *StarredFileRepository {
+	return &StarredFileRepository{db: tx}
+}
@@ -49,3 +49,7 @@ func (r *StarredFolderRepository) FindStarredFoldersByUserID(userID uint) ([]mod
 	err := r.db.Where("user_id = ?", userID).Find(&folders).Error
 	return folders, err
 }
+
+func (r *StarredFolderRepository) WithTx(tx *gorm.DB) *StarredFolderRepository {
+	return &StarredFolderRepository{db: tx}
+}
@@ -0,0 +1,226 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StorageUsageRepository struct {
+	db *gorm.DB
+}
+
+func NewStorageUsageRepository(db *gorm.DB) *StorageUsageRepository {
+	return &StorageUsageRepository{db: db}
+}
+
+// WithTx возвращает копию репозитория, работающую внутри транзакции tx.
+// Reserve и Release такой копии выполняются точками сохранения tx: счетчик,
+// который tx уже заблокировала, не ждется с другого соединения.
+func (r *StorageUsageRepository) WithTx(tx *gorm.DB) *StorageUsageRepository {
+	return &StorageUsageRepository{db: tx}
+}
+
+// adjustUsage меняет счетчик личного пространства владельца file внутри tx.
+// Вызывается из мутаций FileRepository рядом с recordChange.
+func adjustUsage(tx *gorm.DB, file *models.File, used, trash int64) error {
+	if file.TeamID != nil || (used == 0 && trash == 0) {
+		return nil
+	}
+
+	applied, err := addUsage(tx, file.UserID, used, trash)
+	if err != nil || applied {
+		return err
+	}
+
+	// Счетчика еще нет - строим его по files, где это изменение уже учтено
+	created, err := initUsage(tx, file.UserID)
+	if err != nil || created {
+		return err
+	}
+
+	// Счетчик успел создать параллельный запрос, не видевший нашего изменения
+	_, err = addUsage(tx, file.UserID, used, trash)
+	return err
+}
+
+func addUsage(tx *gorm.DB, userID uint, used, trash int64) (bool, error) {
+	res := tx.Model(&models.StorageUsage{}).
+		Where("user_id = ?", userID).
+		Updates(map[string]interface{}{
+			"used_bytes":  gorm.Expr("used_bytes + ?", used),
+			"trash_bytes": gorm.Expr("trash_bytes + ?", trash),
+			"updated_at":  time.Now(),
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+// usageSums - занятое место пользователя по таблице files
+const usageSums = `SELECT
+	COALESCE(SUM(size) FILTER (WHERE deleted_at IS NULL), 0) AS used_bytes,
+	COALESCE(SUM(size) FILTER (WHERE deleted_at IS NOT NULL), 0) AS trash_bytes
+FROM files WHERE user_id = ? AND team_id IS NULL`
+
+func initUsage(tx *gorm.DB, userID uint) (bool, error) {
+	res := tx.Exec(`INSERT INTO storage_usages (user_id, used_bytes, trash_bytes, reserved_bytes, updated_at)
+SELECT ?, sums.used_bytes, sums.trash_bytes, 0, NOW() FROM (`+usageSums+`) AS sums
+ON CONFLICT (user_id) DO NOTHING`, userID, userID)
+	return res.RowsAffected > 0, res.Error
+}
+
+// lockUsage возвращает счетчик, заблокированный до конца tx, и создает его при необходимости
+func lockUsage(tx *gorm.DB, userID uint) (*models.StorageUsage, error) {
+	var usage models.StorageUsage
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&usage).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if _, err := initUsage(tx, userID); err != nil {
+			return nil, err
+		}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&usage).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// Get возвращает счетчик пользователя, при первом обращении строя его по files
+func (r *StorageUsageRepository) Get(userID uint) (*models.StorageUsage, error) {
+	var usage models.StorageUsage
+	err := r.db.Where("user_id = ?", userID).First(&usage).Error
+	if err == nil {
+		return &usage, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if _, err := initUsage(r.db, userID); err != nil {
+		return nil, err
+	}
+	if err := r.db.Where("user_id = ?", userID).First(&usage).Error; err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// Reserve атомарно занимает место под загрузку. Счетчик блокируется на время
+// проверки, поэтому параллельные загрузки одного пользователя не превысят limit.
+// extra вызывается под блокировкой и возвращает место, учтенное вне счетчика
+// (например, части незавершенных S3-загрузок). false - места не хватает.
+func (r *StorageUsageRepository) Reserve(reservation *models.QuotaReservation, limit int64, includeTrash bool, extra func(tx *gorm.DB) (int64, error)) (bool, error) {
+	reserved := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		usage, err := lockUsage(tx, reservation.UserID)
+		if err != nil {
+			return err
+		}
+
+		used := usage.UsedBytes + usage.ReservedBytes
+		if includeTrash {
+			used += usage.TrashBytes
+		}
+		if extra != nil {
+			pending, err := extra(tx)
+			if err != nil {
+				return err
+			}
+			used += pending
+		}
+		if used+reservation.Size > limit {
+			return nil
+		}
+
+		if err := tx.Model(usage).Update("reserved_bytes", gorm.Expr("reserved_bytes + ?", reservation.Size)).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(reservation).Error; err != nil {
+			return err
+		}
+		reserved = true
+		return nil
+	})
+	return reserved, err
+}
+
+// Release снимает резерв. Повторный вызов и уже снятый сверкой резерв ничего не меняют.
+func (r *StorageUsageRepository) Release(reservation *models.QuotaReservation) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ?", reservation.ID).Delete(&models.QuotaReservation{})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return tx.Model(&models.StorageUsage{}).
+			Where("user_id = ?", reservation.UserID).
+			Update("reserved_bytes", gorm.Expr("GREATEST(reserved_bytes - ?, 0)", reservation.Size)).Error
+	})
+}
+
+// DeleteExpiredReservations удаляет резервы, брошенные упавшими загрузками.
+// reserved_bytes пересчитывается в Reconcile.
+func (r *StorageUsageRepository) DeleteExpiredReservations(now time.Time) (int64, error) {
+	res := r.db.Where("expires_at < ?", now).Delete(&models.QuotaReservation{})
+	return res.RowsAffected, res.Error
+}
+
+// InitMissing создает счетчики пользователям, у которых их еще нет
+// (файлы загружены до появления счетчиков, а изменений с тех пор не было)
+func (r *StorageUsageRepository) InitMissing() (int64, error) {
+	res := r.db.Exec(`INSERT INTO storage_usages (user_id, used_bytes, trash_bytes, reserved_bytes, updated_at)
+SELECT users.id,
+	COALESCE(SUM(files.size) FILTER (WHERE files.deleted_at IS NULL), 0),
+	COALESCE(SUM(files.size) FILTER (WHERE files.deleted_at IS NOT NULL), 0),
+	0, NOW()
+FROM users
+LEFT JOIN files ON files.user_id = users.id AND files.team_id IS NULL
+WHERE users.deleted_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM storage_usages WHERE storage_usages.user_id = users.id)
+GROUP BY users.id
+ON CONFLICT (user_id) DO NOTHING`)
+	return res.RowsAffected, res.Error
+}
+
+func (r *StorageUsageRepository) FindUserIDs() ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&models.StorageUsage{}).Order("user_id").Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// Reconcile пересчитывает счетчик пользователя по files и действующим резервам.
+// Счетчик заблокирован на время пересчета: параллельные изменения files ждут
+// блокировки и применяются поверх уже пересчитанного значения.
+// Возвращает true, если значение пришлось исправить.
+func (r *StorageUsageRepository) Reconcile(userID uint) (bool, error) {
+	corrected := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		usage, err := lockUsage(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		var actual models.StorageUsage
+		if err := tx.Raw(usageSums, userID).Row().Scan(&actual.UsedBytes, &actual.TrashBytes); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.QuotaReservation{}).
+			Select("COALESCE(SUM(size), 0)").
+			Where("user_id = ?", userID).
+			Scan(&actual.ReservedBytes).Error; err != nil {
+			return err
+		}
+
+		if usage.UsedBytes == actual.UsedBytes && usage.TrashBytes == actual.TrashBytes && usage.ReservedBytes == actual.ReservedBytes {
+			return nil
+		}
+		corrected = true
+		return tx.Model(usage).Updates(map[string]interface{}{
+			"used_bytes":     actual.UsedBytes,
+			"trash_bytes":    actual.TrashBytes,
+			"reserved_bytes": actual.ReservedBytes,
+			"updated_at":     time.Now(),
+		}).Error
+	})
+	return corrected, err
+}
@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TeamRepository struct {
+	db *gorm.DB
+}
+
+func NewTeamRepository(db *gorm.DB) *TeamRepository {
+	return &TeamRepository{db: db}
+}
+
+// WithTx возвращает копию репозитория, работающую внутри транзакции tx
+func (r *TeamRepository) WithTx(tx *gorm.DB) *TeamRepository {
+	return &TeamRepository{db: tx}
+}
+
+// Create создает команду вместе с первым участником-владельцем
+func (r *TeamRepository) Create(team *models.Team, ownerID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(team).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TeamMember{TeamID: team.ID, UserID: ownerID, Role: models.TeamRoleOwner}).Error
+	})
+}
+
+func (r *TeamRepository) FindByID(id uint) (*models.Team, error) {
+	var team models.Team
+	if err := r.db.First(&team, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &team, nil
+}
+
+// FindByUserID - команды, в которых состоит пользователь
+func (r *TeamRepository) FindByUserID(userID uint) ([]models.Team, error) {
+	var teams []models.Team
+	err := r.db.Joins("JOIN team_members ON team_members.team_id = teams.id").
+		Where("team_members.user_id = ?", userID).
+		Order("teams.name ASC").
+		Find(&teams).Error
+	return teams, err
+}
+
+// FindMember возвращает участие пользователя в команде; nil, если он не участник
+func (r *TeamRepository) FindMember(teamID, userID uint) (*models.TeamMember, error) {
+	var member models.TeamMember
+	err := r.db.Where("team_id = ? AND user_id = ?", teamID, userID).First(&member).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *TeamRepository) FindMembers(teamID uint) ([]models.TeamMember, error) {
+	var members []models.TeamMember
+	err := r.db.Preload("User").Where("team_id = ?", teamID).Order("created_at ASC").Find(&members).Error
+	return members, err
+}
+
+func (r *TeamRepository) CountOwners(teamID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.TeamMember{}).Where("team_id = ? AND role = ?", teamID, models.TeamRoleOwner).Count(&count).Error
+	return count, err
+}
+
+// SaveMember добавляет участника или меняет его роль
+func (r *TeamRepository) SaveMember(member *models.TeamMember) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "team_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role"}),
+	}).Create(member).Error
+}
+
+func (r *TeamRepository) RemoveMember(teamID, userID uint) (bool, error) {
+	result := r.db.Where("team_id = ? AND user_id = ?", teamID, userID).Delete(&models.TeamMember{})
+	return result.RowsAffected > 0, result.Error
+}
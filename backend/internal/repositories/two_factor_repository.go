@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"gorm.io/gorm"
+)
+
+// TwoFactorRepository - TOTP-секреты пользователей и коды восстановления
+type TwoFactorRepository struct {
+	db *gorm.DB
+}
+
+func NewTwoFactorRepository(db *gorm.DB) *TwoFactorRepository {
+	return &TwoFactorRepository{db: db}
+}
+
+// SetPendingSecret сохраняет новый, еще не подтвержденный секрет
+func (r *TwoFactorRepository) SetPendingSecret(userID uint, sealedSecret string) error {
+	return r.db.Model(&models.User{}).Where("id = ? AND totp_enabled_at IS NULL", userID).Updates(map[string]interface{}{
+		"totp_secret":    sealedSecret,
+		"totp_last_step": 0,
+	}).Error
+}
+
+// Enable включает 2FA и заменяет коды восстановления. step - шаг кода,
+// которым подтверждено включение, повторно он не принимается.
+func (r *TwoFactorRepository) Enable(userID uint, step int64, codeHashes []string) (bool, error) {
+	enabled := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND totp_enabled_at IS NULL AND totp_secret <> ''", userID).
+			Updates(map[string]interface{}{
+				"totp_enabled_at": time.Now(),
+				"totp_last_step":  step,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		enabled = true
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+	return enabled, err
+}
+
+// Disable выключает 2FA и удаляет секрет и коды восстановления
+func (r *TwoFactorRepository) Disable(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// UseStep отмечает шаг TOTP использованным. false - этот или более поздний
+// код уже принимался, то есть код перехвачен и повторен.
+func (r *TwoFactorRepository) UseStep(userID uint, step int64) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UseRecoveryCode погашает код восстановления; false - кода нет или он уже использован
+func (r *TwoFactorRepository) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *TwoFactorRepository) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func (r *TwoFactorRepository) CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]models.RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
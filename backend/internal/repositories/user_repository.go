@@ -1,7 +1,11 @@
 package repositories
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/bhop_dynasty/0x40_cloud/internal/models"
 	"gorm.io/gorm"
@@ -15,6 +19,11 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
+// WithTx возвращает копию репозитория, работающую внутри транзакции tx
+func (r *UserRepository) WithTx(tx *gorm.DB) *UserRepository {
+	return &UserRepository{db: tx}
+}
+
 func (r *UserRepository) Create(user *models.User) error {
 	return r.db.Create(user).Error
 }
@@ -55,10 +64,197 @@ func (r *UserRepository) FindByID(id uint) (*models.User, error) {
 	return &user, nil
 }
 
+// FindByOIDC ищет пользователя по учетной записи у OIDC-провайдера
+func (r *UserRepository) FindByOIDC(issuer, subject string) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("oidc_issuer = ? AND oidc_subject = ?", issuer, subject).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// LinkOIDC привязывает существующего пользователя к учетной записи провайдера
+func (r *UserRepository) LinkOIDC(id uint, issuer, subject string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"oidc_issuer":  issuer,
+		"oidc_subject": subject,
+	}).Error
+}
+
 func (r *UserRepository) Update(user *models.User) error {
 	return r.db.Save(user).Error
 }
 
+// PromoteByEmails назначает роль пользователям с указанными email (без учета регистра)
+func (r *UserRepository) PromoteByEmails(emails []string, role string) error {
+	lowered := make([]string, len(emails))
+	for i, email := range emails {
+		lowered[i] = strings.ToLower(email)
+	}
+	return r.db.Model(&models.User{}).
+		Where("LOWER(email) IN ?", lowered).
+		Update("role", role).Error
+}
+
+// UpdateStorageQuota задает персональную квоту; nil возвращает квоту по умолчанию
+func (r *UserRepository) UpdateStorageQuota(id uint, quota *int64) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("storage_quota", quota).Error
+}
+
+func (r *UserRepository) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&models.User{}).Count(&count).Error
+	return count, err
+}
+
+// CountActiveAdmins - сколько администраторов может войти (для защиты последнего)
+func (r *UserRepository) CountActiveAdmins() (int64, error) {
+	var count int64
+	err := r.db.Model(&models.User{}).Where("role = ? AND disabled_at IS NULL", models.RoleAdmin).Count(&count).Error
+	return count, err
+}
+
+// List возвращает пользователей с занятым местом; query ищет по имени и email
+func (r *UserRepository) List(query string, limit, offset int) ([]models.AdminUserResponse, int64, error) {
+	db := r.db.Model(&models.User{})
+	if query != "" {
+		pattern := "%" + strings.ToLower(query) + "%"
+		db = db.Where("LOWER(username) LIKE ? OR LOWER(email) LIKE ?", pattern, pattern)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	users := []models.AdminUserResponse{}
+	err := db.Select("users.id, users.username, users.email, users.role, users.created_at, users.disabled_at, users.storage_quota, users.deletion_scheduled_at, " +
+		"COALESCE(storage_usages.used_bytes, 0) AS used_bytes, COALESCE(storage_usages.trash_bytes, 0) AS trash_bytes").
+		Joins("LEFT JOIN storage_usages ON storage_usages.user_id = users.id").
+		Order("users.id").
+		Limit(limit).
+		Offset(offset).
+		Scan(&users).Error
+	return users, total, err
+}
+
+func (r *UserRepository) UpdateRole(id uint, role string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("role", role).Error
+}
+
+// SetDisabled отключает (disabledAt != nil) или включает пользователя.
+// Включение отменяет и удаление аккаунта, запланированное самим пользователем.
+func (r *UserRepository) SetDisabled(id uint, disabledAt *time.Time) error {
+	updates := map[string]interface{}{"disabled_at": disabledAt}
+	if disabledAt == nil {
+		updates["deletion_scheduled_at"] = nil
+	}
+	return r.db.Model(&models.User{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// ScheduleDeletion отключает аккаунт и назначает окончательное удаление на deleteAt
+func (r *UserRepository) ScheduleDeletion(id uint, disabledAt, deleteAt time.Time) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"disabled_at":           disabledAt,
+		"deletion_scheduled_at": deleteAt,
+	}).Error
+}
+
+// CancelDeletion включает аккаунт, если его удаление еще не выполнено.
+// false - удаление не было запланировано.
+func (r *UserRepository) CancelDeletion(id uint) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND deletion_scheduled_at IS NOT NULL", id).
+		Updates(map[string]interface{}{
+			"disabled_at":           nil,
+			"deletion_scheduled_at": nil,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// FindDueForDeletion - пользователи, у которых истекла отсрочка удаления
+func (r *UserRepository) FindDueForDeletion(now time.Time, limit int) ([]models.User, error) {
+	var users []models.User
+	err := r.db.Where("deletion_scheduled_at <= ?", now).
+		Order("deletion_scheduled_at").
+		Limit(limit).
+		Find(&users).Error
+	return users, err
+}
+
+func (r *UserRepository) UpdatePassword(id uint, passwordHash string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("password", passwordHash).Error
+}
+
+// ConfirmEmail снимает флаг неподтвержденного email, если адрес не сменился
+// с момента отправки письма. false - адрес уже другой.
+func (r *UserRepository) ConfirmEmail(id uint, email string) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND email = ?", id, email).
+		Update("email_verification_pending", false)
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteAccountData удаляет все, что принадлежит пользователю, кроме файлов:
+// ссылки, выданные и полученные доступы, отметки, ключи, приглашения, журнал синхронизации
+func (r *UserRepository) DeleteAccountData(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		deletes := []struct {
+			model interface{}
+			where string
+		}{
+			{&models.SharedFile{}, "user_id = @id"},
+			{&models.FileGrant{}, "owner_id = @id OR grantee_id = @id"},
+			{&models.StarredFile{}, "user_id = @id"},
+			{&models.StarredFolder{}, "user_id = @id"},
+			{&models.SSHKey{}, "user_id = @id"},
+			{&models.AccessKey{}, "user_id = @id"},
+			{&models.FileChange{}, "user_id = @id"},
+			{&models.FileChangeWatermark{}, "user_id = @id"},
+			{&models.QuotaReservation{}, "user_id = @id"},
+			{&models.RecoveryCode{}, "user_id = @id"},
+			{&models.PersonalToken{}, "user_id = @id"},
+			{&models.Invite{}, "created_by = @id"},
+			{&models.Vault{}, "user_id = @id"},
+		}
+		for _, d := range deletes {
+			if err := tx.Where(d.where, sql.Named("id", id)).Delete(d.model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Anonymize освобождает имя и email удаляемого пользователя и помечает его удаленным.
+// Запись остается: на нее ссылаются файлы команд, которые он загружал.
+func (r *UserRepository) Anonymize(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		placeholder := fmt.Sprintf("deleted-%d", id)
+		if err := tx.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"username":      placeholder,
+			"email":         placeholder + "@deleted.invalid",
+			"password":      "",
+			"storage_quota": nil,
+			"totp_secret":   "",
+			"oidc_issuer":   nil,
+			"oidc_subject":  nil,
+
+			"deletion_scheduled_at": nil,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&models.StorageUsage{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.User{}, id).Error
+	})
+}
+
 func (r *UserRepository) Delete(id uint) error {
 	return r.db.Delete(&models.User{}, id).Error
 }
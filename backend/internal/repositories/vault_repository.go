@@ -0,0 +1,134 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// VaultRepository - E2E-хранилища и чтение их файлов. Создание и удаление
+// файлов идет через FileRepository, чтобы учитывались счетчики квоты.
+type VaultRepository struct {
+	db *gorm.DB
+}
+
+func NewVaultRepository(db *gorm.DB) *VaultRepository {
+	return &VaultRepository{db: db}
+}
+
+// WithTx возвращает копию репозитория, работающую внутри транзакции tx
+func (r *VaultRepository) WithTx(tx *gorm.DB) *VaultRepository {
+	return &VaultRepository{db: tx}
+}
+
+func (r *VaultRepository) Create(vault *models.Vault) error {
+	return r.db.Create(vault).Error
+}
+
+func (r *VaultRepository) FindByUserID(userID uint) ([]models.Vault, error) {
+	var vaults []models.Vault
+	err := r.db.Where("user_id = ?", userID).Order("name").Find(&vaults).Error
+	return vaults, err
+}
+
+func (r *VaultRepository) CountByUserID(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Vault{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// FindByID возвращает хранилище пользователя или nil
+func (r *VaultRepository) FindByID(id, userID uint) (*models.Vault, error) {
+	var vault models.Vault
+	err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&vault).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &vault, nil
+}
+
+func (r *VaultRepository) FindByName(userID uint, name string) (*models.Vault, error) {
+	var vault models.Vault
+	err := r.db.Where("user_id = ? AND name = ?", userID, name).First(&vault).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &vault, nil
+}
+
+// UpdateKey заменяет обернутый ключ, только если версия не менялась с момента,
+// когда клиент ее прочитал. false - хранилища нет или версия устарела.
+func (r *VaultRepository) UpdateKey(id, userID uint, version int, wrappedKey, keyParams string) (bool, error) {
+	result := r.db.Model(&models.Vault{}).
+		Where("id = ? AND user_id = ? AND key_version = ?", id, userID, version).
+		Updates(map[string]interface{}{
+			"wrapped_key": wrappedKey,
+			"key_params":  keyParams,
+			"key_version": gorm.Expr("key_version + 1"),
+			"updated_at":  time.Now(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *VaultRepository) Delete(id uint) error {
+	return r.db.Where("id = ?", id).Delete(&models.Vault{}).Error
+}
+
+// Usage - число файлов и объем каждого из хранилищ
+func (r *VaultRepository) Usage(vaultIDs []uint) ([]models.VaultUsage, error) {
+	var usage []models.VaultUsage
+	if len(vaultIDs) == 0 {
+		return usage, nil
+	}
+	err := r.db.Model(&models.File{}).
+		Select("vault_id, COUNT(*) AS files, COALESCE(SUM(size), 0) AS size").
+		Where("vault_id IN ?", vaultIDs).
+		Group("vault_id").
+		Scan(&usage).Error
+	return usage, err
+}
+
+func (r *VaultRepository) FindFiles(vaultID uint) ([]models.File, error) {
+	var files []models.File
+	err := r.db.Where("vault_id = ?", vaultID).Order("created_at").Find(&files).Error
+	return files, err
+}
+
+// FindFile возвращает файл хранилища или nil
+func (r *VaultRepository) FindFile(vaultID uint, fileID uuid.UUID) (*models.File, error) {
+	var file models.File
+	err := r.db.Where("id = ? AND vault_id = ?", fileID, vaultID).First(&file).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// FindFilesByUserID - файлы всех хранилищ пользователя (для удаления аккаунта и выгрузки)
+func (r *VaultRepository) FindFilesByUserID(userID uint) ([]models.File, error) {
+	var files []models.File
+	err := r.db.Unscoped().Where("user_id = ? AND vault_id IS NOT NULL", userID).Order("vault_id, created_at").Find(&files).Error
+	return files, err
+}
+
+// UpdateFileMetadata меняет зашифрованное имя и/или обернутый ключ файла.
+// Содержимое и размер не меняются, поэтому квоту и журнал это не затрагивает.
+func (r *VaultRepository) UpdateFileMetadata(vaultID uint, fileID uuid.UUID, updates map[string]interface{}) (bool, error) {
+	updates["updated_at"] = time.Now()
+	result := r.db.Model(&models.File{}).
+		Where("id = ? AND vault_id = ?", fileID, vaultID).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
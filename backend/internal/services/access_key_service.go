@@ -0,0 +1,128 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+)
+
+const (
+	maxAccessKeysPerUser = 20
+	accessKeyIDPrefix    = "0X40"
+	accessKeyIDAlphabet  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+)
+
+var (
+	ErrAccessKeyNotFound   = errors.New("access key not found")
+	ErrTooManyAccessKeys   = errors.New("too many access keys")
+	errInvalidSealedSecret = errors.New("invalid sealed secret")
+)
+
+// AccessKeyService выдает ключи для S3-совместимого API и проверяет подписи запросов
+type AccessKeyService struct {
+	repo          *repositories.AccessKeyRepository
+	encryptionKey []byte
+}
+
+func NewAccessKeyService(repo *repositories.AccessKeyRepository, encryptionKey string) *AccessKeyService {
+	return &AccessKeyService{
+		repo:          repo,
+		encryptionKey: []byte(encryptionKey),
+	}
+}
+
+func (s *AccessKeyService) CreateKey(userID uint, name string) (*models.AccessKeyCreatedResponse, error) {
+	existing, err := s.repo.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxAccessKeysPerUser {
+		return nil, ErrTooManyAccessKeys
+	}
+
+	accessKeyID, err := randomString(accessKeyIDAlphabet, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	secretBytes := make([]byte, 30)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	secret := base64.StdEncoding.EncodeToString(secretBytes)
+
+	sealed, err := s.sealSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &models.AccessKey{
+		UserID:          userID,
+		Name:            name,
+		AccessKeyID:     accessKeyIDPrefix + accessKeyID,
+		EncryptedSecret: sealed,
+	}
+	if err := s.repo.Create(key); err != nil {
+		return nil, fmt.Errorf("failed to save access key: %w", err)
+	}
+
+	return &models.AccessKeyCreatedResponse{AccessKey: *key, SecretAccessKey: secret}, nil
+}
+
+func (s *AccessKeyService) ListKeys(userID uint) ([]models.AccessKey, error) {
+	return s.repo.FindByUserID(userID)
+}
+
+func (s *AccessKeyService) DeleteKey(id uint, userID uint) error {
+	deleted, err := s.repo.Delete(id, userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrAccessKeyNotFound
+	}
+	return nil
+}
+
+// lookupSecret возвращает владельца и расшифрованный секрет ключа
+func (s *AccessKeyService) lookupSecret(accessKeyID string) (uint, string, error) {
+	key, err := s.repo.FindByAccessKeyID(accessKeyID)
+	if err != nil {
+		return 0, "", err
+	}
+	if key == nil {
+		return 0, "", ErrAccessKeyNotFound
+	}
+
+	secret, err := s.openSecret(key.EncryptedSecret)
+	if err != nil {
+		return 0, "", err
+	}
+	return key.UserID, secret, nil
+}
+
+func (s *AccessKeyService) sealSecret(secret string) (string, error) {
+	return sealString(s.encryptionKey, secret)
+}
+
+func (s *AccessKeyService) openSecret(sealed string) (string, error) {
+	return openString(s.encryptionKey, sealed)
+}
+
+func randomString(alphabet string, length int) (string, error) {
+	result := make([]byte, length)
+	max := big.NewInt(int64(len(alphabet)))
+	for i := range result {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate random string: %w", err)
+		}
+		result[i] = alphabet[n.Int64()]
+	}
+	return string(result), nil
+}
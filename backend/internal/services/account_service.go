@@ -0,0 +1,444 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/config"
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	emailTokenTTL = 48 * time.Hour
+	resetTokenTTL = time.Hour
+
+	// Писем на один адрес в час: иначе форму сброса можно использовать для спама
+	mailsPerAddressPerHour = 3
+	mailSendTimeout        = time.Minute
+
+	accountTokenVerifyEmail = "verify_email"
+	accountTokenChangeEmail = "change_email"
+)
+
+var (
+	ErrInvalidCurrentPassword = errors.New("current password is incorrect")
+	ErrInvalidAccountToken    = errors.New("link is invalid or has expired")
+	ErrEmailNotVerified       = errors.New("email address is not verified, check your inbox")
+	ErrEmailTaken             = errors.New("user with this email already exists")
+	ErrEmailUnchanged         = errors.New("this is already your email address")
+	ErrDeleteConfirmation     = errors.New("type your username to confirm account deletion")
+)
+
+// accountToken - данные одноразовой ссылки из письма. В Redis лежит под
+// sha256 от токена: утечка дампа Redis не дает рабочих ссылок.
+//
+// account:email:<hash> - подтверждение email (при регистрации и смене адреса)
+// account:reset:<hash> - сброс пароля
+// account:restore:<hash> - отмена удаления аккаунта
+type accountToken struct {
+	Purpose string `json:"purpose,omitempty"`
+	UserID  uint   `json:"user_id"`
+	Email   string `json:"email"`
+	// Отпечаток хеша пароля: после смены пароля старые ссылки сброса не работают
+	Password string `json:"password,omitempty"`
+}
+
+// AccountService - смена пароля и email, подтверждение email и сброс пароля
+// по ссылке из письма
+type AccountService struct {
+	userRepo *repositories.UserRepository
+	sessions *SessionService
+	redis    *redis.Client
+	mailer   Mailer
+	limiter  *RateLimiter
+	guard    *LoginGuard
+	cfg      *config.Config
+}
+
+func NewAccountService(userRepo *repositories.UserRepository, sessions *SessionService, redis *redis.Client, mailer Mailer, limiter *RateLimiter, guard *LoginGuard, cfg *config.Config) *AccountService {
+	return &AccountService{
+		userRepo: userRepo,
+		sessions: sessions,
+		redis:    redis,
+		mailer:   mailer,
+		limiter:  limiter,
+		guard:    guard,
+		cfg:      cfg,
+	}
+}
+
+func (s *AccountService) findUser(userID uint) (*models.User, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// verifyPassword проверяет текущий пароль. Неудачи засчитываются в блокировку
+// аккаунта, как при входе: угнанная сессия не должна позволять подбирать пароль.
+func (s *AccountService) verifyPassword(ctx context.Context, user *models.User, password, ip string) error {
+	if err := s.guard.Check(ctx, user.Email); err != nil {
+		return err
+	}
+	if user.Password == "" || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		s.guard.Failure(ctx, user.Email, &user.ID, ip)
+		return ErrInvalidCurrentPassword
+	}
+	s.guard.Success(ctx, user.Email)
+	return nil
+}
+
+// ChangePassword меняет пароль и закрывает все сессии, кроме текущей
+func (s *AccountService) ChangePassword(ctx context.Context, userID uint, sessionID string, req *models.ChangePasswordRequest, ip string) error {
+	if s.cfg.Auth.DisablePasswordLogin {
+		return ErrPasswordLoginDisabled
+	}
+
+	user, err := s.findUser(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.verifyPassword(ctx, user, req.CurrentPassword, ip); err != nil {
+		return err
+	}
+
+	if err := s.setPassword(ctx, user.ID, req.NewPassword); err != nil {
+		return err
+	}
+	return s.sessions.RevokeOthers(ctx, user.ID, sessionID)
+}
+
+func (s *AccountService) setPassword(ctx context.Context, userID uint, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost)
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
+	return s.userRepo.UpdatePassword(userID, string(hash))
+}
+
+// SendVerification отправляет ссылку подтверждения на текущий адрес пользователя
+func (s *AccountService) SendVerification(ctx context.Context, user *models.User) error {
+	token, err := s.issueToken(ctx, "account:email:", emailTokenTTL, &accountToken{
+		Purpose: accountTokenVerifyEmail,
+		UserID:  user.ID,
+		Email:   user.Email,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.send(user.Email, "Confirm your email address", fmt.Sprintf(
+		"Hi %s,\n\nconfirm your email address for 0x40 Cloud by opening this link:\n\n%s\n\nThe link is valid for %d hours. If you did not sign up, ignore this message.\n",
+		user.Username, s.link("/verify-email", token), int(emailTokenTTL.Hours())))
+	return nil
+}
+
+// ResendVerification - повторное письмо по адресу. Ответ не зависит от того,
+// есть ли такой пользователь, чтобы по нему нельзя было перебирать адреса.
+func (s *AccountService) ResendVerification(ctx context.Context, email string) error {
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.EmailVerificationPending || user.IsDisabled() {
+		return nil
+	}
+	if err := s.limiter.Allow(ctx, "mail:"+loginAccount(email), mailsPerAddressPerHour, time.Hour); err != nil {
+		return nil
+	}
+	return s.SendVerification(ctx, user)
+}
+
+// RequestEmailChange отправляет ссылку подтверждения на новый адрес. Email
+// меняется только после перехода по ней, старый адрес получает уведомление.
+func (s *AccountService) RequestEmailChange(ctx context.Context, userID uint, req *models.ChangeEmailRequest, ip string) error {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(user.Email, req.Email) {
+		return ErrEmailUnchanged
+	}
+	if err := s.verifyPassword(ctx, user, req.Password, ip); err != nil {
+		return err
+	}
+
+	existing, err := s.userRepo.FindByEmail(req.Email)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrEmailTaken
+	}
+	if err := s.limiter.Allow(ctx, "mail:"+loginAccount(req.Email), mailsPerAddressPerHour, time.Hour); err != nil {
+		return err
+	}
+
+	token, err := s.issueToken(ctx, "account:email:", emailTokenTTL, &accountToken{
+		Purpose: accountTokenChangeEmail,
+		UserID:  user.ID,
+		Email:   req.Email,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.send(req.Email, "Confirm your new email address", fmt.Sprintf(
+		"Hi %s,\n\nconfirm that 0x40 Cloud should use this address for your account by opening this link:\n\n%s\n\nThe link is valid for %d hours. If you did not request the change, ignore this message.\n",
+		user.Username, s.link("/verify-email", token), int(emailTokenTTL.Hours())))
+	s.send(user.Email, "Email change requested", fmt.Sprintf(
+		"Hi %s,\n\nsomeone requested to change the email address of your 0x40 Cloud account to %s.\nThe change takes effect only after it is confirmed from the new address.\nIf this was not you, change your password.\n",
+		user.Username, req.Email))
+	return nil
+}
+
+// VerifyEmail подтверждает адрес по ссылке из письма: при регистрации или смене email
+func (s *AccountService) VerifyEmail(ctx context.Context, token string) (*models.User, error) {
+	data, err := s.consumeToken(ctx, "account:email:", token)
+	if err != nil {
+		return nil, err
+	}
+
+	switch data.Purpose {
+	case accountTokenVerifyEmail:
+		confirmed, err := s.userRepo.ConfirmEmail(data.UserID, data.Email)
+		if err != nil {
+			return nil, err
+		}
+		if !confirmed {
+			// Адрес сменился после отправки письма
+			return nil, ErrInvalidAccountToken
+		}
+
+	case accountTokenChangeEmail:
+		user, err := s.findUser(data.UserID)
+		if err != nil {
+			return nil, err
+		}
+		// Адрес могли занять, пока письмо шло
+		existing, err := s.userRepo.FindByEmail(data.Email)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil && existing.ID != user.ID {
+			return nil, ErrEmailTaken
+		}
+
+		user.Email = data.Email
+		user.EmailVerificationPending = false
+		if err := s.userRepo.Update(user); err != nil {
+			return nil, fmt.Errorf("failed to update email: %w", err)
+		}
+
+	default:
+		return nil, ErrInvalidAccountToken
+	}
+
+	return s.findUser(data.UserID)
+}
+
+// ForgotPassword отправляет ссылку сброса пароля. Как и ResendVerification,
+// молча ничего не делает для неизвестных адресов.
+func (s *AccountService) ForgotPassword(ctx context.Context, email string) error {
+	if s.cfg.Auth.DisablePasswordLogin {
+		return ErrPasswordLoginDisabled
+	}
+
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return err
+	}
+	// У пользователей OIDC пароля нет: сброс выдал бы им вход в обход провайдера
+	if user == nil || user.Password == "" || user.IsDisabled() {
+		return nil
+	}
+	if err := s.limiter.Allow(ctx, "mail:"+loginAccount(email), mailsPerAddressPerHour, time.Hour); err != nil {
+		return nil
+	}
+
+	token, err := s.issueToken(ctx, "account:reset:", resetTokenTTL, &accountToken{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Password: passwordFingerprint(user.Password),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.send(user.Email, "Reset your password", fmt.Sprintf(
+		"Hi %s,\n\nopen this link to choose a new password for 0x40 Cloud:\n\n%s\n\nThe link is valid for %d minutes and can be used once. If you did not request a reset, ignore this message.\n",
+		user.Username, s.link("/reset-password", token), int(resetTokenTTL.Minutes())))
+	return nil
+}
+
+// ResetPassword задает новый пароль по ссылке из письма и закрывает все сессии.
+// Переход по ссылке доказывает владение адресом, поэтому email тоже подтверждается.
+func (s *AccountService) ResetPassword(ctx context.Context, req *models.PasswordResetRequest) error {
+	if s.cfg.Auth.DisablePasswordLogin {
+		return ErrPasswordLoginDisabled
+	}
+
+	data, err := s.consumeToken(ctx, "account:reset:", req.Token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.FindByID(data.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.IsDisabled() || user.Email != data.Email ||
+		user.Password == "" || passwordFingerprint(user.Password) != data.Password {
+		return ErrInvalidAccountToken
+	}
+
+	if err := s.setPassword(ctx, user.ID, req.Password); err != nil {
+		return err
+	}
+	if _, err := s.userRepo.ConfirmEmail(user.ID, user.Email); err != nil {
+		fmt.Printf("Warning: failed to confirm email of user %d: %v\n", user.ID, err)
+	}
+	s.guard.Success(ctx, user.Email)
+	return s.sessions.RevokeAll(ctx, user.ID)
+}
+
+// RequestDeletion отключает аккаунт и назначает удаление данных через
+// DeletionGracePeriod. До этого удаление отменяется ссылкой из письма
+// или администратором (включение аккаунта).
+func (s *AccountService) RequestDeletion(ctx context.Context, userID uint, req *models.DeleteAccountRequest, ip string) (*models.DeleteAccountResponse, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Confirm != user.Username {
+		return nil, ErrDeleteConfirmation
+	}
+	if user.Password != "" {
+		if err := s.verifyPassword(ctx, user, req.Password, ip); err != nil {
+			return nil, err
+		}
+	}
+	if user.IsAdmin() {
+		admins, err := s.userRepo.CountActiveAdmins()
+		if err != nil {
+			return nil, err
+		}
+		if admins <= 1 {
+			return nil, ErrLastAdmin
+		}
+	}
+
+	now := time.Now()
+	deleteAt := now.Add(s.cfg.Auth.DeletionGracePeriod)
+	if err := s.userRepo.ScheduleDeletion(user.ID, now, deleteAt); err != nil {
+		return nil, err
+	}
+	if err := s.sessions.RevokeAll(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	token, err := s.issueToken(ctx, "account:restore:", s.cfg.Auth.DeletionGracePeriod, &accountToken{
+		UserID: user.ID,
+		Email:  user.Email,
+	})
+	if err != nil {
+		// Аккаунт уже отключен: без письма удаление отменит администратор
+		fmt.Printf("Warning: failed to issue restore token for user %d: %v\n", user.ID, err)
+	} else {
+		s.send(user.Email, "Your account will be deleted", fmt.Sprintf(
+			"Hi %s,\n\nyour 0x40 Cloud account has been disabled and all its files will be permanently deleted on %s.\n\nChanged your mind? Open this link before then to restore the account:\n\n%s\n",
+			user.Username, deleteAt.UTC().Format("2006-01-02 15:04 MST"), s.link("/restore-account", token)))
+	}
+
+	return &models.DeleteAccountResponse{DeletionScheduledAt: deleteAt}, nil
+}
+
+// CancelDeletion восстанавливает аккаунт по ссылке из письма об удалении
+func (s *AccountService) CancelDeletion(ctx context.Context, token string) error {
+	data, err := s.consumeToken(ctx, "account:restore:", token)
+	if err != nil {
+		return err
+	}
+
+	restored, err := s.userRepo.CancelDeletion(data.UserID)
+	if err != nil {
+		return err
+	}
+	if !restored {
+		return ErrInvalidAccountToken
+	}
+	return nil
+}
+
+func (s *AccountService) issueToken(ctx context.Context, prefix string, ttl time.Duration, data *accountToken) (string, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	if err := s.redis.Set(ctx, prefix+hashAccountToken(token), payload, ttl).Err(); err != nil {
+		return "", fmt.Errorf("failed to save token: %w", err)
+	}
+	return token, nil
+}
+
+// consumeToken забирает токен атомарно (GETDEL): ссылка срабатывает один раз
+func (s *AccountService) consumeToken(ctx context.Context, prefix, token string) (*accountToken, error) {
+	payload, err := s.redis.GetDel(ctx, prefix+hashAccountToken(token)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrInvalidAccountToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var data accountToken
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, ErrInvalidAccountToken
+	}
+	return &data, nil
+}
+
+func (s *AccountService) link(path, token string) string {
+	return s.cfg.Auth.AppURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// send отправляет письмо в фоне: медленный SMTP не задерживает ответ, а время
+// ответа не выдает, существует ли адрес
+func (s *AccountService) send(to, subject, body string) {
+	msg := &MailMessage{To: to, Subject: subject, Body: body}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			fmt.Printf("Warning: failed to send %q to %s: %v\n", subject, to, err)
+		}
+	}()
+}
+
+func hashAccountToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func passwordFingerprint(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:8])
+}
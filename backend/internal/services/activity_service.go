@@ -197,3 +197,14 @@ func (s *ActivityService) CleanOldActivity(ctx context.Context, userID uint, old
 
 	return nil
 }
+
+// ClearUser удаляет всю историю активности пользователя (удаление аккаунта)
+func (s *ActivityService) ClearUser(ctx context.Context, userID uint) error {
+	viewKey := fmt.Sprintf("user:%d:file_%s", userID, ActivityView)
+	downloadKey := fmt.Sprintf("user:%d:file_%s", userID, ActivityDownload)
+
+	if err := s.redis.Del(ctx, viewKey, downloadKey).Err(); err != nil {
+		return fmt.Errorf("failed to clear activity: %w", err)
+	}
+	return nil
+}
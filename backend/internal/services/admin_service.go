@@ -0,0 +1,363 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	JobTypeUserDelete   = "user_delete"
+	JobTypeAccountPurge = "account_purge"
+
+	// Сколько аккаунтов с истекшей отсрочкой удаляет один запуск account_purge
+	accountPurgeBatch = 20
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrAdminSelf    = errors.New("administrators cannot disable, delete or demote themselves")
+	ErrLastAdmin    = errors.New("server must keep at least one active administrator")
+)
+
+type UserDeletePayload struct {
+	UserID uint `json:"user_id"`
+}
+
+type UserDeleteResult struct {
+	Files int `json:"files"`
+}
+
+type AccountPurgeResult struct {
+	Users int `json:"users"`
+	Files int `json:"files"`
+}
+
+// AdminService - операции администратора над пользователями и сервером
+type AdminService struct {
+	userRepo    *repositories.UserRepository
+	fileService *FileService
+	teamService *TeamService
+	settings    *SettingsService
+	sessions    *SessionService
+	twoFactor   *TwoFactorService
+	audit       *AuditService
+	activity    *ActivityService
+	jobs        *JobService
+}
+
+func NewAdminService(userRepo *repositories.UserRepository, fileService *FileService, teamService *TeamService, settings *SettingsService, sessions *SessionService, jobs *JobService) *AdminService {
+	return &AdminService{
+		userRepo:    userRepo,
+		fileService: fileService,
+		teamService: teamService,
+		settings:    settings,
+		sessions:    sessions,
+		jobs:        jobs,
+	}
+}
+
+// SetTwoFactorService позволяет сбрасывать 2FA пользователям, потерявшим устройство
+func (s *AdminService) SetTwoFactorService(twoFactor *TwoFactorService) {
+	s.twoFactor = twoFactor
+}
+
+// SetAuditService открывает администратору журнал событий безопасности
+func (s *AdminService) SetAuditService(audit *AuditService) {
+	s.audit = audit
+}
+
+// SetActivityService позволяет удалять историю активности вместе с аккаунтом
+func (s *AdminService) SetActivityService(activity *ActivityService) {
+	s.activity = activity
+}
+
+// RegisterJobs регистрирует удаление аккаунтов: по команде администратора
+// и по истечении отсрочки после удаления пользователем
+func (s *AdminService) RegisterJobs(jobs *JobService) {
+	jobs.Register(JobTypeUserDelete, s.runUserDeleteJob, nil)
+	jobs.Register(JobTypeAccountPurge, s.runAccountPurgeJob, nil)
+	jobs.Schedule(JobTypeAccountPurge, time.Hour)
+}
+
+func (s *AdminService) ListUsers(query string, limit, offset int) (*models.AdminUserList, error) {
+	users, total, err := s.userRepo.List(query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AdminUserList{Users: users, Total: total}, nil
+}
+
+func (s *AdminService) findUser(userID uint) (*models.User, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// ensureNotLastAdmin не дает отключить или разжаловать последнего активного администратора
+func (s *AdminService) ensureNotLastAdmin(user *models.User) error {
+	if !user.IsAdmin() || user.IsDisabled() {
+		return nil
+	}
+	admins, err := s.userRepo.CountActiveAdmins()
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+func (s *AdminService) SetRole(adminID, userID uint, role string) error {
+	if adminID == userID {
+		return ErrAdminSelf
+	}
+	user, err := s.findUser(userID)
+	if err != nil {
+		return err
+	}
+	if role != models.RoleAdmin {
+		if err := s.ensureNotLastAdmin(user); err != nil {
+			return err
+		}
+	}
+	return s.userRepo.UpdateRole(user.ID, role)
+}
+
+// SetDisabled отключает или включает аккаунт. Отключенный пользователь теряет
+// доступ сразу: AuthMiddleware, WebDAV, SFTP и S3 проверяют это на каждый запрос.
+func (s *AdminService) SetDisabled(adminID, userID uint, disabled bool) error {
+	if adminID == userID {
+		return ErrAdminSelf
+	}
+	user, err := s.findUser(userID)
+	if err != nil {
+		return err
+	}
+
+	if !disabled {
+		return s.userRepo.SetDisabled(user.ID, nil)
+	}
+	if err := s.ensureNotLastAdmin(user); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := s.userRepo.SetDisabled(user.ID, &now); err != nil {
+		return err
+	}
+	return s.sessions.RevokeAll(context.Background(), user.ID)
+}
+
+// ResetPassword задает новый пароль. Пустой пароль - сгенерировать временный,
+// он возвращается один раз и нигде не хранится в открытом виде.
+func (s *AdminService) ResetPassword(userID uint, password string) (*models.ResetPasswordResponse, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.ResetPasswordResponse{}
+	if password == "" {
+		raw := make([]byte, 12)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed to generate password: %w", err)
+		}
+		password = base64.RawURLEncoding.EncodeToString(raw)
+		response.Password = password
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost)
+	if err != nil {
+		return nil, errors.New("failed to hash password")
+	}
+	if err := s.userRepo.UpdatePassword(user.ID, string(hash)); err != nil {
+		return nil, err
+	}
+	// Со старым паролем могли войти посторонние - закрываем все сессии
+	if err := s.sessions.RevokeAll(context.Background(), user.ID); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// ResetTwoFactor выключает 2FA пользователя: следующий вход - по одному паролю,
+// после чего он может настроить второй фактор заново
+func (s *AdminService) ResetTwoFactor(userID uint) error {
+	if s.twoFactor == nil {
+		return ErrTwoFactorNotEnabled
+	}
+	return s.twoFactor.Reset(userID)
+}
+
+// DeleteUser сразу отключает аккаунт и ставит в очередь удаление его данных
+func (s *AdminService) DeleteUser(adminID, userID uint) (*models.Job, error) {
+	if adminID == userID {
+		return nil, ErrAdminSelf
+	}
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureNotLastAdmin(user); err != nil {
+		return nil, err
+	}
+
+	if !user.IsDisabled() {
+		now := time.Now()
+		if err := s.userRepo.SetDisabled(user.ID, &now); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.sessions.RevokeAll(context.Background(), user.ID); err != nil {
+		return nil, err
+	}
+
+	return s.jobs.Enqueue(adminID, JobTypeUserDelete, UserDeletePayload{UserID: user.ID})
+}
+
+func (s *AdminService) runUserDeleteJob(ctx context.Context, job *models.Job, progress JobProgressFunc) (interface{}, error) {
+	var payload UserDeletePayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, PermanentJobError(fmt.Errorf("invalid payload: %w", err))
+	}
+
+	user, err := s.userRepo.FindByID(payload.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return UserDeleteResult{}, nil
+	}
+
+	files, err := s.purgeUser(ctx, user.ID, progress)
+	if err != nil {
+		return nil, err
+	}
+	return UserDeleteResult{Files: files}, nil
+}
+
+// runAccountPurgeJob окончательно удаляет аккаунты, у которых истекла отсрочка
+func (s *AdminService) runAccountPurgeJob(ctx context.Context, job *models.Job, progress JobProgressFunc) (interface{}, error) {
+	users, err := s.userRepo.FindDueForDeletion(time.Now(), accountPurgeBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	result := AccountPurgeResult{}
+	progress(0, int64(len(users)))
+	for i := range users {
+		files, err := s.purgeUser(ctx, users[i].ID, func(done, total int64) {})
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete user %d: %w", users[i].ID, err)
+		}
+		result.Users++
+		result.Files += files
+		progress(int64(i+1), int64(len(users)))
+	}
+	return result, nil
+}
+
+// purgeUser удаляет аккаунт по шагам. Каждый шаг можно повторить,
+// поэтому задача безопасно перезапускается после сбоя.
+func (s *AdminService) purgeUser(ctx context.Context, userID uint, progress JobProgressFunc) (int, error) {
+	if err := s.sessions.RevokeAll(ctx, userID); err != nil {
+		return 0, err
+	}
+	if err := s.teamService.LeaveAllTeams(userID); err != nil {
+		return 0, fmt.Errorf("failed to leave teams: %w", err)
+	}
+	if err := s.userRepo.DeleteAccountData(userID); err != nil {
+		return 0, fmt.Errorf("failed to delete account data: %w", err)
+	}
+	if s.activity != nil {
+		if err := s.activity.ClearUser(ctx, userID); err != nil {
+			return 0, err
+		}
+	}
+
+	files, err := s.fileService.PurgeUserFiles(ctx, userID, progress)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete files: %w", err)
+	}
+
+	if err := s.userRepo.Anonymize(userID); err != nil {
+		return 0, fmt.Errorf("failed to delete user: %w", err)
+	}
+	return files, nil
+}
+
+// ListAuditEvents - журнал безопасности; eventType фильтрует по типу события
+func (s *AdminService) ListAuditEvents(eventType string, limit, offset int) (*models.AuditEventList, error) {
+	if s.audit == nil {
+		return &models.AuditEventList{Events: []models.AuditEvent{}}, nil
+	}
+	return s.audit.List(eventType, limit, offset)
+}
+
+func (s *AdminService) GetStorageStats() (*models.GlobalStorageStats, error) {
+	stats, err := s.fileService.GetGlobalStorageStats()
+	if err != nil {
+		return nil, err
+	}
+	if stats.Users, err = s.userRepo.Count(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (s *AdminService) RegistrationMode() (string, error) {
+	return s.settings.RegistrationMode()
+}
+
+func (s *AdminService) SetRegistrationMode(mode string) error {
+	return s.settings.SetRegistrationMode(mode)
+}
+
+func (s *AdminService) GetUserQuota(userID uint) (*models.UserQuotaResponse, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	used, limit, err := s.fileService.userQuota(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.UserQuotaResponse{
+		UserID:        user.ID,
+		Quota:         limit,
+		IsDefault:     user.StorageQuota == nil,
+		Used:          used,
+		IncludesTrash: s.fileService.QuotaIncludesTrash(),
+	}, nil
+}
+
+// SetUserQuota задает персональную квоту. Квота ниже занятого места допустима:
+// уже загруженные файлы остаются, но новые загрузки будут отклоняться.
+func (s *AdminService) SetUserQuota(userID uint, quota *int64) (*models.UserQuotaResponse, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.userRepo.UpdateStorageQuota(user.ID, quota); err != nil {
+		return nil, err
+	}
+
+	return s.GetUserQuota(user.ID)
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+)
+
+// AuditService ведет журнал событий безопасности
+type AuditService struct {
+	repo *repositories.AuditRepository
+}
+
+func NewAuditService(repo *repositories.AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record сохраняет событие. Ошибка записи журнала не должна ломать действие,
+// которое его вызвало, поэтому она только логируется.
+func (s *AuditService) Record(event *models.AuditEvent) {
+	if err := s.repo.Create(event); err != nil {
+		fmt.Printf("Warning: failed to write audit event %s for %q: %v\n", event.Type, event.Account, err)
+	}
+}
+
+func (s *AuditService) List(eventType string, limit, offset int) (*models.AuditEventList, error) {
+	events, total, err := s.repo.List(eventType, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AuditEventList{Events: events, Total: total}, nil
+}
@@ -1,8 +1,14 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/bhop_dynasty/0x40_cloud/internal/config"
 	"github.com/bhop_dynasty/0x40_cloud/internal/models"
@@ -13,19 +19,139 @@ import (
 
 const BcryptCost = 12
 
+var (
+	ErrAccountDisabled       = errors.New("account is disabled")
+	ErrRegistrationDisabled  = errors.New("registration is disabled")
+	ErrPasswordLoginDisabled = errors.New("password login is disabled, use single sign-on")
+	ErrOIDCSignupDisabled    = errors.New("no account is linked to this identity and sign-up is disabled")
+	ErrOIDCEmailRequired     = errors.New("identity provider did not return an email address")
+	ErrOIDCEmailTaken        = errors.New("an account with this email already exists and the provider did not verify the email")
+)
+
 type AuthService struct {
-	userRepo *repositories.UserRepository
-	Config   *config.Config
+	userRepo  *repositories.UserRepository
+	sessions  *SessionService
+	settings  *SettingsService
+	twoFactor *TwoFactorService
+	guard     *LoginGuard
+	oidc      *OIDCService
+	tokens    *PersonalTokenService
+	account   *AccountService
+	invites   *InviteService
+	Config    *config.Config
 }
 
-func NewAuthService(userRepo *repositories.UserRepository, cfg *config.Config) *AuthService {
+func NewAuthService(userRepo *repositories.UserRepository, sessions *SessionService, cfg *config.Config) *AuthService {
 	return &AuthService{
 		userRepo: userRepo,
+		sessions: sessions,
 		Config:   cfg,
 	}
 }
 
-func (s *AuthService) Register(req *models.RegisterRequest) (*models.AuthResponse, error) {
+// SetSettingsService позволяет включать и выключать регистрацию без перезапуска
+func (s *AuthService) SetSettingsService(settings *SettingsService) {
+	s.settings = settings
+}
+
+// SetTwoFactorService включает второй фактор для пользователей, настроивших TOTP
+func (s *AuthService) SetTwoFactorService(twoFactor *TwoFactorService) {
+	s.twoFactor = twoFactor
+}
+
+// SetLoginGuard включает ограничение попыток входа и блокировку при подборе пароля
+func (s *AuthService) SetLoginGuard(guard *LoginGuard) {
+	s.guard = guard
+}
+
+// SetOIDCService включает вход через OpenID Connect провайдера
+func (s *AuthService) SetOIDCService(oidc *OIDCService) {
+	s.oidc = oidc
+}
+
+// SetPersonalTokenService включает вход по личным токенам доступа
+func (s *AuthService) SetPersonalTokenService(tokens *PersonalTokenService) {
+	s.tokens = tokens
+}
+
+// SetAccountService включает подтверждение email при регистрации
+func (s *AuthService) SetAccountService(account *AccountService) {
+	s.account = account
+}
+
+// SetInviteService включает регистрацию по приглашениям
+func (s *AuthService) SetInviteService(invites *InviteService) {
+	s.invites = invites
+}
+
+// AuthenticatePersonalToken проверяет токен из заголовка Authorization
+func (s *AuthService) AuthenticatePersonalToken(raw, ip string) (*models.User, *models.PersonalToken, error) {
+	if s.tokens == nil {
+		return nil, nil, ErrInvalidPersonalToken
+	}
+	return s.tokens.Authenticate(raw, ip)
+}
+
+// AuthenticateBasic - вход протоколов без cookie (WebDAV, SFTP): паролем или
+// личным токеном вместо пароля. Токен работает и при 2FA, OIDC и выключенных
+// паролях. Возвращает токен, чтобы вызывающий проверил его права; nil - вход по паролю.
+func (s *AuthService) AuthenticateBasic(ctx context.Context, login, secret, ip string) (*models.User, *models.PersonalToken, error) {
+	if !strings.HasPrefix(secret, PersonalTokenPrefix) {
+		user, err := s.Authenticate(ctx, login, secret, ip)
+		return user, nil, err
+	}
+
+	user, token, err := s.AuthenticatePersonalToken(secret, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Логин должен совпадать с владельцем, иначе токен, найденный в логах,
+	// подошел бы к любому имени пользователя
+	if !strings.EqualFold(login, user.Email) && !strings.EqualFold(login, user.Username) {
+		return nil, nil, ErrInvalidPersonalToken
+	}
+	return user, token, nil
+}
+
+// RegistrationMode учитывает настройку администратора, а без нее - REGISTRATION_MODE.
+// Без входа по паролю регистрация закрыта: новые пользователи приходят через OIDC.
+func (s *AuthService) RegistrationMode() (string, error) {
+	if s.Config.Auth.DisablePasswordLogin {
+		return models.RegistrationClosed, nil
+	}
+	return s.configuredRegistrationMode()
+}
+
+// configuredRegistrationMode - режим без поправки на DISABLE_PASSWORD_LOGIN.
+// По нему же решается регистрация через OIDC, которая от входа по паролю не зависит.
+func (s *AuthService) configuredRegistrationMode() (string, error) {
+	if s.settings == nil {
+		return s.Config.Auth.RegistrationMode, nil
+	}
+	mode, err := s.settings.RegistrationMode()
+	if err != nil {
+		return "", err
+	}
+	// Без сервиса приглашений зарегистрироваться по ним нельзя
+	if mode == models.RegistrationInvite && s.invites == nil {
+		return models.RegistrationClosed, nil
+	}
+	return mode, nil
+}
+
+func (s *AuthService) Register(ctx context.Context, req *models.RegisterRequest, client SessionClient) (*models.AuthResponse, error) {
+	mode, err := s.RegistrationMode()
+	if err != nil {
+		return nil, err
+	}
+	if mode == models.RegistrationClosed {
+		return nil, ErrRegistrationDisabled
+	}
+	inviteCode := strings.TrimSpace(req.InviteCode)
+	if mode == models.RegistrationInvite && inviteCode == "" {
+		return nil, ErrInviteRequired
+	}
+
 	existingUser, err := s.userRepo.FindByEmail(req.Email)
 	if err != nil {
 		return nil, err
@@ -53,46 +179,370 @@ func (s *AuthService) Register(req *models.RegisterRequest) (*models.AuthRespons
 		Username: req.Username,
 		Email:    req.Email,
 		Password: string(hashedPassword),
+		Role:     models.RoleUser,
+	}
+
+	// В открытом режиме приглашение тоже принимается: оно может задавать квоту
+	var invite *models.Invite
+	if inviteCode != "" && s.invites != nil {
+		if invite, err = s.invites.Redeem(inviteCode); err != nil {
+			return nil, err
+		}
+		user.StorageQuota = invite.StorageQuota
+	}
+	// Первый пользователь сервера становится администратором
+	count, err := s.userRepo.Count()
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || s.isAdminEmail(req.Email) {
+		user.Role = models.RoleAdmin
 	}
+	user.EmailVerificationPending = s.account != nil
 
 	if err := s.userRepo.Create(user); err != nil {
+		if invite != nil {
+			s.invites.Release(invite)
+		}
 		return nil, errors.New("failed to create user")
 	}
 
-	token, err := s.generateToken(user)
+	if s.account != nil {
+		if err := s.account.SendVerification(ctx, user); err != nil {
+			fmt.Printf("Warning: failed to send verification email to user %d: %v\n", user.ID, err)
+		}
+		// Без подтверждения сессию не выдаем: вход станет доступен после перехода по ссылке
+		if s.Config.Auth.RequireEmailVerification {
+			return &models.AuthResponse{User: user.ToResponse(), EmailVerificationRequired: true}, nil
+		}
+	}
+
+	return s.startSession(ctx, user, client)
+}
+
+func (s *AuthService) Login(ctx context.Context, req *models.LoginRequest, client SessionClient) (*models.AuthResponse, error) {
+	user, err := s.checkPassword(ctx, req.Email, req.Password, client.IP, s.userRepo.FindByEmail)
 	if err != nil {
 		return nil, err
 	}
 
-	return &models.AuthResponse{
-		Token: token,
-		User:  user.ToResponse(),
-	}, nil
+	if user.IsDisabled() {
+		return nil, ErrAccountDisabled
+	}
+	if s.emailVerificationRequired(user) {
+		return nil, ErrEmailNotVerified
+	}
+
+	// С включенной 2FA пароль дает только pre-auth токен, сессия - после кода
+	if s.twoFactor != nil && user.TwoFactorEnabled() {
+		preAuthToken, err := s.twoFactor.CreateChallenge(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &models.AuthResponse{TwoFactorRequired: true, PreAuthToken: preAuthToken}, nil
+	}
+
+	return s.startSession(ctx, user, client)
 }
 
-func (s *AuthService) Login(req *models.LoginRequest) (*models.AuthResponse, error) {
-	user, err := s.userRepo.FindByEmail(req.Email)
+// AuthMethods - способы входа для страницы логина
+func (s *AuthService) AuthMethods() (*models.AuthMethodsResponse, error) {
+	mode, err := s.RegistrationMode()
 	if err != nil {
 		return nil, err
 	}
 
-	if user == nil {
-		return nil, errors.New("invalid credentials")
+	methods := &models.AuthMethodsResponse{
+		PasswordLogin:    !s.Config.Auth.DisablePasswordLogin,
+		Registration:     mode != models.RegistrationClosed,
+		RegistrationMode: mode,
+	}
+	if s.oidc != nil && s.oidc.Enabled() {
+		methods.OIDC = true
+		methods.OIDCName = s.oidc.ProviderName()
+		methods.OIDCLoginURL = "/api/auth/oidc/login"
+	}
+	return methods, nil
+}
+
+// BeginOIDCLogin возвращает адрес провайдера и state для cookie браузера
+func (s *AuthService) BeginOIDCLogin(ctx context.Context, redirect string) (authURL, state string, err error) {
+	if s.oidc == nil {
+		return "", "", ErrOIDCDisabled
 	}
+	return s.oidc.BeginLogin(ctx, redirect)
+}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return nil, errors.New("invalid credentials")
+// CompleteOIDCLogin завершает вход через провайдера: находит, привязывает или
+// создает пользователя и открывает сессию. Второй фактор здесь не спрашивается -
+// за него отвечает провайдер. Возвращает и адрес, куда вернуть браузер.
+func (s *AuthService) CompleteOIDCLogin(ctx context.Context, state, code string, client SessionClient) (*models.AuthResponse, string, error) {
+	if s.oidc == nil {
+		return nil, "", ErrOIDCDisabled
 	}
 
-	token, err := s.generateToken(user)
+	identity, redirect, err := s.oidc.CompleteLogin(ctx, state, code)
+	if err != nil {
+		return nil, "", err
+	}
+
+	user, err := s.oidcUser(identity)
+	if err != nil {
+		return nil, "", err
+	}
+	if user.IsDisabled() {
+		return nil, "", ErrAccountDisabled
+	}
+
+	if err := s.syncOIDCRole(user, identity); err != nil {
+		return nil, "", err
+	}
+
+	response, err := s.startSession(ctx, user, client)
+	if err != nil {
+		return nil, "", err
+	}
+	return response, redirect, nil
+}
+
+// oidcUser - пользователь, привязанный к учетной записи провайдера. Существующий
+// аккаунт привязывается по email, только если провайдер подтвердил этот email:
+// иначе можно было бы войти в чужой аккаунт, указав его адрес у провайдера.
+func (s *AuthService) oidcUser(identity *OIDCIdentity) (*models.User, error) {
+	user, err := s.userRepo.FindByOIDC(identity.Issuer, identity.Subject)
+	if err != nil || user != nil {
+		return user, err
+	}
+
+	if identity.Email == "" {
+		return nil, ErrOIDCEmailRequired
+	}
+	existing, err := s.userRepo.FindByEmail(identity.Email)
 	if err != nil {
 		return nil, err
 	}
+	if existing != nil {
+		if !identity.EmailVerified {
+			return nil, ErrOIDCEmailTaken
+		}
+		if err := s.userRepo.LinkOIDC(existing.ID, identity.Issuer, identity.Subject); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
 
-	return &models.AuthResponse{
-		Token: token,
-		User:  user.ToResponse(),
-	}, nil
+	if !s.Config.OIDC.AllowSignup {
+		return nil, ErrOIDCSignupDisabled
+	}
+	// Приглашение через провайдера не передать, поэтому в режимах invite и closed
+	// новые пользователи OIDC тоже не создаются
+	mode, err := s.configuredRegistrationMode()
+	if err != nil {
+		return nil, err
+	}
+	if mode != models.RegistrationOpen {
+		return nil, ErrOIDCSignupDisabled
+	}
+	return s.provisionOIDCUser(identity)
+}
+
+// provisionOIDCUser создает пользователя при первом входе (JIT). Пароля у него нет.
+func (s *AuthService) provisionOIDCUser(identity *OIDCIdentity) (*models.User, error) {
+	base := identity.Username
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	username, err := s.uniqueUsername(base)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer, subject := identity.Issuer, identity.Subject
+	user := &models.User{
+		Username:    username,
+		Email:       identity.Email,
+		Role:        models.RoleUser,
+		OIDCIssuer:  &issuer,
+		OIDCSubject: &subject,
+	}
+	count, err := s.userRepo.Count()
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || s.isAdminEmail(identity.Email) {
+		user.Role = models.RoleAdmin
+	}
+
+	if err := s.userRepo.Create(user); err != nil {
+		// Два параллельных первых входа: второй найдет уже созданного пользователя
+		if existing, findErr := s.userRepo.FindByOIDC(issuer, subject); findErr == nil && existing != nil {
+			return existing, nil
+		}
+		return nil, errors.New("failed to create user")
+	}
+	return user, nil
+}
+
+// uniqueUsername подбирает свободное имя: base, base-2, base-3...
+func (s *AuthService) uniqueUsername(base string) (string, error) {
+	base = strings.Map(func(r rune) rune {
+		if r == '.' || r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, base)
+	if runes := []rune(base); len(runes) > 40 {
+		base = string(runes[:40])
+	}
+	if len([]rune(base)) < 3 {
+		base = "user"
+	}
+
+	for i := 1; i <= 20; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s-%d", base, i)
+		}
+		existing, err := s.userRepo.FindByUsername(candidate)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return candidate, nil
+		}
+	}
+
+	suffix, err := randomHex(4)
+	if err != nil {
+		return "", err
+	}
+	return base + "-" + suffix, nil
+}
+
+// syncOIDCRole выставляет роль по группам провайдера, если OIDC_ADMIN_GROUPS
+// задан: тогда провайдер - источник истины, и исключение из группы снимает
+// роль при следующем входе. ADMIN_EMAILS остаются администраторами всегда.
+func (s *AuthService) syncOIDCRole(user *models.User, identity *OIDCIdentity) error {
+	if len(s.Config.OIDC.AdminGroups) == 0 {
+		return nil
+	}
+
+	role := models.RoleUser
+	if s.isAdminEmail(user.Email) {
+		role = models.RoleAdmin
+	}
+	for _, group := range identity.Groups {
+		if containsString(s.Config.OIDC.AdminGroups, group) {
+			role = models.RoleAdmin
+			break
+		}
+	}
+
+	if user.Role == role {
+		return nil
+	}
+	if err := s.userRepo.UpdateRole(user.ID, role); err != nil {
+		return err
+	}
+	user.Role = role
+	return nil
+}
+
+// LoginTwoFactor - второй шаг входа: код TOTP или код восстановления
+func (s *AuthService) LoginTwoFactor(ctx context.Context, req *models.TwoFactorLoginRequest, client SessionClient) (*models.AuthResponse, error) {
+	if s.twoFactor == nil {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	userID, err := s.twoFactor.CompleteChallenge(ctx, req.PreAuthToken, req.Code)
+	if errors.Is(err, ErrInvalidTwoFactorCode) && s.guard != nil {
+		// Неверные коды копятся в той же блокировке, что и неверные пароли:
+		// иначе каждый новый pre-auth токен давал бы еще несколько попыток
+		if user, findErr := s.userRepo.FindByID(userID); findErr == nil && user != nil {
+			s.guard.Failure(ctx, user.Email, &user.ID, client.IP)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.GetActiveUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.startSession(ctx, user, client)
+}
+
+// Authenticate проверяет логин (email или имя пользователя) и пароль.
+// Используется протоколами без cookie - WebDAV, SFTP. Там некуда ввести
+// второй фактор, поэтому пользователям с 2FA вход по паролю закрыт.
+func (s *AuthService) Authenticate(ctx context.Context, login, password, ip string) (*models.User, error) {
+	user, err := s.checkPassword(ctx, login, password, ip, s.findByLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsDisabled() {
+		return nil, ErrAccountDisabled
+	}
+	if s.emailVerificationRequired(user) {
+		return nil, ErrEmailNotVerified
+	}
+
+	if s.twoFactor != nil && user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorRequired
+	}
+
+	return user, nil
+}
+
+// emailVerificationRequired - вход по паролю закрыт до подтверждения email
+func (s *AuthService) emailVerificationRequired(user *models.User) bool {
+	return s.Config.Auth.RequireEmailVerification && user.EmailVerificationPending
+}
+
+// findByLogin ищет пользователя по email, а если не нашелся - по имени
+func (s *AuthService) findByLogin(login string) (*models.User, error) {
+	user, err := s.userRepo.FindByEmail(login)
+	if err != nil || user != nil {
+		return user, err
+	}
+	return s.userRepo.FindByUsername(login)
+}
+
+// checkPassword проверяет пароль с учетом блокировки аккаунта: заблокированный
+// логин отклоняется до bcrypt, неудачи засчитываются и без существующего пользователя
+func (s *AuthService) checkPassword(ctx context.Context, login, password, ip string, find func(string) (*models.User, error)) (*models.User, error) {
+	if s.Config.Auth.DisablePasswordLogin {
+		return nil, ErrPasswordLoginDisabled
+	}
+	if s.guard != nil {
+		if err := s.guard.Check(ctx, login); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := find(login)
+	if err != nil {
+		return nil, err
+	}
+
+	// У пользователей, созданных через OIDC, пароля нет
+	if user == nil || user.Password == "" || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		if s.guard != nil {
+			var userID *uint
+			if user != nil {
+				userID = &user.ID
+			}
+			s.guard.Failure(ctx, login, userID, ip)
+		}
+		return nil, errors.New("invalid credentials")
+	}
+
+	if s.guard != nil {
+		s.guard.Success(ctx, login)
+	}
+	return user, nil
 }
 
 func (s *AuthService) GetUserByID(id uint) (*models.User, error) {
@@ -108,16 +558,138 @@ func (s *AuthService) GetUserByID(id uint) (*models.User, error) {
 	return user, nil
 }
 
-func (s *AuthService) generateToken(user *models.User) (string, error) {
+// BootstrapAdmins выдает роль администратора уже зарегистрированным
+// пользователям из ADMIN_EMAILS. Вызывается при запуске сервера.
+func (s *AuthService) BootstrapAdmins() error {
+	if len(s.Config.Auth.AdminEmails) == 0 {
+		return nil
+	}
+	return s.userRepo.PromoteByEmails(s.Config.Auth.AdminEmails, models.RoleAdmin)
+}
+
+func (s *AuthService) isAdminEmail(email string) bool {
+	for _, adminEmail := range s.Config.Auth.AdminEmails {
+		if strings.EqualFold(adminEmail, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetActiveUser - как GetUserByID, но отключенный пользователь считается ошибкой.
+// Нужен там, где токен выдан раньше, чем администратор отключил аккаунт.
+func (s *AuthService) GetActiveUser(id uint) (*models.User, error) {
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsDisabled() {
+		return nil, ErrAccountDisabled
+	}
+	return user, nil
+}
+
+// startSession открывает сессию устройства и выдает пару access + refresh
+func (s *AuthService) startSession(ctx context.Context, user *models.User, client SessionClient) (*models.AuthResponse, error) {
+	session, refreshToken, err := s.sessions.Create(ctx, user.ID, client)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.generateToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		User:         user.ToResponse(),
+	}, nil
+}
+
+// Refresh выдает новый access-токен и заменяет refresh-токен (ротация).
+// RefreshToken в ответе пуст, если замена уже выдана параллельному запросу.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string, client SessionClient) (*models.AuthResponse, error) {
+	session, newRefreshToken, err := s.sessions.Rotate(ctx, refreshToken, client)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.GetActiveUser(session.UserID)
+	if err != nil {
+		if revokeErr := s.sessions.Revoke(ctx, session.UserID, session.ID); revokeErr != nil {
+			fmt.Printf("Warning: failed to revoke session %s: %v\n", session.ID, revokeErr)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	token, err := s.generateToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthResponse{
+		Token:        token,
+		RefreshToken: newRefreshToken,
+		User:         user.ToResponse(),
+	}, nil
+}
+
+// Logout закрывает сессию, которой принадлежит refresh-токен
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	return s.sessions.RevokeByRefreshToken(ctx, refreshToken)
+}
+
+func (s *AuthService) ListSessions(ctx context.Context, userID uint, currentID string) ([]models.SessionResponse, error) {
+	sessions, err := s.sessions.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]models.SessionResponse, 0, len(sessions))
+	for i := range sessions {
+		response = append(response, sessions[i].ToResponse(currentID))
+	}
+	sort.Slice(response, func(i, j int) bool {
+		return response[i].LastSeenAt.After(response[j].LastSeenAt)
+	})
+	return response, nil
+}
+
+func (s *AuthService) RevokeSession(ctx context.Context, userID uint, sessionID string) error {
+	return s.sessions.Revoke(ctx, userID, sessionID)
+}
+
+// OnSessionsRevoked - обработчик, который вызывается, когда у пользователя
+// отзывают сессии: отключение, удаление, смена и сброс пароля, "выйти везде"
+func (s *AuthService) OnSessionsRevoked(fn func(userID uint)) {
+	s.sessions.OnRevoke(fn)
+}
+
+// CredentialStamp меняется при смене или сбросе пароля и при включении 2FA.
+// По нему кеш проверенных паролей (WebDAV) узнает, что запись устарела.
+func CredentialStamp(user *models.User) string {
+	return passwordFingerprint(user.Password) + ":" + strconv.FormatBool(user.TwoFactorEnabled())
+}
+
+// RevokeAllSessions - "выйти везде": отзывает все refresh- и access-токены пользователя
+func (s *AuthService) RevokeAllSessions(ctx context.Context, userID uint) error {
+	return s.sessions.RevokeAll(ctx, userID)
+}
+
+// generateToken выдает короткоживущий access-токен, привязанный к сессии sid
+func (s *AuthService) generateToken(user *models.User, sessionID string) (string, error) {
 	duration, err := time.ParseDuration(s.Config.JWT.Expiration)
 	if err != nil {
-		duration = 24 * time.Hour
+		duration = 15 * time.Minute
 	}
 
 	claims := jwt.MapClaims{
 		"user_id":  user.ID,
 		"email":    user.Email,
 		"username": user.Username,
+		"sid":      sessionID,
 		"exp":      time.Now().Add(duration).Unix(),
 		"iat":      time.Now().Unix(),
 	}
@@ -126,7 +698,9 @@ func (s *AuthService) generateToken(user *models.User) (string, error) {
 	return token.SignedString([]byte(s.Config.JWT.Secret))
 }
 
-func (s *AuthService) ValidateToken(tokenString string) (jwt.MapClaims, error) {
+// ValidateToken проверяет подпись и срок access-токена, а также что его сессия
+// не отозвана. Токены без сессии (выданные до появления сессий) не принимаются.
+func (s *AuthService) ValidateToken(ctx context.Context, tokenString string, ip string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("invalid signing method")
@@ -138,9 +712,19 @@ func (s *AuthService) ValidateToken(tokenString string) (jwt.MapClaims, error) {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	sessionID, _ := claims["sid"].(string)
+	userID, _ := claims["user_id"].(float64)
+	if sessionID == "" {
+		return nil, errors.New("invalid token")
+	}
+	if _, err := s.sessions.Validate(ctx, sessionID, uint(userID), ip); err != nil {
+		return nil, err
 	}
 
-	return nil, errors.New("invalid token")
+	return claims, nil
 }
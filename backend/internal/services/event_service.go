@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	EventFileCreated     = "file.created"
+	EventFileRenamed     = "file.renamed"
+	EventFileMoved       = "file.moved"
+	EventFileDeleted     = "file.deleted"
+	EventFileRestored    = "file.restored"
+	EventFileStarred     = "file.starred"
+	EventFileUnstarred   = "file.unstarred"
+	EventFolderStarred   = "folder.starred"
+	EventFolderUnstarred = "folder.unstarred"
+	EventShareCreated    = "share.created"
+	EventShareRevoked    = "share.revoked"
+	EventShareDownloaded = "share.downloaded"
+	EventShareUploaded   = "share.uploaded"
+	EventGrantCreated    = "grant.created"
+	EventGrantRevoked    = "grant.revoked"
+)
+
+const (
+	// Сколько последних событий храним для переподключения по Last-Event-ID
+	eventHistoryLength  = 1000
+	eventHistoryTTL     = 24 * time.Hour
+	eventPublishTimeout = 5 * time.Second
+)
+
+var eventIDPattern = regexp.MustCompile(`^\d+-\d+$`)
+
+// Event - уведомление об изменении, которое рассылается во все открытые вкладки пользователя
+type Event struct {
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+type FileEventData struct {
+	FileID      uuid.UUID `json:"file_id"`
+	Name        string    `json:"name"`
+	VirtualPath string    `json:"virtual_path"`
+	MimeType    string    `json:"mime_type,omitempty"`
+	Size        int64     `json:"size"`
+	OldName     string    `json:"old_name,omitempty"`
+	OldPath     string    `json:"old_path,omitempty"`
+	Permanent   bool      `json:"permanent,omitempty"`
+}
+
+type FolderEventData struct {
+	Path string `json:"path"`
+}
+
+type ShareEventData struct {
+	Token      string     `json:"token"`
+	FileID     *uuid.UUID `json:"file_id,omitempty"`
+	FolderPath string     `json:"folder_path,omitempty"`
+	Downloads  int        `json:"downloads"`
+}
+
+// GrantEventData - уведомление получателю о выданном или отозванном доступе
+type GrantEventData struct {
+	GrantID    uint   `json:"grant_id"`
+	Owner      string `json:"owner"`
+	Permission string `json:"permission,omitempty"`
+}
+
+// ShareUploadEventData - файл, загруженный посетителем по запросу файлов
+type ShareUploadEventData struct {
+	Token   string        `json:"token"`
+	File    FileEventData `json:"file"`
+	Uploads int           `json:"uploads"`
+}
+
+func newFileEventData(file *models.File) FileEventData {
+	return FileEventData{
+		FileID:      file.ID,
+		Name:        file.OriginalName,
+		VirtualPath: file.VirtualPath,
+		MimeType:    file.MimeType,
+		Size:        file.Size,
+	}
+}
+
+// EventService публикует события через Redis: stream хранит историю для Last-Event-ID,
+// а pub/sub доставляет события подписчикам на всех репликах бэкенда.
+type EventService struct {
+	redis *redis.Client
+}
+
+func NewEventService(redis *redis.Client) *EventService {
+	return &EventService{redis: redis}
+}
+
+func eventStreamKey(userID uint) string {
+	return fmt.Sprintf("user:%d:events", userID)
+}
+
+func eventChannel(userID uint) string {
+	return fmt.Sprintf("user:%d:events:live", userID)
+}
+
+// Publish сохраняет событие в историю и рассылает подписчикам.
+// Ошибки только логируются - уведомления не должны ломать основную операцию.
+func (s *EventService) Publish(userID uint, eventType string, data interface{}) {
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("⚠️ Failed to encode %s event: %v", eventType, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventPublishTimeout)
+	defer cancel()
+
+	event := Event{Type: eventType, Time: time.Now().UTC(), Data: rawData}
+
+	key := eventStreamKey(userID)
+	id, err := s.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: eventHistoryLength,
+		Approx: true,
+		Values: map[string]interface{}{"type": event.Type, "time": event.Time.Format(time.RFC3339Nano), "data": string(rawData)},
+	}).Result()
+	if err != nil {
+		log.Printf("⚠️ Failed to store %s event: %v", eventType, err)
+		return
+	}
+	event.ID = id
+
+	if err := s.redis.Expire(ctx, key, eventHistoryTTL).Err(); err != nil {
+		log.Printf("⚠️ Failed to set event history TTL: %v", err)
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if err := s.redis.Publish(ctx, eventChannel(userID), payload).Err(); err != nil {
+		log.Printf("⚠️ Failed to publish %s event: %v", eventType, err)
+	}
+}
+
+// Subscribe возвращает канал событий пользователя. Если lastEventID не пуст, сначала
+// отдаются пропущенные события из истории. Канал закрывается при отмене ctx.
+func (s *EventService) Subscribe(ctx context.Context, userID uint, lastEventID string) (<-chan Event, error) {
+	if !eventIDPattern.MatchString(lastEventID) {
+		lastEventID = ""
+	}
+
+	// Подписываемся до чтения истории, чтобы не потерять события между этими шагами
+	pubsub := s.redis.Subscribe(ctx, eventChannel(userID))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to events: %w", err)
+	}
+
+	var history []Event
+	if lastEventID != "" {
+		messages, err := s.redis.XRange(ctx, eventStreamKey(userID), "("+lastEventID, "+").Result()
+		if err != nil {
+			pubsub.Close()
+			return nil, fmt.Errorf("failed to read event history: %w", err)
+		}
+		for _, msg := range messages {
+			history = append(history, eventFromStream(msg))
+		}
+	}
+
+	events := make(chan Event, 64)
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+
+		lastSent := lastEventID
+		send := func(event Event) bool {
+			if lastSent != "" && compareEventIDs(event.ID, lastSent) <= 0 {
+				return true
+			}
+			select {
+			case events <- event:
+				lastSent = event.ID
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for _, event := range history {
+			if !send(event) {
+				return
+			}
+		}
+
+		live := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-live:
+				if !ok {
+					return
+				}
+				var event Event
+				if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+					continue
+				}
+				if !send(event) {
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+func eventFromStream(msg redis.XMessage) Event {
+	event := Event{ID: msg.ID}
+	if v, ok := msg.Values["type"].(string); ok {
+		event.Type = v
+	}
+	if v, ok := msg.Values["time"].(string); ok {
+		event.Time, _ = time.Parse(time.RFC3339Nano, v)
+	}
+	if v, ok := msg.Values["data"].(string); ok {
+		event.Data = json.RawMessage(v)
+	}
+	return event
+}
+
+// compareEventIDs сравнивает ID записей Redis stream вида "<ms>-<seq>"
+func compareEventIDs(a, b string) int {
+	aMs, aSeq := splitEventID(a)
+	bMs, bSeq := splitEventID(b)
+	switch {
+	case aMs != bMs:
+		if aMs < bMs {
+			return -1
+		}
+		return 1
+	case aSeq != bSeq:
+		if aSeq < bSeq {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+func splitEventID(id string) (uint64, uint64) {
+	msPart, seqPart, _ := strings.Cut(id, "-")
+	ms, _ := strconv.ParseUint(msPart, 10, 64)
+	seq, _ := strconv.ParseUint(seqPart, 10, 64)
+	return ms, seq
+}
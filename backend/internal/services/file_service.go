@@ -30,6 +30,18 @@ type FileService struct {
 	encryptionKey     []byte // 32 bytes для AES-256
 	storageLimit      int64
 	maxUploadSize     int64
+	events            *EventService
+	pendingEvents     *[]pendingEvent
+	grantRepo         *repositories.FileGrantRepository
+	teamRepo          *repositories.TeamRepository
+	teamStorageLimit  int64
+	userRepo          *repositories.UserRepository
+	usageRepo         *repositories.StorageUsageRepository
+	shareRepo         *repositories.SharedFileRepository
+	vaultRepo         *repositories.VaultRepository
+	// Учет корзины в квоте и пороги предупреждений, см. SetQuotaPolicy
+	quotaIncludesTrash bool
+	quotaWarnings      []int
 }
 
 func NewFileService(fileRepo *repositories.FileRepository, starredRepo *repositories.StarredFileRepository, starredFolderRepo *repositories.StarredFolderRepository, storageDir string, encryptionKey string, storageLimit int64, maxUploadSize int64) (*FileService, error) {
@@ -55,6 +67,36 @@ func NewFileService(fileRepo *repositories.FileRepository, starredRepo *reposito
 	}, nil
 }
 
+// withTx возвращает копию сервиса, все репозитории которой работают внутри tx
+func (s *FileService) withTx(tx *gorm.DB) *FileService {
+	txService := *s
+	txService.fileRepo = s.fileRepo.WithTx(tx)
+	txService.starredRepo = s.starredRepo.WithTx(tx)
+	txService.starredFolderRepo = s.starredFolderRepo.WithTx(tx)
+	// Необязательные репозитории тоже: иначе запрос с другого соединения будет ждать
+	// блокировку, которую tx держит до коммита (например, счетчик storage_usages)
+	if s.grantRepo != nil {
+		txService.grantRepo = s.grantRepo.WithTx(tx)
+	}
+	if s.teamRepo != nil {
+		txService.teamRepo = s.teamRepo.WithTx(tx)
+	}
+	if s.userRepo != nil {
+		txService.userRepo = s.userRepo.WithTx(tx)
+	}
+	if s.usageRepo != nil {
+		txService.usageRepo = s.usageRepo.WithTx(tx)
+	}
+	if s.shareRepo != nil {
+		txService.shareRepo = s.shareRepo.WithTx(tx)
+	}
+	if s.vaultRepo != nil {
+		txService.vaultRepo = s.vaultRepo.WithTx(tx)
+	}
+	txService.pendingEvents = &[]pendingEvent{}
+	return &txService
+}
+
 func (s *FileService) calculateSHA256(file multipart.File) (string, error) {
 	hash := sha256.New()
 	if _, err := io.Copy(hash, file); err != nil {
@@ -81,7 +123,9 @@ func (s *FileService) getStoragePath(sha256Hash string) string {
 	return filepath.Join(s.storageDir, dir1, dir2, sha256Hash)
 }
 
-func (s *FileService) encryptFile(src multipart.File, dstPath string) (int64, error) {
+// encryptFile шифрует поток блоками по 64 КБ. Читаем через io.ReadFull, чтобы
+// границы блоков не зависели от источника (pipe и сеть отдают данные кусками).
+func (s *FileService) encryptFile(src io.Reader, dstPath string) (int64, error) {
 	// Проверяем путь на безопасность
 	safePath, err := s.sanitizePath(dstPath)
 	if err != nil {
@@ -125,8 +169,8 @@ func (s *FileService) encryptFile(src multipart.File, dstPath string) (int64, er
 	var totalWritten int64 = int64(len(nonce))
 
 	for {
-		n, err := src.Read(buf)
-		if err != nil && err != io.EOF {
+		n, err := io.ReadFull(src, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 			return 0, fmt.Errorf("failed to read source file: %w", err)
 		}
 		if n == 0 {
@@ -187,8 +231,8 @@ func (s *FileService) decryptFile(srcPath string, dst io.Writer) error {
 	buf := make([]byte, 64*1024+gcm.Overhead())
 
 	for {
-		n, err := srcFile.Read(buf)
-		if err != nil && err != io.EOF {
+		n, err := io.ReadFull(srcFile, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 			return fmt.Errorf("failed to read encrypted file: %w", err)
 		}
 		if n == 0 {
@@ -220,6 +264,10 @@ func (s *FileService) UploadFile(userID uint, fileHeader *multipart.FileHeader)
 }
 
 func (s *FileService) CreateFolder(userID uint, virtualPath, folderName string) (*models.File, error) {
+	return s.createFolder(spaceTarget{userID: userID}, virtualPath, folderName)
+}
+
+func (s *FileService) createFolder(target spaceTarget, virtualPath, folderName string) (*models.File, error) {
 	if virtualPath == "" {
 		virtualPath = "/"
 	}
@@ -227,7 +275,7 @@ func (s *FileService) CreateFolder(userID uint, virtualPath, folderName string)
 		virtualPath += "/"
 	}
 
-	existingFiles, err := s.fileRepo.FindByUserIDAndPath(userID, virtualPath)
+	existingFiles, err := s.listSpace(target, virtualPath)
 	if err == nil {
 		for _, f := range existingFiles {
 			if f.OriginalName == folderName && f.MimeType == "inode/directory" {
@@ -255,7 +303,8 @@ func (s *FileService) CreateFolder(userID uint, virtualPath, folderName string)
 	fileID := uuid.New()
 	fileModel := &models.File{
 		ID:            fileID,
-		UserID:        userID,
+		UserID:        target.userID,
+		TeamID:        target.teamID,
 		Filename:      uuid.New().String(),
 		OriginalName:  folderName,
 		Path:          storagePath,
@@ -271,10 +320,36 @@ func (s *FileService) CreateFolder(userID uint, virtualPath, folderName string)
 		return nil, fmt.Errorf("failed to create folder record: %w", err)
 	}
 
+	s.emit(target.userID, EventFileCreated, newFileEventData(fileModel))
+
 	return fileModel, nil
 }
 
 func (s *FileService) UploadFileWithPath(userID uint, fileHeader *multipart.FileHeader, virtualPath, folderName string) (*models.File, error) {
+	return s.uploadFile(spaceTarget{userID: userID}, fileHeader, virtualPath, folderName)
+}
+
+// UploadGrantedFile сохраняет загрузку получателя доступа в папку владельца.
+// Как и у ссылки-запроса, дедупликация по записям отключена: иначе по ответу
+// получатель узнал бы ID, имя и путь файла владельца вне выданной папки.
+func (s *FileService) UploadGrantedFile(ownerID uint, fileHeader *multipart.FileHeader, virtualPath, folderName string) (*models.File, error) {
+	return s.storeUpload(spaceTarget{userID: ownerID}, fileHeader, virtualPath, folderName, false)
+}
+
+// UploadRequestFile сохраняет файл посетителя ссылки-запроса: всегда новая запись
+// в папке запроса. Совпадение с уже загруженным файлом владельца посетитель
+// заметить не должен, поэтому переиспользуется только блоб, но не запись.
+func (s *FileService) UploadRequestFile(userID uint, fileHeader *multipart.FileHeader, virtualPath string) (*models.File, error) {
+	return s.storeUpload(spaceTarget{userID: userID}, fileHeader, virtualPath, "", false)
+}
+
+func (s *FileService) uploadFile(target spaceTarget, fileHeader *multipart.FileHeader, virtualPath, folderName string) (*models.File, error) {
+	return s.storeUpload(target, fileHeader, virtualPath, folderName, true)
+}
+
+// storeUpload шифрует и сохраняет загрузку. dedup - вернуть уже существующий
+// файл пространства с тем же содержимым вместо новой записи.
+func (s *FileService) storeUpload(target spaceTarget, fileHeader *multipart.FileHeader, virtualPath, folderName string, dedup bool) (*models.File, error) {
 	file, err := fileHeader.Open()
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
@@ -282,29 +357,29 @@ func (s *FileService) UploadFileWithPath(userID uint, fileHeader *multipart.File
 	defer file.Close()
 
 	if fileHeader.Size > s.maxUploadSize {
-		return nil, fmt.Errorf("file too large: max size is %d bytes", s.maxUploadSize)
+		return nil, fmt.Errorf("%w: max size is %d bytes", ErrFileTooLarge, s.maxUploadSize)
 	}
 
-	stats, err := s.GetStorageStats(userID)
+	// Место резервируется до записи, поэтому параллельные загрузки не превысят квоту
+	reservation, err := s.reserveSpace(target, fileHeader.Size)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check storage quota: %w", err)
-	}
-
-	if stats.TotalUsed+fileHeader.Size > s.storageLimit {
-		return nil, fmt.Errorf("storage quota exceeded")
+		return nil, err
 	}
+	defer s.releaseQuota(reservation)
 
 	sha256Hash, err := s.calculateSHA256(file)
 	if err != nil {
 		return nil, err
 	}
 
-	existingFile, err := s.fileRepo.FindBySHA256AndUserID(sha256Hash, userID)
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, fmt.Errorf("failed to check existing file: %w", err)
-	}
-	if err == nil && existingFile != nil {
-		return existingFile, nil
+	if dedup {
+		existingFile, err := s.findDuplicate(target, sha256Hash)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to check existing file: %w", err)
+		}
+		if err == nil && existingFile != nil {
+			return existingFile, nil
+		}
 	}
 
 	storagePath := s.getStoragePath(sha256Hash)
@@ -332,7 +407,8 @@ func (s *FileService) UploadFileWithPath(userID uint, fileHeader *multipart.File
 
 	fileModel := &models.File{
 		ID:            uuid.New(),
-		UserID:        userID,
+		UserID:        target.userID,
+		TeamID:        target.teamID,
 		Filename:      uuid.New().String() + filepath.Ext(fileHeader.Filename),
 		OriginalName:  fileHeader.Filename,
 		Path:          storagePath,
@@ -348,6 +424,8 @@ func (s *FileService) UploadFileWithPath(userID uint, fileHeader *multipart.File
 		return nil, fmt.Errorf("failed to save file metadata: %w", err)
 	}
 
+	s.emit(target.userID, EventFileCreated, newFileEventData(fileModel))
+
 	return fileModel, nil
 }
 
@@ -357,8 +435,13 @@ func (s *FileService) GetFile(fileID uuid.UUID, userID uint) (*models.File, erro
 		return nil, fmt.Errorf("file not found: %w", err)
 	}
 
-	if file.UserID != userID {
-		return nil, fmt.Errorf("access denied")
+	// Кроме владельца файл доступен тем, кому выдан доступ к нему или к его папке
+	permission, err := s.filePermission(userID, file)
+	if err != nil {
+		return nil, err
+	}
+	if !permits(permission, false) {
+		return nil, ErrAccessDenied
 	}
 
 	return file, nil
@@ -483,15 +566,18 @@ func (s *FileService) DownloadFolderAsZip(virtualPath string, userID uint, w io.
 }
 
 func (s *FileService) DeleteFile(fileID uuid.UUID, userID uint) error {
-	_, err := s.GetFile(fileID, userID)
+	file, err := s.getWritableFile(fileID, userID)
 	if err != nil {
 		return err
 	}
 
+	// Файл попадает в корзину владельца, даже если его удалил пользователь с доступом
 	if err := s.fileRepo.Delete(fileID); err != nil {
 		return fmt.Errorf("failed to delete file metadata: %w", err)
 	}
 
+	s.emit(file.UserID, EventFileDeleted, newFileEventData(file))
+
 	return nil
 }
 
@@ -545,43 +631,68 @@ func (s *FileService) RestoreFile(fileID uuid.UUID, userID uint) error {
 		return fmt.Errorf("file not found: %w", err)
 	}
 
-	if file.UserID != userID {
-		return fmt.Errorf("access denied")
+	if err := s.authorizeTrash(userID, file); err != nil {
+		return err
 	}
 
 	if err := s.fileRepo.Restore(fileID); err != nil {
 		return fmt.Errorf("failed to restore file: %w", err)
 	}
 
+	s.emit(file.UserID, EventFileRestored, newFileEventData(file))
+
 	return nil
 }
 
 func (s *FileService) DeleteFilePermanently(fileID uuid.UUID, userID uint) error {
+	blobPath, err := s.purgeFile(fileID, userID)
+	if err != nil {
+		return err
+	}
+
+	s.removeBlob(blobPath)
+	return nil
+}
+
+// purgeFile удаляет запись о файле навсегда и возвращает путь к физическому
+// файлу, если на него больше никто не ссылается (иначе пустую строку).
+// Сам файл на диске не трогает - внутри транзакции это делать рано.
+func (s *FileService) purgeFile(fileID uuid.UUID, userID uint) (string, error) {
 	file, err := s.fileRepo.FindByIDUnscoped(fileID)
 	if err != nil {
-		return fmt.Errorf("file not found: %w", err)
+		return "", fmt.Errorf("file not found: %w", err)
 	}
 
-	if file.UserID != userID {
-		return fmt.Errorf("access denied")
+	if err := s.authorizeTrash(userID, file); err != nil {
+		return "", err
 	}
 
 	count, err := s.fileRepo.CountBySHA256Unscoped(file.SHA256)
 	if err != nil {
-		return fmt.Errorf("failed to check file usage: %w", err)
+		return "", fmt.Errorf("failed to check file usage: %w", err)
 	}
 
 	if err := s.fileRepo.DeletePermanently(fileID); err != nil {
-		return fmt.Errorf("failed to delete file permanently: %w", err)
+		return "", fmt.Errorf("failed to delete file permanently: %w", err)
 	}
 
+	eventData := newFileEventData(file)
+	eventData.Permanent = true
+	s.emit(file.UserID, EventFileDeleted, eventData)
+
 	if count <= 1 {
-		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
-			fmt.Printf("Warning: failed to delete physical file %s: %v\n", file.Path, err)
-		}
+		return file.Path, nil
 	}
+	return "", nil
+}
 
-	return nil
+func (s *FileService) removeBlob(path string) {
+	if path == "" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: failed to delete physical file %s: %v\n", path, err)
+	}
 }
 
 func (s *FileService) getFileSystemUsage() (total, free uint64, err error) {
@@ -601,7 +712,9 @@ func (s *FileService) GetStorageStats(userID uint) (*models.StorageStats, error)
 		return nil, err
 	}
 
-	stats.Limit = s.storageLimit
+	if err := s.applyQuota(userID, stats); err != nil {
+		return nil, err
+	}
 
 	total, free, err := s.getFileSystemUsage()
 	if err != nil {
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+)
+
+// PurgeUserFiles навсегда удаляет личные файлы пользователя вместе с корзиной
+// и E2E-хранилищами. Блобы удаляются, только если на них не ссылаются файлы
+// других пользователей.
+func (s *FileService) PurgeUserFiles(ctx context.Context, userID uint, progress JobProgressFunc) (int, error) {
+	files, err := s.fileRepo.FindAllByUserIDUnscoped(userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get files: %w", err)
+	}
+
+	total := int64(len(files))
+	progress(0, total)
+
+	for i, file := range files {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+
+		blobPath, err := s.purgeFile(file.ID, userID)
+		if err != nil {
+			return i, err
+		}
+		s.removeBlob(blobPath)
+		progress(int64(i+1), total)
+	}
+
+	purged, err := s.purgeUserVaults(ctx, userID)
+	return len(files) + purged, err
+}
+
+// GetGlobalStorageStats - занятое место на всем сервере для администратора
+func (s *FileService) GetGlobalStorageStats() (*models.GlobalStorageStats, error) {
+	stats, err := s.fileRepo.GetGlobalStats()
+	if err != nil {
+		return nil, err
+	}
+
+	stats.SavedBytes = stats.LogicalBytes + stats.TrashBytes - stats.UniqueBytes
+	if stats.UniqueBytes > 0 {
+		stats.DedupRatio = float64(stats.LogicalBytes+stats.TrashBytes) / float64(stats.UniqueBytes)
+	}
+
+	total, free, err := s.getFileSystemUsage()
+	if err != nil {
+		fmt.Printf("Warning: failed to get disk usage: %v\n", err)
+	} else {
+		const maxInt64 = int64(^uint64(0) >> 1)
+
+		if total > uint64(maxInt64) {
+			stats.PhysicalTotal = maxInt64
+		} else {
+			stats.PhysicalTotal = int64(total)
+		}
+
+		if free > uint64(maxInt64) {
+			stats.PhysicalFree = maxInt64
+		} else {
+			stats.PhysicalFree = int64(free)
+		}
+	}
+
+	return stats, nil
+}
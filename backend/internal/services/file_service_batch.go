@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"gorm.io/gorm"
+)
+
+var errBatchAborted = errors.New("batch aborted")
+
+// ExecuteBatch выполняет набор операций над файлами в одной транзакции.
+// В обычном режиме каждая операция защищена savepoint'ом, и ошибка откатывает только её.
+// В режиме Atomic первая же ошибка откатывает всю транзакцию.
+func (s *FileService) ExecuteBatch(userID uint, req *models.BatchRequest) (*models.BatchResponse, error) {
+	resp := &models.BatchResponse{
+		Results: make([]models.BatchItemResult, len(req.Operations)),
+	}
+	for i, op := range req.Operations {
+		resp.Results[i] = models.BatchItemResult{Index: i, Op: op.Op, FileID: op.FileID}
+	}
+
+	// Физические файлы удаляем только после коммита
+	var blobsToRemove []string
+
+	var txService *FileService
+	err := s.fileRepo.Transaction(func(tx *gorm.DB) error {
+		txService = s.withTx(tx)
+
+		for i, op := range req.Operations {
+			result := &resp.Results[i]
+
+			savepoint := fmt.Sprintf("batch_op_%d", i)
+			if !req.Atomic {
+				if err := tx.SavePoint(savepoint).Error; err != nil {
+					return err
+				}
+			}
+
+			eventsBefore := len(*txService.pendingEvents)
+			file, blobPath, err := txService.applyBatchOperation(userID, op)
+			if err != nil {
+				result.Error = err.Error()
+				if req.Atomic {
+					return errBatchAborted
+				}
+				if err := tx.RollbackTo(savepoint).Error; err != nil {
+					return err
+				}
+				// События откатанной операции не отправляем
+				*txService.pendingEvents = (*txService.pendingEvents)[:eventsBefore]
+				continue
+			}
+
+			result.Success = true
+			result.File = file
+			if blobPath != "" {
+				blobsToRemove = append(blobsToRemove, blobPath)
+			}
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, errBatchAborted) {
+		resp.RolledBack = true
+		blobsToRemove = nil
+		for i := range resp.Results {
+			result := &resp.Results[i]
+			if result.Success {
+				result.Success = false
+				result.File = nil
+				result.Error = "rolled back"
+			} else if result.Error == "" {
+				result.Error = "not executed"
+			}
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("batch transaction failed: %w", err)
+	}
+
+	for _, path := range blobsToRemove {
+		s.removeBlob(path)
+	}
+
+	if !resp.RolledBack {
+		s.flushEvents(*txService.pendingEvents)
+	}
+
+	for _, result := range resp.Results {
+		if result.Success {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+
+	return resp, nil
+}
+
+// applyBatchOperation выполняет одну операцию пакета.
+// Для purge возвращает путь к физическому файлу, который нужно удалить после коммита.
+func (s *FileService) applyBatchOperation(userID uint, op models.BatchOperation) (*models.File, string, error) {
+	switch op.Op {
+	case models.BatchOpDelete:
+		return nil, "", s.DeleteFile(op.FileID, userID)
+	case models.BatchOpMove:
+		if op.TargetPath == "" {
+			return nil, "", fmt.Errorf("target_path is required")
+		}
+		file, err := s.MoveFile(op.FileID, userID, op.TargetPath)
+		return file, "", err
+	case models.BatchOpCopy:
+		file, err := s.CopyFile(op.FileID, userID, op.TargetPath)
+		return file, "", err
+	case models.BatchOpStar:
+		return nil, "", s.SetStarred(op.FileID, userID, true)
+	case models.BatchOpUnstar:
+		return nil, "", s.SetStarred(op.FileID, userID, false)
+	case models.BatchOpRestore:
+		return nil, "", s.RestoreFile(op.FileID, userID)
+	case models.BatchOpPurge:
+		blobPath, err := s.purgeFile(op.FileID, userID)
+		return nil, blobPath, err
+	default:
+		return nil, "", fmt.Errorf("unknown operation: %s", op.Op)
+	}
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"gorm.io/gorm"
+)
+
+// runBatch выполняет пакет с таймаутом: зависание на блокировке должно
+// проваливать тест, а не весь прогон
+func runBatch(t *testing.T, service *FileService, userID uint, req *models.BatchRequest) *models.BatchResponse {
+	t.Helper()
+
+	type outcome struct {
+		resp *models.BatchResponse
+		err  error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		resp, err := service.ExecuteBatch(userID, req)
+		done <- outcome{resp, err}
+	}()
+
+	select {
+	case out := <-done:
+		if out.err != nil {
+			t.Fatalf("ExecuteBatch: %v", out.err)
+		}
+		return out.resp
+	case <-time.After(15 * time.Second):
+		t.Fatal("ExecuteBatch did not finish: batch transaction is waiting on its own lock")
+		return nil
+	}
+}
+
+// Копирование резервирует квоту; после удаления в том же пакете счетчик
+// storage_usages уже заблокирован транзакцией пакета, и резерв с другого
+// соединения ждал бы его вечно
+func TestExecuteBatchCopyAfterDeleteDoesNotDeadlock(t *testing.T) {
+	db := openTestDB(t)
+	service := newTestFileService(t, db)
+	user := createTestUser(t, db)
+
+	first := storeTestFile(t, service, user.ID, "/", "first.txt", "first")
+	second := storeTestFile(t, service, user.ID, "/", "second.txt", "second")
+	if _, err := service.CreateFolder(user.ID, "/", "copies"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+
+	resp := runBatch(t, service, user.ID, &models.BatchRequest{Operations: []models.BatchOperation{
+		{Op: models.BatchOpCopy, FileID: first.ID, TargetPath: "/copies/"},
+		{Op: models.BatchOpDelete, FileID: second.ID},
+		{Op: models.BatchOpCopy, FileID: first.ID, TargetPath: "/copies/"},
+	}})
+
+	if resp.Succeeded != 3 || resp.Failed != 0 {
+		t.Fatalf("succeeded=%d failed=%d, results=%+v", resp.Succeeded, resp.Failed, resp.Results)
+	}
+
+	usage, reservations := testUsage(t, db, user.ID)
+	if usage.ReservedBytes != 0 || reservations != 0 {
+		t.Errorf("reserved_bytes=%d reservations=%d, want both released", usage.ReservedBytes, reservations)
+	}
+}
+
+// batchFixture - два файла пользователя и пакет, последняя операция которого
+// падает: копирование в несуществующую папку
+func batchFixture(t *testing.T, atomic bool) (*gorm.DB, *FileService, *models.User, *models.BatchRequest, *models.File, *models.File) {
+	t.Helper()
+
+	db := openTestDB(t)
+	service := newTestFileService(t, db)
+	user := createTestUser(t, db)
+
+	first := storeTestFile(t, service, user.ID, "/", "first.txt", "first")
+	second := storeTestFile(t, service, user.ID, "/", "second.txt", "second")
+
+	req := &models.BatchRequest{Atomic: atomic, Operations: []models.BatchOperation{
+		{Op: models.BatchOpCopy, FileID: first.ID, TargetPath: "/"},
+		{Op: models.BatchOpStar, FileID: first.ID},
+		{Op: models.BatchOpDelete, FileID: second.ID},
+		{Op: models.BatchOpCopy, FileID: first.ID, TargetPath: "/missing/"},
+	}}
+	return db, service, user, req, first, second
+}
+
+func countActiveFiles(t *testing.T, db *gorm.DB, userID uint) int64 {
+	t.Helper()
+
+	var count int64
+	if err := db.Model(&models.File{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		t.Fatalf("failed to count files: %v", err)
+	}
+	return count
+}
+
+func TestExecuteBatchAtomicRollsBackEverything(t *testing.T) {
+	db, service, user, req, first, second := batchFixture(t, true)
+	before, _ := testUsage(t, db, user.ID)
+
+	resp := runBatch(t, service, user.ID, req)
+
+	if !resp.RolledBack || resp.Succeeded != 0 || resp.Failed != len(req.Operations) {
+		t.Fatalf("rolled_back=%v succeeded=%d failed=%d", resp.RolledBack, resp.Succeeded, resp.Failed)
+	}
+	for _, result := range resp.Results[:3] {
+		if result.Error != "rolled back" || result.File != nil {
+			t.Errorf("op %d (%s): error=%q file=%v, want rolled back", result.Index, result.Op, result.Error, result.File)
+		}
+	}
+	if resp.Results[3].Error == "" || resp.Results[3].Error == "rolled back" {
+		t.Errorf("failing op error = %q, want the copy error", resp.Results[3].Error)
+	}
+
+	if count := countActiveFiles(t, db, user.ID); count != 2 {
+		t.Errorf("active files = %d, want 2 (copy undone, delete undone)", count)
+	}
+	if _, err := service.GetFile(second.ID, user.ID); err != nil {
+		t.Errorf("deleted file was not restored by rollback: %v", err)
+	}
+	if starred, err := service.starredRepo.IsStarred(user.ID, first.ID); err != nil || starred {
+		t.Errorf("starred=%v err=%v, want star undone", starred, err)
+	}
+
+	after, reservations := testUsage(t, db, user.ID)
+	if after.UsedBytes != before.UsedBytes || after.TrashBytes != before.TrashBytes {
+		t.Errorf("usage changed: before %+v, after %+v", before, after)
+	}
+	if after.ReservedBytes != 0 || reservations != 0 {
+		t.Errorf("reserved_bytes=%d reservations=%d after rollback", after.ReservedBytes, reservations)
+	}
+}
+
+func TestExecuteBatchRollsBackOnlyFailedOperation(t *testing.T) {
+	db, service, user, req, first, second := batchFixture(t, false)
+
+	resp := runBatch(t, service, user.ID, req)
+
+	if resp.RolledBack || resp.Succeeded != 3 || resp.Failed != 1 {
+		t.Fatalf("rolled_back=%v succeeded=%d failed=%d, results=%+v", resp.RolledBack, resp.Succeeded, resp.Failed, resp.Results)
+	}
+	if resp.Results[3].Success || resp.Results[3].Error == "" {
+		t.Errorf("failing op reported as %+v", resp.Results[3])
+	}
+	if resp.Results[0].File == nil {
+		t.Fatal("copy result has no file")
+	}
+
+	// Первый файл и его копия; второй в корзине
+	if count := countActiveFiles(t, db, user.ID); count != 2 {
+		t.Errorf("active files = %d, want 2", count)
+	}
+	if _, err := service.GetFile(resp.Results[0].File.ID, user.ID); err != nil {
+		t.Errorf("committed copy is missing: %v", err)
+	}
+	if _, err := service.GetFile(second.ID, user.ID); err == nil {
+		t.Error("deleted file is still active")
+	}
+	if starred, err := service.starredRepo.IsStarred(user.ID, first.ID); err != nil || !starred {
+		t.Errorf("starred=%v err=%v, want star committed", starred, err)
+	}
+
+	usage, reservations := testUsage(t, db, user.ID)
+	if usage.ReservedBytes != 0 || reservations != 0 {
+		t.Errorf("reserved_bytes=%d reservations=%d, want both released", usage.ReservedBytes, reservations)
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/google/uuid"
+)
+
+// CopyFile создает копию файла в другой папке.
+// Зашифрованные данные на диске общие (дедупликация по SHA256), копируется только запись.
+// Копия чужого файла, доступного по выданному доступу, попадает к userID и в его квоту.
+func (s *FileService) CopyFile(fileID uuid.UUID, userID uint, targetPath string) (*models.File, error) {
+	file, err := s.GetFile(fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.MimeType == "inode/directory" {
+		return nil, fmt.Errorf("copying folders is not supported")
+	}
+
+	// Нормализуем путь, по умолчанию копируем в ту же папку, а чужой файл - в корень
+	if targetPath == "" {
+		targetPath = file.VirtualPath
+		if file.UserID != userID {
+			targetPath = "/"
+		}
+	}
+	if targetPath[len(targetPath)-1] != '/' {
+		targetPath += "/"
+	}
+
+	// Копия попадает в пространство userID, там папка и должна существовать,
+	// иначе опечатка в пути создаст папку, которой никто не создавал
+	exists, err := s.folderExists(userID, targetPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check target folder: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("target folder %s does not exist", targetPath)
+	}
+
+	reservation, err := s.reserveQuota(userID, file.Size, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseQuota(reservation)
+
+	fileCopy := &models.File{
+		ID:            uuid.New(),
+		UserID:        userID,
+		Filename:      uuid.New().String() + filepath.Ext(file.OriginalName),
+		OriginalName:  file.OriginalName,
+		Path:          file.Path,
+		VirtualPath:   targetPath,
+		FolderName:    file.FolderName,
+		SHA256:        file.SHA256,
+		MimeType:      file.MimeType,
+		Size:          file.Size,
+		EncryptedSize: file.EncryptedSize,
+	}
+
+	if err := s.fileRepo.Create(fileCopy); err != nil {
+		return nil, fmt.Errorf("failed to copy file: %w", err)
+	}
+
+	s.emit(userID, EventFileCreated, newFileEventData(fileCopy))
+
+	return fileCopy, nil
+}
+
+// folderExists проверяет папку личного пространства так же, как WebDAV при
+// перемещении: корень есть всегда, иначе нужен маркер папки или файлы в ней
+func (s *FileService) folderExists(userID uint, folderPath string) (bool, error) {
+	if folderPath == "/" {
+		return true, nil
+	}
+
+	parent, name := splitFolderPath(folderPath)
+	markers, err := s.fileRepo.FindByPathAndName(userID, parent, name)
+	if err != nil {
+		return false, err
+	}
+	for i := range markers {
+		if markers[i].MimeType == "inode/directory" {
+			return true, nil
+		}
+	}
+
+	// Папки без маркера существуют, пока в них есть файлы
+	return s.fileRepo.HasFilesUnderPath(userID, folderPath)
+}
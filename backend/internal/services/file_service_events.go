@@ -0,0 +1,34 @@
+package services
+
+type pendingEvent struct {
+	userID    uint
+	eventType string
+	data      interface{}
+}
+
+// SetEventService подключает уведомления об изменениях файлов
+func (s *FileService) SetEventService(events *EventService) {
+	s.events = events
+}
+
+// emit публикует событие. Внутри транзакции (см. withTx) события копятся
+// и отправляются только после коммита.
+func (s *FileService) emit(userID uint, eventType string, data interface{}) {
+	if s.events == nil {
+		return
+	}
+	if s.pendingEvents != nil {
+		*s.pendingEvents = append(*s.pendingEvents, pendingEvent{userID: userID, eventType: eventType, data: data})
+		return
+	}
+	s.events.Publish(userID, eventType, data)
+}
+
+func (s *FileService) flushEvents(events []pendingEvent) {
+	if s.events == nil {
+		return
+	}
+	for _, event := range events {
+		s.events.Publish(event.userID, event.eventType, event.data)
+	}
+}
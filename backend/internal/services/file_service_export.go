@@ -0,0 +1,342 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+)
+
+const (
+	JobTypeAccountExport = "account_export"
+
+	exportManifestVersion = 1
+)
+
+// SetShareRepository добавляет публичные ссылки в выгрузку данных аккаунта
+func (s *FileService) SetShareRepository(shareRepo *repositories.SharedFileRepository) {
+	s.shareRepo = shareRepo
+}
+
+// runAccountExportJob собирает архив "все мои данные": файлы со структурой
+// папок в files/, корзину в trash/, шифротекст E2E-хранилищ в vaults/ и
+// manifest.json с метаданными, отметками, ссылками и доступами. Файлы команд
+// в выгрузку не входят.
+func (s *FileService) runAccountExportJob(ctx context.Context, job *models.Job, progress JobProgressFunc) (interface{}, error) {
+	files, err := s.fileRepo.FindAllByUserIDUnscoped(job.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files: %w", err)
+	}
+
+	manifest, err := s.buildExportManifest(job.UserID, files)
+	if err != nil {
+		return nil, err
+	}
+	var vaultFiles []models.File
+	if manifest.Vaults, vaultFiles, err = s.exportVaults(job.UserID); err != nil {
+		return nil, err
+	}
+
+	var total int64
+	count := 0
+	for _, file := range files {
+		if file.MimeType != "inode/directory" {
+			total += file.Size
+			count++
+		}
+	}
+	for _, file := range vaultFiles {
+		total += file.Size
+		count++
+	}
+	progress(0, total)
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.writeAccountExport(ctx, pw, manifest, files, vaultFiles, total, progress))
+	}()
+
+	artifactPath := s.jobArtifactPath(job.ID)
+	if _, err := s.encryptFile(pr, artifactPath); err != nil {
+		pr.CloseWithError(err)
+		s.removeJobArtifact(job)
+		return nil, err
+	}
+
+	return FolderZipResult{
+		Filename: "0x40-cloud-export-" + manifest.ExportedAt.Format("2006-01-02") + ".zip",
+		Files:    count,
+		Size:     total,
+	}, nil
+}
+
+// buildExportManifest описывает все данные пользователя. Пути в архиве
+// назначаются здесь же, чтобы manifest.json можно было записать первым.
+func (s *FileService) buildExportManifest(userID uint, files []models.File) (*models.ExportManifest, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, PermanentJobError(ErrUserNotFound)
+	}
+
+	manifest := &models.ExportManifest{
+		Version:        exportManifestVersion,
+		ExportedAt:     time.Now().UTC(),
+		User:           user.ToResponse(),
+		Files:          make([]models.ExportFile, 0, len(files)),
+		StarredFolders: []string{},
+		Shares:         []models.ExportShare{},
+		GrantsGiven:    []models.ExportGrant{},
+		GrantsReceived: []models.ExportGrant{},
+		Vaults:         []models.ExportVault{},
+	}
+
+	starredIDs, err := s.starredRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get starred files: %w", err)
+	}
+	starred := make(map[string]bool, len(starredIDs))
+	for _, id := range starredIDs {
+		starred[id.String()] = true
+	}
+
+	// В корзине могут лежать одноименные файлы из одной папки
+	used := make(map[string]bool, len(files))
+	for _, file := range files {
+		entry := models.ExportFile{
+			ID:        file.ID,
+			Name:      file.OriginalName,
+			Folder:    file.VirtualPath,
+			IsFolder:  file.MimeType == "inode/directory",
+			Size:      file.Size,
+			MimeType:  file.MimeType,
+			CreatedAt: file.CreatedAt,
+			UpdatedAt: file.UpdatedAt,
+			Starred:   starred[file.ID.String()],
+		}
+		if file.DeletedAt.Valid {
+			deletedAt := file.DeletedAt.Time
+			entry.DeletedAt = &deletedAt
+		}
+		if !entry.IsFolder {
+			entry.SHA256 = file.SHA256
+			entry.ArchivePath = uniqueArchivePath(used, exportArchivePath(file))
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	folders, err := s.starredFolderRepo.FindStarredFoldersByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get starred folders: %w", err)
+	}
+	for _, folder := range folders {
+		manifest.StarredFolders = append(manifest.StarredFolders, folder.FolderPath)
+	}
+
+	if s.shareRepo != nil {
+		shares, err := s.shareRepo.GetByUserID(userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get shares: %w", err)
+		}
+		for _, share := range shares {
+			manifest.Shares = append(manifest.Shares, models.ExportShare{
+				Type:              share.Type,
+				FileID:            share.FileID,
+				FolderPath:        share.FolderPath,
+				CreatedAt:         share.CreatedAt,
+				ExpiresAt:         share.ExpiresAt,
+				Limit:             share.Limit,
+				Downloads:         share.Downloads,
+				Uploads:           share.Uploads,
+				PasswordProtected: share.PasswordProtected,
+			})
+		}
+	}
+
+	if s.grantRepo != nil {
+		given, err := s.grantRepo.FindByOwnerID(userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get grants: %w", err)
+		}
+		for _, grant := range given {
+			manifest.GrantsGiven = append(manifest.GrantsGiven, exportGrant(grant, grant.Grantee.Username))
+		}
+		received, err := s.grantRepo.FindByGranteeID(userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get grants: %w", err)
+		}
+		for _, grant := range received {
+			manifest.GrantsReceived = append(manifest.GrantsReceived, exportGrant(grant, grant.Owner.Username))
+		}
+	}
+
+	return manifest, nil
+}
+
+// exportVaults описывает E2E-хранилища с обернутыми ключами и возвращает их файлы
+func (s *FileService) exportVaults(userID uint) ([]models.ExportVault, []models.File, error) {
+	if s.vaultRepo == nil {
+		return []models.ExportVault{}, nil, nil
+	}
+
+	vaults, err := s.vaultRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get vaults: %w", err)
+	}
+	files, err := s.vaultRepo.FindFilesByUserID(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get vault files: %w", err)
+	}
+
+	result := make([]models.ExportVault, 0, len(vaults))
+	index := make(map[uint]int, len(vaults))
+	for _, vault := range vaults {
+		index[vault.ID] = len(result)
+		result = append(result, models.ExportVault{
+			ID:         vault.ID,
+			Name:       vault.Name,
+			WrappedKey: vault.WrappedKey,
+			KeyParams:  vault.KeyParams,
+			KeyVersion: vault.KeyVersion,
+			CreatedAt:  vault.CreatedAt,
+			Files:      []models.ExportVaultFile{},
+		})
+	}
+
+	exported := make([]models.File, 0, len(files))
+	for _, file := range files {
+		i, ok := index[*file.VaultID]
+		if !ok {
+			continue
+		}
+		result[i].Files = append(result[i].Files, models.ExportVaultFile{
+			VaultFileResponse: file.ToVaultFileResponse(),
+			ArchivePath:       vaultArchivePath(file),
+		})
+		exported = append(exported, file)
+	}
+	return result, exported, nil
+}
+
+// vaultArchivePath - имена файлов хранилищ зашифрованы, поэтому в архиве они по ID
+func vaultArchivePath(file models.File) string {
+	return path.Join("vaults", strconv.FormatUint(uint64(*file.VaultID), 10), file.ID.String())
+}
+
+func exportGrant(grant models.FileGrant, user string) models.ExportGrant {
+	return models.ExportGrant{
+		User:       user,
+		Type:       grant.Type,
+		FileID:     grant.FileID,
+		FolderPath: grant.FolderPath,
+		Permission: grant.Permission,
+		CreatedAt:  grant.CreatedAt,
+	}
+}
+
+// exportArchivePath - путь файла в архиве: files/ для личных файлов, trash/ для корзины.
+// Имя, выводящее за пределы каталога, заменяется идентификатором файла.
+func exportArchivePath(file models.File) string {
+	root := "files"
+	if file.DeletedAt.Valid {
+		root = "trash"
+	}
+	name := path.Join(root, file.VirtualPath, file.OriginalName)
+	if !strings.HasPrefix(name, root+"/") {
+		name = path.Join(root, file.ID.String())
+	}
+	return name
+}
+
+// uniqueArchivePath добавляет к имени " (2)", " (3)"..., если путь уже занят
+func uniqueArchivePath(used map[string]bool, name string) string {
+	candidate := name
+	ext := path.Ext(name)
+	for i := 2; used[candidate]; i++ {
+		candidate = strings.TrimSuffix(name, ext) + " (" + strconv.Itoa(i) + ")" + ext
+	}
+	used[candidate] = true
+	return candidate
+}
+
+func (s *FileService) writeAccountExport(ctx context.Context, w io.Writer, manifest *models.ExportManifest, files, vaultFiles []models.File, total int64, progress JobProgressFunc) error {
+	zipWriter := zip.NewWriter(w)
+
+	entry, err := zipWriter.Create("manifest.json")
+	if err != nil {
+		return fmt.Errorf("failed to create zip entry: %w", err)
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	var done int64
+	for i, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Пустые папки сохраняются отдельными записями каталогов
+		if manifest.Files[i].IsFolder {
+			if _, err := zipWriter.Create(exportArchivePath(file) + "/"); err != nil {
+				return fmt.Errorf("failed to create zip entry: %w", err)
+			}
+			continue
+		}
+
+		entry, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:     manifest.Files[i].ArchivePath,
+			Method:   zip.Deflate,
+			Modified: file.UpdatedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create zip entry: %w", err)
+		}
+
+		counter := &progressWriter{w: entry, ctx: ctx, onWrite: func(n int64) {
+			done += n
+			progress(done, total)
+		}}
+		if err := s.decryptFile(file.Path, counter); err != nil {
+			return fmt.Errorf("failed to decrypt file %s: %w", file.OriginalName, err)
+		}
+	}
+
+	for _, file := range vaultFiles {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Шифротекст не сжимается, копируем его без Deflate
+		entry, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:     vaultArchivePath(file),
+			Method:   zip.Store,
+			Modified: file.UpdatedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create zip entry: %w", err)
+		}
+
+		counter := &progressWriter{w: entry, ctx: ctx, onWrite: func(n int64) {
+			done += n
+			progress(done, total)
+		}}
+		if err := s.copyRawBlob(file.Path, counter); err != nil {
+			return fmt.Errorf("failed to copy vault file %s: %w", file.ID, err)
+		}
+	}
+
+	return zipWriter.Close()
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+	"github.com/google/uuid"
+)
+
+var ErrAccessDenied = errors.New("access denied")
+
+// SetGrantRepository подключает проверку доступов, выданных другими пользователями.
+// Без него к файлам имеет доступ только владелец.
+func (s *FileService) SetGrantRepository(grantRepo *repositories.FileGrantRepository) {
+	s.grantRepo = grantRepo
+}
+
+// filePermission - права userID на файл: владелец может все, остальные - по выданным доступам
+// или по роли в команде.
+// Пустая строка - доступа нет.
+func (s *FileService) filePermission(userID uint, file *models.File) (string, error) {
+	// Файлами команды распоряжаются по ролям, загрузивший участник не считается владельцем
+	if file.TeamID != nil {
+		return s.teamPermission(userID, *file.TeamID)
+	}
+	if file.UserID == userID {
+		return models.GrantPermissionWrite, nil
+	}
+	if s.grantRepo == nil {
+		return "", nil
+	}
+
+	grants, err := s.grantRepo.FindBetween(file.UserID, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to check access: %w", err)
+	}
+
+	// Маркер папки проверяем по пути самой папки, а не родительской
+	filePath := file.VirtualPath
+	if file.MimeType == "inode/directory" {
+		filePath = normalizeFolderPath(file.VirtualPath + file.OriginalName)
+	}
+
+	permission := ""
+	for _, grant := range grants {
+		covers := (grant.FileID != nil && *grant.FileID == file.ID) ||
+			(grant.FileID == nil && strings.HasPrefix(filePath, grant.FolderPath))
+		if covers {
+			permission = strongerPermission(permission, grant.Permission)
+		}
+	}
+	return permission, nil
+}
+
+// FolderPermission - права userID на папку владельца ownerID (с учетом доступов к родительским папкам)
+func (s *FileService) FolderPermission(userID, ownerID uint, folderPath string) (string, error) {
+	if userID == ownerID {
+		return models.GrantPermissionWrite, nil
+	}
+	if s.grantRepo == nil {
+		return "", nil
+	}
+
+	grants, err := s.grantRepo.FindBetween(ownerID, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to check access: %w", err)
+	}
+
+	// Clean не дает выйти из расшаренной папки через ".."
+	folderPath = normalizeFolderPath(path.Clean("/" + folderPath))
+	permission := ""
+	for _, grant := range grants {
+		if grant.FileID == nil && strings.HasPrefix(folderPath, grant.FolderPath) {
+			permission = strongerPermission(permission, grant.Permission)
+		}
+	}
+	return permission, nil
+}
+
+// AuthorizeFolder проверяет, что userID может читать (или изменять, если write) папку владельца ownerID
+func (s *FileService) AuthorizeFolder(userID, ownerID uint, folderPath string, write bool) error {
+	permission, err := s.FolderPermission(userID, ownerID, folderPath)
+	if err != nil {
+		return err
+	}
+	if !permits(permission, write) {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// getWritableFile - GetFile для операций, меняющих файл
+func (s *FileService) getWritableFile(fileID uuid.UUID, userID uint) (*models.File, error) {
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+
+	permission, err := s.filePermission(userID, file)
+	if err != nil {
+		return nil, err
+	}
+	if !permits(permission, true) {
+		return nil, ErrAccessDenied
+	}
+
+	return file, nil
+}
+
+// filterReadable убирает файлы, доступ к которым у userID уже отозван
+func (s *FileService) filterReadable(files []models.File, userID uint) ([]models.File, error) {
+	readable := files[:0]
+	for _, file := range files {
+		if file.ID == uuid.Nil {
+			readable = append(readable, file)
+			continue
+		}
+		permission, err := s.filePermission(userID, &file)
+		if err != nil {
+			return nil, err
+		}
+		if permits(permission, false) {
+			readable = append(readable, file)
+		}
+	}
+	return readable, nil
+}
+
+func permits(permission string, write bool) bool {
+	if write {
+		return permission == models.GrantPermissionWrite
+	}
+	return permission == models.GrantPermissionRead || permission == models.GrantPermissionWrite
+}
+
+func strongerPermission(a, b string) string {
+	if a == models.GrantPermissionWrite || b == models.GrantPermissionWrite {
+		return models.GrantPermissionWrite
+	}
+	if a == models.GrantPermissionRead || b == models.GrantPermissionRead {
+		return models.GrantPermissionRead
+	}
+	return ""
+}
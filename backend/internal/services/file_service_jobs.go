@@ -0,0 +1,229 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	JobTypeFolderZip    = "folder_zip"
+	JobTypeFolderDelete = "folder_delete"
+)
+
+type FolderJobPayload struct {
+	Path string `json:"path"`
+}
+
+type FolderZipResult struct {
+	Filename string `json:"filename"`
+	Files    int    `json:"files"`
+	Size     int64  `json:"size"`
+}
+
+type FolderDeleteResult struct {
+	Deleted int `json:"deleted"`
+}
+
+// RegisterJobs регистрирует фоновые задачи, которые выполняет FileService
+func (s *FileService) RegisterJobs(jobs *JobService) {
+	jobs.Register(JobTypeFolderZip, s.runFolderZipJob, s.removeJobArtifact)
+	jobs.Register(JobTypeFolderDelete, s.runFolderDeleteJob, nil)
+	jobs.Register(JobTypeAccountExport, s.runAccountExportJob, s.removeJobArtifact)
+
+	if s.usageRepo != nil {
+		jobs.Register(JobTypeStorageReconcile, s.runReconcileJob, nil)
+		jobs.Schedule(JobTypeStorageReconcile, time.Hour)
+	}
+}
+
+// jobArtifactPath - где лежит результат задачи (зашифрован тем же ключом, что и файлы)
+func (s *FileService) jobArtifactPath(jobID uuid.UUID) string {
+	return filepath.Join(s.storageDir, "jobs", jobID.String()+".zip")
+}
+
+func (s *FileService) removeJobArtifact(job *models.Job) {
+	if err := os.Remove(s.jobArtifactPath(job.ID)); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: failed to remove job artifact %s: %v\n", job.ID, err)
+	}
+}
+
+// DownloadJobArtifact расшифровывает готовый архив задачи в dst
+func (s *FileService) DownloadJobArtifact(job *models.Job, dst io.Writer) error {
+	if job.Status != models.JobCompleted {
+		return fmt.Errorf("job is not completed")
+	}
+
+	artifactPath := s.jobArtifactPath(job.ID)
+	if _, err := os.Stat(artifactPath); err != nil {
+		return fmt.Errorf("job has no downloadable result")
+	}
+
+	return s.decryptFile(artifactPath, dst)
+}
+
+func normalizeFolderPath(virtualPath string) string {
+	if virtualPath == "" {
+		return "/"
+	}
+	if !strings.HasSuffix(virtualPath, "/") {
+		virtualPath += "/"
+	}
+	return virtualPath
+}
+
+func (s *FileService) runFolderZipJob(ctx context.Context, job *models.Job, progress JobProgressFunc) (interface{}, error) {
+	var payload FolderJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, PermanentJobError(fmt.Errorf("invalid payload: %w", err))
+	}
+	folderPath := normalizeFolderPath(payload.Path)
+
+	files, err := s.fileRepo.FindAllRecursively(job.UserID, folderPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files: %w", err)
+	}
+
+	var total int64
+	regularFiles := make([]models.File, 0, len(files))
+	for _, file := range files {
+		if file.MimeType == "inode/directory" {
+			continue
+		}
+		regularFiles = append(regularFiles, file)
+		total += file.Size
+	}
+	progress(0, total)
+
+	// Архив пишется в pipe и сразу шифруется, открытый zip на диск не попадает
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.writeFolderZip(ctx, pw, folderPath, regularFiles, total, progress))
+	}()
+
+	artifactPath := s.jobArtifactPath(job.ID)
+	if _, err := s.encryptFile(pr, artifactPath); err != nil {
+		pr.CloseWithError(err)
+		s.removeJobArtifact(job)
+		return nil, err
+	}
+
+	name := path.Base(strings.TrimSuffix(folderPath, "/"))
+	if name == "/" || name == "." {
+		name = "files"
+	}
+
+	return FolderZipResult{
+		Filename: name + ".zip",
+		Files:    len(regularFiles),
+		Size:     total,
+	}, nil
+}
+
+func (s *FileService) writeFolderZip(ctx context.Context, w io.Writer, folderPath string, files []models.File, total int64, progress JobProgressFunc) error {
+	zipWriter := zip.NewWriter(w)
+
+	var done int64
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Сохраняем структуру подпапок относительно архивируемой папки
+		entryName := strings.TrimPrefix(file.VirtualPath, folderPath) + file.OriginalName
+
+		entry, err := zipWriter.Create(entryName)
+		if err != nil {
+			return fmt.Errorf("failed to create zip entry: %w", err)
+		}
+
+		counter := &progressWriter{w: entry, ctx: ctx, onWrite: func(n int64) {
+			done += n
+			progress(done, total)
+		}}
+		if err := s.decryptFile(file.Path, counter); err != nil {
+			return fmt.Errorf("failed to decrypt file %s: %w", file.OriginalName, err)
+		}
+	}
+
+	return zipWriter.Close()
+}
+
+func (s *FileService) runFolderDeleteJob(ctx context.Context, job *models.Job, progress JobProgressFunc) (interface{}, error) {
+	var payload FolderJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, PermanentJobError(fmt.Errorf("invalid payload: %w", err))
+	}
+
+	folderPath := normalizeFolderPath(payload.Path)
+	if folderPath == "/" {
+		return nil, PermanentJobError(fmt.Errorf("cannot delete root folder"))
+	}
+
+	deleted, err := s.deleteFolderRecursive(ctx, folderPath, job.UserID, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return FolderDeleteResult{Deleted: deleted}, nil
+}
+
+// deleteFolderRecursive перемещает в корзину всё содержимое папки, включая вложенные папки и её маркер
+func (s *FileService) deleteFolderRecursive(ctx context.Context, folderPath string, userID uint, progress JobProgressFunc) (int, error) {
+	files, err := s.fileRepo.FindAllRecursively(userID, folderPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get files: %w", err)
+	}
+
+	// Маркер самой папки лежит в родительской папке
+	parentPath := normalizeFolderPath(path.Dir(strings.TrimSuffix(folderPath, "/")))
+	folderName := path.Base(strings.TrimSuffix(folderPath, "/"))
+	if siblings, err := s.fileRepo.FindByUserIDAndPath(userID, parentPath); err == nil {
+		for _, sibling := range siblings {
+			if sibling.ID != uuid.Nil && sibling.OriginalName == folderName && sibling.MimeType == "inode/directory" {
+				files = append(files, sibling)
+			}
+		}
+	}
+
+	total := int64(len(files))
+	progress(0, total)
+
+	for i, file := range files {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		if err := s.DeleteFile(file.ID, userID); err != nil {
+			return i, fmt.Errorf("failed to delete file %s: %w", file.OriginalName, err)
+		}
+		progress(int64(i+1), total)
+	}
+
+	return len(files), nil
+}
+
+// progressWriter считает записанные байты и прерывает запись при отмене контекста
+type progressWriter struct {
+	w       io.Writer
+	ctx     context.Context
+	onWrite func(n int64)
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	if err := pw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := pw.w.Write(p)
+	pw.onWrite(int64(n))
+	return n, err
+}
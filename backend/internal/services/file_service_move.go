@@ -2,15 +2,18 @@ package services
 
 import (
 	"fmt"
+	"path"
+	"strings"
 
 	"github.com/bhop_dynasty/0x40_cloud/internal/models"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // MoveFile перемещает файл в другую папку (меняет virtual_path)
 func (s *FileService) MoveFile(fileID uuid.UUID, userID uint, newPath string) (*models.File, error) {
 	// Проверяем права доступа
-	file, err := s.GetFile(fileID, userID)
+	file, err := s.getWritableFile(fileID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -23,6 +26,16 @@ func (s *FileService) MoveFile(fileID uuid.UUID, userID uint, newPath string) (*
 		newPath += "/"
 	}
 
+	// Чужой файл можно переместить только в папку владельца, доступную на запись.
+	// Файл команды остается в пространстве команды, права уже проверены по роли.
+	if file.TeamID == nil {
+		if err := s.AuthorizeFolder(userID, file.UserID, newPath, true); err != nil {
+			return nil, err
+		}
+	}
+
+	oldPath := file.VirtualPath
+
 	// Update path
 	file.VirtualPath = newPath
 
@@ -31,5 +44,116 @@ func (s *FileService) MoveFile(fileID uuid.UUID, userID uint, newPath string) (*
 		return nil, fmt.Errorf("failed to move file: %w", err)
 	}
 
+	eventData := newFileEventData(file)
+	eventData.OldPath = oldPath
+	s.emit(file.UserID, EventFileMoved, eventData)
+
+	return file, nil
+}
+
+// MoveAndRenameFile перемещает файл и меняет его имя одним обновлением: при
+// ошибке файл не остается перемещенным под старым именем
+func (s *FileService) MoveAndRenameFile(fileID uuid.UUID, userID uint, newPath, newName string) (*models.File, error) {
+	file, err := s.getWritableFile(fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if newName == "" {
+		return nil, fmt.Errorf("new name cannot be empty")
+	}
+	newPath = normalizeFolderPath(newPath)
+
+	if file.TeamID == nil {
+		if err := s.AuthorizeFolder(userID, file.UserID, newPath, true); err != nil {
+			return nil, err
+		}
+	}
+
+	oldPath, oldName := file.VirtualPath, file.OriginalName
+	file.VirtualPath = newPath
+	file.OriginalName = newName
+
+	if err := s.fileRepo.Update(file); err != nil {
+		return nil, fmt.Errorf("failed to move file: %w", err)
+	}
+
+	eventData := newFileEventData(file)
+	eventData.OldPath = oldPath
+	eventData.OldName = oldName
+	s.emit(file.UserID, EventFileMoved, eventData)
+
 	return file, nil
 }
+
+// MoveFolder перемещает (или переименовывает) папку вместе со всем содержимым
+func (s *FileService) MoveFolder(userID uint, oldPath, newPath string) error {
+	oldPath = normalizeFolderPath(oldPath)
+	newPath = normalizeFolderPath(newPath)
+
+	if oldPath == "/" || newPath == "/" {
+		return fmt.Errorf("cannot move root folder")
+	}
+	if strings.HasPrefix(newPath, oldPath) {
+		return fmt.Errorf("cannot move folder into itself")
+	}
+
+	oldParent, oldName := splitFolderPath(oldPath)
+	newParent, newName := splitFolderPath(newPath)
+
+	var txService *FileService
+	err := s.fileRepo.Transaction(func(tx *gorm.DB) error {
+		txService = s.withTx(tx)
+
+		files, err := txService.fileRepo.FindAllRecursively(userID, oldPath)
+		if err != nil {
+			return fmt.Errorf("failed to get files: %w", err)
+		}
+
+		for i := range files {
+			file := &files[i]
+			previousPath := file.VirtualPath
+			file.VirtualPath = newPath + strings.TrimPrefix(file.VirtualPath, oldPath)
+			if err := txService.fileRepo.Update(file); err != nil {
+				return fmt.Errorf("failed to move file %s: %w", file.OriginalName, err)
+			}
+			eventData := newFileEventData(file)
+			eventData.OldPath = previousPath
+			txService.emit(userID, EventFileMoved, eventData)
+		}
+
+		markers, err := txService.fileRepo.FindByPathAndName(userID, oldParent, oldName)
+		if err != nil {
+			return fmt.Errorf("failed to get folder marker: %w", err)
+		}
+		for i := range markers {
+			marker := &markers[i]
+			if marker.MimeType != "inode/directory" {
+				continue
+			}
+			marker.VirtualPath = newParent
+			marker.OriginalName = newName
+			if err := txService.fileRepo.Update(marker); err != nil {
+				return fmt.Errorf("failed to move folder marker: %w", err)
+			}
+			eventData := newFileEventData(marker)
+			eventData.OldPath = oldParent
+			eventData.OldName = oldName
+			txService.emit(userID, EventFileMoved, eventData)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.flushEvents(*txService.pendingEvents)
+	return nil
+}
+
+// splitFolderPath разбивает "/a/b/" на родительскую папку "/a/" и имя "b"
+func splitFolderPath(folderPath string) (string, string) {
+	trimmed := strings.TrimSuffix(folderPath, "/")
+	return normalizeFolderPath(path.Dir(trimmed)), path.Base(trimmed)
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const JobTypeStorageReconcile = "storage_reconcile"
+
+// QuotaReservationTTL - через сколько брошенный резерв снимается сверкой.
+// Резерв держится только на время записи файла, поэтому запас большой.
+const QuotaReservationTTL = 6 * time.Hour
+
+// SetUserRepository включает персональные квоты (User.StorageQuota).
+// Без него всем пользователям действует глобальный STORAGE_LIMIT_BYTES.
+func (s *FileService) SetUserRepository(userRepo *repositories.UserRepository) {
+	s.userRepo = userRepo
+}
+
+// SetStorageUsageRepository включает счетчики занятого места и резервирование
+// квоты. Без него квота проверяется подсчетом по таблице files.
+func (s *FileService) SetStorageUsageRepository(usageRepo *repositories.StorageUsageRepository) {
+	s.usageRepo = usageRepo
+}
+
+// SetQuotaPolicy задает, учитывается ли корзина в квоте, и пороги мягких
+// предупреждений в процентах от квоты
+func (s *FileService) SetQuotaPolicy(includeTrash bool, warnings []int) {
+	thresholds := make([]int, 0, len(warnings))
+	for _, w := range warnings {
+		if w > 0 && w <= 100 {
+			thresholds = append(thresholds, w)
+		}
+	}
+	sort.Ints(thresholds)
+
+	s.quotaIncludesTrash = includeTrash
+	s.quotaWarnings = thresholds
+}
+
+// QuotaIncludesTrash сообщает, учитывается ли корзина в квоте
+func (s *FileService) QuotaIncludesTrash() bool {
+	return s.quotaIncludesTrash
+}
+
+// UserStorageLimit - квота пользователя: персональная, если задана, иначе глобальная
+func (s *FileService) UserStorageLimit(userID uint) (int64, error) {
+	if s.userRepo == nil {
+		return s.storageLimit, nil
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return 0, err
+	}
+	if user == nil || user.StorageQuota == nil {
+		return s.storageLimit, nil
+	}
+	return *user.StorageQuota, nil
+}
+
+// userQuota - занятое в квоте место (вместе с резервами незавершенных загрузок)
+// и сама квота личного пространства. Годится для предварительной проверки,
+// место под запись занимает reserveQuota.
+func (s *FileService) userQuota(userID uint) (used, limit int64, err error) {
+	if s.usageRepo != nil {
+		usage, err := s.usageRepo.Get(userID)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to check storage quota: %w", err)
+		}
+		limit, err := s.UserStorageLimit(userID)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to check storage quota: %w", err)
+		}
+		used = usage.UsedBytes + usage.ReservedBytes
+		if s.quotaIncludesTrash {
+			used += usage.TrashBytes
+		}
+		return used, limit, nil
+	}
+
+	stats, err := s.fileRepo.GetStorageStats(userID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to check storage quota: %w", err)
+	}
+	if err := s.applyQuota(userID, stats); err != nil {
+		return 0, 0, fmt.Errorf("failed to check storage quota: %w", err)
+	}
+	return stats.QuotaUsed, stats.Limit, nil
+}
+
+// applyQuota заполняет в статистике квоту, учитываемый объем и предупреждение
+func (s *FileService) applyQuota(userID uint, stats *models.StorageStats) error {
+	limit, err := s.UserStorageLimit(userID)
+	if err != nil {
+		return err
+	}
+
+	stats.Limit = limit
+	stats.QuotaIncludesTrash = s.quotaIncludesTrash
+	stats.QuotaUsed = stats.TotalUsed
+	if s.quotaIncludesTrash {
+		stats.QuotaUsed += stats.TrashSize
+	}
+	stats.Warning = s.quotaWarning(stats.QuotaUsed, limit)
+	return nil
+}
+
+// quotaWarning возвращает наибольший пройденный порог или nil
+func (s *FileService) quotaWarning(used, limit int64) *models.QuotaWarning {
+	if limit <= 0 || len(s.quotaWarnings) == 0 {
+		return nil
+	}
+
+	percent := float64(used) * 100 / float64(limit)
+	for i := len(s.quotaWarnings) - 1; i >= 0; i-- {
+		threshold := s.quotaWarnings[i]
+		if percent < float64(threshold) {
+			continue
+		}
+
+		message := fmt.Sprintf("Storage is %d%% full", threshold)
+		if used >= limit {
+			message = "Storage quota is exhausted"
+		}
+		return &models.QuotaWarning{
+			Threshold:   threshold,
+			UsedPercent: percent,
+			Message:     message,
+		}
+	}
+	return nil
+}
+
+// reserveQuota занимает size байт квоты пользователя до записи файла.
+// extra - место, учтенное вне счетчика (части S3-загрузок), может быть nil.
+// Резерв нужно снять через releaseQuota после сохранения файла или при ошибке.
+func (s *FileService) reserveQuota(userID uint, size int64, extra func(tx *gorm.DB) (int64, error)) (*models.QuotaReservation, error) {
+	if s.usageRepo == nil {
+		used, limit, err := s.userQuota(userID)
+		if err != nil {
+			return nil, err
+		}
+		if used+size > limit {
+			return nil, ErrQuotaExceeded
+		}
+		return nil, nil
+	}
+
+	limit, err := s.UserStorageLimit(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check storage quota: %w", err)
+	}
+
+	reservation := &models.QuotaReservation{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Size:      size,
+		ExpiresAt: time.Now().Add(QuotaReservationTTL),
+	}
+	ok, err := s.usageRepo.Reserve(reservation, limit, s.quotaIncludesTrash, extra)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve storage quota: %w", err)
+	}
+	if !ok {
+		return nil, ErrQuotaExceeded
+	}
+	return reservation, nil
+}
+
+// releaseQuota снимает резерв. Ошибка не критична: резерв снимет сверка по TTL.
+func (s *FileService) releaseQuota(reservation *models.QuotaReservation) {
+	if reservation == nil {
+		return
+	}
+	if err := s.usageRepo.Release(reservation); err != nil {
+		fmt.Printf("Warning: failed to release quota reservation %s: %v\n", reservation.ID, err)
+	}
+}
+
+// reserveSpace занимает место в пространстве загрузки. Квота команды проверяется
+// без резерва: счетчики ведутся только для личных пространств.
+func (s *FileService) reserveSpace(target spaceTarget, size int64) (*models.QuotaReservation, error) {
+	if target.teamID == nil {
+		return s.reserveQuota(target.userID, size, nil)
+	}
+
+	used, limit, err := s.spaceUsage(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check storage quota: %w", err)
+	}
+	if used+size > limit {
+		return nil, ErrQuotaExceeded
+	}
+	return nil, nil
+}
+
+// runReconcileJob снимает просроченные резервы и сверяет счетчики с таблицей files
+func (s *FileService) runReconcileJob(ctx context.Context, job *models.Job, progress JobProgressFunc) (interface{}, error) {
+	result := &models.UsageReconcileResult{}
+
+	expired, err := s.usageRepo.DeleteExpiredReservations(time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired reservations: %w", err)
+	}
+	result.ExpiredReservations = expired
+
+	if _, err := s.usageRepo.InitMissing(); err != nil {
+		return nil, fmt.Errorf("failed to create storage counters: %w", err)
+	}
+
+	userIDs, err := s.usageRepo.FindUserIDs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage counters: %w", err)
+	}
+
+	for i, userID := range userIDs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		corrected, err := s.usageRepo.Reconcile(userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reconcile storage usage of user %d: %w", userID, err)
+		}
+		if corrected {
+			fmt.Printf("Warning: storage usage of user %d drifted and was recalculated\n", userID)
+			result.Corrected++
+		}
+		result.Checked++
+		progress(int64(i+1), int64(len(userIDs)))
+	}
+
+	return result, nil
+}
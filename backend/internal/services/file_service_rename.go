@@ -10,7 +10,7 @@ import (
 // RenameFile переименовывает файл (меняет только original_name)
 func (s *FileService) RenameFile(fileID uuid.UUID, userID uint, newName string) (*models.File, error) {
 	// Проверяем права доступа
-	file, err := s.GetFile(fileID, userID)
+	file, err := s.getWritableFile(fileID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -20,6 +20,8 @@ func (s *FileService) RenameFile(fileID uuid.UUID, userID uint, newName string)
 		return nil, fmt.Errorf("new name cannot be empty")
 	}
 
+	oldName := file.OriginalName
+
 	// Обновляем только оригинальное имя
 	file.OriginalName = newName
 
@@ -28,5 +30,9 @@ func (s *FileService) RenameFile(fileID uuid.UUID, userID uint, newName string)
 		return nil, fmt.Errorf("failed to rename file: %w", err)
 	}
 
+	eventData := newFileEventData(file)
+	eventData.OldName = oldName
+	s.emit(file.UserID, EventFileRenamed, eventData)
+
 	return file, nil
 }
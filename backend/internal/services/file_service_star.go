@@ -9,7 +9,7 @@ import (
 )
 
 func (s *FileService) ToggleStarred(fileID uuid.UUID, userID uint) (bool, error) {
-	_, err := s.GetFile(fileID, userID)
+	file, err := s.GetFile(fileID, userID)
 	if err != nil {
 		return false, err
 	}
@@ -23,6 +23,7 @@ func (s *FileService) ToggleStarred(fileID uuid.UUID, userID uint) (bool, error)
 		if err := s.starredRepo.Delete(userID, fileID); err != nil {
 			return false, fmt.Errorf("failed to unstar file: %w", err)
 		}
+		s.emit(userID, EventFileUnstarred, newFileEventData(file))
 		return false, nil
 	} else {
 		starredFile := &models.StarredFile{
@@ -33,6 +34,7 @@ func (s *FileService) ToggleStarred(fileID uuid.UUID, userID uint) (bool, error)
 		if err := s.starredRepo.Create(starredFile); err != nil {
 			return false, fmt.Errorf("failed to star file: %w", err)
 		}
+		s.emit(userID, EventFileStarred, newFileEventData(file))
 		return true, nil
 	}
 }
@@ -43,6 +45,12 @@ func (s *FileService) GetStarredFiles(userID uint) ([]models.File, error) {
 		return nil, err
 	}
 
+	// Отмеченные чужие файлы пропадают из списка сразу после отзыва доступа
+	files, err = s.filterReadable(files, userID)
+	if err != nil {
+		return nil, err
+	}
+
 	for i := range files {
 		files[i].IsStarred = true
 	}
@@ -148,6 +156,7 @@ func (s *FileService) ToggleStarredFolder(virtualPath string, userID uint) (bool
         if err := s.starredFolderRepo.Delete(userID, virtualPath); err != nil {
              return false, err
         }
+        s.emit(userID, EventFolderUnstarred, FolderEventData{Path: virtualPath})
         return false, nil
     } else {
         starredFolder := &models.StarredFolder{
@@ -158,6 +167,38 @@ func (s *FileService) ToggleStarredFolder(virtualPath string, userID uint) (bool
         if err := s.starredFolderRepo.Create(starredFolder); err != nil {
             return false, err
         }
+        s.emit(userID, EventFolderStarred, FolderEventData{Path: virtualPath})
         return true, nil
     }
 }
+
+// SetStarred явно ставит или снимает отметку (в отличие от ToggleStarred идемпотентен)
+func (s *FileService) SetStarred(fileID uuid.UUID, userID uint, starred bool) error {
+	file, err := s.GetFile(fileID, userID)
+	if err != nil {
+		return err
+	}
+
+	isStarred, err := s.starredRepo.IsStarred(userID, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to check starred status: %w", err)
+	}
+
+	if isStarred == starred {
+		return nil
+	}
+
+	if !starred {
+		if err := s.starredRepo.Delete(userID, fileID); err != nil {
+			return fmt.Errorf("failed to unstar file: %w", err)
+		}
+		s.emit(userID, EventFileUnstarred, newFileEventData(file))
+		return nil
+	}
+
+	if err := s.starredRepo.Create(&models.StarredFile{UserID: userID, FileID: fileID}); err != nil {
+		return fmt.Errorf("failed to star file: %w", err)
+	}
+	s.emit(userID, EventFileStarred, newFileEventData(file))
+	return nil
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/google/uuid"
+)
+
+// Размер блока открытого текста в encryptFile
+const encryptionChunkSize = 64 * 1024
+
+var (
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+	ErrFileTooLarge  = errors.New("file too large")
+)
+
+// StoreFile сохраняет файл из произвольного потока (WebDAV, S3, SFTP) за один проход:
+// данные шифруются во временный файл с одновременным подсчетом SHA256, затем
+// перемещаются по content-addressed пути (или отбрасываются, если такой блоб уже есть).
+// size = -1, если размер заранее неизвестен - тогда квота проверяется по мере чтения.
+func (s *FileService) StoreFile(userID uint, src io.Reader, size int64, name, mimeType, virtualPath string) (*models.File, error) {
+	if size > s.maxUploadSize {
+		return nil, fmt.Errorf("%w: max size is %d bytes", ErrFileTooLarge, s.maxUploadSize)
+	}
+
+	used, quota, err := s.userQuota(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := quota - used
+	if size > remaining {
+		return nil, ErrQuotaExceeded
+	}
+
+	limit := s.maxUploadSize
+	if remaining < limit {
+		limit = remaining
+	}
+
+	reader := &limitedCountingReader{r: src, limit: limit}
+	hash := sha256.New()
+
+	tmpPath := filepath.Join(s.storageDir, "tmp", uuid.New().String())
+	encryptedSize, err := s.encryptFile(io.TeeReader(reader, hash), tmpPath)
+	if err != nil {
+		s.removeBlob(tmpPath)
+		if reader.exceeded {
+			if limit == remaining {
+				return nil, ErrQuotaExceeded
+			}
+			return nil, fmt.Errorf("%w: max size is %d bytes", ErrFileTooLarge, s.maxUploadSize)
+		}
+		return nil, err
+	}
+
+	// Размер известен только после чтения: проверка выше была предварительной,
+	// а резерв атомарно занимает место до появления записи в files
+	reservation, err := s.reserveQuota(userID, reader.n, nil)
+	if err != nil {
+		s.removeBlob(tmpPath)
+		return nil, err
+	}
+	defer s.releaseQuota(reservation)
+
+	sha256Hash := hex.EncodeToString(hash.Sum(nil))
+	storagePath := s.getStoragePath(sha256Hash)
+
+	if fileInfo, err := os.Stat(storagePath); err == nil {
+		// Такой блоб уже есть - дедупликация
+		s.removeBlob(tmpPath)
+		encryptedSize = fileInfo.Size()
+	} else {
+		if err := os.MkdirAll(filepath.Dir(storagePath), 0750); err != nil {
+			s.removeBlob(tmpPath)
+			return nil, fmt.Errorf("failed to create directories: %w", err)
+		}
+		if err := os.Rename(tmpPath, storagePath); err != nil {
+			s.removeBlob(tmpPath)
+			return nil, fmt.Errorf("failed to store file: %w", err)
+		}
+	}
+
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(filepath.Ext(name))
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	fileModel := &models.File{
+		ID:            uuid.New(),
+		UserID:        userID,
+		Filename:      uuid.New().String() + filepath.Ext(name),
+		OriginalName:  name,
+		Path:          storagePath,
+		VirtualPath:   normalizeFolderPath(virtualPath),
+		SHA256:        sha256Hash,
+		MimeType:      mimeType,
+		Size:          reader.n,
+		EncryptedSize: encryptedSize,
+	}
+
+	if err := s.fileRepo.Create(fileModel); err != nil {
+		return nil, fmt.Errorf("failed to save file metadata: %w", err)
+	}
+
+	s.emit(userID, EventFileCreated, newFileEventData(fileModel))
+
+	return fileModel, nil
+}
+
+// replaceOlderVersions убирает в корзину другие файлы с тем же именем в той же папке:
+// протоколы вроде WebDAV и S3 перезаписывают файл, а не создают копию рядом
+func (s *FileService) replaceOlderVersions(current *models.File) error {
+	previous, err := s.fileRepo.FindByPathAndName(current.UserID, current.VirtualPath, current.OriginalName)
+	if err != nil {
+		return err
+	}
+	for _, file := range previous {
+		if file.ID == current.ID || file.MimeType == "inode/directory" {
+			continue
+		}
+		if err := s.DeleteFile(file.ID, current.UserID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitedCountingReader считает прочитанные байты и возвращает ошибку при превышении limit
+type limitedCountingReader struct {
+	r        io.Reader
+	limit    int64
+	n        int64
+	exceeded bool
+}
+
+func (l *limitedCountingReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.limit {
+		l.exceeded = true
+		return n, ErrQuotaExceeded
+	}
+	return n, err
+}
+
+// OpenDecrypted открывает файл для чтения с произвольным доступом (Seek) без расшифровки целиком:
+// каждый блок шифруется со своим nonce, поэтому нужный блок можно найти и расшифровать отдельно.
+func (s *FileService) OpenDecrypted(file *models.File) (io.ReadSeekCloser, error) {
+	safePath, err := s.sanitizePath(file.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source path: %w", err)
+	}
+
+	f, err := os.Open(safePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open encrypted file: %w", err)
+	}
+
+	block, err := aes.NewCipher(s.encryptionKey)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(f, nonce); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read nonce: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to stat encrypted file: %w", err)
+	}
+
+	// Размер открытого текста: из зашифрованного вычитаем nonce и теги всех блоков
+	encryptedChunk := int64(encryptionChunkSize + gcm.Overhead())
+	payload := info.Size() - int64(len(nonce))
+	chunks := (payload + encryptedChunk - 1) / encryptedChunk
+
+	return &decryptingReader{
+		file:       f,
+		gcm:        gcm,
+		baseNonce:  nonce,
+		size:       payload - chunks*int64(gcm.Overhead()),
+		chunkIndex: -1,
+	}, nil
+}
+
+type decryptingReader struct {
+	file       *os.File
+	gcm        cipher.AEAD
+	baseNonce  []byte
+	size       int64
+	offset     int64
+	chunkIndex int64
+	chunk      []byte
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	if d.offset >= d.size {
+		return 0, io.EOF
+	}
+
+	index := d.offset / encryptionChunkSize
+	if index != d.chunkIndex {
+		if err := d.loadChunk(index); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.chunk[d.offset%encryptionChunkSize:])
+	d.offset += int64(n)
+	return n, nil
+}
+
+func (d *decryptingReader) loadChunk(index int64) error {
+	encryptedChunk := int64(encryptionChunkSize + d.gcm.Overhead())
+	buf := make([]byte, encryptedChunk)
+
+	n, err := d.file.ReadAt(buf, int64(len(d.baseNonce))+index*encryptedChunk)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read encrypted file: %w", err)
+	}
+
+	plain, err := d.gcm.Open(nil, nonceForChunk(d.baseNonce, index), buf[:n], nil)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt data: %w", err)
+	}
+
+	d.chunk = plain
+	d.chunkIndex = index
+	return nil
+}
+
+func (d *decryptingReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = d.offset + offset
+	case io.SeekEnd:
+		target = d.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if target < 0 {
+		return 0, errors.New("negative position")
+	}
+	d.offset = target
+	return target, nil
+}
+
+func (d *decryptingReader) Close() error {
+	return d.file.Close()
+}
+
+// nonceForChunk повторяет инкремент nonce из encryptFile: nonce блока = базовый nonce + index
+func nonceForChunk(base []byte, index int64) []byte {
+	nonce := append([]byte(nil), base...)
+	carry := uint64(index)
+	for i := len(nonce) - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(nonce[i]) + (carry & 0xff)
+		nonce[i] = byte(sum)
+		carry = (carry >> 8) + (sum >> 8)
+	}
+	return nonce
+}
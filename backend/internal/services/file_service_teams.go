@@ -0,0 +1,161 @@
+package services
+
+import (
+	"fmt"
+	"mime/multipart"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+)
+
+// spaceTarget - пространство, в котором создается файл: личное (teamID == nil) или команды.
+// userID - владелец личного пространства или участник команды, который загружает файл.
+type spaceTarget struct {
+	userID uint
+	teamID *uint
+}
+
+// SetTeamRepository подключает пространства команд; teamStorageLimit - квота команды по умолчанию
+func (s *FileService) SetTeamRepository(teamRepo *repositories.TeamRepository, teamStorageLimit int64) {
+	s.teamRepo = teamRepo
+	s.teamStorageLimit = teamStorageLimit
+}
+
+func (s *FileService) listSpace(target spaceTarget, virtualPath string) ([]models.File, error) {
+	if target.teamID != nil {
+		return s.fileRepo.FindByTeamAndPath(*target.teamID, virtualPath)
+	}
+	return s.fileRepo.FindByUserIDAndPath(target.userID, virtualPath)
+}
+
+func (s *FileService) findDuplicate(target spaceTarget, sha256Hash string) (*models.File, error) {
+	if target.teamID != nil {
+		return s.fileRepo.FindBySHA256AndTeam(sha256Hash, *target.teamID)
+	}
+	return s.fileRepo.FindBySHA256AndUserID(sha256Hash, target.userID)
+}
+
+// spaceUsage - занятое место и квота пространства. Файлы команды учитываются
+// только в квоте команды, а не у загрузившего их участника.
+func (s *FileService) spaceUsage(target spaceTarget) (used, limit int64, err error) {
+	if target.teamID == nil {
+		return s.userQuota(target.userID)
+	}
+
+	team, err := s.teamRepo.FindByID(*target.teamID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if team == nil {
+		return 0, 0, ErrTeamNotFound
+	}
+	used, err = s.fileRepo.TeamStorageUsed(team.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+	return used, s.TeamStorageLimit(team), nil
+}
+
+// TeamStorageLimit - квота команды: своя или по умолчанию из конфигурации
+func (s *FileService) TeamStorageLimit(team *models.Team) int64 {
+	if team.StorageLimit > 0 {
+		return team.StorageLimit
+	}
+	return s.teamStorageLimit
+}
+
+func (s *FileService) TeamStorageUsed(teamID uint) (int64, error) {
+	return s.fileRepo.TeamStorageUsed(teamID)
+}
+
+// teamPermission - права участника на файлы команды по его роли. Проверяется при каждом
+// запросе, поэтому исключенный участник сразу теряет доступ, а файлы остаются у команды.
+func (s *FileService) teamPermission(userID, teamID uint) (string, error) {
+	if s.teamRepo == nil {
+		return "", nil
+	}
+
+	member, err := s.teamRepo.FindMember(teamID, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to check team membership: %w", err)
+	}
+	if member == nil {
+		return "", nil
+	}
+
+	if member.Role == models.TeamRoleViewer {
+		return models.GrantPermissionRead, nil
+	}
+	return models.GrantPermissionWrite, nil
+}
+
+// AuthorizeTeam проверяет, что userID может читать (или изменять, если write) файлы команды
+func (s *FileService) AuthorizeTeam(userID, teamID uint, write bool) error {
+	permission, err := s.teamPermission(userID, teamID)
+	if err != nil {
+		return err
+	}
+	if !permits(permission, write) {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// authorizeTrash - восстанавливать и удалять навсегда может владелец файла,
+// а для файлов команды - участник с правом изменения
+func (s *FileService) authorizeTrash(userID uint, file *models.File) error {
+	if file.TeamID != nil {
+		return s.AuthorizeTeam(userID, *file.TeamID, true)
+	}
+	if file.UserID != userID {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+func (s *FileService) GetTeamFilesByPath(teamID, userID uint, virtualPath string) ([]models.File, error) {
+	if err := s.AuthorizeTeam(userID, teamID, false); err != nil {
+		return nil, err
+	}
+	files, err := s.fileRepo.FindByTeamAndPath(teamID, virtualPath)
+	if err != nil {
+		return nil, err
+	}
+	return s.EnrichFilesWithStarred(files, userID)
+}
+
+func (s *FileService) SearchTeamFiles(teamID, userID uint, query string, limit int) ([]models.File, error) {
+	if err := s.AuthorizeTeam(userID, teamID, false); err != nil {
+		return nil, err
+	}
+	if query == "" {
+		return []models.File{}, nil
+	}
+	files, err := s.fileRepo.SearchByNameInTeam(teamID, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return s.EnrichFilesWithStarred(files, userID)
+}
+
+// UploadTeamFile загружает файл в пространство команды; место учитывается в квоте команды
+func (s *FileService) UploadTeamFile(teamID, userID uint, fileHeader *multipart.FileHeader, virtualPath, folderName string) (*models.File, error) {
+	if err := s.AuthorizeTeam(userID, teamID, true); err != nil {
+		return nil, err
+	}
+	return s.uploadFile(spaceTarget{userID: userID, teamID: &teamID}, fileHeader, virtualPath, folderName)
+}
+
+func (s *FileService) CreateTeamFolder(teamID, userID uint, virtualPath, folderName string) (*models.File, error) {
+	if err := s.AuthorizeTeam(userID, teamID, true); err != nil {
+		return nil, err
+	}
+	return s.createFolder(spaceTarget{userID: userID, teamID: &teamID}, virtualPath, folderName)
+}
+
+func (s *FileService) GetTeamDeletedFiles(teamID, userID uint) ([]models.File, error) {
+	if err := s.AuthorizeTeam(userID, teamID, false); err != nil {
+		return nil, err
+	}
+	return s.fileRepo.FindDeletedByTeam(teamID)
+}
@@ -0,0 +1,419 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+	"github.com/google/uuid"
+)
+
+const (
+	maxVaultsPerUser = 20
+
+	// vaultMimeType - тип всех файлов хранилищ: настоящий тип знает только клиент,
+	// а сервер не угадывает его по содержимому
+	vaultMimeType = "application/octet-stream"
+)
+
+var (
+	ErrVaultNotFound     = errors.New("vault not found")
+	ErrVaultFileNotFound = errors.New("file not found in vault")
+	ErrVaultExists       = errors.New("vault with this name already exists")
+	ErrTooManyVaults     = errors.New("too many vaults")
+	ErrVaultKeyConflict  = errors.New("vault key was changed by another client, reload it and try again")
+	ErrVaultIncomplete   = errors.New("uploaded data is shorter than declared")
+)
+
+// SetVaultRepository включает E2E-хранилища. Их файлы пишутся на диск как есть,
+// без encryptFile: шифрует клиент, ключей у сервера нет.
+func (s *FileService) SetVaultRepository(vaultRepo *repositories.VaultRepository) {
+	s.vaultRepo = vaultRepo
+}
+
+func (s *FileService) ListVaults(userID uint) (*models.VaultList, error) {
+	vaults, err := s.vaultRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(vaults))
+	for _, vault := range vaults {
+		ids = append(ids, vault.ID)
+	}
+	usage, err := s.vaultRepo.Usage(ids)
+	if err != nil {
+		return nil, err
+	}
+	byVault := make(map[uint]models.VaultUsage, len(usage))
+	for _, u := range usage {
+		byVault[u.VaultID] = u
+	}
+
+	list := &models.VaultList{
+		Vaults:              make([]models.VaultResponse, 0, len(vaults)),
+		UnavailableFeatures: models.VaultUnavailableFeatures,
+	}
+	for i := range vaults {
+		response := vaults[i].ToResponse()
+		response.Files = byVault[vaults[i].ID].Files
+		response.Size = byVault[vaults[i].ID].Size
+		list.Vaults = append(list.Vaults, response)
+	}
+	return list, nil
+}
+
+func (s *FileService) CreateVault(userID uint, req *models.CreateVaultRequest) (*models.VaultResponse, error) {
+	existing, err := s.vaultRepo.FindByName(userID, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrVaultExists
+	}
+
+	count, err := s.vaultRepo.CountByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxVaultsPerUser {
+		return nil, ErrTooManyVaults
+	}
+
+	vault := &models.Vault{
+		UserID:     userID,
+		Name:       req.Name,
+		WrappedKey: req.WrappedKey,
+		KeyParams:  req.KeyParams,
+		KeyVersion: 1,
+	}
+	if err := s.vaultRepo.Create(vault); err != nil {
+		return nil, fmt.Errorf("failed to create vault: %w", err)
+	}
+
+	response := vault.ToResponse()
+	return &response, nil
+}
+
+func (s *FileService) GetVault(userID, vaultID uint) (*models.VaultResponse, error) {
+	vault, err := s.findVault(userID, vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := vault.ToResponse()
+	usage, err := s.vaultRepo.Usage([]uint{vault.ID})
+	if err != nil {
+		return nil, err
+	}
+	if len(usage) > 0 {
+		response.Files = usage[0].Files
+		response.Size = usage[0].Size
+	}
+	return &response, nil
+}
+
+// UpdateVaultKey сохраняет ключ хранилища, заново обернутый клиентом.
+// Сами файлы не перешифровываются: их ключи обернуты ключом хранилища, а он не меняется.
+func (s *FileService) UpdateVaultKey(userID, vaultID uint, req *models.UpdateVaultKeyRequest) (*models.VaultResponse, error) {
+	updated, err := s.vaultRepo.UpdateKey(vaultID, userID, req.KeyVersion, req.WrappedKey, req.KeyParams)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		if _, err := s.findVault(userID, vaultID); err != nil {
+			return nil, err
+		}
+		return nil, ErrVaultKeyConflict
+	}
+	return s.GetVault(userID, vaultID)
+}
+
+// DeleteVault удаляет хранилище вместе с файлами, минуя корзину
+func (s *FileService) DeleteVault(userID, vaultID uint) error {
+	vault, err := s.findVault(userID, vaultID)
+	if err != nil {
+		return err
+	}
+
+	files, err := s.vaultRepo.FindFiles(vault.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get vault files: %w", err)
+	}
+	for i := range files {
+		if err := s.deleteVaultFile(&files[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := s.vaultRepo.Delete(vault.ID); err != nil {
+		return fmt.Errorf("failed to delete vault: %w", err)
+	}
+	s.removeVaultDir(vault.ID)
+	return nil
+}
+
+func (s *FileService) ListVaultFiles(userID, vaultID uint) ([]models.VaultFileResponse, error) {
+	vault, err := s.findVault(userID, vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.vaultRepo.FindFiles(vault.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]models.VaultFileResponse, 0, len(files))
+	for i := range files {
+		response = append(response, files[i].ToVaultFileResponse())
+	}
+	return response, nil
+}
+
+// UploadVaultFile сохраняет шифротекст клиента без изменений. Дедупликации нет:
+// у каждого файла свой блоб, SHA256 считается по шифротексту для проверки целостности.
+func (s *FileService) UploadVaultFile(userID, vaultID uint, src io.Reader, size int64, meta *models.VaultFileMetadata) (*models.VaultFileResponse, error) {
+	vault, err := s.findVault(userID, vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	if size > s.maxUploadSize {
+		return nil, fmt.Errorf("%w: max size is %d bytes", ErrFileTooLarge, s.maxUploadSize)
+	}
+
+	// Шифротекст занимает место в квоте владельца наравне с обычными файлами
+	reservation, err := s.reserveQuota(userID, size, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseQuota(reservation)
+
+	fileID := uuid.New()
+	tmpPath := filepath.Join(s.storageDir, "tmp", fileID.String())
+	sha256Hash, written, err := s.writeRawBlob(src, size, tmpPath)
+	if err != nil {
+		s.removeBlob(tmpPath)
+		return nil, err
+	}
+
+	storagePath := s.vaultBlobPath(vault.ID, fileID)
+	if err := os.MkdirAll(filepath.Dir(storagePath), 0750); err != nil {
+		s.removeBlob(tmpPath)
+		return nil, fmt.Errorf("failed to create directories: %w", err)
+	}
+	if err := os.Rename(tmpPath, storagePath); err != nil {
+		s.removeBlob(tmpPath)
+		return nil, fmt.Errorf("failed to store file: %w", err)
+	}
+
+	fileModel := &models.File{
+		ID:            fileID,
+		UserID:        userID,
+		VaultID:       &vault.ID,
+		Filename:      fileID.String(),
+		OriginalName:  fileID.String(), // Настоящее имя - в EncryptedName, серверу оно неизвестно
+		Path:          storagePath,
+		VirtualPath:   "/",
+		SHA256:        sha256Hash,
+		MimeType:      vaultMimeType,
+		Size:          written,
+		EncryptedSize: written,
+		EncryptedName: meta.EncryptedName,
+		WrappedKey:    meta.WrappedKey,
+	}
+	if err := s.fileRepo.Create(fileModel); err != nil {
+		s.removeBlob(storagePath)
+		return nil, fmt.Errorf("failed to save file metadata: %w", err)
+	}
+
+	response := fileModel.ToVaultFileResponse()
+	return &response, nil
+}
+
+// OpenVaultFile открывает шифротекст для отдачи клиенту как есть (с поддержкой Range)
+func (s *FileService) OpenVaultFile(userID, vaultID uint, fileID uuid.UUID) (*models.File, *os.File, error) {
+	file, err := s.findVaultFile(userID, vaultID, fileID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	safePath, err := s.sanitizePath(file.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid source path: %w", err)
+	}
+	f, err := os.Open(safePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return file, f, nil
+}
+
+func (s *FileService) UpdateVaultFile(userID, vaultID uint, fileID uuid.UUID, req *models.UpdateVaultFileRequest) (*models.VaultFileResponse, error) {
+	file, err := s.findVaultFile(userID, vaultID, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.EncryptedName != nil {
+		updates["encrypted_name"] = *req.EncryptedName
+	}
+	if req.WrappedKey != nil {
+		updates["wrapped_key"] = *req.WrappedKey
+	}
+	if len(updates) > 0 {
+		updated, err := s.vaultRepo.UpdateFileMetadata(vaultID, file.ID, updates)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update file: %w", err)
+		}
+		if !updated {
+			return nil, ErrVaultFileNotFound
+		}
+	}
+
+	file, err = s.findVaultFile(userID, vaultID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	response := file.ToVaultFileResponse()
+	return &response, nil
+}
+
+// DeleteVaultFile удаляет файл хранилища сразу навсегда: корзины у хранилищ нет
+func (s *FileService) DeleteVaultFile(userID, vaultID uint, fileID uuid.UUID) error {
+	file, err := s.findVaultFile(userID, vaultID, fileID)
+	if err != nil {
+		return err
+	}
+	return s.deleteVaultFile(file)
+}
+
+// purgeUserVaults удаляет файлы всех хранилищ пользователя при удалении аккаунта.
+// Записи самих хранилищ удаляет UserRepository.DeleteAccountData.
+func (s *FileService) purgeUserVaults(ctx context.Context, userID uint) (int, error) {
+	if s.vaultRepo == nil {
+		return 0, nil
+	}
+
+	files, err := s.vaultRepo.FindFilesByUserID(userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get vault files: %w", err)
+	}
+
+	vaultIDs := make(map[uint]bool)
+	for i := range files {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		if err := s.deleteVaultFile(&files[i]); err != nil {
+			return i, err
+		}
+		vaultIDs[*files[i].VaultID] = true
+	}
+	for id := range vaultIDs {
+		s.removeVaultDir(id)
+	}
+	return len(files), nil
+}
+
+func (s *FileService) deleteVaultFile(file *models.File) error {
+	if err := s.fileRepo.DeletePermanently(file.ID); err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	s.removeBlob(file.Path)
+	return nil
+}
+
+func (s *FileService) findVault(userID, vaultID uint) (*models.Vault, error) {
+	vault, err := s.vaultRepo.FindByID(vaultID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if vault == nil {
+		return nil, ErrVaultNotFound
+	}
+	return vault, nil
+}
+
+func (s *FileService) findVaultFile(userID, vaultID uint, fileID uuid.UUID) (*models.File, error) {
+	vault, err := s.findVault(userID, vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := s.vaultRepo.FindFile(vault.ID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, ErrVaultFileNotFound
+	}
+	return file, nil
+}
+
+// vaultBlobPath - у каждого файла хранилища свой блоб, а не content-addressed путь
+func (s *FileService) vaultBlobPath(vaultID uint, fileID uuid.UUID) string {
+	return filepath.Join(s.storageDir, "vaults", strconv.FormatUint(uint64(vaultID), 10), fileID.String())
+}
+
+func (s *FileService) removeVaultDir(vaultID uint) {
+	dir := filepath.Join(s.storageDir, "vaults", strconv.FormatUint(uint64(vaultID), 10))
+	if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: failed to delete vault directory %s: %v\n", dir, err)
+	}
+}
+
+// writeRawBlob записывает ровно size байт из src без шифрования и считает их SHA256
+func (s *FileService) writeRawBlob(src io.Reader, size int64, dstPath string) (string, int64, error) {
+	safePath, err := s.sanitizePath(dstPath)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid destination path: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(safePath), 0750); err != nil {
+		return "", 0, fmt.Errorf("failed to create directories: %w", err)
+	}
+
+	dst, err := os.OpenFile(safePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create destination file: %w", err)
+	}
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(dst, hash), io.LimitReader(src, size))
+	if closeErr := dst.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to write file: %w", err)
+	}
+	if written != size {
+		return "", 0, ErrVaultIncomplete
+	}
+	return hex.EncodeToString(hash.Sum(nil)), written, nil
+}
+
+// copyRawBlob копирует блоб хранилища как есть, без расшифровки
+func (s *FileService) copyRawBlob(srcPath string, dst io.Writer) error {
+	safePath, err := s.sanitizePath(srcPath)
+	if err != nil {
+		return fmt.Errorf("invalid source path: %w", err)
+	}
+	src, err := os.Open(safePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
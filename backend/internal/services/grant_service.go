@@ -0,0 +1,203 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+)
+
+var (
+	ErrGrantNotFound      = errors.New("grant not found")
+	ErrGrantUserNotFound  = errors.New("user not found")
+	ErrGrantSelf          = errors.New("cannot share with yourself")
+	ErrGrantInvalidTarget = errors.New("invalid grant target")
+)
+
+// GrantService выдает доступ к файлам и папкам другим зарегистрированным пользователям.
+// Сами проверки прав выполняет FileService (см. file_service_grants.go).
+type GrantService struct {
+	repo        *repositories.FileGrantRepository
+	userRepo    *repositories.UserRepository
+	fileRepo    *repositories.FileRepository
+	fileService *FileService
+	events      *EventService
+}
+
+func NewGrantService(repo *repositories.FileGrantRepository, userRepo *repositories.UserRepository, fileRepo *repositories.FileRepository, fileService *FileService) *GrantService {
+	return &GrantService{repo: repo, userRepo: userRepo, fileRepo: fileRepo, fileService: fileService}
+}
+
+func (s *GrantService) SetEventService(events *EventService) {
+	s.events = events
+}
+
+// CreateGrant выдает доступ к файлу (req.FileID) или папке (req.Path).
+// Повторная выдача тому же пользователю меняет уровень доступа.
+func (s *GrantService) CreateGrant(ownerID uint, req *models.CreateGrantRequest) (*models.GrantResponse, error) {
+	grantee, err := s.findUser(req.Grantee)
+	if err != nil {
+		return nil, err
+	}
+	if grantee.ID == ownerID {
+		return nil, ErrGrantSelf
+	}
+
+	owner, err := s.userRepo.FindByID(ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	grant := &models.FileGrant{
+		OwnerID:    ownerID,
+		GranteeID:  grantee.ID,
+		Permission: req.Permission,
+	}
+
+	if req.FileID != nil {
+		file, err := s.fileRepo.FindByID(*req.FileID)
+		if err != nil || file.UserID != ownerID || file.TeamID != nil {
+			return nil, ErrGrantInvalidTarget
+		}
+		if file.MimeType == "inode/directory" {
+			// Доступ к маркеру папки - это доступ к самой папке
+			grant.Type = models.ShareTypeFolder
+			grant.FolderPath = normalizeFolderPath(file.VirtualPath + file.OriginalName)
+		} else {
+			grant.Type = models.ShareTypeFile
+			grant.FileID = req.FileID
+			grant.File = *file
+		}
+	} else {
+		folderPath := normalizeFolderPath(path.Clean("/" + req.Path))
+		if folderPath == "/" {
+			return nil, ErrGrantInvalidTarget
+		}
+		_, isDir, err := s.fileService.VirtualFS(ownerID).lookup(strings.TrimSuffix(folderPath, "/"))
+		if err != nil || !isDir {
+			return nil, ErrGrantInvalidTarget
+		}
+		grant.Type = models.ShareTypeFolder
+		grant.FolderPath = folderPath
+	}
+
+	existing, err := s.repo.FindExisting(ownerID, grantee.ID, grant.FileID, grant.FolderPath)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		existing.Permission = req.Permission
+		if err := s.repo.Update(existing); err != nil {
+			return nil, fmt.Errorf("failed to update grant: %w", err)
+		}
+		existing.File = grant.File
+		grant = existing
+	} else if err := s.repo.Create(grant); err != nil {
+		return nil, fmt.Errorf("failed to create grant: %w", err)
+	}
+
+	grant.Owner = *owner
+	grant.Grantee = *grantee
+	s.notify(grant, EventGrantCreated)
+
+	resp := toGrantResponse(grant)
+	return &resp, nil
+}
+
+// ListGrants - доступы, выданные пользователем
+func (s *GrantService) ListGrants(ownerID uint) ([]models.GrantResponse, error) {
+	grants, err := s.repo.FindByOwnerID(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return toGrantResponses(grants), nil
+}
+
+// ListSharedWithMe - файлы и папки, к которым пользователю выдали доступ
+func (s *GrantService) ListSharedWithMe(userID uint) ([]models.GrantResponse, error) {
+	grants, err := s.repo.FindByGranteeID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return toGrantResponses(grants), nil
+}
+
+// RevokeGrant удаляет доступ; права проверяются по базе при каждом запросе,
+// поэтому отзыв действует сразу
+func (s *GrantService) RevokeGrant(ownerID, grantID uint) error {
+	grant, err := s.repo.Delete(grantID, ownerID)
+	if err != nil {
+		return err
+	}
+	if grant == nil {
+		return ErrGrantNotFound
+	}
+
+	if owner, err := s.userRepo.FindByID(ownerID); err == nil {
+		grant.Owner = *owner
+	}
+	s.notify(grant, EventGrantRevoked)
+	return nil
+}
+
+func (s *GrantService) findUser(login string) (*models.User, error) {
+	find := s.userRepo.FindByUsername
+	if strings.Contains(login, "@") {
+		find = s.userRepo.FindByEmail
+	}
+
+	user, err := find(strings.TrimSpace(login))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrGrantUserNotFound
+	}
+	return user, nil
+}
+
+func (s *GrantService) notify(grant *models.FileGrant, eventType string) {
+	if s.events == nil {
+		return
+	}
+	s.events.Publish(grant.GranteeID, eventType, GrantEventData{
+		GrantID:    grant.ID,
+		Owner:      grant.Owner.Username,
+		Permission: grant.Permission,
+	})
+}
+
+func toGrantResponses(grants []models.FileGrant) []models.GrantResponse {
+	responses := make([]models.GrantResponse, 0, len(grants))
+	for i := range grants {
+		responses = append(responses, toGrantResponse(&grants[i]))
+	}
+	return responses
+}
+
+// toGrantResponse не раскрывает email и пути на диске ни владельцу, ни получателю
+func toGrantResponse(grant *models.FileGrant) models.GrantResponse {
+	resp := models.GrantResponse{
+		ID:         grant.ID,
+		Type:       grant.Type,
+		Permission: grant.Permission,
+		OwnerID:    grant.OwnerID,
+		Owner:      grant.Owner.Username,
+		Grantee:    grant.Grantee.Username,
+		FileID:     grant.FileID,
+		FolderPath: grant.FolderPath,
+		CreatedAt:  grant.CreatedAt,
+	}
+
+	if grant.Type == models.ShareTypeFile {
+		resp.Name = grant.File.OriginalName
+		resp.MimeType = grant.File.MimeType
+		resp.Size = grant.File.Size
+	} else {
+		resp.Name = path.Base(strings.TrimSuffix(grant.FolderPath, "/"))
+	}
+	return resp
+}
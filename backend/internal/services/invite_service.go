@@ -0,0 +1,221 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/config"
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+)
+
+const (
+	defaultInviteTTL = 7 * 24 * time.Hour
+	maxUserInviteTTL = 30 * 24 * time.Hour // Пользователь не может выдать приглашение дольше
+)
+
+var (
+	ErrInviteNotFound    = errors.New("invite not found")
+	ErrInviteRequired    = errors.New("registration requires an invite")
+	ErrInvalidInvite     = errors.New("invalid or expired invite")
+	ErrInvitesNotAllowed = errors.New("only administrators can create invites")
+	ErrTooManyInvites    = errors.New("invite limit reached")
+	ErrInviteExpiry      = errors.New("expiry must be in the future")
+	ErrInviteTooLong     = errors.New("invites can be valid for at most 30 days")
+	ErrInviteAdminOnly   = errors.New("only administrators can set max uses or a storage quota")
+)
+
+// InviteService выдает приглашения на регистрацию. Администратор создает их без
+// ограничений, обычный пользователь - одноразовые и не больше INVITES_PER_USER.
+type InviteService struct {
+	repo     *repositories.InviteRepository
+	userRepo *repositories.UserRepository
+	config   *config.Config
+}
+
+func NewInviteService(repo *repositories.InviteRepository, userRepo *repositories.UserRepository, cfg *config.Config) *InviteService {
+	return &InviteService{
+		repo:     repo,
+		userRepo: userRepo,
+		config:   cfg,
+	}
+}
+
+func (s *InviteService) Create(userID uint, req *models.CreateInviteRequest) (*models.InviteCreatedResponse, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	now := time.Now()
+	expiresAt := req.ExpiresAt
+	if expiresAt == nil {
+		defaultExpiry := now.Add(defaultInviteTTL)
+		expiresAt = &defaultExpiry
+	}
+	if !expiresAt.After(now) {
+		return nil, ErrInviteExpiry
+	}
+
+	maxUses := 1
+	if req.MaxUses != nil {
+		maxUses = *req.MaxUses
+	}
+
+	if !user.IsAdmin() {
+		if maxUses != 1 || req.StorageQuota != nil {
+			return nil, ErrInviteAdminOnly
+		}
+		if expiresAt.After(now.Add(maxUserInviteTTL)) {
+			return nil, ErrInviteTooLong
+		}
+		if s.config.Auth.InvitesPerUser <= 0 {
+			return nil, ErrInvitesNotAllowed
+		}
+		count, err := s.repo.CountByCreator(userID)
+		if err != nil {
+			return nil, err
+		}
+		if count >= int64(s.config.Auth.InvitesPerUser) {
+			return nil, ErrTooManyInvites
+		}
+	}
+
+	code, err := randomHex(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate invite: %w", err)
+	}
+
+	invite := &models.Invite{
+		CreatedBy:    userID,
+		CodeHash:     hashInviteCode(code),
+		Prefix:       code[:8],
+		Note:         req.Note,
+		MaxUses:      maxUses,
+		ExpiresAt:    expiresAt,
+		StorageQuota: req.StorageQuota,
+	}
+	if err := s.repo.Create(invite); err != nil {
+		return nil, fmt.Errorf("failed to save invite: %w", err)
+	}
+
+	return &models.InviteCreatedResponse{
+		InviteResponse: invite.ToResponse(),
+		Code:           code,
+		URL:            s.config.Auth.AppURL + "/login?invite=" + code,
+	}, nil
+}
+
+// List - приглашения пользователя и сколько еще он может создать
+func (s *InviteService) List(userID uint) (*models.InviteList, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	invites, err := s.repo.FindByCreator(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &models.InviteList{
+		Invites: inviteResponses(invites),
+		Limit:   -1,
+		Created: int64(len(invites)),
+	}
+	if !user.IsAdmin() {
+		list.Limit = max(s.config.Auth.InvitesPerUser, 0)
+	}
+	return list, nil
+}
+
+// ListAll - все приглашения сервера для администратора
+func (s *InviteService) ListAll(limit, offset int) (*models.AdminInviteList, error) {
+	invites, total, err := s.repo.List(limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AdminInviteList{Invites: inviteResponses(invites), Total: total}, nil
+}
+
+// Revoke отзывает приглашение пользователя; createdBy = 0 - любое (администратор)
+func (s *InviteService) Revoke(createdBy, inviteID uint) error {
+	revoked, err := s.repo.Revoke(inviteID, createdBy, time.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// Check показывает странице регистрации, действует ли код, не расходуя его
+func (s *InviteService) Check(code string) (*models.InviteStatusResponse, error) {
+	invite, err := s.find(code)
+	if err != nil {
+		return nil, err
+	}
+	if invite == nil || !invite.Usable(time.Now()) {
+		return &models.InviteStatusResponse{Valid: false}, nil
+	}
+	return &models.InviteStatusResponse{Valid: true, ExpiresAt: invite.ExpiresAt}, nil
+}
+
+// Redeem расходует одно использование приглашения. Если регистрация потом не
+// удалась, использование возвращают через Release.
+func (s *InviteService) Redeem(code string) (*models.Invite, error) {
+	invite, err := s.find(code)
+	if err != nil {
+		return nil, err
+	}
+	if invite == nil {
+		return nil, ErrInvalidInvite
+	}
+
+	used, err := s.repo.Use(invite.ID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, ErrInvalidInvite
+	}
+	return invite, nil
+}
+
+func (s *InviteService) Release(invite *models.Invite) {
+	if err := s.repo.Release(invite.ID); err != nil {
+		fmt.Printf("Warning: failed to release invite %d: %v\n", invite.ID, err)
+	}
+}
+
+func (s *InviteService) find(code string) (*models.Invite, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil, nil
+	}
+	return s.repo.FindByHash(hashInviteCode(code))
+}
+
+func inviteResponses(invites []models.Invite) []models.InviteResponse {
+	response := make([]models.InviteResponse, 0, len(invites))
+	for i := range invites {
+		response = append(response, invites[i].ToResponse())
+	}
+	return response
+}
+
+func hashInviteCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
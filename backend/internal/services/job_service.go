@@ -0,0 +1,410 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+	"github.com/google/uuid"
+)
+
+const (
+	jobPollInterval     = 2 * time.Second
+	jobFlushInterval    = time.Second
+	jobHeartbeatTimeout = 2 * time.Minute
+	jobJanitorInterval  = time.Minute
+)
+
+// JobProgressFunc сообщает прогресс задачи: done из total единиц (байт, файлов и т.п.)
+type JobProgressFunc func(done, total int64)
+
+// JobHandlerFunc выполняет задачу. Результат сериализуется в JSON и сохраняется в Job.Result.
+// Обработчик должен завершаться при отмене ctx.
+type JobHandlerFunc func(ctx context.Context, job *models.Job, progress JobProgressFunc) (interface{}, error)
+
+// JobCleanupFunc удаляет артефакты задачи (например, готовый архив) при очистке старых задач
+type JobCleanupFunc func(job *models.Job)
+
+type jobDefinition struct {
+	run     JobHandlerFunc
+	cleanup JobCleanupFunc
+}
+
+type permanentJobError struct {
+	err error
+}
+
+func (e *permanentJobError) Error() string { return e.err.Error() }
+func (e *permanentJobError) Unwrap() error { return e.err }
+
+// PermanentJobError помечает ошибку как неисправимую - задача не будет перезапущена
+func PermanentJobError(err error) error {
+	return &permanentJobError{err: err}
+}
+
+type jobSchedule struct {
+	jobType  string
+	interval time.Duration
+}
+
+type JobService struct {
+	repo        *repositories.JobRepository
+	definitions map[string]jobDefinition
+	schedules   []jobSchedule
+	workers     int
+	maxAttempts int
+	resultTTL   time.Duration
+	workerID    string
+	wake        chan struct{}
+
+	mu      sync.Mutex
+	running map[uuid.UUID]context.CancelFunc
+}
+
+func NewJobService(repo *repositories.JobRepository, workers int, maxAttempts int, resultTTL time.Duration) *JobService {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	hostname, _ := os.Hostname()
+
+	return &JobService{
+		repo:        repo,
+		definitions: make(map[string]jobDefinition),
+		workers:     workers,
+		maxAttempts: maxAttempts,
+		resultTTL:   resultTTL,
+		workerID:    fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8]),
+		wake:        make(chan struct{}, workers),
+		running:     make(map[uuid.UUID]context.CancelFunc),
+	}
+}
+
+// Register регистрирует обработчик для типа задач. Вызывается до Start.
+func (s *JobService) Register(jobType string, run JobHandlerFunc, cleanup JobCleanupFunc) {
+	s.definitions[jobType] = jobDefinition{run: run, cleanup: cleanup}
+}
+
+// Schedule периодически ставит системную задачу (UserID = 0) в очередь.
+// Если такая задача уже ждет или выполняется (в т.ч. на другой реплике), новая не создается.
+func (s *JobService) Schedule(jobType string, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	s.schedules = append(s.schedules, jobSchedule{jobType: jobType, interval: interval})
+}
+
+// Start запускает пул воркеров и фоновую очистку. Останавливается при отмене ctx.
+func (s *JobService) Start(ctx context.Context) {
+	for i := 0; i < s.workers; i++ {
+		go s.worker(ctx)
+	}
+	go s.janitor(ctx)
+	for _, schedule := range s.schedules {
+		go s.runSchedule(ctx, schedule)
+	}
+	log.Printf("✓ Job workers started (%d workers, id %s)", s.workers, s.workerID)
+}
+
+func (s *JobService) Enqueue(userID uint, jobType string, payload interface{}) (*models.Job, error) {
+	if _, ok := s.definitions[jobType]; !ok {
+		return nil, fmt.Errorf("unknown job type: %s", jobType)
+	}
+
+	rawPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job payload: %w", err)
+	}
+
+	job := &models.Job{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Type:        jobType,
+		Status:      models.JobPending,
+		Payload:     rawPayload,
+		MaxAttempts: s.maxAttempts,
+		RunAfter:    time.Now(),
+	}
+
+	if err := s.repo.Create(job); err != nil {
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return job, nil
+}
+
+func (s *JobService) runSchedule(ctx context.Context, schedule jobSchedule) {
+	ticker := time.NewTicker(schedule.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		active, err := s.repo.HasActive(schedule.jobType)
+		if err != nil {
+			log.Printf("⚠️ Failed to check scheduled job %s: %v", schedule.jobType, err)
+			continue
+		}
+		if active {
+			continue
+		}
+		if _, err := s.Enqueue(0, schedule.jobType, struct{}{}); err != nil {
+			log.Printf("⚠️ Failed to enqueue scheduled job %s: %v", schedule.jobType, err)
+		}
+	}
+}
+
+func (s *JobService) GetJob(jobID uuid.UUID, userID uint) (*models.Job, error) {
+	job, err := s.repo.FindByID(jobID)
+	if err != nil {
+		return nil, errors.New("job not found")
+	}
+
+	if job.UserID != userID {
+		return nil, errors.New("job not found")
+	}
+
+	return job, nil
+}
+
+func (s *JobService) ListJobs(userID uint, limit int) ([]models.Job, error) {
+	return s.repo.FindByUserID(userID, limit)
+}
+
+func (s *JobService) CancelJob(jobID uuid.UUID, userID uint) (*models.Job, error) {
+	job, err := s.GetJob(jobID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.IsFinished() {
+		return job, nil
+	}
+
+	if err := s.repo.RequestCancel(jobID); err != nil {
+		return nil, fmt.Errorf("failed to cancel job: %w", err)
+	}
+
+	// Если задача выполняется на этой реплике - отменяем сразу, иначе воркер увидит флаг при следующем heartbeat
+	s.mu.Lock()
+	if cancel, ok := s.running[jobID]; ok {
+		cancel()
+	}
+	s.mu.Unlock()
+
+	return s.repo.FindByID(jobID)
+}
+
+func (s *JobService) worker(ctx context.Context) {
+	types := make([]string, 0, len(s.definitions))
+	for jobType := range s.definitions {
+		types = append(types, jobType)
+	}
+
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			job, err := s.repo.ClaimNext(s.workerID, types)
+			if err != nil {
+				log.Printf("⚠️ Failed to claim job: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			s.execute(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *JobService) execute(parent context.Context, job *models.Job) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	s.mu.Lock()
+	s.running[job.ID] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, job.ID)
+		s.mu.Unlock()
+	}()
+
+	// Прогресс копится в памяти и сбрасывается в БД раз в секунду - заодно это heartbeat
+	var (
+		progressMu     sync.Mutex
+		done, total    int64
+		stopHeartbeat  = make(chan struct{})
+		heartbeatEnded = make(chan struct{})
+	)
+	progress := func(d, t int64) {
+		progressMu.Lock()
+		done, total = d, t
+		progressMu.Unlock()
+	}
+
+	go func() {
+		defer close(heartbeatEnded)
+		ticker := time.NewTicker(jobFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopHeartbeat:
+				return
+			case <-ticker.C:
+				progressMu.Lock()
+				d, t := done, total
+				progressMu.Unlock()
+				stop, err := s.repo.UpdateProgress(job.ID, job.WorkerID, d, t)
+				if err != nil {
+					log.Printf("⚠️ Failed to update job %s progress: %v", job.ID, err)
+					continue
+				}
+				if stop {
+					cancel()
+				}
+			}
+		}
+	}()
+
+	result, err := s.runSafely(ctx, job, progress)
+
+	close(stopHeartbeat)
+	<-heartbeatEnded
+
+	progressMu.Lock()
+	finalDone, finalTotal := done, total
+	progressMu.Unlock()
+	if _, updateErr := s.repo.UpdateProgress(job.ID, job.WorkerID, finalDone, finalTotal); updateErr != nil {
+		log.Printf("⚠️ Failed to update job %s progress: %v", job.ID, updateErr)
+	}
+
+	s.finish(ctx, job, result, err)
+}
+
+func (s *JobService) runSafely(ctx context.Context, job *models.Job, progress JobProgressFunc) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = PermanentJobError(fmt.Errorf("job panicked: %v", r))
+		}
+	}()
+	return s.definitions[job.Type].run(ctx, job, progress)
+}
+
+func (s *JobService) finish(ctx context.Context, job *models.Job, result interface{}, err error) {
+	if err == nil {
+		rawResult, marshalErr := json.Marshal(result)
+		if marshalErr != nil {
+			err = PermanentJobError(fmt.Errorf("failed to encode job result: %w", marshalErr))
+		} else {
+			if _, finishErr := s.repo.Finish(job.ID, job.WorkerID, models.JobCompleted, rawResult, ""); finishErr != nil {
+				log.Printf("⚠️ Failed to complete job %s: %v", job.ID, finishErr)
+			}
+			return
+		}
+	}
+
+	// Отмена пользователем (а не остановка сервера)
+	if ctx.Err() != nil {
+		if current, findErr := s.repo.FindByID(job.ID); findErr == nil && current.CancelRequested {
+			s.finishWithCleanup(job, models.JobCanceled, "canceled")
+			return
+		}
+	}
+
+	var permanent *permanentJobError
+	if !errors.As(err, &permanent) && job.Attempts < job.MaxAttempts {
+		backoff := time.Duration(job.Attempts*job.Attempts) * 5 * time.Second
+		log.Printf("⚠️ Job %s (%s) failed, retrying in %s: %v", job.ID, job.Type, backoff, err)
+		if _, requeueErr := s.repo.Requeue(job.ID, job.WorkerID, time.Now().Add(backoff), err.Error()); requeueErr != nil {
+			log.Printf("⚠️ Failed to requeue job %s: %v", job.ID, requeueErr)
+		}
+		return
+	}
+
+	log.Printf("⚠️ Job %s (%s) failed: %v", job.ID, job.Type, err)
+	s.finishWithCleanup(job, models.JobFailed, err.Error())
+}
+
+// finishWithCleanup закрывает задачу с ошибкой или отменой и удаляет ее артефакты.
+// Если задачу уже перезапустил другой воркер, артефакты принадлежат новому запуску.
+func (s *JobService) finishWithCleanup(job *models.Job, status models.JobStatus, errMsg string) {
+	finished, err := s.repo.Finish(job.ID, job.WorkerID, status, nil, errMsg)
+	if err != nil {
+		log.Printf("⚠️ Failed to mark job %s as %s: %v", job.ID, status, err)
+		return
+	}
+	if finished {
+		s.cleanupArtifacts(job)
+	}
+}
+
+func (s *JobService) cleanupArtifacts(job *models.Job) {
+	if def, ok := s.definitions[job.Type]; ok && def.cleanup != nil {
+		def.cleanup(job)
+	}
+}
+
+// janitor возвращает в очередь зависшие задачи и удаляет старые завершенные вместе с артефактами
+func (s *JobService) janitor(ctx context.Context) {
+	ticker := time.NewTicker(jobJanitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if requeued, closed, err := s.repo.RequeueStale(time.Now().Add(-jobHeartbeatTimeout)); err != nil {
+			log.Printf("⚠️ Failed to requeue stale jobs: %v", err)
+		} else if requeued+closed > 0 {
+			log.Printf("Requeued %d stale jobs, closed %d canceled or out of attempts", requeued, closed)
+		}
+
+		if s.resultTTL <= 0 {
+			continue
+		}
+
+		expired, err := s.repo.FindFinishedBefore(time.Now().Add(-s.resultTTL))
+		if err != nil {
+			log.Printf("⚠️ Failed to find expired jobs: %v", err)
+			continue
+		}
+		for i := range expired {
+			s.cleanupArtifacts(&expired[i])
+			if err := s.repo.Delete(expired[i].ID); err != nil {
+				log.Printf("⚠️ Failed to delete expired job %s: %v", expired[i].ID, err)
+			}
+		}
+	}
+}
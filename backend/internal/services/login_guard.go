@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/config"
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// LoginGuard защищает аккаунты от подбора пароля независимо от IP атакующего:
+// ограничивает частоту попыток на аккаунт и после LockoutThreshold неудач подряд
+// блокирует вход. Каждая следующая неудача удваивает блокировку до LockoutMax.
+//
+// login:fail:<account> - неудачи подряд, живет LockoutMax после последней
+// login:lock:<account> - блокировка, TTL равен ее длительности
+type LoginGuard struct {
+	redis   *redis.Client
+	limiter *RateLimiter
+	audit   *AuditService
+	cfg     config.SecurityConfig
+}
+
+func NewLoginGuard(redis *redis.Client, limiter *RateLimiter, audit *AuditService, cfg config.SecurityConfig) *LoginGuard {
+	return &LoginGuard{
+		redis:   redis,
+		limiter: limiter,
+		audit:   audit,
+		cfg:     cfg,
+	}
+}
+
+// loginAccount приводит логин к одному виду, чтобы User@Mail и user@mail
+// считались одним аккаунтом
+func loginAccount(login string) string {
+	return strings.ToLower(strings.TrimSpace(login))
+}
+
+// Check вызывается до проверки пароля: заблокированный аккаунт не тратит bcrypt
+func (g *LoginGuard) Check(ctx context.Context, login string) error {
+	if !g.limiter.Enabled() {
+		return nil
+	}
+	account := loginAccount(login)
+
+	ttl, err := g.redis.PTTL(ctx, "login:lock:"+account).Result()
+	if err != nil {
+		fmt.Printf("Warning: login lockout check failed: %v\n", err)
+	} else if ttl > 0 {
+		return &TooManyAttemptsError{RetryAfter: ttl}
+	}
+
+	return g.limiter.Allow(ctx, "login:"+account, g.cfg.AuthPerMinute, time.Minute)
+}
+
+// Failure засчитывает неудачный вход и при необходимости блокирует аккаунт.
+// userID - найденный по логину пользователь или nil.
+func (g *LoginGuard) Failure(ctx context.Context, login string, userID *uint, ip string) {
+	if !g.limiter.Enabled() || g.cfg.LockoutThreshold <= 0 {
+		return
+	}
+	account := loginAccount(login)
+	failKey := "login:fail:" + account
+
+	pipe := g.redis.TxPipeline()
+	failures := pipe.Incr(ctx, failKey)
+	pipe.Expire(ctx, failKey, g.cfg.LockoutMax)
+	if _, err := pipe.Exec(ctx); err != nil {
+		fmt.Printf("Warning: failed to count login failure: %v\n", err)
+		return
+	}
+
+	excess := failures.Val() - int64(g.cfg.LockoutThreshold)
+	if excess < 0 {
+		return
+	}
+
+	lockout := g.lockoutDuration(excess)
+	if err := g.redis.Set(ctx, "login:lock:"+account, 1, lockout).Err(); err != nil {
+		fmt.Printf("Warning: failed to lock account %q: %v\n", account, err)
+		return
+	}
+
+	g.audit.Record(&models.AuditEvent{
+		Type:    models.AuditLoginLockout,
+		UserID:  userID,
+		Account: account,
+		IP:      ip,
+		Details: fmt.Sprintf("%d failed attempts, login locked for %s", failures.Val(), lockout),
+	})
+}
+
+// Success сбрасывает счетчик неудач после верного пароля
+func (g *LoginGuard) Success(ctx context.Context, login string) {
+	if !g.limiter.Enabled() {
+		return
+	}
+	if err := g.redis.Del(ctx, "login:fail:"+loginAccount(login)).Err(); err != nil {
+		fmt.Printf("Warning: failed to reset login failures: %v\n", err)
+	}
+}
+
+// lockoutDuration - LockoutBase * 2^excess, но не больше LockoutMax
+func (g *LoginGuard) lockoutDuration(excess int64) time.Duration {
+	lockout := g.cfg.LockoutBase
+	for i := int64(0); i < excess && lockout < g.cfg.LockoutMax; i++ {
+		lockout *= 2
+	}
+	if lockout > g.cfg.LockoutMax {
+		lockout = g.cfg.LockoutMax
+	}
+	return lockout
+}
@@ -0,0 +1,470 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Сколько живет незавершенный вход: пользователь вводит пароль у провайдера
+	oidcStateTTL = 10 * time.Minute
+	// Неизвестный kid - повод перечитать JWKS (провайдер сменил ключ), но не чаще
+	oidcJWKSRefreshInterval = time.Minute
+	oidcHTTPTimeout         = 10 * time.Second
+)
+
+var (
+	ErrOIDCDisabled     = errors.New("OIDC login is not configured")
+	ErrOIDCInvalidState = errors.New("OIDC login expired or was started in another browser")
+	ErrOIDCInvalidToken = errors.New("OIDC provider returned an invalid ID token")
+)
+
+// oidcSigningAlgs - алгоритмы подписи ID-токена, которые мы умеем проверять
+var oidcSigningAlgs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// OIDCIdentity - проверенные claims ID-токена
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Groups        []string
+}
+
+type oidcDiscovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	SigningAlgs           []string `json:"id_token_signing_alg_values_supported"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// oidcLoginState - то, что нужно вспомнить на callback: хранится в Redis
+// под oidc:state:<state> и удаляется при первом же использовании
+type oidcLoginState struct {
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"redirect"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// OIDCService - клиент OpenID Connect: authorization code flow с PKCE (S256).
+// Настройки провайдера (discovery) и его ключи (JWKS) загружаются при первом
+// входе и кэшируются в памяти.
+type OIDCService struct {
+	cfg    config.OIDCConfig
+	redis  *redis.Client
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+func NewOIDCService(cfg config.OIDCConfig, redis *redis.Client) *OIDCService {
+	return &OIDCService{
+		cfg:    cfg,
+		redis:  redis,
+		client: &http.Client{Timeout: oidcHTTPTimeout},
+	}
+}
+
+func (s *OIDCService) Enabled() bool {
+	return s.cfg.Enabled && s.cfg.IssuerURL != "" && s.cfg.ClientID != ""
+}
+
+func (s *OIDCService) ProviderName() string {
+	return s.cfg.ProviderName
+}
+
+// BeginLogin готовит вход и возвращает адрес страницы провайдера и state,
+// который обработчик кладет в cookie: callback примет только свой браузер
+func (s *OIDCService) BeginLogin(ctx context.Context, redirect string) (authURL, state string, err error) {
+	if !s.Enabled() {
+		return "", "", ErrOIDCDisabled
+	}
+	provider, err := s.provider(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err = randomHex(16)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomHex(16)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	data, err := json.Marshal(oidcLoginState{Nonce: nonce, Verifier: verifier, Redirect: redirect})
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.redis.Set(ctx, oidcStateKey(state), data, oidcStateTTL).Err(); err != nil {
+		return "", "", fmt.Errorf("failed to save OIDC state: %w", err)
+	}
+
+	endpoint, err := url.Parse(provider.AuthorizationEndpoint)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	query := endpoint.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", s.cfg.ClientID)
+	query.Set("redirect_uri", s.cfg.RedirectURL)
+	query.Set("scope", strings.Join(s.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	endpoint.RawQuery = query.Encode()
+
+	return endpoint.String(), state, nil
+}
+
+// CompleteLogin обменивает code на ID-токен, проверяет его и возвращает
+// личность пользователя и адрес, сохраненный в BeginLogin
+func (s *OIDCService) CompleteLogin(ctx context.Context, state, code string) (*OIDCIdentity, string, error) {
+	if !s.Enabled() {
+		return nil, "", ErrOIDCDisabled
+	}
+
+	data, err := s.redis.GetDel(ctx, oidcStateKey(state)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, "", ErrOIDCInvalidState
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	var login oidcLoginState
+	if err := json.Unmarshal(data, &login); err != nil {
+		return nil, "", ErrOIDCInvalidState
+	}
+
+	provider, err := s.provider(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	idToken, err := s.exchangeCode(ctx, provider, code, login.Verifier)
+	if err != nil {
+		return nil, "", err
+	}
+
+	identity, err := s.verifyIDToken(ctx, provider, idToken, login.Nonce)
+	if err != nil {
+		return nil, "", err
+	}
+	return identity, login.Redirect, nil
+}
+
+func oidcStateKey(state string) string {
+	return "oidc:state:" + state
+}
+
+// provider загружает /.well-known/openid-configuration один раз за время работы
+func (s *OIDCService) provider(ctx context.Context) (*oidcDiscovery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.discovery != nil {
+		return s.discovery, nil
+	}
+
+	issuer := strings.TrimSuffix(s.cfg.IssuerURL, "/")
+	var discovery oidcDiscovery
+	if err := s.getJSON(ctx, issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to load OIDC discovery document: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("OIDC issuer mismatch: configured %q, provider reports %q", s.cfg.IssuerURL, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is missing endpoints")
+	}
+
+	s.discovery = &discovery
+	return s.discovery, nil
+}
+
+func (s *OIDCService) exchangeCode(ctx context.Context, provider *oidcDiscovery, code, verifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", s.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", s.cfg.ClientID)
+
+	// client_secret_basic - способ по умолчанию по спецификации; post - если
+	// провайдер поддерживает только его
+	secretPost := containsString(provider.TokenAuthMethods, "client_secret_post") &&
+		!containsString(provider.TokenAuthMethods, "client_secret_basic")
+	if s.cfg.ClientSecret != "" && secretPost {
+		form.Set("client_secret", s.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.cfg.ClientSecret != "" && !secretPost {
+		req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.cfg.ClientSecret))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("OIDC token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid OIDC token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("OIDC token request rejected: %s", strings.TrimSpace(body.Error+" "+body.ErrorDescription))
+	}
+	if body.IDToken == "" {
+		return "", errors.New("OIDC token response has no id_token, is the openid scope requested?")
+	}
+	return body.IDToken, nil
+}
+
+func (s *OIDCService) verifyIDToken(ctx context.Context, provider *oidcDiscovery, raw, nonce string) (*OIDCIdentity, error) {
+	algs := make([]string, 0, len(oidcSigningAlgs))
+	for _, alg := range provider.SigningAlgs {
+		if containsString(oidcSigningAlgs, alg) {
+			algs = append(algs, alg)
+		}
+	}
+	if len(algs) == 0 {
+		algs = []string{"RS256"}
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return s.signingKey(ctx, provider, kid)
+	},
+		jwt.WithValidMethods(algs),
+		jwt.WithIssuer(provider.Issuer),
+		jwt.WithAudience(s.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCInvalidToken, err)
+	}
+
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCInvalidToken)
+	}
+	// Токен для нескольких клиентов должен быть выдан именно нам (azp)
+	audience, _ := claims.GetAudience()
+	if azp, ok := claims["azp"].(string); len(audience) > 1 && (!ok || azp != s.cfg.ClientID) {
+		return nil, fmt.Errorf("%w: token was issued to another client", ErrOIDCInvalidToken)
+	}
+
+	identity := &OIDCIdentity{Issuer: provider.Issuer}
+	identity.Subject, _ = claims["sub"].(string)
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub claim", ErrOIDCInvalidToken)
+	}
+	identity.Email, _ = claims["email"].(string)
+	// Некоторые провайдеры отдают email_verified строкой
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	identity.Username, _ = claims[s.cfg.UsernameClaim].(string)
+	identity.Groups = claimStrings(claims[s.cfg.GroupsClaim])
+
+	return identity, nil
+}
+
+// signingKey ищет ключ по kid, при необходимости перечитывая JWKS
+func (s *OIDCService) signingKey(ctx context.Context, provider *oidcDiscovery, kid string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key := s.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	if s.keys != nil && time.Since(s.keysFetchedAt) < oidcJWKSRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := s.getJSON(ctx, provider.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to load OIDC signing keys: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			fmt.Printf("Warning: skipping OIDC signing key %q: %v\n", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	s.keys = keys
+	s.keysFetchedAt = time.Now()
+
+	if key := s.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey - ключ по kid; токен без kid допустим, если ключ у провайдера один
+func (s *OIDCService) lookupKey(kid string) interface{} {
+	if key, ok := s.keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key
+		}
+	}
+	return nil
+}
+
+func (s *OIDCService) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %d", target, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// claimStrings читает claim со списком: массив строк или одна строка
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
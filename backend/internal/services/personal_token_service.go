@@ -0,0 +1,160 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+)
+
+const (
+	// PersonalTokenPrefix отличает токены от JWT в заголовке Authorization и
+	// помогает сканерам секретов находить утекшие токены
+	PersonalTokenPrefix = "0x40_pat_"
+
+	maxPersonalTokensPerUser = 50
+	personalTokenTouchPeriod = time.Minute
+)
+
+var (
+	ErrPersonalTokenNotFound   = errors.New("token not found")
+	ErrTooManyPersonalTokens   = errors.New("too many tokens")
+	ErrInvalidPersonalToken    = errors.New("invalid or expired token")
+	ErrPersonalTokenExpiry     = errors.New("expiry must be in the future")
+	ErrPersonalTokenAdminScope = errors.New("only administrators can create tokens with the admin scope")
+)
+
+// PersonalTokenService выдает и проверяет личные токены доступа
+type PersonalTokenService struct {
+	repo     *repositories.PersonalTokenRepository
+	userRepo *repositories.UserRepository
+}
+
+func NewPersonalTokenService(repo *repositories.PersonalTokenRepository, userRepo *repositories.UserRepository) *PersonalTokenService {
+	return &PersonalTokenService{
+		repo:     repo,
+		userRepo: userRepo,
+	}
+}
+
+func (s *PersonalTokenService) Create(userID uint, req *models.CreatePersonalTokenRequest) (*models.PersonalTokenCreatedResponse, error) {
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, ErrPersonalTokenExpiry
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	// Порядок и дубликаты не важны: read,write и write,read,read - одно и то же
+	var scopes []string
+	for _, scope := range []string{models.TokenScopeRead, models.TokenScopeWrite, models.TokenScopeShare, models.TokenScopeAdmin} {
+		if containsString(req.Scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if containsString(scopes, models.TokenScopeAdmin) && !user.IsAdmin() {
+		return nil, ErrPersonalTokenAdminScope
+	}
+
+	count, err := s.repo.CountByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxPersonalTokensPerUser {
+		return nil, ErrTooManyPersonalTokens
+	}
+
+	secret, err := randomHex(20)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	raw := PersonalTokenPrefix + secret
+
+	token := &models.PersonalToken{
+		UserID:    userID,
+		Name:      req.Name,
+		TokenHash: hashPersonalToken(raw),
+		Prefix:    raw[:len(PersonalTokenPrefix)+6],
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.repo.Create(token); err != nil {
+		return nil, fmt.Errorf("failed to save token: %w", err)
+	}
+
+	return &models.PersonalTokenCreatedResponse{
+		PersonalTokenResponse: token.ToResponse(),
+		Token:                 raw,
+	}, nil
+}
+
+func (s *PersonalTokenService) List(userID uint) ([]models.PersonalTokenResponse, error) {
+	tokens, err := s.repo.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]models.PersonalTokenResponse, 0, len(tokens))
+	for i := range tokens {
+		response = append(response, tokens[i].ToResponse())
+	}
+	return response, nil
+}
+
+func (s *PersonalTokenService) Revoke(userID, tokenID uint) error {
+	deleted, err := s.repo.Delete(tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrPersonalTokenNotFound
+	}
+	return nil
+}
+
+// Authenticate находит токен и его активного владельца и отмечает использование
+func (s *PersonalTokenService) Authenticate(raw, ip string) (*models.User, *models.PersonalToken, error) {
+	if !strings.HasPrefix(raw, PersonalTokenPrefix) {
+		return nil, nil, ErrInvalidPersonalToken
+	}
+
+	now := time.Now()
+	token, err := s.repo.FindActiveByHash(hashPersonalToken(raw), now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if token == nil {
+		return nil, nil, ErrInvalidPersonalToken
+	}
+
+	user, err := s.userRepo.FindByID(token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil {
+		return nil, nil, ErrInvalidPersonalToken
+	}
+	if user.IsDisabled() {
+		return nil, nil, ErrAccountDisabled
+	}
+
+	if err := s.repo.Touch(token.ID, ip, now, personalTokenTouchPeriod); err != nil {
+		fmt.Printf("Warning: failed to update last use of token %d: %v\n", token.ID, err)
+	}
+	return user, token, nil
+}
+
+func hashPersonalToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
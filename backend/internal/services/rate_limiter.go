@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TooManyAttemptsError - лимит запросов исчерпан или аккаунт временно заблокирован
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("too many attempts, try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// RateLimiter - счетчики запросов в Redis с фиксированным окном. Общие для всех
+// экземпляров сервера. Если Redis недоступен, запросы пропускаются: лимит
+// защищает от перебора, но не должен останавливать вход целиком.
+type RateLimiter struct {
+	redis   *redis.Client
+	enabled bool
+}
+
+func NewRateLimiter(redis *redis.Client, enabled bool) *RateLimiter {
+	return &RateLimiter{
+		redis:   redis,
+		enabled: enabled,
+	}
+}
+
+func (l *RateLimiter) Enabled() bool {
+	return l.enabled
+}
+
+// Allow засчитывает запрос с ключом key и сообщает, укладывается ли он в limit
+// запросов за window. Если нет, RetryAfter в ошибке - до конца окна.
+func (l *RateLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) error {
+	if !l.enabled || limit <= 0 {
+		return nil
+	}
+
+	key = "ratelimit:" + key
+	pipe := l.redis.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+	ttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		fmt.Printf("Warning: rate limiter unavailable: %v\n", err)
+		return nil
+	}
+
+	if count.Val() <= int64(limit) {
+		return nil
+	}
+	retryAfter := ttl.Val()
+	if retryAfter <= 0 {
+		retryAfter = window
+	}
+	return &TooManyAttemptsError{RetryAfter: retryAfter}
+}
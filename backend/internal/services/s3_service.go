@@ -0,0 +1,663 @@
+package services
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	JobTypeS3MultipartCleanup = "s3_multipart_cleanup"
+
+	// Брошенные multipart-загрузки удаляются через неделю
+	s3MultipartTTL = 7 * 24 * time.Hour
+
+	s3MaxPartNumber  = 10000
+	s3MinPartSize    = 5 * 1024 * 1024
+	s3DefaultMaxKeys = 1000
+
+	emptyMD5 = "d41d8cd98f00b204e9800998ecf8427e"
+)
+
+var (
+	ErrS3NoSuchBucket       = errors.New("the specified bucket does not exist")
+	ErrS3BucketExists       = errors.New("the bucket already exists")
+	ErrS3BucketNotEmpty     = errors.New("the bucket is not empty")
+	ErrS3InvalidBucketName  = errors.New("the specified bucket name is not valid")
+	ErrS3NoSuchKey          = errors.New("the specified key does not exist")
+	ErrS3InvalidKey         = errors.New("the specified key cannot be mapped to a path")
+	ErrS3NoSuchUpload       = errors.New("the specified multipart upload does not exist")
+	ErrS3InvalidPart        = errors.New("one or more of the specified parts could not be found")
+	ErrS3InvalidPartOrder   = errors.New("the list of parts was not in ascending order")
+	ErrS3EntityTooSmall     = errors.New("your proposed upload is smaller than the minimum allowed size")
+	ErrS3InvalidPartNumber  = errors.New("part number must be an integer between 1 and 10000")
+	ErrS3FolderNotEmptyBody = errors.New("folder objects must be empty")
+)
+
+// S3Service отображает S3-модель на VirtualPath: бакет - папка верхнего уровня,
+// ключ "a/b/c.txt" в бакете "docs" - файл c.txt в папке /docs/a/b/.
+// Объекты сохраняются через FileService, поэтому шифрование, дедупликация и квота общие.
+type S3Service struct {
+	files        *FileService
+	uploadRepo   *repositories.S3UploadRepository
+	multipartDir string
+}
+
+func NewS3Service(files *FileService, uploadRepo *repositories.S3UploadRepository) *S3Service {
+	return &S3Service{
+		files:        files,
+		uploadRepo:   uploadRepo,
+		multipartDir: filepath.Join(files.storageDir, "multipart"),
+	}
+}
+
+// RegisterJobs регистрирует периодическую очистку брошенных multipart-загрузок
+func (s *S3Service) RegisterJobs(jobs *JobService) {
+	jobs.Register(JobTypeS3MultipartCleanup, s.runMultipartCleanupJob, nil)
+	jobs.Schedule(JobTypeS3MultipartCleanup, time.Hour)
+}
+
+// S3ETag возвращает ETag объекта. MD5 содержимого не хранится, поэтому используется SHA256:
+// он длиннее MD5, и клиенты не пытаются сверять его с локальным MD5.
+func S3ETag(file *models.File) string {
+	return `"` + file.SHA256 + `"`
+}
+
+func validBucketName(bucket string) bool {
+	return bucket != "" && bucket != "." && bucket != ".." && !strings.ContainsAny(bucket, "/\\")
+}
+
+// objectLocation переводит ключ в папку и имя файла. Ключ на "/" обозначает саму папку.
+func objectLocation(bucket, key string) (dir, name string, isFolder bool, err error) {
+	isFolder = strings.HasSuffix(key, "/")
+	trimmed := strings.TrimSuffix(key, "/")
+	if trimmed == "" {
+		return "", "", false, ErrS3InvalidKey
+	}
+
+	for _, segment := range strings.Split(trimmed, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", "", false, ErrS3InvalidKey
+		}
+	}
+
+	dir, name = splitVirtualName("/" + bucket + "/" + trimmed)
+	return dir, name, isFolder, nil
+}
+
+func (s *S3Service) ensureBucket(userID uint, bucket string) error {
+	if !validBucketName(bucket) {
+		return ErrS3NoSuchBucket
+	}
+	_, isDir, err := s.files.VirtualFS(userID).lookup("/" + bucket)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && !isDir) {
+		return ErrS3NoSuchBucket
+	}
+	return err
+}
+
+// ListBuckets возвращает папки верхнего уровня
+func (s *S3Service) ListBuckets(userID uint) ([]models.File, error) {
+	entries, err := s.files.fileRepo.FindByUserIDAndPath(userID, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]models.File, 0)
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.MimeType != "inode/directory" || seen[entry.OriginalName] {
+			continue
+		}
+		seen[entry.OriginalName] = true
+		buckets = append(buckets, entry)
+	}
+
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].OriginalName < buckets[j].OriginalName })
+	return buckets, nil
+}
+
+func (s *S3Service) CreateBucket(userID uint, bucket string) error {
+	if !validBucketName(bucket) {
+		return ErrS3InvalidBucketName
+	}
+	if err := s.ensureBucket(userID, bucket); err == nil {
+		return ErrS3BucketExists
+	} else if !errors.Is(err, ErrS3NoSuchBucket) {
+		return err
+	}
+
+	_, err := s.files.CreateFolder(userID, "/", bucket)
+	return err
+}
+
+func (s *S3Service) HeadBucket(userID uint, bucket string) error {
+	return s.ensureBucket(userID, bucket)
+}
+
+// DeleteBucket удаляет только пустой бакет, как и S3
+func (s *S3Service) DeleteBucket(userID uint, bucket string) error {
+	if err := s.ensureBucket(userID, bucket); err != nil {
+		return err
+	}
+
+	hasChildren, err := s.files.fileRepo.HasFilesUnderPath(userID, "/"+bucket+"/")
+	if err != nil {
+		return err
+	}
+	if hasChildren {
+		return ErrS3BucketNotEmpty
+	}
+
+	return s.deleteFolderMarkers(userID, "/", bucket)
+}
+
+// ListObjects возвращает ключи бакета по возрастанию. marker - ключ, после которого продолжать
+// (StartAfter / ContinuationToken / Marker), delimiter сворачивает ключи в CommonPrefixes.
+func (s *S3Service) ListObjects(userID uint, bucket, prefix, delimiter, marker string, maxKeys int) (*models.S3ListResult, error) {
+	if err := s.ensureBucket(userID, bucket); err != nil {
+		return nil, err
+	}
+	if maxKeys < 0 || maxKeys > s3DefaultMaxKeys {
+		maxKeys = s3DefaultMaxKeys
+	}
+
+	bucketPath := "/" + bucket + "/"
+	files, err := s.files.fileRepo.FindAllRecursively(userID, bucketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Для одного имени может быть несколько версий - в листинг попадает самая новая
+	objects := make(map[string]models.S3Object)
+	for i := range files {
+		file := &files[i]
+		key := strings.TrimPrefix(file.VirtualPath, bucketPath) + file.OriginalName
+		object := models.S3Object{Key: key, LastModified: file.UpdatedAt}
+		if file.MimeType == "inode/directory" {
+			object.Key += "/"
+			object.ETag = `"` + emptySHA256 + `"`
+		} else {
+			object.Size = file.Size
+			object.ETag = S3ETag(file)
+		}
+
+		if !strings.HasPrefix(object.Key, prefix) {
+			continue
+		}
+		if existing, ok := objects[object.Key]; ok && existing.LastModified.After(object.LastModified) {
+			continue
+		}
+		objects[object.Key] = object
+	}
+
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := &models.S3ListResult{Objects: []models.S3Object{}, CommonPrefixes: []string{}}
+	seenPrefixes := make(map[string]bool)
+	count := 0
+
+	for _, key := range keys {
+		if key <= marker {
+			continue
+		}
+
+		entry := key
+		isPrefix := false
+		if delimiter != "" {
+			if idx := strings.Index(key[len(prefix):], delimiter); idx >= 0 {
+				entry = key[:len(prefix)+idx+len(delimiter)]
+				isPrefix = true
+			}
+		}
+		if isPrefix && (seenPrefixes[entry] || entry <= marker) {
+			continue
+		}
+
+		if count == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		count++
+
+		if isPrefix {
+			seenPrefixes[entry] = true
+			result.CommonPrefixes = append(result.CommonPrefixes, entry)
+		} else {
+			result.Objects = append(result.Objects, objects[key])
+		}
+		result.NextMarker = entry
+	}
+
+	return result, nil
+}
+
+// GetObject находит объект. Ключ на "/" возвращает маркер папки.
+func (s *S3Service) GetObject(userID uint, bucket, key string) (*models.File, error) {
+	if err := s.ensureBucket(userID, bucket); err != nil {
+		return nil, err
+	}
+
+	dir, name, isFolder, err := objectLocation(bucket, key)
+	if err != nil {
+		return nil, ErrS3NoSuchKey
+	}
+
+	files, err := s.files.fileRepo.FindByPathAndName(userID, dir, name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		if (files[i].MimeType == "inode/directory") == isFolder {
+			return &files[i], nil
+		}
+	}
+	return nil, ErrS3NoSuchKey
+}
+
+// OpenObject открывает объект для чтения с поддержкой Seek (для Range-запросов)
+func (s *S3Service) OpenObject(file *models.File) (io.ReadSeekCloser, error) {
+	if file.MimeType == "inode/directory" {
+		return emptyReadSeekCloser{strings.NewReader("")}, nil
+	}
+	return s.files.OpenDecrypted(file)
+}
+
+type emptyReadSeekCloser struct {
+	*strings.Reader
+}
+
+func (emptyReadSeekCloser) Close() error { return nil }
+
+// PutObject сохраняет объект и убирает в корзину предыдущую версию с тем же ключом.
+// Возвращает MD5 тела - его ждут SDK в ETag ответа на PutObject.
+func (s *S3Service) PutObject(userID uint, bucket, key, contentType string, body io.Reader, size int64) (*models.File, string, error) {
+	if err := s.ensureBucket(userID, bucket); err != nil {
+		return nil, "", err
+	}
+
+	dir, name, isFolder, err := objectLocation(bucket, key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if isFolder {
+		return s.putFolder(userID, dir, name, body)
+	}
+
+	hash := md5.New()
+	file, err := s.files.StoreFile(userID, io.TeeReader(body, hash), size, name, contentType, dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := s.files.replaceOlderVersions(file); err != nil {
+		return nil, "", err
+	}
+
+	return file, `"` + hex.EncodeToString(hash.Sum(nil)) + `"`, nil
+}
+
+// putFolder создает маркер папки - так S3-клиенты создают "пустые папки"
+func (s *S3Service) putFolder(userID uint, dir, name string, body io.Reader) (*models.File, string, error) {
+	var probe [1]byte
+	if n, _ := body.Read(probe[:]); n > 0 {
+		return nil, "", ErrS3FolderNotEmptyBody
+	}
+
+	files, err := s.files.fileRepo.FindByPathAndName(userID, dir, name)
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range files {
+		if files[i].MimeType == "inode/directory" {
+			return &files[i], `"` + emptyMD5 + `"`, nil
+		}
+	}
+
+	folder, err := s.files.CreateFolder(userID, dir, name)
+	if err != nil {
+		return nil, "", err
+	}
+	return folder, `"` + emptyMD5 + `"`, nil
+}
+
+// DeleteObject удаляет объект в корзину. Отсутствующий ключ - не ошибка (как в S3).
+// Удаление ключа на "/" убирает только маркер папки, но не ее содержимое.
+func (s *S3Service) DeleteObject(userID uint, bucket, key string) error {
+	if err := s.ensureBucket(userID, bucket); err != nil {
+		return err
+	}
+
+	dir, name, isFolder, err := objectLocation(bucket, key)
+	if err != nil {
+		return nil
+	}
+
+	if isFolder {
+		return s.deleteFolderMarkers(userID, dir, name)
+	}
+
+	files, err := s.files.fileRepo.FindByPathAndName(userID, dir, name)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.MimeType == "inode/directory" {
+			continue
+		}
+		if err := s.files.DeleteFile(file.ID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3Service) deleteFolderMarkers(userID uint, dir, name string) error {
+	files, err := s.files.fileRepo.FindByPathAndName(userID, dir, name)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.MimeType != "inode/directory" {
+			continue
+		}
+		if err := s.files.DeleteFile(file.ID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3Service) CreateMultipartUpload(userID uint, bucket, key, contentType string) (*models.S3MultipartUpload, error) {
+	if err := s.ensureBucket(userID, bucket); err != nil {
+		return nil, err
+	}
+	if _, _, isFolder, err := objectLocation(bucket, key); err != nil || isFolder {
+		return nil, ErrS3InvalidKey
+	}
+
+	upload := &models.S3MultipartUpload{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Bucket:      bucket,
+		Key:         key,
+		ContentType: contentType,
+	}
+	if err := s.uploadRepo.Create(upload); err != nil {
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	return upload, nil
+}
+
+func (s *S3Service) findUpload(userID uint, bucket, key, uploadID string) (*models.S3MultipartUpload, error) {
+	id, err := uuid.Parse(uploadID)
+	if err != nil {
+		return nil, ErrS3NoSuchUpload
+	}
+
+	upload, err := s.uploadRepo.FindByID(id, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrS3NoSuchUpload
+	}
+	if err != nil {
+		return nil, err
+	}
+	if upload.Bucket != bucket || upload.Key != key {
+		return nil, ErrS3NoSuchUpload
+	}
+	return upload, nil
+}
+
+func (s *S3Service) partPath(uploadID uuid.UUID, partNumber int) string {
+	return filepath.Join(s.multipartDir, uploadID.String(), strconv.Itoa(partNumber))
+}
+
+// UploadPart шифрует часть на диск. Квота учитывает уже загруженные части всех
+// незавершенных загрузок пользователя, чтобы ими нельзя было обойти лимит.
+func (s *S3Service) UploadPart(userID uint, bucket, key, uploadID string, partNumber int, body io.Reader, size int64) (string, error) {
+	if partNumber < 1 || partNumber > s3MaxPartNumber {
+		return "", ErrS3InvalidPartNumber
+	}
+
+	upload, err := s.findUpload(userID, bucket, key, uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	used, quota, err := s.files.userQuota(userID)
+	if err != nil {
+		return "", err
+	}
+	pending, err := s.uploadRepo.PendingSize(userID, upload.ID, partNumber)
+	if err != nil {
+		return "", fmt.Errorf("failed to check storage quota: %w", err)
+	}
+
+	remaining := quota - used - pending
+	if size > remaining {
+		return "", ErrQuotaExceeded
+	}
+	limit := s.files.maxUploadSize
+	if remaining < limit {
+		limit = remaining
+	}
+
+	reader := &limitedCountingReader{r: body, limit: limit}
+	hash := md5.New()
+
+	tmpPath := filepath.Join(s.files.storageDir, "tmp", uuid.New().String())
+	if _, err := s.files.encryptFile(io.TeeReader(reader, hash), tmpPath); err != nil {
+		s.files.removeBlob(tmpPath)
+		if reader.exceeded {
+			if limit == remaining {
+				return "", ErrQuotaExceeded
+			}
+			return "", fmt.Errorf("%w: max size is %d bytes", ErrFileTooLarge, s.files.maxUploadSize)
+		}
+		return "", err
+	}
+
+	// Части в счетчик не попадают, поэтому под блокировкой резерва учитываются отдельно.
+	// Резерв снимается, когда часть уже сохранена и видна в PendingSize.
+	reservation, err := s.files.reserveQuota(userID, reader.n, func(tx *gorm.DB) (int64, error) {
+		return s.uploadRepo.WithTx(tx).PendingSize(userID, upload.ID, partNumber)
+	})
+	if err != nil {
+		s.files.removeBlob(tmpPath)
+		return "", err
+	}
+	defer s.files.releaseQuota(reservation)
+
+	partPath := s.partPath(upload.ID, partNumber)
+	if err := os.MkdirAll(filepath.Dir(partPath), 0750); err != nil {
+		s.files.removeBlob(tmpPath)
+		return "", fmt.Errorf("failed to create directories: %w", err)
+	}
+	if err := os.Rename(tmpPath, partPath); err != nil {
+		s.files.removeBlob(tmpPath)
+		return "", fmt.Errorf("failed to store part: %w", err)
+	}
+
+	etag := hex.EncodeToString(hash.Sum(nil))
+	if err := s.uploadRepo.SavePart(&models.S3MultipartPart{
+		UploadID:   upload.ID,
+		PartNumber: partNumber,
+		ETag:       etag,
+		Size:       reader.n,
+	}); err != nil {
+		return "", fmt.Errorf("failed to save part: %w", err)
+	}
+
+	return `"` + etag + `"`, nil
+}
+
+func (s *S3Service) ListParts(userID uint, bucket, key, uploadID string) (*models.S3MultipartUpload, error) {
+	return s.findUpload(userID, bucket, key, uploadID)
+}
+
+func (s *S3Service) ListMultipartUploads(userID uint, bucket string) ([]models.S3MultipartUpload, error) {
+	if err := s.ensureBucket(userID, bucket); err != nil {
+		return nil, err
+	}
+	return s.uploadRepo.FindByBucket(userID, bucket)
+}
+
+// CompleteMultipartUpload склеивает части потоком (расшифровка -> StoreFile) и удаляет их.
+// ETag собирается как в S3: MD5 от MD5 частей с суффиксом "-N".
+func (s *S3Service) CompleteMultipartUpload(userID uint, bucket, key, uploadID string, parts []models.S3CompletedPart) (*models.File, string, error) {
+	upload, err := s.findUpload(userID, bucket, key, uploadID)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(parts) == 0 {
+		return nil, "", ErrS3InvalidPart
+	}
+
+	uploaded := make(map[int]models.S3MultipartPart, len(upload.Parts))
+	for _, part := range upload.Parts {
+		uploaded[part.PartNumber] = part
+	}
+
+	var total int64
+	etagHash := md5.New()
+	selected := make([]models.S3MultipartPart, 0, len(parts))
+	for i, requested := range parts {
+		if i > 0 && requested.PartNumber <= parts[i-1].PartNumber {
+			return nil, "", ErrS3InvalidPartOrder
+		}
+		part, ok := uploaded[requested.PartNumber]
+		if !ok || strings.Trim(requested.ETag, `"`) != part.ETag {
+			return nil, "", ErrS3InvalidPart
+		}
+		if i < len(parts)-1 && part.Size < s3MinPartSize {
+			return nil, "", ErrS3EntityTooSmall
+		}
+
+		raw, _ := hex.DecodeString(part.ETag)
+		etagHash.Write(raw)
+		total += part.Size
+		selected = append(selected, part)
+	}
+
+	dir, name, _, err := objectLocation(bucket, key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	reader := &multipartReader{service: s, upload: upload, parts: selected}
+	defer reader.Close()
+
+	file, err := s.files.StoreFile(userID, reader, total, name, upload.ContentType, dir)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.files.replaceOlderVersions(file); err != nil {
+		return nil, "", err
+	}
+
+	if err := s.AbortMultipartUpload(userID, bucket, key, uploadID); err != nil {
+		return nil, "", err
+	}
+
+	etag := fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(etagHash.Sum(nil)), len(selected))
+	return file, etag, nil
+}
+
+func (s *S3Service) AbortMultipartUpload(userID uint, bucket, key, uploadID string) error {
+	upload, err := s.findUpload(userID, bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	return s.removeUpload(upload.ID)
+}
+
+func (s *S3Service) removeUpload(id uuid.UUID) error {
+	if err := s.uploadRepo.Delete(id); err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	if err := os.RemoveAll(filepath.Join(s.multipartDir, id.String())); err != nil {
+		return fmt.Errorf("failed to remove parts: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Service) runMultipartCleanupJob(ctx context.Context, job *models.Job, progress JobProgressFunc) (interface{}, error) {
+	uploads, err := s.uploadRepo.FindOlderThan(time.Now().Add(-s3MultipartTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stale uploads: %w", err)
+	}
+
+	total := int64(len(uploads))
+	for i, upload := range uploads {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := s.removeUpload(upload.ID); err != nil {
+			return nil, err
+		}
+		progress(int64(i+1), total)
+	}
+	return map[string]int64{"removed": total}, nil
+}
+
+// multipartReader последовательно расшифровывает части загрузки
+type multipartReader struct {
+	service *S3Service
+	upload  *models.S3MultipartUpload
+	parts   []models.S3MultipartPart
+	current io.ReadCloser
+}
+
+func (m *multipartReader) Read(p []byte) (int, error) {
+	for {
+		if m.current == nil {
+			if len(m.parts) == 0 {
+				return 0, io.EOF
+			}
+			partPath := m.service.partPath(m.upload.ID, m.parts[0].PartNumber)
+			reader, err := m.service.files.OpenDecrypted(&models.File{Path: partPath})
+			if err != nil {
+				return 0, err
+			}
+			m.current = reader
+			m.parts = m.parts[1:]
+		}
+
+		n, err := m.current.Read(p)
+		if err == io.EOF {
+			m.current.Close()
+			m.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (m *multipartReader) Close() error {
+	if m.current != nil {
+		return m.current.Close()
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Как часто обновлять LastSeenAt - не чаще раза в минуту на сессию
+	sessionTouchInterval = time.Minute
+	// Сколько старый refresh-токен еще принимается после ротации: параллельные
+	// запросы из соседних вкладок приходят со старой cookie
+	refreshReuseGrace = 30 * time.Second
+)
+
+var (
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, session revoked")
+)
+
+// SessionClient - откуда выполнен вход, для списка устройств
+type SessionClient struct {
+	IP        string
+	UserAgent string
+}
+
+// SessionService хранит сессии в Redis: session:<id> - сама сессия с TTL до
+// истечения refresh-токена, user:<id>:sessions - множество сессий пользователя.
+type SessionService struct {
+	redis      *redis.Client
+	refreshTTL time.Duration
+
+	// Вызываются после RevokeAll/RevokeOthers: кеши вне Redis (пароли WebDAV)
+	// должны забыть пользователя вместе с его сессиями
+	onRevoke []func(userID uint)
+}
+
+func NewSessionService(redis *redis.Client, refreshTTL time.Duration) *SessionService {
+	return &SessionService{
+		redis:      redis,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// OnRevoke регистрирует обработчик отзыва сессий пользователя. Вызывать при старте.
+func (s *SessionService) OnRevoke(fn func(userID uint)) {
+	s.onRevoke = append(s.onRevoke, fn)
+}
+
+func (s *SessionService) notifyRevoked(userID uint) {
+	for _, fn := range s.onRevoke {
+		fn(userID)
+	}
+}
+
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+func userSessionsKey(userID uint) string {
+	return fmt.Sprintf("user:%d:sessions", userID)
+}
+
+func hashRefreshSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// Create открывает сессию и возвращает refresh-токен вида <session id>.<secret>
+func (s *SessionService) Create(ctx context.Context, userID uint, client SessionClient) (*models.Session, string, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		ID:          id,
+		UserID:      userID,
+		IP:          client.IP,
+		UserAgent:   truncate(client.UserAgent, 512),
+		CreatedAt:   now,
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(s.refreshTTL),
+		RefreshHash: hashRefreshSecret(secret),
+		RotatedAt:   now,
+	}
+
+	if err := s.save(ctx, s.redis, session); err != nil {
+		return nil, "", err
+	}
+	if err := s.redis.SAdd(ctx, userSessionsKey(userID), id).Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to save session: %w", err)
+	}
+	return session, id + "." + secret, nil
+}
+
+func (s *SessionService) save(ctx context.Context, cmd redis.Cmdable, session *models.Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if err := cmd.Set(ctx, sessionKey(session.ID), data, time.Until(session.ExpiresAt)).Err(); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+func (s *SessionService) load(ctx context.Context, cmd redis.Cmdable, id string) (*models.Session, error) {
+	data, err := cmd.Get(ctx, sessionKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session models.Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Validate проверяет, что сессия access-токена не отозвана, и отмечает активность
+func (s *SessionService) Validate(ctx context.Context, id string, userID uint, ip string) (*models.Session, error) {
+	session, err := s.load(ctx, s.redis, id)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != userID {
+		return nil, ErrSessionNotFound
+	}
+
+	if time.Since(session.LastSeenAt) >= sessionTouchInterval {
+		session.LastSeenAt = time.Now()
+		session.IP = ip
+		data, err := json.Marshal(session)
+		if err == nil {
+			// KEEPTTL: отметка активности не продлевает сессию
+			err = s.redis.SetArgs(ctx, sessionKey(id), data, redis.SetArgs{KeepTTL: true, Mode: "XX"}).Err()
+		}
+		if err != nil && !errors.Is(err, redis.Nil) {
+			fmt.Printf("Warning: failed to update session %s: %v\n", id, err)
+		}
+	}
+	return session, nil
+}
+
+// Rotate обменивает refresh-токен на новый. Предъявление уже замененного токена
+// после льготного окна означает его кражу - сессия отзывается целиком.
+// Пустой newToken - токен принят в льготном окне: новый уже выдан параллельному
+// запросу и повторно не выдается.
+func (s *SessionService) Rotate(ctx context.Context, refreshToken string, client SessionClient) (session *models.Session, newToken string, err error) {
+	id, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || id == "" || secret == "" {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	presented := hashRefreshSecret(secret)
+
+	reused := false
+	txf := func(tx *redis.Tx) error {
+		session, err = s.load(ctx, tx, id)
+		if errors.Is(err, ErrSessionNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(session.PrevRefreshHash)) == 1 {
+			if time.Since(session.RotatedAt) <= refreshReuseGrace {
+				newToken = ""
+				return nil
+			}
+			reused = true
+			return ErrRefreshTokenReused
+		}
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(session.RefreshHash)) != 1 {
+			return ErrInvalidRefreshToken
+		}
+
+		next, err := randomHex(32)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		session.PrevRefreshHash = session.RefreshHash
+		session.RefreshHash = hashRefreshSecret(next)
+		session.RotatedAt = now
+		session.LastSeenAt = now
+		session.ExpiresAt = now.Add(s.refreshTTL)
+		session.IP = client.IP
+		session.UserAgent = truncate(client.UserAgent, 512)
+		newToken = id + "." + next
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			return s.save(ctx, pipe, session)
+		})
+		return err
+	}
+
+	// Оптимистичная блокировка: из двух одновременных ротаций проходит одна,
+	// вторая повторяется и попадает в льготное окно
+	for attempt := 0; attempt < 3; attempt++ {
+		err = s.redis.Watch(ctx, txf, sessionKey(id))
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+
+	if reused {
+		if revokeErr := s.Revoke(ctx, session.UserID, id); revokeErr != nil {
+			fmt.Printf("Warning: failed to revoke session %s: %v\n", id, revokeErr)
+		}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return session, newToken, nil
+}
+
+// RevokeByRefreshToken закрывает сессию, которой принадлежит refresh-токен (выход)
+func (s *SessionService) RevokeByRefreshToken(ctx context.Context, refreshToken string) error {
+	id, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok {
+		return ErrInvalidRefreshToken
+	}
+	session, err := s.load(ctx, s.redis, id)
+	if err != nil {
+		return err
+	}
+	presented := hashRefreshSecret(secret)
+	if subtle.ConstantTimeCompare([]byte(presented), []byte(session.RefreshHash)) != 1 &&
+		subtle.ConstantTimeCompare([]byte(presented), []byte(session.PrevRefreshHash)) != 1 {
+		return ErrInvalidRefreshToken
+	}
+	return s.Revoke(ctx, session.UserID, id)
+}
+
+// List возвращает действующие сессии пользователя, заодно вычищая истекшие из индекса
+func (s *SessionService) List(ctx context.Context, userID uint) ([]models.Session, error) {
+	ids, err := s.redis.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	sessions := make([]models.Session, 0, len(ids))
+	for _, id := range ids {
+		session, err := s.load(ctx, s.redis, id)
+		if errors.Is(err, ErrSessionNotFound) {
+			s.redis.SRem(ctx, userSessionsKey(userID), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, nil
+}
+
+// Revoke закрывает сессию пользователя; чужая сессия считается несуществующей
+func (s *SessionService) Revoke(ctx context.Context, userID uint, id string) error {
+	session, err := s.load(ctx, s.redis, id)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, sessionKey(id))
+	pipe.SRem(ctx, userSessionsKey(userID), id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// RevokeAll закрывает все сессии пользователя ("выйти везде", отключение аккаунта)
+func (s *SessionService) RevokeAll(ctx context.Context, userID uint) error {
+	ids, err := s.redis.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	pipe := s.redis.TxPipeline()
+	for _, id := range ids {
+		pipe.Del(ctx, sessionKey(id))
+	}
+	pipe.Del(ctx, userSessionsKey(userID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	s.notifyRevoked(userID)
+	return nil
+}
+
+// RevokeOthers закрывает все сессии пользователя, кроме keepID (смена пароля).
+// Пустой keepID закрывает все.
+func (s *SessionService) RevokeOthers(ctx context.Context, userID uint, keepID string) error {
+	ids, err := s.redis.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	pipe := s.redis.TxPipeline()
+	for _, id := range ids {
+		if id != keepID {
+			pipe.Del(ctx, sessionKey(id))
+			pipe.SRem(ctx, userSessionsKey(userID), id)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	s.notifyRevoked(userID)
+	return nil
+}
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/config"
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+)
+
+var ErrInvalidRegistrationMode = errors.New("registration mode must be open, invite or closed")
+
+// SettingsService - параметры сервера, изменяемые администратором во время работы.
+// Пока параметр не задан через API, действует значение из конфигурации (.env).
+type SettingsService struct {
+	repo   *repositories.SettingRepository
+	config *config.Config
+}
+
+func NewSettingsService(repo *repositories.SettingRepository, cfg *config.Config) *SettingsService {
+	return &SettingsService{
+		repo:   repo,
+		config: cfg,
+	}
+}
+
+// RegistrationMode - open, invite или closed. Флаг registration_enabled из
+// прежних версий учитывается, пока режим не задан явно.
+func (s *SettingsService) RegistrationMode() (string, error) {
+	mode, found, err := s.repo.Get(models.SettingRegistrationMode)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		if !validRegistrationMode(mode) {
+			return "", ErrInvalidRegistrationMode
+		}
+		return mode, nil
+	}
+
+	value, found, err := s.repo.Get(models.SettingRegistrationEnabled)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return s.config.Auth.RegistrationMode, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return "", err
+	}
+	if enabled {
+		return models.RegistrationOpen, nil
+	}
+	return models.RegistrationClosed, nil
+}
+
+func (s *SettingsService) SetRegistrationMode(mode string) error {
+	if !validRegistrationMode(mode) {
+		return ErrInvalidRegistrationMode
+	}
+	return s.repo.Set(models.SettingRegistrationMode, mode)
+}
+
+func validRegistrationMode(mode string) bool {
+	switch mode {
+	case models.RegistrationOpen, models.RegistrationInvite, models.RegistrationClosed:
+		return true
+	}
+	return false
+}
@@ -1,98 +1,485 @@
 package services
 
 import (
+	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bhop_dynasty/0x40_cloud/internal/models"
 	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/google/uuid"
 )
 
+// Сколько действует cookie после ввода пароля к ссылке
+const ShareUnlockTTL = time.Hour
+
+var (
+	ErrShareNotFound         = errors.New("share not found")
+	ErrShareExpired          = errors.New("link expired")
+	ErrShareLimitReached     = errors.New("download limit reached")
+	ErrSharePasswordRequired = errors.New("password required")
+	ErrShareInvalidPassword  = errors.New("invalid password")
+	ErrShareWrongType        = errors.New("operation not supported for this share type")
+	ErrShareInvalidTarget    = errors.New("invalid share target")
+)
+
 type ShareService struct {
-	repo        *repositories.SharedFileRepository
-	fileRepo    *repositories.FileRepository
-	fileService *FileService
+	repo         *repositories.SharedFileRepository
+	fileRepo     *repositories.FileRepository
+	fileService  *FileService
+	events       *EventService
+	unlockSecret []byte
+}
+
+func NewShareService(repo *repositories.SharedFileRepository, fileRepo *repositories.FileRepository, fileService *FileService, unlockSecret string) *ShareService {
+	return &ShareService{repo: repo, fileRepo: fileRepo, fileService: fileService, unlockSecret: []byte(unlockSecret)}
+}
+
+// SetEventService подключает уведомления владельцу о создании, отзыве и скачивании ссылок
+func (s *ShareService) SetEventService(events *EventService) {
+	s.events = events
 }
 
-func NewShareService(repo *repositories.SharedFileRepository, fileRepo *repositories.FileRepository, fileService *FileService) *ShareService {
-	return &ShareService{repo: repo, fileRepo: fileRepo, fileService: fileService}
+func (s *ShareService) emit(share *models.SharedFile, eventType string) {
+	if s.events == nil {
+		return
+	}
+	s.events.Publish(share.UserID, eventType, ShareEventData{
+		Token:      share.Token,
+		FileID:     share.FileID,
+		FolderPath: share.FolderPath,
+		Downloads:  share.Downloads,
+	})
 }
 
-func (s *ShareService) CreateShare(userID uint, fileID uuid.UUID, limit *int, expiresAt *time.Time) (*models.SharedFile, error) {
+func (s *ShareService) CreateShare(userID uint, fileID uuid.UUID, req *models.CreateShareRequest) (*models.SharedFile, error) {
 	file, err := s.fileRepo.FindByID(fileID)
 	if err != nil {
 		return nil, err
 	}
 	fmt.Printf("DEBUG: CreateShare - Request UserID: %d, File UserID: %d, FileID: %s\n", userID, file.UserID, file.ID)
 
-	if file.UserID != userID {
+	// Публичные ссылки - только на личные файлы: у файла команды нет одного владельца
+	if file.UserID != userID || file.TeamID != nil {
 		return nil, errors.New("unauthorized")
 	}
 
+	return s.createShare(&models.SharedFile{
+		Type:   models.ShareTypeFile,
+		FileID: &fileID,
+		UserID: userID,
+	}, req)
+}
+
+// CreateFolderShare создает ссылку на папку: по ней можно смотреть содержимое,
+// скачивать отдельные файлы и всю папку архивом
+func (s *ShareService) CreateFolderShare(userID uint, folderPath string, req *models.CreateShareRequest) (*models.SharedFile, error) {
+	folderPath = normalizeFolderPath(path.Clean("/" + folderPath))
+	if folderPath == "/" {
+		return nil, ErrShareInvalidTarget
+	}
+
+	_, isDir, err := s.fileService.VirtualFS(userID).lookup(strings.TrimSuffix(folderPath, "/"))
+	if err != nil || !isDir {
+		return nil, ErrShareInvalidTarget
+	}
+
+	return s.createShare(&models.SharedFile{
+		Type:       models.ShareTypeFolder,
+		FolderPath: folderPath,
+		UserID:     userID,
+	}, req)
+}
+
+// CreateFileRequest создает ссылку, по которой посетители загружают файлы в папку,
+// не видя ее содержимого
+func (s *ShareService) CreateFileRequest(userID uint, folderPath string, req *models.CreateFileRequestRequest) (*models.SharedFile, error) {
+	folderPath = normalizeFolderPath(path.Clean("/" + folderPath))
+
+	if folderPath != "/" {
+		_, isDir, err := s.fileService.VirtualFS(userID).lookup(strings.TrimSuffix(folderPath, "/"))
+		if err != nil || !isDir {
+			return nil, ErrShareInvalidTarget
+		}
+	}
+
+	return s.createShare(&models.SharedFile{
+		Type:        models.ShareTypeRequest,
+		FolderPath:  folderPath,
+		UserID:      userID,
+		MaxFileSize: req.MaxFileSize,
+	}, &req.CreateShareRequest)
+}
+
+func (s *ShareService) createShare(share *models.SharedFile, req *models.CreateShareRequest) (*models.SharedFile, error) {
 	token, err := generateToken(32)
 	if err != nil {
 		return nil, err
 	}
 
-	share := &models.SharedFile{
-		Token:     token,
-		FileID:    fileID,
-		UserID:    userID,
-		Limit:     limit,
-		ExpiresAt: expiresAt,
+	share.Token = token
+	share.Limit = req.Limit
+	share.ExpiresAt = req.ExpiresAt
+	share.HideOwner = req.HideOwner
+
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash password: %w", err)
+		}
+		share.PasswordHash = string(hash)
+		share.PasswordProtected = true
 	}
 
 	if err := s.repo.Create(share); err != nil {
 		return nil, err
 	}
 
+	s.emit(share, EventShareCreated)
+
 	return share, nil
 }
 
 func (s *ShareService) GetSharedFile(token string) (*models.SharedFile, error) {
 	share, err := s.repo.GetByToken(token)
 	if err != nil {
-		return nil, errors.New("share not found")
+		return nil, ErrShareNotFound
 	}
 
 	// Check expiration
 	if share.ExpiresAt != nil && time.Now().After(*share.ExpiresAt) {
-		return nil, errors.New("link expired")
+		return nil, ErrShareExpired
 	}
 
 	// Check download limit
-	if share.Limit != nil && share.Downloads >= *share.Limit {
-		return nil, errors.New("download limit reached")
+	if share.Limit != nil && share.Used() >= *share.Limit {
+		return nil, ErrShareLimitReached
 	}
 
 	return share, nil
 }
 
-func (s *ShareService) DownloadSharedFile(token string, dst io.Writer) (*models.SharedFile, error) {
+// AuthorizeShare возвращает ссылку, если она действительна и, для защищенных паролем,
+// unlockCookie подтверждает, что пароль уже был введен
+func (s *ShareService) AuthorizeShare(token, unlockCookie string) (*models.SharedFile, error) {
 	share, err := s.GetSharedFile(token)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := s.repo.IncrementDownloads(token); err != nil {
+	if share.PasswordProtected && !s.validUnlock(share, unlockCookie) {
+		return nil, ErrSharePasswordRequired
+	}
+
+	return share, nil
+}
+
+// UnlockShare проверяет пароль и возвращает значение cookie, открывающей ссылку на ShareUnlockTTL
+func (s *ShareService) UnlockShare(token, password string) (string, error) {
+	share, err := s.GetSharedFile(token)
+	if err != nil {
+		return "", err
+	}
+
+	if !share.PasswordProtected {
+		return "", nil
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(password)); err != nil {
+		return "", ErrShareInvalidPassword
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(ShareUnlockTTL).Unix(), 10)
+	return expires + "." + s.unlockSignature(share, expires), nil
+}
+
+// unlockSignature подписывает срок действия вместе с хешем пароля:
+// после смены пароля или пересоздания ссылки старые cookie перестают действовать
+func (s *ShareService) unlockSignature(share *models.SharedFile, expires string) string {
+	mac := hmac.New(sha256.New, s.unlockSecret)
+	mac.Write([]byte(share.Token + "|" + expires + "|" + share.PasswordHash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *ShareService) validUnlock(share *models.SharedFile, value string) bool {
+	expires, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return false
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(s.unlockSignature(share, expires)))
+}
+
+// DownloadSharedFile отдает файл по ссылке; download должен быть получен через BeginDownload
+func (s *ShareService) DownloadSharedFile(download *ShareDownload, dst io.Writer) error {
+	share := download.share
+	if share.Type != models.ShareTypeFile {
+		s.finishDownload(download, nil, 0, 0, ErrShareWrongType)
+		return ErrShareWrongType
+	}
+
+	counter := &countingWriter{w: dst}
+	err := s.fileService.decryptFile(share.File.Path, counter)
+	s.finishDownload(download, share.FileID, counter.n, share.File.Size, err)
+	return err
+}
+
+// sharedFolderPath переводит путь внутри расшаренной папки в VirtualPath владельца.
+// path.Clean от "/"+subPath не дает выйти за пределы папки через "..".
+func sharedFolderPath(share *models.SharedFile, subPath string) string {
+	relative := strings.TrimPrefix(path.Clean("/"+subPath), "/")
+	return normalizeFolderPath(share.FolderPath + relative)
+}
+
+// ListSharedFolder возвращает содержимое папки (или подпапки subPath) по ссылке
+func (s *ShareService) ListSharedFolder(share *models.SharedFile, subPath string) ([]models.SharedFolderEntry, error) {
+	if share.Type != models.ShareTypeFolder {
+		return nil, ErrShareWrongType
+	}
+
+	folderPath := sharedFolderPath(share, subPath)
+	files, err := s.fileRepo.FindByUserIDAndPath(share.UserID, folderPath)
+	if err != nil {
+		return nil, err
+	}
+
+	relativeDir := "/" + strings.TrimPrefix(folderPath, share.FolderPath)
+	entries := make([]models.SharedFolderEntry, 0, len(files))
+	seenDirs := make(map[string]bool)
+
+	for i := range files {
+		file := &files[i]
+		isDir := file.MimeType == "inode/directory"
+		if isDir {
+			// Папка может встречаться дважды: как маркер и как неявная папка с файлами
+			if seenDirs[file.OriginalName] {
+				continue
+			}
+			seenDirs[file.OriginalName] = true
+		}
+
+		entry := models.SharedFolderEntry{
+			Name:      file.OriginalName,
+			Path:      relativeDir + file.OriginalName,
+			IsDir:     isDir,
+			UpdatedAt: file.UpdatedAt,
+		}
+		if !isDir {
+			fileID := file.ID
+			entry.ID = &fileID
+			entry.MimeType = file.MimeType
+			entry.Size = file.Size
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// UploadToFileRequest сохраняет файл посетителя в папку запроса. Файл загружается
+// от имени владельца и учитывается в его квоте.
+func (s *ShareService) UploadToFileRequest(share *models.SharedFile, fileHeader *multipart.FileHeader) (*models.File, error) {
+	if share.Type != models.ShareTypeRequest {
+		return nil, ErrShareWrongType
+	}
+	if share.MaxFileSize != nil && fileHeader.Size > *share.MaxFileSize {
+		return nil, fmt.Errorf("%w: max size is %d bytes", ErrFileTooLarge, *share.MaxFileSize)
+	}
+
+	reserved, err := s.repo.ReserveUpload(share.Token)
+	if err != nil {
+		return nil, err
+	}
+	if !reserved {
+		if share.ExpiresAt != nil && time.Now().After(*share.ExpiresAt) {
+			return nil, ErrShareExpired
+		}
+		return nil, ErrShareLimitReached
+	}
+
+	file, err := s.fileService.UploadRequestFile(share.UserID, fileHeader, share.FolderPath)
+	if err != nil {
+		if releaseErr := s.repo.ReleaseUpload(share.Token); releaseErr != nil {
+			fmt.Printf("Warning: failed to release share upload %s: %v\n", share.Token, releaseErr)
+		}
 		return nil, err
 	}
+	share.Uploads++
+
+	if s.events != nil {
+		s.events.Publish(share.UserID, EventShareUploaded, ShareUploadEventData{
+			Token:   share.Token,
+			File:    newFileEventData(file),
+			Uploads: share.Uploads,
+		})
+	}
 
-	if err := s.fileService.decryptFile(share.File.Path, dst); err != nil {
+	return file, nil
+}
+
+// Доля переданных байт, начиная с которой оборванное скачивание все равно засчитывается
+const shareDownloadCompleteRatio = 0.9
+
+// DownloadClient - кто скачивает по ссылке, для журнала скачиваний
+type DownloadClient struct {
+	IP        string
+	UserAgent string
+}
+
+// ShareDownload - скачивание, под которое в лимите ссылки уже занято место
+type ShareDownload struct {
+	share  *models.SharedFile
+	client DownloadClient
+}
+
+// BeginDownload атомарно занимает одно скачивание в лимите ссылки.
+// Вызывается до отправки заголовков: если лимит исчерпан параллельными запросами,
+// клиент получает ошибку, а не пустой файл.
+func (s *ShareService) BeginDownload(share *models.SharedFile, client DownloadClient) (*ShareDownload, error) {
+	reserved, err := s.repo.ReserveDownload(share.Token)
+	if err != nil {
 		return nil, err
 	}
+	if !reserved {
+		if share.ExpiresAt != nil && time.Now().After(*share.ExpiresAt) {
+			return nil, ErrShareExpired
+		}
+		return nil, ErrShareLimitReached
+	}
 
-	return share, nil
+	share.Downloads++
+	return &ShareDownload{share: share, client: client}, nil
 }
 
-func (s *ShareService) TrackDownload(token string) error {
-	return s.repo.IncrementDownloads(token)
+// finishDownload записывает скачивание в журнал. Оборванная передача, не дошедшая
+// до shareDownloadCompleteRatio, в лимит не засчитывается и освобождает место.
+func (s *ShareService) finishDownload(download *ShareDownload, fileID *uuid.UUID, sent, expected int64, transferErr error) {
+	share := download.share
+	completed := transferErr == nil ||
+		(expected > 0 && float64(sent) >= float64(expected)*shareDownloadCompleteRatio)
+
+	if !completed {
+		if err := s.repo.ReleaseDownload(share.Token); err != nil {
+			fmt.Printf("Warning: failed to release share download %s: %v\n", share.Token, err)
+		}
+		share.Downloads--
+	}
+
+	userAgent := download.client.UserAgent
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	event := &models.ShareDownloadEvent{
+		ShareID:   share.ID,
+		FileID:    fileID,
+		IPHash:    s.hashIP(download.client.IP),
+		UserAgent: userAgent,
+		BytesSent: sent,
+		Completed: completed,
+	}
+	if err := s.repo.CreateDownloadEvent(event); err != nil {
+		fmt.Printf("Warning: failed to log share download %s: %v\n", share.Token, err)
+	}
+
+	if completed {
+		s.emit(share, EventShareDownloaded)
+	}
+}
+
+// hashIP - HMAC адреса на секрете сервера: по журналу видно повторные скачивания,
+// но сам адрес восстановить нельзя
+func (s *ShareService) hashIP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, s.unlockSecret)
+	mac.Write([]byte("share-download-ip|" + ip))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// countingWriter считает байты, реально отданные клиенту
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// GetSharedFolderFile находит файл внутри расшаренной папки (включая подпапки).
+// Как и ListSharedFolder, смотрит только в личное пространство владельца.
+func (s *ShareService) GetSharedFolderFile(share *models.SharedFile, fileID uuid.UUID) (*models.File, error) {
+	if share.Type != models.ShareTypeFolder {
+		return nil, ErrShareWrongType
+	}
+
+	file, err := s.fileRepo.FindPersonalByID(fileID, share.UserID)
+	// Командные файлы хранят user_id загрузившего: в ссылку владельца они не входят
+	if err != nil || file.TeamID != nil || file.MimeType == "inode/directory" ||
+		!strings.HasPrefix(file.VirtualPath, share.FolderPath) {
+		return nil, ErrShareNotFound
+	}
+	return file, nil
+}
+
+func (s *ShareService) DownloadSharedFolderFile(download *ShareDownload, file *models.File, dst io.Writer) error {
+	counter := &countingWriter{w: dst}
+	err := s.fileService.decryptFile(file.Path, counter)
+	fileID := file.ID
+	s.finishDownload(download, &fileID, counter.n, file.Size, err)
+	return err
+}
+
+// DownloadSharedFolderZip отдает всю папку архивом с сохранением структуры подпапок
+func (s *ShareService) DownloadSharedFolderZip(ctx context.Context, download *ShareDownload, dst io.Writer) error {
+	share := download.share
+	if share.Type != models.ShareTypeFolder {
+		s.finishDownload(download, nil, 0, 0, ErrShareWrongType)
+		return ErrShareWrongType
+	}
+
+	files, err := s.fileRepo.FindAllRecursively(share.UserID, share.FolderPath)
+	if err != nil {
+		s.finishDownload(download, nil, 0, 0, err)
+		return fmt.Errorf("failed to get files: %w", err)
+	}
+
+	var total int64
+	regularFiles := make([]models.File, 0, len(files))
+	for _, file := range files {
+		if file.MimeType != "inode/directory" {
+			regularFiles = append(regularFiles, file)
+			total += file.Size
+		}
+	}
+
+	// Считаем расшифрованные байты: размер архива заранее неизвестен
+	var sent int64
+	err = s.fileService.writeFolderZip(ctx, dst, share.FolderPath, regularFiles, total, func(done, _ int64) {
+		sent = done
+	})
+	s.finishDownload(download, nil, sent, total, err)
+	return err
 }
 
 func (s *ShareService) ListUserShares(userID uint) ([]models.SharedFile, error) {
@@ -109,7 +496,12 @@ func (s *ShareService) RevokeShare(userID uint, token string) error {
 		return errors.New("unauthorized")
 	}
 
-	return s.repo.Delete(token)
+	if err := s.repo.Delete(token); err != nil {
+		return err
+	}
+
+	s.emit(share, EventShareRevoked)
+	return nil
 }
 
 func generateToken(length int) (string, error) {
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+	"golang.org/x/crypto/ssh"
+)
+
+const maxSSHKeysPerUser = 20
+
+var (
+	ErrSSHKeyNotFound = errors.New("ssh key not found")
+	ErrSSHKeyInvalid  = errors.New("invalid public key")
+	ErrSSHKeyExists   = errors.New("ssh key already registered")
+	ErrTooManySSHKeys = errors.New("too many ssh keys")
+)
+
+type SSHKeyService struct {
+	keyRepo  *repositories.SSHKeyRepository
+	userRepo *repositories.UserRepository
+}
+
+func NewSSHKeyService(keyRepo *repositories.SSHKeyRepository, userRepo *repositories.UserRepository) *SSHKeyService {
+	return &SSHKeyService{keyRepo: keyRepo, userRepo: userRepo}
+}
+
+// AddKey регистрирует ключ из строки формата authorized_keys ("ssh-ed25519 AAAA... comment")
+func (s *SSHKeyService) AddKey(userID uint, name, publicKey string) (*models.SSHKey, error) {
+	parsed, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(publicKey)))
+	if err != nil {
+		return nil, ErrSSHKeyInvalid
+	}
+
+	fingerprint := ssh.FingerprintSHA256(parsed)
+	existing, err := s.keyRepo.FindByFingerprint(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrSSHKeyExists
+	}
+
+	keys, err := s.keyRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) >= maxSSHKeysPerUser {
+		return nil, ErrTooManySSHKeys
+	}
+
+	if name == "" {
+		name = comment
+	}
+
+	key := &models.SSHKey{
+		UserID:      userID,
+		Name:        name,
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(parsed))),
+		Fingerprint: fingerprint,
+	}
+	if err := s.keyRepo.Create(key); err != nil {
+		return nil, fmt.Errorf("failed to save ssh key: %w", err)
+	}
+	return key, nil
+}
+
+func (s *SSHKeyService) ListKeys(userID uint) ([]models.SSHKey, error) {
+	return s.keyRepo.FindByUserID(userID)
+}
+
+func (s *SSHKeyService) DeleteKey(id uint, userID uint) error {
+	deleted, err := s.keyRepo.Delete(id, userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrSSHKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateKey находит владельца ключа. Логин (имя пользователя или email)
+// должен совпадать с владельцем, иначе чужой ключ открывал бы любой аккаунт.
+func (s *SSHKeyService) AuthenticateKey(login string, publicKey ssh.PublicKey) (*models.User, error) {
+	key, err := s.keyRepo.FindByFingerprint(ssh.FingerprintSHA256(publicKey))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, ErrSSHKeyNotFound
+	}
+
+	user, err := s.userRepo.FindByID(key.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || (user.Username != login && user.Email != login) {
+		return nil, ErrSSHKeyNotFound
+	}
+	if user.IsDisabled() {
+		return nil, ErrAccountDisabled
+	}
+	return user, nil
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+)
+
+const JobTypeSyncCompact = "sync_compact"
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type SyncService struct {
+	changeRepo *repositories.FileChangeRepository
+	fileRepo   *repositories.FileRepository
+	retention  time.Duration
+}
+
+func NewSyncService(changeRepo *repositories.FileChangeRepository, fileRepo *repositories.FileRepository, retention time.Duration) *SyncService {
+	return &SyncService{
+		changeRepo: changeRepo,
+		fileRepo:   fileRepo,
+		retention:  retention,
+	}
+}
+
+// RegisterJobs регистрирует периодическое сжатие журнала изменений
+func (s *SyncService) RegisterJobs(jobs *JobService) {
+	if s.retention <= 0 {
+		return
+	}
+	jobs.Register(JobTypeSyncCompact, s.runCompactJob, nil)
+	jobs.Schedule(JobTypeSyncCompact, time.Hour)
+}
+
+// GetChanges возвращает изменения после cursor. Пустой или устаревший курсор
+// возвращает Reset=true: клиент должен сделать полный снимок через GetSnapshot.
+func (s *SyncService) GetChanges(userID uint, cursor string, limit int) (*models.SyncChangesResponse, error) {
+	if cursor == "" {
+		return &models.SyncChangesResponse{Changes: []models.FileChange{}, Reset: true}, nil
+	}
+
+	seq, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	watermark, err := s.changeRepo.Watermark(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check journal state: %w", err)
+	}
+	if seq < watermark {
+		return &models.SyncChangesResponse{Changes: []models.FileChange{}, Cursor: cursor, Reset: true}, nil
+	}
+
+	changes, err := s.changeRepo.FindSince(userID, seq, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changes: %w", err)
+	}
+
+	hasMore := len(changes) > limit
+	if hasMore {
+		changes = changes[:limit]
+	}
+
+	nextCursor := seq
+	if len(changes) > 0 {
+		nextCursor = changes[len(changes)-1].Seq
+	}
+
+	return &models.SyncChangesResponse{
+		Changes: changes,
+		Cursor:  strconv.FormatUint(nextCursor, 10),
+		HasMore: hasMore,
+	}, nil
+}
+
+// GetSnapshot возвращает все активные файлы пользователя и курсор, с которого продолжать синхронизацию.
+// Курсор берется до чтения файлов: изменения между шагами придут повторно, а не потеряются.
+func (s *SyncService) GetSnapshot(userID uint) (*models.SyncSnapshotResponse, error) {
+	seq, err := s.changeRepo.LatestSeq(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor: %w", err)
+	}
+
+	files, err := s.fileRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files: %w", err)
+	}
+
+	return &models.SyncSnapshotResponse{
+		Files:  files,
+		Cursor: strconv.FormatUint(seq, 10),
+	}, nil
+}
+
+func (s *SyncService) runCompactJob(ctx context.Context, job *models.Job, progress JobProgressFunc) (interface{}, error) {
+	deleted, err := s.changeRepo.Compact(time.Now().Add(-s.retention))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compact journal: %w", err)
+	}
+	progress(deleted, deleted)
+	return map[string]int64{"deleted": deleted}, nil
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+)
+
+var (
+	ErrTeamNotFound       = errors.New("team not found")
+	ErrTeamForbidden      = errors.New("only team owners can manage members")
+	ErrTeamUserNotFound   = errors.New("user not found")
+	ErrTeamMemberNotFound = errors.New("team member not found")
+	ErrTeamLastOwner      = errors.New("team must keep at least one owner")
+)
+
+// TeamService управляет командами и их участниками.
+// Файлы пространства команды обслуживает FileService (см. file_service_teams.go).
+type TeamService struct {
+	repo        *repositories.TeamRepository
+	userRepo    *repositories.UserRepository
+	fileService *FileService
+}
+
+func NewTeamService(repo *repositories.TeamRepository, userRepo *repositories.UserRepository, fileService *FileService) *TeamService {
+	return &TeamService{repo: repo, userRepo: userRepo, fileService: fileService}
+}
+
+// CreateTeam создает команду, создатель становится ее владельцем
+func (s *TeamService) CreateTeam(userID uint, name string) (*models.TeamResponse, error) {
+	team := &models.Team{Name: strings.TrimSpace(name)}
+	if err := s.repo.Create(team, userID); err != nil {
+		return nil, fmt.Errorf("failed to create team: %w", err)
+	}
+	return s.toResponse(team, models.TeamRoleOwner, nil)
+}
+
+// ListTeams - команды пользователя с его ролью и занятым местом
+func (s *TeamService) ListTeams(userID uint) ([]models.TeamResponse, error) {
+	teams, err := s.repo.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.TeamResponse, 0, len(teams))
+	for i := range teams {
+		member, err := s.repo.FindMember(teams[i].ID, userID)
+		if err != nil || member == nil {
+			continue
+		}
+		resp, err := s.toResponse(&teams[i], member.Role, nil)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, *resp)
+	}
+	return responses, nil
+}
+
+// GetTeam возвращает команду со списком участников; доступно только участникам
+func (s *TeamService) GetTeam(teamID, userID uint) (*models.TeamResponse, error) {
+	team, member, err := s.membership(teamID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.repo.FindMembers(teamID)
+	if err != nil {
+		return nil, err
+	}
+	return s.toResponse(team, member.Role, members)
+}
+
+// AddMember добавляет пользователя в команду или меняет его роль
+func (s *TeamService) AddMember(teamID, userID uint, req *models.AddTeamMemberRequest) (*models.TeamMemberResponse, error) {
+	if _, err := s.requireOwner(teamID, userID); err != nil {
+		return nil, err
+	}
+
+	find := s.userRepo.FindByUsername
+	if strings.Contains(req.User, "@") {
+		find = s.userRepo.FindByEmail
+	}
+	user, err := find(strings.TrimSpace(req.User))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrTeamUserNotFound
+	}
+
+	if err := s.changeRole(teamID, user.ID, req.Role); err != nil {
+		return nil, err
+	}
+
+	member, err := s.repo.FindMember(teamID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	member.User = *user
+	resp := toTeamMemberResponse(member)
+	return &resp, nil
+}
+
+// UpdateMember меняет роль участника
+func (s *TeamService) UpdateMember(teamID, userID, memberID uint, role string) error {
+	if _, err := s.requireOwner(teamID, userID); err != nil {
+		return err
+	}
+
+	member, err := s.repo.FindMember(teamID, memberID)
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		return ErrTeamMemberNotFound
+	}
+	return s.changeRole(teamID, memberID, role)
+}
+
+// RemoveMember исключает участника (или участник выходит сам). Файлы, которые он
+// загрузил, остаются в команде; доступ пропадает сразу, так как права проверяются по членству.
+func (s *TeamService) RemoveMember(teamID, userID, memberID uint) error {
+	if memberID == userID {
+		if _, _, err := s.membership(teamID, userID); err != nil {
+			return err
+		}
+	} else if _, err := s.requireOwner(teamID, userID); err != nil {
+		return err
+	}
+
+	member, err := s.repo.FindMember(teamID, memberID)
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		return ErrTeamMemberNotFound
+	}
+	if member.Role == models.TeamRoleOwner {
+		if err := s.ensureAnotherOwner(teamID); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.repo.RemoveMember(teamID, memberID)
+	return err
+}
+
+// changeRole сохраняет роль, не давая команде остаться без владельца
+func (s *TeamService) changeRole(teamID, memberID uint, role string) error {
+	current, err := s.repo.FindMember(teamID, memberID)
+	if err != nil {
+		return err
+	}
+	if current != nil && current.Role == models.TeamRoleOwner && role != models.TeamRoleOwner {
+		if err := s.ensureAnotherOwner(teamID); err != nil {
+			return err
+		}
+	}
+
+	return s.repo.SaveMember(&models.TeamMember{TeamID: teamID, UserID: memberID, Role: role})
+}
+
+func (s *TeamService) ensureAnotherOwner(teamID uint) error {
+	owners, err := s.repo.CountOwners(teamID)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return ErrTeamLastOwner
+	}
+	return nil
+}
+
+// membership возвращает команду и участие пользователя; посторонним команда "не найдена"
+func (s *TeamService) membership(teamID, userID uint) (*models.Team, *models.TeamMember, error) {
+	team, err := s.repo.FindByID(teamID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if team == nil {
+		return nil, nil, ErrTeamNotFound
+	}
+
+	member, err := s.repo.FindMember(teamID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if member == nil {
+		return nil, nil, ErrTeamNotFound
+	}
+	return team, member, nil
+}
+
+func (s *TeamService) requireOwner(teamID, userID uint) (*models.Team, error) {
+	team, member, err := s.membership(teamID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if member.Role != models.TeamRoleOwner {
+		return nil, ErrTeamForbidden
+	}
+	return team, nil
+}
+
+func (s *TeamService) toResponse(team *models.Team, role string, members []models.TeamMember) (*models.TeamResponse, error) {
+	used, err := s.fileService.TeamStorageUsed(team.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.TeamResponse{
+		ID:           team.ID,
+		Name:         team.Name,
+		Role:         role,
+		StorageUsed:  used,
+		StorageLimit: s.fileService.TeamStorageLimit(team),
+		CreatedAt:    team.CreatedAt,
+	}
+	for i := range members {
+		resp.Members = append(resp.Members, toTeamMemberResponse(&members[i]))
+	}
+	return resp, nil
+}
+
+func toTeamMemberResponse(member *models.TeamMember) models.TeamMemberResponse {
+	return models.TeamMemberResponse{
+		UserID:   member.UserID,
+		Username: member.User.Username,
+		Role:     member.Role,
+		JoinedAt: member.CreatedAt,
+	}
+}
+
+// LeaveAllTeams убирает пользователя из всех команд перед удалением аккаунта.
+// Если он был единственным владельцем, владельцем становится самый давний
+// из оставшихся участников; команда без участников остается как есть.
+func (s *TeamService) LeaveAllTeams(userID uint) error {
+	teams, err := s.repo.FindByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, team := range teams {
+		member, err := s.repo.FindMember(team.ID, userID)
+		if err != nil {
+			return err
+		}
+		if member == nil {
+			continue
+		}
+
+		if member.Role == models.TeamRoleOwner {
+			owners, err := s.repo.CountOwners(team.ID)
+			if err != nil {
+				return err
+			}
+			if owners <= 1 {
+				if err := s.handOverOwnership(team.ID, userID); err != nil {
+					return err
+				}
+			}
+		}
+
+		if _, err := s.repo.RemoveMember(team.ID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *TeamService) handOverOwnership(teamID, leavingID uint) error {
+	members, err := s.repo.FindMembers(teamID)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member.UserID == leavingID {
+			continue
+		}
+		member.Role = models.TeamRoleOwner
+		return s.repo.SaveMember(&member)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Тестам с базой нужна настоящая Postgres: блокировки строк, точки сохранения
+// и FILTER в SQLite не проверить. Без TEST_DATABASE_DSN они пропускаются:
+//
+//	TEST_DATABASE_DSN="host=localhost port=5433 user=postgres password=postgres dbname=0x40_cloud_test sslmode=disable" go test ./...
+const testEncryptionKey = "0123456789abcdef0123456789abcdef"
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.File{}, &models.StarredFile{}, &models.StarredFolder{},
+		&models.SharedFile{}, &models.FileGrant{}, &models.Team{}, &models.TeamMember{},
+		&models.StorageUsage{}, &models.QuotaReservation{}, &models.FileChange{}, &models.FileChangeWatermark{},
+		&models.Vault{}, &models.RecoveryCode{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get database handle: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// newTestFileService собирает FileService так же, как main.go, но на временном каталоге
+func newTestFileService(t *testing.T, db *gorm.DB) *FileService {
+	t.Helper()
+
+	service, err := NewFileService(repositories.NewFileRepository(db), repositories.NewStarredFileRepository(db),
+		repositories.NewStarredFolderRepository(db), t.TempDir(), testEncryptionKey, 1<<30, 1<<30)
+	if err != nil {
+		t.Fatalf("failed to create file service: %v", err)
+	}
+	service.SetGrantRepository(repositories.NewFileGrantRepository(db))
+	service.SetTeamRepository(repositories.NewTeamRepository(db), 1<<30)
+	service.SetUserRepository(repositories.NewUserRepository(db))
+	service.SetStorageUsageRepository(repositories.NewStorageUsageRepository(db))
+	service.SetShareRepository(repositories.NewSharedFileRepository(db))
+	service.SetVaultRepository(repositories.NewVaultRepository(db))
+	return service
+}
+
+// createTestUser создает пользователя и удаляет его данные после теста
+func createTestUser(t *testing.T, db *gorm.DB) *models.User {
+	t.Helper()
+
+	name := "test-" + uuid.NewString()[:8]
+	user := &models.User{Username: name, Email: name + "@example.com", Password: "-"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	t.Cleanup(func() {
+		for _, table := range []string{"files", "file_changes", "file_change_watermarks", "storage_usages", "quota_reservations", "recovery_codes"} {
+			db.Exec("DELETE FROM "+table+" WHERE user_id = ?", user.ID)
+		}
+		db.Unscoped().Delete(user)
+	})
+	return user
+}
+
+func storeTestFile(t *testing.T, service *FileService, userID uint, virtualPath, name, content string) *models.File {
+	t.Helper()
+
+	file, err := service.StoreFile(userID, strings.NewReader(content), int64(len(content)), name, "text/plain", virtualPath)
+	if err != nil {
+		t.Fatalf("failed to store %s: %v", name, err)
+	}
+	return file
+}
+
+// testUsage - счетчик пользователя и число действующих резервов
+func testUsage(t *testing.T, db *gorm.DB, userID uint) (models.StorageUsage, int64) {
+	t.Helper()
+
+	var usage models.StorageUsage
+	if err := db.Where("user_id = ?", userID).First(&usage).Error; err != nil {
+		t.Fatalf("failed to read storage usage: %v", err)
+	}
+	var reservations int64
+	if err := db.Model(&models.QuotaReservation{}).Where("user_id = ?", userID).Count(&reservations).Error; err != nil {
+		t.Fatalf("failed to count reservations: %v", err)
+	}
+	return usage, reservations
+}
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// Допустимый сдвиг часов телефона - по одному шагу в каждую сторону
+	totpSkew = 1
+
+	recoveryCodeCount    = 10
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+	// Pre-auth токен живет, пока пользователь достает телефон, и выдерживает
+	// несколько опечаток. Дальше нужно снова вводить пароль.
+	preAuthTTL         = 5 * time.Minute
+	preAuthMaxAttempts = 5
+)
+
+var (
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotPending     = errors.New("two-factor setup was not started")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrInvalidPreAuthToken     = errors.New("invalid or expired pre-auth token")
+	ErrTwoFactorRequired       = errors.New("two-factor authentication is enabled, password login is not available here")
+)
+
+// TwoFactorService - второй фактор входа: TOTP (RFC 6238) и одноразовые коды
+// восстановления. Между паролем и кодом пользователь держит pre-auth токен,
+// который хранится в Redis (2fa:challenge:<token>) и не дает доступа к API.
+type TwoFactorService struct {
+	repo          *repositories.TwoFactorRepository
+	userRepo      *repositories.UserRepository
+	redis         *redis.Client
+	encryptionKey []byte
+	issuer        string
+}
+
+func NewTwoFactorService(repo *repositories.TwoFactorRepository, userRepo *repositories.UserRepository, redis *redis.Client, encryptionKey string, issuer string) *TwoFactorService {
+	return &TwoFactorService{
+		repo:          repo,
+		userRepo:      userRepo,
+		redis:         redis,
+		encryptionKey: []byte(encryptionKey),
+		issuer:        issuer,
+	}
+}
+
+func (s *TwoFactorService) findUser(userID uint) (*models.User, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *TwoFactorService) Status(userID uint) (*models.TwoFactorStatusResponse, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.TwoFactorStatusResponse{
+		Enabled: user.TwoFactorEnabled(),
+		Pending: !user.TwoFactorEnabled() && user.TOTPSecret != "",
+	}
+	if status.Enabled {
+		status.RecoveryCodesLeft, err = s.repo.CountRecoveryCodes(userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// BeginSetup выдает новый секрет. 2FA включится только после Enable
+// с кодом из приложения, до этого вход работает по одному паролю.
+func (s *TwoFactorService) BeginSetup(userID uint) (*models.TwoFactorSetupResponse, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)
+
+	sealed, err := sealString(s.encryptionKey, secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetPendingSecret(userID, sealed); err != nil {
+		return nil, fmt.Errorf("failed to save secret: %w", err)
+	}
+
+	return &models.TwoFactorSetupResponse{
+		Secret: secret,
+		URI:    s.otpauthURI(user.Email, secret),
+	}, nil
+}
+
+// Enable подтверждает выданный секрет первым кодом и возвращает коды восстановления
+func (s *TwoFactorService) Enable(userID uint, code string) ([]string, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotPending
+	}
+
+	secret, err := openString(s.encryptionKey, user.TOTPSecret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := matchTOTP(secret, normalizeCode(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := s.repo.Enable(userID, step, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	if !enabled {
+		// Параллельный запрос уже включил 2FA или выдал новый секрет
+		return nil, ErrTwoFactorNotPending
+	}
+	return codes, nil
+}
+
+// Disable выключает 2FA; нужен действующий код, чтобы украденная сессия
+// не могла снять второй фактор
+func (s *TwoFactorService) Disable(userID uint, code string) error {
+	if err := s.VerifyCode(userID, code); err != nil {
+		return err
+	}
+	return s.repo.Disable(userID)
+}
+
+// RegenerateRecoveryCodes заменяет все коды восстановления новыми
+func (s *TwoFactorService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	if err := s.VerifyCode(userID, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// Reset - сброс 2FA администратором, когда пользователь потерял и телефон, и коды
+func (s *TwoFactorService) Reset(userID uint) error {
+	if _, err := s.findUser(userID); err != nil {
+		return err
+	}
+	return s.repo.Disable(userID)
+}
+
+// VerifyCode принимает код TOTP или код восстановления. Каждый код
+// срабатывает один раз: TOTP - по номеру шага, код восстановления гасится.
+func (s *TwoFactorService) VerifyCode(userID uint, code string) error {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled() {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = normalizeCode(code)
+	if isTOTPCode(code) {
+		secret, err := openString(s.encryptionKey, user.TOTPSecret)
+		if err != nil {
+			return err
+		}
+		step, ok := matchTOTP(secret, code, time.Now())
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		fresh, err := s.repo.UseStep(userID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	used, err := s.repo.UseRecoveryCode(userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func preAuthKey(token string) string {
+	return "2fa:challenge:" + token
+}
+
+// CreateChallenge выдает pre-auth токен после верного пароля
+func (s *TwoFactorService) CreateChallenge(ctx context.Context, userID uint) (string, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate pre-auth token: %w", err)
+	}
+
+	key := preAuthKey(token)
+	pipe := s.redis.TxPipeline()
+	pipe.HSet(ctx, key, "user_id", userID)
+	pipe.Expire(ctx, key, preAuthTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", fmt.Errorf("failed to save pre-auth token: %w", err)
+	}
+	return token, nil
+}
+
+// CompleteChallenge проверяет код для pre-auth токена и возвращает пользователя.
+// Токен одноразовый и сгорает после preAuthMaxAttempts неверных кодов.
+// При неверном коде пользователь возвращается вместе с ошибкой.
+func (s *TwoFactorService) CompleteChallenge(ctx context.Context, token, code string) (uint, error) {
+	key := preAuthKey(token)
+
+	pipe := s.redis.TxPipeline()
+	attempts := pipe.HIncrBy(ctx, key, "attempts", 1)
+	userIDField := pipe.HGet(ctx, key, "user_id")
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+
+	userID, err := strconv.ParseUint(userIDField.Val(), 10, 64)
+	if err != nil || attempts.Val() > preAuthMaxAttempts {
+		// HINCRBY создает ключ без TTL, если токен уже истек
+		s.redis.Del(ctx, key)
+		return 0, ErrInvalidPreAuthToken
+	}
+
+	if err := s.VerifyCode(uint(userID), code); err != nil {
+		// Пользователь нужен вызывающему, чтобы засчитать неудачу в блокировку аккаунта
+		return uint(userID), err
+	}
+
+	deleted, err := s.redis.Del(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if deleted == 0 {
+		// Токен уже использован параллельным запросом
+		return 0, ErrInvalidPreAuthToken
+	}
+	return uint(userID), nil
+}
+
+func (s *TwoFactorService) otpauthURI(account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", s.issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(totpDigits))
+	query.Set("period", strconv.Itoa(totpPeriod))
+
+	label := url.PathEscape(s.issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// totpCode - код RFC 6238 (HOTP по номеру 30-секундного шага)
+func totpCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// matchTOTP ищет шаг, которому соответствует код, с учетом сдвига часов
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	if !isTOTPCode(code) {
+		return 0, false
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeCode убирает пробелы и дефисы, которые пользователи копируют вместе с кодом
+func normalizeCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateRecoveryCodes возвращает коды для показа (xxxxx-xxxxx) и их хэши
+func generateRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := randomString(recoveryCodeAlphabet, 10)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashRecoveryCode(raw))
+	}
+	return codes, hashes, nil
+}
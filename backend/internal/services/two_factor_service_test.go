@@ -0,0 +1,169 @@
+package services
+
+import (
+	"encoding/base32"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/repositories"
+)
+
+// Секрет из приложения B RFC 6238 для HMAC-SHA1
+const rfc6238Secret = "12345678901234567890"
+
+var rfc6238SecretBase32 = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(rfc6238Secret))
+
+// В RFC коды 8-значные; 6-значный код - те же младшие разряды
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode([]byte(rfc6238Secret), tt.unix/totpPeriod); got != tt.code {
+			t.Errorf("T=%d: code = %s, want %s", tt.unix, got, tt.code)
+		}
+
+		step, ok := matchTOTP(rfc6238SecretBase32, tt.code, time.Unix(tt.unix, 0))
+		if !ok || step != tt.unix/totpPeriod {
+			t.Errorf("T=%d: matchTOTP = (%d, %v), want (%d, true)", tt.unix, step, ok, tt.unix/totpPeriod)
+		}
+	}
+}
+
+// Код принимается на шаг раньше и на шаг позже, но не дальше
+func TestMatchTOTPWindow(t *testing.T) {
+	// 1111111111 - середина шага 37037037
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	for offset := int64(-3); offset <= 3; offset++ {
+		code := totpCode([]byte(rfc6238Secret), current+offset)
+		step, ok := matchTOTP(rfc6238SecretBase32, code, now)
+
+		wantOK := offset >= -totpSkew && offset <= totpSkew
+		if ok != wantOK {
+			t.Errorf("offset %d: accepted = %v, want %v", offset, ok, wantOK)
+		}
+		if ok && step != current+offset {
+			t.Errorf("offset %d: step = %d, want %d", offset, step, current+offset)
+		}
+	}
+}
+
+func TestMatchTOTPRejectsMalformedInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, tt := range []struct{ secret, code string }{
+		{rfc6238SecretBase32, "28708"},
+		{rfc6238SecretBase32, "2870822"},
+		{rfc6238SecretBase32, "28708a"},
+		{rfc6238SecretBase32, ""},
+		{"not base32!", "287082"},
+	} {
+		if _, ok := matchTOTP(tt.secret, tt.code, now); ok {
+			t.Errorf("secret %q, code %q accepted", tt.secret, tt.code)
+		}
+	}
+}
+
+func TestNormalizeCode(t *testing.T) {
+	for input, want := range map[string]string{
+		" 287 082 ":     "287082",
+		"ABCDE-FGHJK":   "abcdefghjk",
+		" abcde fghjk ": "abcdefghjk",
+	} {
+		if got := normalizeCode(input); got != want {
+			t.Errorf("normalizeCode(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+// newTestTwoFactor включает 2FA тестовому пользователю и возвращает ключ TOTP,
+// шаг кода, которым 2FA включена, и коды восстановления. Redis для VerifyCode не нужен.
+func newTestTwoFactor(t *testing.T) (*TwoFactorService, uint, []byte, int64, []string) {
+	t.Helper()
+
+	db := openTestDB(t)
+	user := createTestUser(t, db)
+	service := NewTwoFactorService(repositories.NewTwoFactorRepository(db), repositories.NewUserRepository(db),
+		nil, testEncryptionKey, "0x40 Cloud")
+
+	setup, err := service.BeginSetup(user.ID)
+	if err != nil {
+		t.Fatalf("BeginSetup: %v", err)
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(setup.Secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+
+	step := time.Now().Unix() / totpPeriod
+	codes, err := service.Enable(user.ID, totpCode(key, step))
+	if err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+	return service, user.ID, key, step, codes
+}
+
+func TestVerifyCodeRejectsReusedStep(t *testing.T) {
+	service, userID, key, current, _ := newTestTwoFactor(t)
+
+	// Код, которым включали 2FA, уже использован
+	if err := service.VerifyCode(userID, totpCode(key, current)); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("code used for Enable: err = %v, want %v", err, ErrInvalidTwoFactorCode)
+	}
+
+	next := totpCode(key, current+1)
+	if err := service.VerifyCode(userID, next); err != nil {
+		t.Fatalf("next step: %v", err)
+	}
+	if err := service.VerifyCode(userID, next); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("replayed code: err = %v, want %v", err, ErrInvalidTwoFactorCode)
+	}
+	// Более ранний шаг после позднего тоже не принимается
+	if err := service.VerifyCode(userID, totpCode(key, current-1)); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("older step after newer one: err = %v, want %v", err, ErrInvalidTwoFactorCode)
+	}
+}
+
+func TestVerifyCodeRecoveryCodesAreSingleUse(t *testing.T) {
+	service, userID, _, _, codes := newTestTwoFactor(t)
+
+	if err := service.VerifyCode(userID, codes[0]); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := service.VerifyCode(userID, codes[0]); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("second use: err = %v, want %v", err, ErrInvalidTwoFactorCode)
+	}
+
+	// Код вводят как угодно: с пробелами, без дефиса, заглавными
+	typed := " " + strings.ToUpper(strings.Replace(codes[1], "-", " ", 1)) + " "
+	if err := service.VerifyCode(userID, typed); err != nil {
+		t.Errorf("code typed as %q: %v", typed, err)
+	}
+
+	if err := service.VerifyCode(userID, "aaaaa-aaaaa"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("unknown code: err = %v, want %v", err, ErrInvalidTwoFactorCode)
+	}
+
+	status, err := service.Status(userID)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if status.RecoveryCodesLeft != recoveryCodeCount-2 {
+		t.Errorf("recovery codes left = %d, want %d", status.RecoveryCodesLeft, recoveryCodeCount-2)
+	}
+}
@@ -0,0 +1,457 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+
+	"github.com/bhop_dynasty/0x40_cloud/internal/models"
+	"golang.org/x/net/webdav"
+)
+
+var errWriteAborted = errors.New("write aborted")
+
+// VirtualFS представляет дерево VirtualPath пользователя как файловую систему.
+// Реализует webdav.FileSystem; все изменения идут через FileService,
+// поэтому шифрование, дедупликация, квота и журнал работают как при загрузке через API.
+type VirtualFS struct {
+	files  *FileService
+	userID uint
+}
+
+func (s *FileService) VirtualFS(userID uint) *VirtualFS {
+	return &VirtualFS{files: s, userID: userID}
+}
+
+// splitVirtualName разбивает "/a/b/c.txt" на папку "/a/b/" и имя "c.txt"
+func splitVirtualName(name string) (string, string) {
+	clean := path.Clean("/" + name)
+	if clean == "/" {
+		return "/", ""
+	}
+	return normalizeFolderPath(path.Dir(clean)), path.Base(clean)
+}
+
+// lookup находит файл по имени. Для папок возвращает (nil, true).
+func (v *VirtualFS) lookup(name string) (*models.File, bool, error) {
+	dir, base := splitVirtualName(name)
+	if base == "" {
+		return nil, true, nil
+	}
+
+	files, err := v.files.fileRepo.FindByPathAndName(v.userID, dir, base)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var regular *models.File
+	for i := range files {
+		if files[i].MimeType == "inode/directory" {
+			return &files[i], true, nil
+		}
+		if regular == nil {
+			regular = &files[i]
+		}
+	}
+	if regular != nil {
+		return regular, false, nil
+	}
+
+	// Папки без маркера существуют, пока в них есть файлы
+	hasChildren, err := v.files.fileRepo.HasFilesUnderPath(v.userID, dir+base+"/")
+	if err != nil {
+		return nil, false, err
+	}
+	if hasChildren {
+		return nil, true, nil
+	}
+
+	return nil, false, os.ErrNotExist
+}
+
+func (v *VirtualFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	file, isDir, err := v.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	_, base := splitVirtualName(name)
+	return newVirtualFileInfo(base, file, isDir), nil
+}
+
+func (v *VirtualFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	dir, base := splitVirtualName(name)
+	if base == "" {
+		return os.ErrExist
+	}
+
+	if _, _, err := v.lookup(name); err == nil {
+		return os.ErrExist
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if _, isDir, err := v.lookup(dir); err != nil || !isDir {
+		return os.ErrNotExist
+	}
+
+	_, err := v.files.CreateFolder(v.userID, dir, base)
+	return err
+}
+
+func (v *VirtualFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	file, isDir, err := v.lookup(name)
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0 {
+		if exists && isDir {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+		}
+		if exists && flag&os.O_EXCL != 0 {
+			return nil, os.ErrExist
+		}
+		if !exists && flag&os.O_CREATE == 0 {
+			return nil, os.ErrNotExist
+		}
+
+		dir, base := splitVirtualName(name)
+		if _, parentIsDir, err := v.lookup(dir); err != nil || !parentIsDir {
+			return nil, os.ErrNotExist
+		}
+		return v.newWriter(dir, base), nil
+	}
+
+	if !exists {
+		return nil, os.ErrNotExist
+	}
+
+	_, base := splitVirtualName(name)
+	info := newVirtualFileInfo(base, file, isDir)
+
+	if isDir {
+		dir, _ := splitVirtualName(name)
+		dirPath := dir + base + "/"
+		if base == "" {
+			dirPath = "/"
+		}
+		return &virtualDir{fs: v, path: dirPath, info: info}, nil
+	}
+
+	reader, err := v.files.OpenDecrypted(file)
+	if err != nil {
+		return nil, err
+	}
+	return &virtualFile{ReadSeekCloser: reader, info: info}, nil
+}
+
+func (v *VirtualFS) RemoveAll(ctx context.Context, name string) error {
+	file, isDir, err := v.lookup(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !isDir {
+		return v.files.DeleteFile(file.ID, v.userID)
+	}
+
+	dir, base := splitVirtualName(name)
+	if base == "" {
+		return os.ErrPermission
+	}
+	_, err = v.files.deleteFolderRecursive(ctx, dir+base+"/", v.userID, func(int64, int64) {})
+	return err
+}
+
+func (v *VirtualFS) Rename(ctx context.Context, oldName, newName string) error {
+	file, isDir, err := v.lookup(oldName)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := v.lookup(newName); err == nil {
+		return os.ErrExist
+	}
+
+	oldDir, oldBase := splitVirtualName(oldName)
+	newDir, newBase := splitVirtualName(newName)
+	if oldBase == "" || newBase == "" {
+		return os.ErrPermission
+	}
+	if _, parentIsDir, err := v.lookup(newDir); err != nil || !parentIsDir {
+		return os.ErrNotExist
+	}
+
+	if isDir {
+		return v.files.MoveFolder(v.userID, oldDir+oldBase+"/", newDir+newBase+"/")
+	}
+
+	switch {
+	case newDir != oldDir && newBase != oldBase:
+		_, err = v.files.MoveAndRenameFile(file.ID, v.userID, newDir, newBase)
+	case newDir != oldDir:
+		_, err = v.files.MoveFile(file.ID, v.userID, newDir)
+	case newBase != oldBase:
+		_, err = v.files.RenameFile(file.ID, v.userID, newBase)
+	}
+	return err
+}
+
+// newWriter возвращает файл для записи: данные потоком уходят в StoreFile через pipe,
+// поэтому открытый текст не попадает на диск даже временно
+func (v *VirtualFS) newWriter(dir, base string) *virtualWriter {
+	pr, pw := io.Pipe()
+	w := &virtualWriter{
+		fs:   v,
+		dir:  dir,
+		name: base,
+		pw:   pw,
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(w.done)
+		w.file, w.err = v.files.StoreFile(v.userID, pr, -1, base, "", dir)
+		pr.CloseWithError(w.err)
+	}()
+
+	return w
+}
+
+type virtualWriter struct {
+	fs      *VirtualFS
+	dir     string
+	name    string
+	pw      *io.PipeWriter
+	written int64
+	done    chan struct{}
+	file    *models.File
+	err     error
+	closed  bool
+}
+
+func (w *virtualWriter) Write(p []byte) (int, error) {
+	n, err := w.pw.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Close дожидается сохранения и заменяет предыдущую версию файла (она уходит в корзину)
+func (w *virtualWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+
+	w.pw.Close()
+	<-w.done
+	if w.err != nil {
+		return w.err
+	}
+
+	return w.fs.files.replaceOlderVersions(w.file)
+}
+
+// Abort прерывает запись без сохранения: StoreFile получает ошибку и удаляет временный файл.
+// Нужен протоколам, где обрыв соединения не должен оставлять обрезанный файл (SFTP).
+func (w *virtualWriter) Abort() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+
+	w.pw.CloseWithError(errWriteAborted)
+	<-w.done
+	if w.err == nil {
+		w.err = errWriteAborted
+	}
+}
+
+func (w *virtualWriter) Read(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (w *virtualWriter) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekCurrent && offset == 0 {
+		return w.written, nil
+	}
+	if whence == io.SeekStart && offset == w.written {
+		return w.written, nil
+	}
+	return 0, errors.New("seek is not supported while writing")
+}
+
+func (w *virtualWriter) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (w *virtualWriter) Stat() (fs.FileInfo, error) {
+	if w.file != nil {
+		return newVirtualFileInfo(w.name, w.file, false), nil
+	}
+	return &virtualFileInfo{name: w.name, size: w.written, modTime: time.Now()}, nil
+}
+
+type virtualFile struct {
+	io.ReadSeekCloser
+	info *virtualFileInfo
+}
+
+func (f *virtualFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (f *virtualFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (f *virtualFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+type virtualDir struct {
+	fs      *VirtualFS
+	path    string
+	info    *virtualFileInfo
+	entries []fs.FileInfo
+	loaded  bool
+	pos     int
+}
+
+func (d *virtualDir) load() error {
+	if d.loaded {
+		return nil
+	}
+
+	files, err := d.fs.files.fileRepo.FindByUserIDAndPath(d.fs.userID, d.path)
+	if err != nil {
+		return err
+	}
+
+	// Папка может встречаться дважды: как маркер и как неявная папка с файлами
+	seenDirs := make(map[string]bool)
+	for i := range files {
+		file := &files[i]
+		isDir := file.MimeType == "inode/directory"
+		if isDir {
+			if seenDirs[file.OriginalName] {
+				continue
+			}
+			seenDirs[file.OriginalName] = true
+		}
+		d.entries = append(d.entries, newVirtualFileInfo(file.OriginalName, file, isDir))
+	}
+
+	d.loaded = true
+	return nil
+}
+
+func (d *virtualDir) Readdir(count int) ([]fs.FileInfo, error) {
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+
+	if count <= 0 {
+		entries := d.entries[d.pos:]
+		d.pos = len(d.entries)
+		return entries, nil
+	}
+
+	if d.pos >= len(d.entries) {
+		return nil, io.EOF
+	}
+
+	end := d.pos + count
+	if end > len(d.entries) {
+		end = len(d.entries)
+	}
+	entries := d.entries[d.pos:end]
+	d.pos = end
+	return entries, nil
+}
+
+func (d *virtualDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *virtualDir) Read(p []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+
+func (d *virtualDir) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		d.pos = 0
+		return 0, nil
+	}
+	return 0, os.ErrInvalid
+}
+
+func (d *virtualDir) Write(p []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+
+func (d *virtualDir) Close() error {
+	return nil
+}
+
+// virtualFileInfo реализует os.FileInfo, а также webdav.ContentTyper и webdav.ETager,
+// чтобы WebDAV не расшифровывал файл ради определения типа и ETag
+type virtualFileInfo struct {
+	name     string
+	size     int64
+	modTime  time.Time
+	isDir    bool
+	mimeType string
+	sha256   string
+}
+
+func newVirtualFileInfo(name string, file *models.File, isDir bool) *virtualFileInfo {
+	info := &virtualFileInfo{name: name, isDir: isDir}
+	if file != nil {
+		info.modTime = file.UpdatedAt
+		if !isDir {
+			info.size = file.Size
+			info.mimeType = file.MimeType
+			info.sha256 = file.SHA256
+		}
+	}
+	return info
+}
+
+func (i *virtualFileInfo) Name() string       { return i.name }
+func (i *virtualFileInfo) Size() int64        { return i.size }
+func (i *virtualFileInfo) ModTime() time.Time { return i.modTime }
+func (i *virtualFileInfo) IsDir() bool        { return i.isDir }
+func (i *virtualFileInfo) Sys() interface{}   { return nil }
+
+func (i *virtualFileInfo) Mode() fs.FileMode {
+	if i.isDir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// SHA256 возвращает хеш содержимого (пустой для папок)
+func (i *virtualFileInfo) SHA256() string { return i.sha256 }
+
+func (i *virtualFileInfo) ContentType(ctx context.Context) (string, error) {
+	if i.mimeType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return i.mimeType, nil
+}
+
+func (i *virtualFileInfo) ETag(ctx context.Context) (string, error) {
+	if i.sha256 == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + i.sha256 + `"`, nil
+}
@@ -1,5 +1,5 @@
 import axios, { AxiosError } from 'axios';
-import type { AxiosResponse } from 'axios';
+import type { AxiosResponse, InternalAxiosRequestConfig } from 'axios';
 
 const API_BASE_URL = import.meta.env.VITE_API_URL || '/api';
 
@@ -11,10 +11,45 @@ export const api = axios.create({
     withCredentials: true, // Important: send cookies with requests
 });
 
+// Access-токен живет недолго: при 401 один раз обновляем его по refresh-cookie
+// и повторяем запрос. Параллельные запросы ждут одного общего обновления.
+let refreshPromise: Promise<void> | null = null;
+
+const refreshSession = (): Promise<void> => {
+    if (!refreshPromise) {
+        refreshPromise = api
+            .post('/auth/refresh')
+            .then(() => undefined)
+            .finally(() => {
+                refreshPromise = null;
+            });
+    }
+    return refreshPromise;
+};
+
+const NO_REFRESH_URLS = ['/auth/login', '/auth/login/2fa', '/auth/register', '/auth/refresh', '/auth/logout'];
+
 // Интерсептор для обработки ошибок
 api.interceptors.response.use(
     (response: AxiosResponse) => response,
-    (error: AxiosError) => {
+    async (error: AxiosError) => {
+        const request = error.config as (InternalAxiosRequestConfig & { _retried?: boolean }) | undefined;
+
+        if (
+            error.response?.status === 401 &&
+            request &&
+            !request._retried &&
+            !NO_REFRESH_URLS.some((url) => request.url?.endsWith(url))
+        ) {
+            request._retried = true;
+            try {
+                await refreshSession();
+                return api(request);
+            } catch {
+                // Сессия истекла или отозвана - дальше обычная обработка 401
+            }
+        }
+
         if (error.response?.status === 401) {
             // Токен истек или невалиден
             sessionStorage.removeItem('user');
@@ -8,7 +8,9 @@ interface LoginProps {
 }
 
 export default function Login({ onAuthSuccess }: LoginProps) {
-    const [isRegister, setIsRegister] = useState(false);
+    // Ссылка-приглашение ведет на /login?invite=<код> и сразу открывает регистрацию
+    const [inviteCode] = useState(() => new URLSearchParams(window.location.search).get('invite') || '');
+    const [isRegister, setIsRegister] = useState(inviteCode !== '');
     const [username, setUsername] = useState('');
     const [email, setEmail] = useState('');
     const [password, setPassword] = useState('');
@@ -55,6 +57,7 @@ export default function Login({ onAuthSuccess }: LoginProps) {
                     email,
                     password,
                     confirm_password: confirmPassword,
+                    ...(inviteCode && { invite_code: inviteCode }),
                 });
 
                 // Cache user info in sessionStorage
@@ -10,6 +10,7 @@ export interface RegisterRequest {
     email: string;
     password: string;
     confirm_password: string;
+    invite_code?: string;
 }
 
 export interface LoginRequest {
@@ -121,7 +121,7 @@ if [ ! -f ".env" ]; then
     echo "ENCRYPTION_KEY=$ENCRYPTION_KEY" >> .env
     echo "STORAGE_LIMIT_BYTES=10737418240" >> .env
     echo "MAX_UPLOAD_SIZE=1073741824" >> .env
-    echo "DISABLE_REGISTRATION=false" >> .env
+    echo "REGISTRATION_MODE=open" >> .env
     
     # Get Public IP for CORS
     PUBLIC_IP=$(curl -s https://api.ipify.org || echo "localhost")
@@ -33,7 +33,7 @@ func main() {
 					Description("Use ↑/↓ and Enter to select.").
 					Options(
 						huh.NewOption("Status & Info", "status"),
-						huh.NewOption("Toggle Registration", "registration"),
+						huh.NewOption("Registration Mode", "registration"),
 						huh.NewOption("Generate New Secrets", "secrets"),
 						huh.NewOption("Edit Quotas", "quotas"),
 						huh.NewOption("Start/Stop Cloud", "toggle_cloud"),
@@ -53,7 +53,7 @@ func main() {
 		case "status":
 			showStatus()
 		case "registration":
-			toggleRegistration()
+			setRegistrationMode()
 		case "secrets":
 			generateSecrets()
 		case "quotas":
@@ -95,7 +95,7 @@ func showStatus() {
 		frontendPort = "3000"
 	}
 	diskLimit := os.Getenv("STORAGE_LIMIT_BYTES")
-	regDisabled := os.Getenv("DISABLE_REGISTRATION")
+	regMode := registrationMode()
 
 	publicIP := "localhost"
 	ipCmd := exec.Command("curl", "-s", "https://api.ipify.org")
@@ -108,22 +108,69 @@ func showStatus() {
 	fmt.Printf("Backend Status: %s\n", status)
 	fmt.Printf("Backend Port: %s\n", backendPort)
 	fmt.Printf("Frontend Port: %s\n", frontendPort)
-	fmt.Printf("Registration Disabled: %s\n", regDisabled)
+	fmt.Printf("Registration Mode: %s\n", regMode)
 	fmt.Printf("Storage Limit: %s bytes\n", diskLimit)
 	fmt.Println("\n=== WEB ACCESS ===")
 	fmt.Printf("Frontend: http://%s:%s\n", publicIP, frontendPort)
 	fmt.Printf("Backend:  http://%s:%s\n", publicIP, backendPort)
 }
 
-func toggleRegistration() {
-	current := os.Getenv("DISABLE_REGISTRATION")
-	newVal := "true"
-	if current == "true" {
-		newVal = "false"
+// registrationSQL выполняет запрос в базе облака и возвращает результат без форматирования
+func registrationSQL(query string) (string, error) {
+	cmd := exec.Command("docker", "exec", "0x40-postgres", "psql", "-U", "postgres", "-d", "0x40_cloud", "-tAc", query)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// registrationMode - режим из настроек сервера, а если его не меняли - из .env
+func registrationMode() string {
+	if mode, err := registrationSQL("SELECT value FROM settings WHERE key = 'registration_mode'"); err == nil && mode != "" {
+		return mode
+	}
+	if mode := os.Getenv("REGISTRATION_MODE"); mode != "" {
+		return mode
+	}
+	if os.Getenv("DISABLE_REGISTRATION") == "true" {
+		return "closed"
+	}
+	return "open"
+}
+
+// setRegistrationMode меняет режим в базе: сервер применяет его сразу, без перезапуска.
+// В .env режим тоже сохраняется - он действует для новой базы.
+func setRegistrationMode() {
+	mode := registrationMode()
+	err := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Registration Mode").
+				Description(fmt.Sprintf("Current: %s", mode)).
+				Options(
+					huh.NewOption("Open - anyone can sign up", "open"),
+					huh.NewOption("Invite only - sign up with an invite code", "invite"),
+					huh.NewOption("Closed - no new accounts", "closed"),
+				).
+				Value(&mode),
+		),
+	).WithTheme(huh.ThemeCatppuccin()).Run()
+	if err != nil {
+		fmt.Println("Cancelled.")
+		return
+	}
+
+	updateEnv("REGISTRATION_MODE", mode)
+	// mode - одно из значений списка выше, подставлять его в запрос безопасно
+	query := fmt.Sprintf("INSERT INTO settings (key, value, updated_at) VALUES ('registration_mode', '%s', NOW()) "+
+		"ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = EXCLUDED.updated_at", mode)
+	if _, err := registrationSQL(query); err != nil {
+		fmt.Printf("Saved to .env, but the database is not reachable (%v).\n", err)
+		fmt.Println("Start the cloud and select the mode again to apply it.")
+		return
 	}
-	updateEnv("DISABLE_REGISTRATION", newVal)
-	fmt.Printf("Registration set to %s. Applying changes...\n", newVal)
-	restartContainer()
+	fmt.Printf("Registration mode set to %s. No restart needed.\n", mode)
 }
 
 func generateSecrets() {